@@ -1,12 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 	"xcp/internal/cli"
 )
 
 func main() {
+	// Cancel in-flight downloads on Ctrl-C or SIGTERM so partial output is cleaned up
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	opts := cli.Options{
 		Args:   os.Args[1:],
 		Stdout: os.Stdout,
@@ -14,7 +22,12 @@ func main() {
 	}
 
 	c := cli.New(opts)
-	if err := c.Run(os.Args[1:]); err != nil {
+	if err := c.RunContext(ctx, os.Args[1:]); err != nil {
+		stop()
+		if errors.Is(err, context.Canceled) {
+			fmt.Fprintln(os.Stderr, "Interrupted")
+			os.Exit(130)
+		}
 		fmt.Fprintln(os.Stderr, "Error:", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,81 @@
+// Package archive parses sources that name an archive by URL, such as a
+// release tarball or a file on an artifact server. Archives are fetched and
+// extracted by the downloaders like a repository's own archives; they have
+// no refs, API or tree to verify against.
+package archive
+
+import (
+	"errors"
+	"strings"
+	"xcp/internal/downloader"
+	"xcp/internal/github"
+)
+
+const (
+	// Scheme names the provider of archive URL sources
+	Scheme = "https"
+	// prefix starts every archive URL source
+	prefix = "https://"
+)
+
+var ErrInvalidURL = errors.New("invalid archive URL format")
+
+// NewHost returns the server at name that archives are downloaded from
+func NewHost(name string) github.Host {
+	return github.Host{Name: name, Web: "https://" + name}
+}
+
+// IsSource reports whether url is an archive URL source: an https:// URL
+// whose path, before any "//subdir", names a zip archive or tarball
+func IsSource(url string) bool {
+	rest, ok := strings.CutPrefix(url, prefix)
+	if !ok {
+		return false
+	}
+	file, _, _ := strings.Cut(rest, "//")
+	return downloader.ArchiveFormat(file) != ""
+}
+
+// ParseArchiveURL parses an archive URL source of the form
+//
+//	https://host/path/to/archive.tar.gz[//subdir]
+//
+// The directory of the archive becomes the owner and its file name the repo;
+// a path inside the archive follows "//". Query strings and fragments are
+// not supported.
+func ParseArchiveURL(url string) (*github.ParsedURL, error) {
+	if !IsSource(url) || strings.ContainsAny(url, "?#") {
+		return nil, ErrInvalidURL
+	}
+	rest := strings.TrimPrefix(url, prefix)
+
+	host, rest, _ := strings.Cut(rest, "/")
+	if host == "" || strings.Contains(host, "@") {
+		return nil, ErrInvalidURL
+	}
+
+	file, path, _ := strings.Cut(rest, "//")
+	owner, repo := "", file
+	if i := strings.LastIndex(file, "/"); i != -1 {
+		owner, repo = file[:i], file[i+1:]
+	}
+	if downloader.ArchiveFormat(repo) == "" {
+		return nil, ErrInvalidURL
+	}
+
+	return &github.ParsedURL{
+		Provider: Scheme,
+		Host:     strings.ToLower(host),
+		Owner:    owner,
+		Repo:     repo,
+		Path:     path,
+	}, nil
+}
+
+// URL returns the location of the archive a parsed source names
+func URL(parsed *github.ParsedURL) string {
+	if parsed.Owner == "" {
+		return prefix + parsed.Host + "/" + parsed.Repo
+	}
+	return prefix + parsed.Host + "/" + parsed.Owner + "/" + parsed.Repo
+}
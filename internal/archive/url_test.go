@@ -0,0 +1,107 @@
+package archive
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseArchiveURL(t *testing.T) {
+	tests := []struct {
+		name          string
+		url           string
+		expectedHost  string
+		expectedOwner string
+		expectedRepo  string
+		expectedPath  string
+		expectedErr   error
+	}{
+		{
+			name:          "Release tarball",
+			url:           "https://Example.com/releases/v1.2.0/templates-1.2.0.tar.gz",
+			expectedHost:  "example.com",
+			expectedOwner: "releases/v1.2.0",
+			expectedRepo:  "templates-1.2.0.tar.gz",
+		},
+		{
+			name:          "Subdir of an xz tarball",
+			url:           "https://artifacts.example.com:8443/pkg.tar.xz//ci/jobs",
+			expectedHost:  "artifacts.example.com:8443",
+			expectedRepo:  "pkg.tar.xz",
+			expectedPath:  "ci/jobs",
+			expectedOwner: "",
+		},
+		{
+			name:          "Zip archive",
+			url:           "https://example.com/dist/site.zip//index.html",
+			expectedHost:  "example.com",
+			expectedOwner: "dist",
+			expectedRepo:  "site.zip",
+			expectedPath:  "index.html",
+		},
+		{
+			name:        "Not an archive",
+			url:         "https://example.com/dist/site",
+			expectedErr: ErrInvalidURL,
+		},
+		{
+			name:        "Query string",
+			url:         "https://example.com/download?file=site.zip",
+			expectedErr: ErrInvalidURL,
+		},
+		{
+			name:        "User info",
+			url:         "https://user@example.com/site.zip",
+			expectedErr: ErrInvalidURL,
+		},
+		{
+			name:        "Plain HTTP",
+			url:         "http://example.com/site.zip",
+			expectedErr: ErrInvalidURL,
+		},
+		{
+			name:        "Missing file",
+			url:         "https://example.com.zip",
+			expectedErr: ErrInvalidURL,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseArchiveURL(tt.url)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if parsed.Provider != Scheme || parsed.Host != tt.expectedHost {
+				t.Errorf("Expected %s@%s, got %s@%s", Scheme, tt.expectedHost, parsed.Provider, parsed.Host)
+			}
+			if parsed.Owner != tt.expectedOwner || parsed.Repo != tt.expectedRepo {
+				t.Errorf("Expected %s/%s, got %s/%s", tt.expectedOwner, tt.expectedRepo, parsed.Owner, parsed.Repo)
+			}
+			if parsed.Path != tt.expectedPath {
+				t.Errorf("Expected path %q, got %q", tt.expectedPath, parsed.Path)
+			}
+		})
+	}
+}
+
+func TestURL(t *testing.T) {
+	for _, url := range []string{
+		"https://example.com/releases/v1/pkg.tar.gz",
+		"https://example.com:8443/pkg.zip",
+	} {
+		parsed, err := ParseArchiveURL(url + "//docs")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got := URL(parsed); got != url {
+			t.Errorf("URL() = %q, expected %q", got, url)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package bitbucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"xcp/internal/github"
+	"xcp/internal/logger"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+	// pageSize is the largest page the src endpoint serves
+	pageSize = 100
+)
+
+var ErrTreeUnavailable = errors.New("Bitbucket does not serve git trees")
+
+// Client is a Bitbucket Cloud REST API client. It offers the same
+// operations as the GitHub client, reporting results in the same types, so
+// downloaders work with either. Owners are workspaces.
+type Client struct {
+	httpClient *http.Client
+	host       github.Host
+
+	mu       sync.Mutex
+	branches map[string]string // Main branch by workspace/repo
+}
+
+// srcEntry is an item of a src directory listing
+type srcEntry struct {
+	Path       string   `json:"path"`
+	Type       string   `json:"type"`
+	Size       int64    `json:"size"`
+	Attributes []string `json:"attributes"`
+}
+
+// srcPage is a page of a src directory listing
+type srcPage struct {
+	Values []srcEntry `json:"values"`
+	Next   string     `json:"next"`
+}
+
+// NewClient creates a client for Bitbucket Cloud as described by host
+func NewClient(host github.Host) (*Client, error) {
+	httpClient, err := host.HTTPClient(defaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{httpClient: httpClient, host: host, branches: make(map[string]string)}, nil
+}
+
+// SetLogger logs every request made by the client at debug level
+func (c *Client) SetLogger(l *logger.Logger) {
+	logger.WrapClient(c.httpClient, l)
+}
+
+// repoURL returns the API URL of the repository workspace/repo
+func (c *Client) repoURL(workspace, repo string) string {
+	return fmt.Sprintf("%s/repositories/%s/%s", c.host.API, url.PathEscape(workspace), url.PathEscape(repo))
+}
+
+// srcURL returns the URL of path in the repository at ref
+func (c *Client) srcURL(workspace, repo, ref, path string) string {
+	escaped := make([]string, 0)
+	for _, part := range strings.Split(strings.Trim(path, "/"), "/") {
+		if part != "" {
+			escaped = append(escaped, url.PathEscape(part))
+		}
+	}
+	return fmt.Sprintf("%s/src/%s/%s", c.repoURL(workspace, repo), url.PathEscape(ref), strings.Join(escaped, "/"))
+}
+
+// ref returns ref, or the repository's main branch when ref is empty. The
+// src endpoint always needs one.
+func (c *Client) ref(ctx context.Context, workspace, repo, ref string) (string, error) {
+	if ref != "" && ref != defaultRef {
+		return ref, nil
+	}
+
+	key := workspace + "/" + repo
+	c.mu.Lock()
+	branch, ok := c.branches[key]
+	c.mu.Unlock()
+	if ok {
+		return branch, nil
+	}
+
+	var info struct {
+		MainBranch struct {
+			Name string `json:"name"`
+		} `json:"mainbranch"`
+	}
+	if _, err := github.APIGetJSON(ctx, c.httpClient, c.repoURL(workspace, repo), github.ErrRepositoryNotFound, &info); err != nil {
+		return "", err
+	}
+	if info.MainBranch.Name == "" {
+		return "", fmt.Errorf("%w: %s has no main branch", github.ErrRefNotFound, key)
+	}
+
+	c.mu.Lock()
+	c.branches[key] = info.MainBranch.Name
+	c.mu.Unlock()
+	return info.MainBranch.Name, nil
+}
+
+// OpenFile opens a streaming reader over the raw content of a file through
+// the src endpoint. An empty ref selects the main branch. The caller must
+// close the returned reader.
+func (c *Client) OpenFile(ctx context.Context, workspace, repo, ref, path string) (io.ReadCloser, github.FileInfo, error) {
+	ref, err := c.ref(ctx, workspace, repo, ref)
+	if err != nil {
+		return nil, github.FileInfo{}, err
+	}
+
+	srcURL := c.srcURL(workspace, repo, ref, path)
+	resp, err := github.APIGet(ctx, c.httpClient, srcURL, github.ErrFileNotFound)
+	if err != nil {
+		return nil, github.FileInfo{}, err
+	}
+
+	// Directories come back as a JSON listing, which a JSON file could be
+	// mistaken for, so ask what the path is
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		var meta srcEntry
+		if _, err := github.APIGetJSON(ctx, c.httpClient, srcURL+"?format=meta", github.ErrFileNotFound, &meta); err != nil {
+			resp.Body.Close()
+			return nil, github.FileInfo{}, err
+		}
+		if meta.Type != "commit_file" {
+			resp.Body.Close()
+			return nil, github.FileInfo{}, github.ErrFileNotFound
+		}
+	}
+
+	return resp.Body, github.RawFileInfo(path, resp), nil
+}
+
+// GetDirectoryContents lists a directory of the repository through the src
+// endpoint, following its pagination. An empty ref selects the main branch.
+func (c *Client) GetDirectoryContents(ctx context.Context, workspace, repo, ref, path string) (github.DirectoryContents, error) {
+	ref, err := c.ref(ctx, workspace, repo, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var contents github.DirectoryContents
+	next := strings.TrimSuffix(c.srcURL(workspace, repo, ref, path), "/") + "/?pagelen=" + fmt.Sprint(pageSize)
+	for next != "" {
+		var page srcPage
+		if _, err := github.APIGetJSON(ctx, c.httpClient, next, github.ErrDirectoryNotFound, &page); err != nil {
+			return nil, err
+		}
+
+		for _, entry := range page.Values {
+			item := github.ContentResponse{Path: entry.Path, Size: int(entry.Size)}
+			item.Name = entry.Path[strings.LastIndex(entry.Path, "/")+1:]
+			switch {
+			case entry.Type == "commit_directory":
+				item.Type = github.DirectoryContent
+			case hasAttribute(entry.Attributes, "link"):
+				item.Type = "symlink"
+			case hasAttribute(entry.Attributes, "subrepository"):
+				item.Type = "submodule"
+			default:
+				item.Type = github.FileContent
+			}
+			contents = append(contents, item)
+		}
+		next = page.Next
+	}
+	return contents, nil
+}
+
+// hasAttribute reports whether attrs holds attr
+func hasAttribute(attrs []string, attr string) bool {
+	for _, a := range attrs {
+		if a == attr {
+			return true
+		}
+	}
+	return false
+}
+
+// GetTree fails: Bitbucket has no endpoint for git trees, so files can be
+// neither checked against blob SHAs nor given their modes through the API
+func (c *Client) GetTree(ctx context.Context, workspace, repo, ref string) (*github.Tree, error) {
+	return nil, ErrTreeUnavailable
+}
+
+// RepositoryExists checks if a repository exists and is visible
+func (c *Client) RepositoryExists(ctx context.Context, workspace, repo string) (bool, error) {
+	resp, err := github.APIGet(ctx, c.httpClient, c.repoURL(workspace, repo), github.ErrRepositoryNotFound)
+	if errors.Is(err, github.ErrRepositoryNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+// ResolveRef finds out whether ref is a branch, tag or commit and which
+// commit it points to. An empty ref resolves the main branch.
+func (c *Client) ResolveRef(ctx context.Context, workspace, repo, ref string) (*github.ResolvedRef, error) {
+	lookup, err := c.ref(ctx, workspace, repo, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lookup) != 40 || !github.IsCommitSHA(lookup) {
+		for _, candidate := range []struct {
+			path string
+			kind github.RefKind
+		}{{"branches", github.RefBranch}, {"tags", github.RefTag}} {
+			var named struct {
+				Target struct {
+					Hash string `json:"hash"`
+				} `json:"target"`
+			}
+			apiURL := fmt.Sprintf("%s/refs/%s/%s", c.repoURL(workspace, repo), candidate.path, url.PathEscape(lookup))
+			_, err := github.APIGetJSON(ctx, c.httpClient, apiURL, github.ErrRefNotFound, &named)
+			if errors.Is(err, github.ErrRefNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			return &github.ResolvedRef{Ref: ref, Kind: candidate.kind, Commit: named.Target.Hash}, nil
+		}
+	}
+
+	var commit struct {
+		Hash string `json:"hash"`
+	}
+	apiURL := fmt.Sprintf("%s/commit/%s", c.repoURL(workspace, repo), url.PathEscape(lookup))
+	if _, err := github.APIGetJSON(ctx, c.httpClient, apiURL, fmt.Errorf("%w: %s", github.ErrRefNotFound, lookup), &commit); err != nil {
+		return nil, err
+	}
+	return &github.ResolvedRef{Ref: ref, Kind: github.RefCommit, Commit: commit.Hash}, nil
+}
+
+// ArchiveURL returns the URL of an archive of workspace/repo at ref in
+// format ("zip" or "tar.gz"). Bitbucket always archives the whole
+// repository, so path is not used.
+func (c *Client) ArchiveURL(workspace, repo, ref, path, format string) string {
+	return fmt.Sprintf("%s/%s/%s/get/%s.%s", c.host.Web, url.PathEscape(workspace), url.PathEscape(repo), url.PathEscape(ref), format)
+}
+
+// ArchivePrefix returns "": Bitbucket names the top-level directory of an
+// archive after the workspace, repository and abbreviated commit
+func (c *Client) ArchivePrefix(repo, ref string) string {
+	return ""
+}
@@ -0,0 +1,200 @@
+package bitbucket
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"xcp/internal/github"
+)
+
+const testCommit = "0123456789abcdef0123456789abcdef01234567"
+
+// newTestServer serves the Bitbucket API endpoints of the repository
+// workspace/repo
+func newTestServer(t *testing.T) (*httptest.Server, *Client) {
+	t.Helper()
+
+	const repo = "/2.0/repositories/workspace/repo"
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		query := r.URL.Query()
+		switch r.URL.Path {
+		case repo:
+			io.WriteString(w, `{"mainbranch":{"name":"main"}}`)
+		case repo + "/src/v1/ci/build.yml":
+			io.WriteString(w, "stages: [build]\n")
+		case repo + "/src/v1/config.json":
+			w.Header().Set("Content-Type", "application/json")
+			if query.Get("format") == "meta" {
+				io.WriteString(w, `{"path":"config.json","type":"commit_file","size":13}`)
+				return
+			}
+			io.WriteString(w, `{"key":"on"}`)
+		case repo + "/src/v1/ci", repo + "/src/v1/ci/":
+			w.Header().Set("Content-Type", "application/json")
+			if query.Get("format") == "meta" {
+				io.WriteString(w, `{"path":"ci","type":"commit_directory"}`)
+				return
+			}
+			io.WriteString(w, `{"values":[]}`)
+		case repo + "/src/main/":
+			if query.Get("page") == "" {
+				io.WriteString(w, `{"values":[{"path":"ci","type":"commit_directory"}],"next":"`+server.URL+repo+`/src/main/?page=2"}`)
+				return
+			}
+			io.WriteString(w, `{"values":[{"path":"ci/run.sh","type":"commit_file","size":10,"attributes":["executable"]},{"path":"ci/current","type":"commit_file","size":4,"attributes":["link"]}]}`)
+		case repo + "/refs/branches/main":
+			io.WriteString(w, `{"target":{"hash":"`+testCommit+`"}}`)
+		case repo + "/refs/tags/v1":
+			io.WriteString(w, `{"target":{"hash":"`+testCommit+`"}}`)
+		case repo + "/commit/0123456":
+			io.WriteString(w, `{"hash":"`+testCommit+`"}`)
+		case "/2.0/repositories/workspace/limited":
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(github.Host{Name: "bitbucket.test", API: server.URL + "/2.0", Web: server.URL, Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, client
+}
+
+func TestClient_OpenFile(t *testing.T) {
+	_, client := newTestServer(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		path    string
+		content string
+		err     error
+	}{
+		{path: "ci/build.yml", content: "stages: [build]\n"},
+		{path: "config.json", content: `{"key":"on"}`},
+		{path: "ci", err: github.ErrFileNotFound},
+		{path: "missing.txt", err: github.ErrFileNotFound},
+	}
+
+	for _, tt := range tests {
+		body, _, err := client.OpenFile(ctx, "workspace", "repo", "v1", tt.path)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%s: expected error %v, got %v", tt.path, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.path, err)
+			continue
+		}
+		content, _ := io.ReadAll(body)
+		body.Close()
+		if string(content) != tt.content {
+			t.Errorf("%s: unexpected content %q", tt.path, content)
+		}
+	}
+}
+
+func TestClient_GetDirectoryContents(t *testing.T) {
+	_, client := newTestServer(t)
+	ctx := context.Background()
+
+	contents, err := client.GetDirectoryContents(ctx, "workspace", "repo", "", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(contents) != 3 {
+		t.Fatalf("Expected both pages of the listing, got %+v", contents)
+	}
+	if contents[0].Type != github.DirectoryContent || contents[0].Name != "ci" {
+		t.Errorf("Unexpected directory %+v", contents[0])
+	}
+	if contents[1].Type != github.FileContent || contents[1].Name != "run.sh" || contents[1].Size != 10 {
+		t.Errorf("Unexpected file %+v", contents[1])
+	}
+	if contents[2].Type != "symlink" {
+		t.Errorf("Expected a symlink, got %+v", contents[2])
+	}
+
+	if _, err := client.GetDirectoryContents(ctx, "workspace", "repo", "main", "missing"); !errors.Is(err, github.ErrDirectoryNotFound) {
+		t.Errorf("Expected ErrDirectoryNotFound, got %v", err)
+	}
+	if _, err := client.GetTree(ctx, "workspace", "repo", "main"); !errors.Is(err, ErrTreeUnavailable) {
+		t.Errorf("Expected ErrTreeUnavailable, got %v", err)
+	}
+}
+
+func TestClient_RepositoryExists(t *testing.T) {
+	_, client := newTestServer(t)
+	ctx := context.Background()
+
+	if exists, err := client.RepositoryExists(ctx, "workspace", "repo"); err != nil || !exists {
+		t.Errorf("Expected repository to exist, got %v, %v", exists, err)
+	}
+	if exists, err := client.RepositoryExists(ctx, "workspace", "other"); err != nil || exists {
+		t.Errorf("Expected repository not to exist, got %v, %v", exists, err)
+	}
+	if _, err := client.RepositoryExists(ctx, "workspace", "limited"); !errors.Is(err, github.ErrRateLimitExceeded) {
+		t.Errorf("Expected ErrRateLimitExceeded, got %v", err)
+	}
+}
+
+func TestClient_ResolveRef(t *testing.T) {
+	_, client := newTestServer(t)
+
+	tests := []struct {
+		ref  string
+		kind github.RefKind
+		err  error
+	}{
+		{ref: "", kind: github.RefBranch},
+		{ref: "HEAD", kind: github.RefBranch},
+		{ref: "main", kind: github.RefBranch},
+		{ref: "v1", kind: github.RefTag},
+		{ref: "0123456", kind: github.RefCommit},
+		{ref: "gone", err: github.ErrRefNotFound},
+	}
+
+	for _, tt := range tests {
+		resolved, err := client.ResolveRef(context.Background(), "workspace", "repo", tt.ref)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%q: expected error %v, got %v", tt.ref, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.ref, err)
+			continue
+		}
+		if resolved.Kind != tt.kind || resolved.Commit != testCommit || resolved.Ref != tt.ref {
+			t.Errorf("%q: unexpected resolution %+v", tt.ref, resolved)
+		}
+	}
+}
+
+func TestClient_ArchiveURL(t *testing.T) {
+	client, err := NewClient(NewHost())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := client.ArchiveURL("workspace", "repo", "v1", "ci/", "tar.gz"); got != "https://bitbucket.org/workspace/repo/get/v1.tar.gz" {
+		t.Errorf("Unexpected archive URL %s", got)
+	}
+	if client.ArchivePrefix("repo", "v1") != "" {
+		t.Errorf("Expected the archive prefix to be detected")
+	}
+}
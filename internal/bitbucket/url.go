@@ -0,0 +1,62 @@
+// Package bitbucket reads repositories on Bitbucket Cloud. Sources are
+// parsed into github.ParsedURL with the Bitbucket provider, so they flow
+// through the same downloaders as GitHub sources.
+package bitbucket
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"xcp/internal/github"
+)
+
+const (
+	// Scheme prefixes Bitbucket sources and names the provider
+	Scheme = "bitbucket"
+	// PublicHost is the name of Bitbucket Cloud
+	PublicHost = "bitbucket.org"
+	// defaultRef stands for the repository's main branch
+	defaultRef = "HEAD"
+)
+
+var ErrInvalidURL = errors.New("invalid Bitbucket URL format")
+
+// NewHost returns the URLs of Bitbucket Cloud, whose API lives on its own host
+func NewHost() github.Host {
+	return github.Host{
+		Name: PublicHost,
+		API:  "https://api.bitbucket.org/2.0",
+		Web:  "https://bitbucket.org",
+	}
+}
+
+// IsSource reports whether url is a Bitbucket source
+func IsSource(url string) bool {
+	return strings.HasPrefix(url, Scheme+":")
+}
+
+// ParseBitbucketURL parses a Bitbucket source. Supported formats mirror
+// GitHub's:
+//   - bitbucket:workspace/repo
+//   - bitbucket:workspace/repo@ref
+//   - bitbucket:workspace/repo/path/to/file
+//   - bitbucket:workspace/repo@ref/path/to/file
+func ParseBitbucketURL(url string) (*github.ParsedURL, error) {
+	rest, ok := strings.CutPrefix(url, Scheme+":")
+	if !ok {
+		return nil, ErrInvalidURL
+	}
+
+	// Workspaces and repositories are single path segments, exactly like
+	// GitHub owners and repositories, so GitHub's parser applies
+	parsed, err := github.ParseGitHubURLWithRef("github:" + rest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidURL, err)
+	}
+
+	parsed.Provider = Scheme
+	if !parsed.ExplicitRef {
+		parsed.Ref = defaultRef
+	}
+	return parsed, nil
+}
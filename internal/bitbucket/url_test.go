@@ -0,0 +1,82 @@
+package bitbucket
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseBitbucketURL(t *testing.T) {
+	tests := []struct {
+		name          string
+		url           string
+		expectedOwner string
+		expectedRepo  string
+		expectedPath  string
+		expectedRef   string
+		explicitRef   bool
+		expectedErr   error
+	}{
+		{
+			name:          "Repository",
+			url:           "bitbucket:workspace/repo",
+			expectedOwner: "workspace",
+			expectedRepo:  "repo",
+			expectedRef:   "HEAD",
+		},
+		{
+			name:          "Ref and path",
+			url:           "bitbucket:workspace/repo@v1.2/ci/build.yml",
+			expectedOwner: "workspace",
+			expectedRepo:  "repo",
+			expectedPath:  "ci/build.yml",
+			expectedRef:   "v1.2",
+			explicitRef:   true,
+		},
+		{
+			name:          "Path without ref",
+			url:           "bitbucket:workspace/repo/docs/",
+			expectedOwner: "workspace",
+			expectedRepo:  "repo",
+			expectedPath:  "docs/",
+			expectedRef:   "HEAD",
+		},
+		{
+			name:        "Missing repository",
+			url:         "bitbucket:workspace",
+			expectedErr: ErrInvalidURL,
+		},
+		{
+			name:        "Wrong scheme",
+			url:         "github:owner/repo",
+			expectedErr: ErrInvalidURL,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseBitbucketURL(tt.url)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if parsed.Provider != Scheme || parsed.Host != "" {
+				t.Errorf("Expected provider %s on the public host, got %s@%s", Scheme, parsed.Provider, parsed.Host)
+			}
+			if parsed.Owner != tt.expectedOwner || parsed.Repo != tt.expectedRepo {
+				t.Errorf("Expected %s/%s, got %s/%s", tt.expectedOwner, tt.expectedRepo, parsed.Owner, parsed.Repo)
+			}
+			if parsed.Path != tt.expectedPath {
+				t.Errorf("Expected path %q, got %q", tt.expectedPath, parsed.Path)
+			}
+			if parsed.Ref != tt.expectedRef || parsed.ExplicitRef != tt.explicitRef {
+				t.Errorf("Expected ref %s (explicit %v), got %s (%v)", tt.expectedRef, tt.explicitRef, parsed.Ref, parsed.ExplicitRef)
+			}
+		})
+	}
+}
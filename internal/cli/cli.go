@@ -1,28 +1,77 @@
 package cli
 
 import (
+	"context"
+	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
+	"xcp/internal/archive"
+	"xcp/internal/bitbucket"
+	"xcp/internal/config"
+	"xcp/internal/diff"
 	"xcp/internal/downloader"
+	"xcp/internal/gist"
+	"xcp/internal/git"
+	"xcp/internal/gitea"
 	"xcp/internal/github"
+	"xcp/internal/gitlab"
+	"xcp/internal/local"
+	"xcp/internal/logger"
+	"xcp/internal/manifest"
+	"xcp/internal/progress"
+	"xcp/internal/report"
 )
 
 const (
 	version = "2.0.0"
 )
 
+// Download methods accepted by --method
+const (
+	methodAuto = "auto"
+	methodZip  = "zip"
+	methodAPI  = "api"
+	methodRaw  = "raw"
+	methodTar  = "tar"
+)
+
+// methodRelease is reported for release asset downloads, which take no --method
+const methodRelease = "release"
+
 var (
 	ErrMissingSource = errors.New("source parameter is required")
 	ErrInvalidArgs   = errors.New("invalid command-line arguments")
+	ErrStdoutInUse   = errors.New("cannot write file content to stdout together with --output json/ndjson")
+	ErrUnpinnedRef   = errors.New("source is not pinned to an immutable ref")
+	ErrSHAMismatch   = errors.New("resolved commit does not match --expect-sha")
 )
 
 // Downloader interface for downloading content
 type Downloader interface {
-	Download(source *github.GitHubSource, destPath string, opts downloader.DownloadOptions) error
+	Download(ctx context.Context, source *github.GitHubSource, destPath string, opts downloader.DownloadOptions) error
+}
+
+// ArchiveDownloader interface for downloading repositories as archives
+type ArchiveDownloader interface {
+	Download(ctx context.Context, req downloader.DownloadRequest) error
+}
+
+// RefResolver resolves refs to the commits they point to
+type RefResolver interface {
+	ResolveRef(ctx context.Context, owner, repo, ref string) (*github.ResolvedRef, error)
+}
+
+// apiClient is the API of the service a source lives on
+type apiClient interface {
+	downloader.GitHubClient
+	RefResolver
+	SetLogger(l *logger.Logger)
 }
 
 // CLI represents the command-line interface
@@ -31,6 +80,12 @@ type CLI struct {
 	stdout     io.Writer
 	stderr     io.Writer
 	downloader Downloader
+	archiver   ArchiveDownloader
+	raw        Downloader
+	tar        ArchiveDownloader
+	release    Downloader
+	resolver   RefResolver
+	config     *config.Config
 
 	// Command-line flags
 	showVersion bool
@@ -39,14 +94,36 @@ type CLI struct {
 	method      string
 	tempDir     string
 	verbose     bool
+	quiet       bool
+	debug       bool
+	output      string
+	symlinks    string
+	preserve    bool
+	mode        string
+	maxSize     string
+	maxFiles    int
+	verify      bool
+	pinned      bool
+	expectSHA   string
+	configPath  string
+	strip       int
+	sha256      string
+	checksums   string
+	extract     bool
 }
 
 // Options for configuring the CLI
 type Options struct {
-	Args       []string
-	Stdout     io.Writer
-	Stderr     io.Writer
-	Downloader Downloader
+	Args              []string
+	Stdout            io.Writer
+	Stderr            io.Writer
+	Downloader        Downloader
+	ArchiveDownloader ArchiveDownloader
+	RawDownloader     Downloader
+	TarDownloader     ArchiveDownloader
+	ReleaseDownloader Downloader
+	Resolver          RefResolver
+	Config            *config.Config // Read from the config file when nil
 }
 
 // New creates a new CLI instance
@@ -63,6 +140,12 @@ func New(opts Options) *CLI {
 		stdout:     opts.Stdout,
 		stderr:     opts.Stderr,
 		downloader: opts.Downloader,
+		archiver:   opts.ArchiveDownloader,
+		raw:        opts.RawDownloader,
+		tar:        opts.TarDownloader,
+		release:    opts.ReleaseDownloader,
+		resolver:   opts.Resolver,
+		config:     opts.Config,
 	}
 
 	cli.flagSet.SetOutput(opts.Stderr)
@@ -72,19 +155,50 @@ func New(opts Options) *CLI {
 	cli.flagSet.BoolVar(&cli.showHelp, "h", false, "Show help information (shorthand)")
 	cli.flagSet.BoolVar(&cli.overwrite, "overwrite", false, "Overwrite existing files")
 	cli.flagSet.BoolVar(&cli.overwrite, "f", false, "Overwrite existing files (shorthand)")
-	cli.flagSet.StringVar(&cli.method, "method", "zip", "Download method: zip (default) or api")
+	cli.flagSet.StringVar(&cli.method, "method", methodAuto, "Download method: auto, zip, tar, api or raw")
 	cli.flagSet.StringVar(&cli.tempDir, "temp-dir", "", "Custom temporary directory for zip extraction")
 	cli.flagSet.BoolVar(&cli.verbose, "verbose", false, "Enable verbose output")
+	cli.flagSet.BoolVar(&cli.quiet, "quiet", false, "Suppress all output except errors")
+	cli.flagSet.BoolVar(&cli.quiet, "q", false, "Suppress all output except errors (shorthand)")
+	cli.flagSet.BoolVar(&cli.debug, "debug", false, "Log HTTP requests, status codes and timing")
+	cli.flagSet.StringVar(&cli.output, "output", "text", "Result format on stdout: text, json or ndjson")
+	cli.flagSet.StringVar(&cli.symlinks, "symlinks", string(downloader.SymlinksPreserve), "Symlinks in archives: preserve, follow or skip")
+	cli.flagSet.BoolVar(&cli.preserve, "preserve-mode", false, "Keep file permissions exactly as recorded in the source")
+	cli.flagSet.StringVar(&cli.mode, "mode", "", "Octal permissions for every file written, e.g. 0644")
+	cli.flagSet.StringVar(&cli.maxSize, "max-size", "8G", "Largest total size an archive may extract to, 0 for no limit")
+	cli.flagSet.IntVar(&cli.maxFiles, "max-files", downloader.DefaultLimits().MaxFiles, "Most files, links and directories an archive may extract, 0 for no limit")
+	cli.flagSet.BoolVar(&cli.verify, "verify", false, "Check files against the repository tree and record a manifest for 'xcp verify'")
+	cli.flagSet.BoolVar(&cli.pinned, "require-pinned", false, "Only copy from tags or commits, never branches; tags are pinned to their commit")
+	cli.flagSet.StringVar(&cli.expectSHA, "expect-sha", "", "Fail unless the source resolves to this commit SHA")
+	cli.flagSet.IntVar(&cli.strip, "strip-components", 0, "Leading path components to drop from archive entries instead of a single top-level directory")
+	cli.flagSet.StringVar(&cli.sha256, "sha256", "", "Fail unless the archive has this SHA-256 digest, checked before extraction")
+	cli.flagSet.StringVar(&cli.checksums, "checksums", "", "Release asset listing SHA-256 digests that downloaded assets must match, e.g. checksums.txt")
+	cli.flagSet.BoolVar(&cli.extract, "extract", false, "Extract release assets that are archives into the target directory")
+	cli.flagSet.StringVar(&cli.configPath, "config", "", "Config file with host tokens, CA bundles and aliases (default $XCP_CONFIG or ~/.config/xcp/config.json)")
 
 	return cli
 }
 
 // Run executes the CLI with the provided arguments
 func (c *CLI) Run(args []string) error {
+	return c.RunContext(context.Background(), args)
+}
+
+// RunContext executes the CLI with the provided arguments, aborting any
+// download in progress when ctx is cancelled
+func (c *CLI) RunContext(ctx context.Context, args []string) error {
 	if err := c.flagSet.Parse(args); err != nil {
 		return err
 	}
 
+	// diff takes the same options after its name
+	diffing := c.flagSet.Arg(0) == "diff"
+	if diffing {
+		if err := c.flagSet.Parse(c.flagSet.Args()[1:]); err != nil {
+			return err
+		}
+	}
+
 	if c.showVersion {
 		fmt.Fprintf(c.stdout, "xcp version %s\n", version)
 		return nil
@@ -95,6 +209,42 @@ func (c *CLI) Run(args []string) error {
 		return nil
 	}
 
+	switch c.method {
+	case methodAuto, methodZip, methodTar, methodAPI, methodRaw:
+	default:
+		return fmt.Errorf("%w: unknown method %q (want auto, zip, tar, api or raw)", ErrInvalidArgs, c.method)
+	}
+
+	format, err := report.ParseFormat(c.output)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArgs, err)
+	}
+
+	if _, err := downloader.ParseSymlinkMode(c.symlinks); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArgs, err)
+	}
+
+	modes, err := c.modePolicy()
+	if err != nil {
+		return err
+	}
+
+	limits, err := c.limits()
+	if err != nil {
+		return err
+	}
+
+	if c.expectSHA != "" && !github.IsCommitSHA(c.expectSHA) {
+		return fmt.Errorf("%w: --expect-sha %q is not a commit SHA", ErrInvalidArgs, c.expectSHA)
+	}
+
+	if c.strip < 0 {
+		return fmt.Errorf("%w: --strip-components must not be negative", ErrInvalidArgs)
+	}
+	if _, err := hex.DecodeString(c.sha256); c.sha256 != "" && (err != nil || len(c.sha256) != 64) {
+		return fmt.Errorf("%w: --sha256 %q is not a SHA-256 digest", ErrInvalidArgs, c.sha256)
+	}
+
 	// Get non-flag arguments
 	args = c.flagSet.Args()
 	if len(args) == 0 {
@@ -102,19 +252,72 @@ func (c *CLI) Run(args []string) error {
 		return ErrMissingSource
 	}
 
-	// First argument is always the source
-	sourceURL := args[0]
+	if !diffing && args[0] == "verify" {
+		return c.runVerify(args[1:])
+	}
 
-	// Parse GitHub URL
-	source, err := github.ParseGitHubURL(sourceURL)
-	if err != nil {
-		return fmt.Errorf("invalid source URL: %w", err)
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+
+	if diffing {
+		if format != report.Text {
+			return fmt.Errorf("%w: diff writes text only", ErrInvalidArgs)
+		}
+		return c.runDiff(ctx, args, modes, limits)
+	}
+
+	if format == report.Text {
+		return c.download(ctx, args, modes, limits, nil)
+	}
+
+	// Describe the outcome, including any failure, as a JSON document
+	collector := report.NewCollector(c.stdout, format)
+	err = c.download(ctx, args, modes, limits, collector)
+	if finishErr := collector.Finish(err, errorCode(err)); finishErr != nil && err == nil {
+		err = finishErr
 	}
+	return err
+}
+
+// job holds everything needed to run a single download
+type job struct {
+	sourceURL string
+	source    *github.GitHubSource
+	parsed    *github.ParsedURL
+	host      github.Host
+	target    string
+	opts      downloader.DownloadOptions
+	limits    downloader.Limits
+	log       *logger.Logger
+	rec       report.Recorder
+	collector *report.Collector
+}
 
-	// Also parse with enhanced parser for zip downloader
-	parsedURL, err := github.ParseGitHubURLWithRef(sourceURL)
+// download resolves the source and target from args and runs the selected
+// downloader. When collector is non-nil it is told about everything written.
+func (c *CLI) download(ctx context.Context, args []string, modes downloader.ModePolicy, limits downloader.Limits, collector *report.Collector) error {
+	// First argument is always the source, which may name its host by alias
+	sourceURL := args[0]
+	parsedURL, err := c.parseSource(sourceURL)
 	if err != nil {
-		return fmt.Errorf("invalid source URL: %w", err)
+		return err
+	}
+	source := parsedURL.Source()
+	if (c.strip > 0 || c.sha256 != "") && !isArchive(parsedURL) {
+		return fmt.Errorf("%w: --strip-components and --sha256 only apply to archive URLs and local archives", ErrInvalidArgs)
+	}
+	if (c.checksums != "" || c.extract) && parsedURL.Asset == "" {
+		return fmt.Errorf("%w: --checksums and --extract only apply to release assets", ErrInvalidArgs)
+	}
+	if parsedURL.Asset != "" && parsedURL.Provider != "" {
+		return fmt.Errorf("%w: release assets are only supported for GitHub sources", ErrInvalidArgs)
+	}
+	if parsedURL.Asset != "" && (c.pinned || c.expectSHA != "") {
+		return fmt.Errorf("%w: release assets are not commits; check them with --checksums", ErrInvalidArgs)
+	}
+	if _, _, ok := parsedURL.CompareRefs(); ok {
+		return fmt.Errorf("%w: compare ranges name two refs; show their changes with 'xcp diff'", ErrInvalidArgs)
 	}
 
 	// Determine target path
@@ -142,41 +345,822 @@ func (c *CLI) Run(args []string) error {
 		}
 	}
 
-	// Set download options
-	opts := downloader.DownloadOptions{
-		OutputToStdout: outputToStdout,
-		Overwrite:      c.overwrite,
+	j := c.newJob(sourceURL, parsedURL, targetPath, outputToStdout, modes, limits)
+	if collector != nil {
+		if outputToStdout {
+			return ErrStdoutInUse
+		}
+		collector.Begin(sourceURL, parsedURL.Ref, c.method, targetPath)
+		j.rec = collector
+		j.collector = collector
+	}
+
+	// Verified downloads record what they wrote so it can be checked later
+	if c.verify && !outputToStdout && j.collector == nil {
+		j.collector = report.NewCollector(io.Discard, report.JSON)
+		j.collector.Begin(sourceURL, parsedURL.Ref, c.method, targetPath)
+		j.rec = j.collector
+	}
+
+	if err := c.fetch(ctx, j); err != nil {
+		return err
+	}
+
+	if c.verify && !outputToStdout {
+		return c.writeManifest(j)
+	}
+	return nil
+}
+
+// newJob describes the download of the source parsed from sourceURL to
+// targetPath, or to stdout
+func (c *CLI) newJob(sourceURL string, parsedURL *github.ParsedURL, targetPath string, outputToStdout bool, modes downloader.ModePolicy, limits downloader.Limits) *job {
+	return &job{
+		sourceURL: sourceURL,
+		source:    parsedURL.Source(),
+		parsed:    parsedURL,
+		host:      c.config.Host(parsedURL.Provider, parsedURL.Host),
+		target:    targetPath,
+		opts: downloader.DownloadOptions{
+			OutputToStdout: outputToStdout,
+			Overwrite:      c.overwrite,
+			Mode:           modes,
+			// Local and archive URL sources have no repository tree to
+			// check files against
+			Verify: c.verify && parsedURL.Provider != local.Scheme && parsedURL.Provider != archive.Scheme,
+		},
+		limits: limits,
+		log:    logger.New(c.stderr, c.logLevel()),
+		rec:    report.Nop{},
+	}
+}
+
+// fetch pins the job to a commit when asked to, or when its ref names a
+// pull request that may move, and runs it
+func (c *CLI) fetch(ctx context.Context, j *job) error {
+	if c.pinned || c.expectSHA != "" || isPullRef(j.parsed) {
+		if err := c.pin(ctx, j); err != nil {
+			return err
+		}
+	}
+	return c.run(ctx, j)
+}
+
+// parseSource expands the host alias sourceURL may start with and parses it
+func (c *CLI) parseSource(sourceURL string) (*github.ParsedURL, error) {
+	parsedURL, err := parseSource(c.config.Expand(sourceURL))
+	if err != nil {
+		return nil, fmt.Errorf("invalid source URL: %w", err)
+	}
+	return parsedURL, nil
+}
+
+// parseSource parses a source URL with the parser of the provider its
+// scheme names
+func parseSource(url string) (*github.ParsedURL, error) {
+	switch {
+	case gitlab.IsSource(url):
+		return gitlab.ParseGitLabURL(url)
+	case bitbucket.IsSource(url):
+		return bitbucket.ParseBitbucketURL(url)
+	case gitea.IsSource(url):
+		return gitea.ParseGiteaURL(url)
+	case git.IsSource(url):
+		return git.ParseGitURL(url)
+	case local.IsSource(url):
+		return local.ParseLocalPath(url)
+	case archive.IsSource(url):
+		return archive.ParseArchiveURL(url)
+	case gist.IsSource(url):
+		return gist.ParseGistURL(url)
+	}
+	return github.ParseGitHubURLWithRef(url)
+}
+
+// isArchive reports whether a source names an archive file, by URL or path
+func isArchive(parsed *github.ParsedURL) bool {
+	switch parsed.Provider {
+	case archive.Scheme:
+		return true
+	case local.Scheme:
+		return downloader.ArchiveFormat(parsed.Repo) != ""
+	}
+	return false
+}
+
+// isPullRef reports whether a GitHub source names a pull request, whose
+// head can only be downloaded by its commit
+func isPullRef(parsed *github.ParsedURL) bool {
+	return parsed.Provider == "" && github.IsPullRef(parsed.Ref)
+}
+
+// pin resolves the source ref, enforces --require-pinned and --expect-sha,
+// and points the job at the resolved commit so it cannot move mid-download
+func (c *CLI) pin(ctx context.Context, j *job) error {
+	resolver := c.resolver
+	if resolver == nil {
+		client, err := c.client(j)
+		if err != nil {
+			return err
+		}
+		resolver = client
+	}
+
+	resolved, err := resolver.ResolveRef(ctx, j.source.Owner, j.source.Repo, j.source.Ref)
+	if err != nil {
+		return fmt.Errorf("failed to resolve ref: %w", err)
+	}
+	j.log.Verbosef("Resolved %s (%s) to %s", j.parsed.Ref, resolved.Kind, resolved.Commit)
+
+	if c.pinned && (resolved.Kind == github.RefBranch || resolved.Kind == github.RefPull) {
+		return fmt.Errorf("%w: %s is a %s; use a tag or commit", ErrUnpinnedRef, j.parsed.Ref, resolved.Kind)
+	}
+	if c.expectSHA != "" && !strings.HasPrefix(resolved.Commit, strings.ToLower(c.expectSHA)) {
+		return fmt.Errorf("%w: %s resolved to %s, expected %s", ErrSHAMismatch, j.parsed.Ref, resolved.Commit, c.expectSHA)
+	}
+
+	// Keep reporting the ref that was asked for next to the commit
+	j.rec.Resolved(j.parsed.Ref, resolved.Commit)
+	j.rec = pinnedRecorder{Recorder: j.rec, ref: j.parsed.Ref}
+
+	j.parsed.Pin(resolved.Commit)
+	j.source.Ref = resolved.Commit
+	return nil
+}
+
+// pinnedRecorder reports the ref that was asked for although the download
+// runs against the commit it resolved to
+type pinnedRecorder struct {
+	report.Recorder
+	ref string
+}
+
+func (p pinnedRecorder) Resolved(_, commit string) {
+	p.Recorder.Resolved(p.ref, commit)
+}
+
+// run hands the job to the downloader for the selected method
+func (c *CLI) run(ctx context.Context, j *job) error {
+	// A custom downloader without the other downloaders handles everything (for tests)
+	if c.downloader != nil && c.archiver == nil && c.raw == nil && c.tar == nil && c.release == nil {
+		return c.downloader.Download(ctx, j.source, j.target, j.opts)
+	}
+
+	if j.parsed.Asset != "" {
+		return c.runRelease(ctx, j)
+	}
+
+	// Git remotes and gists serve no archives; everything comes through
+	// the protocol or API
+	if j.parsed.Provider == git.Scheme || j.parsed.Provider == gist.Scheme {
+		if c.method == methodZip || c.method == methodTar {
+			return fmt.Errorf("%w: %s sources have no archives; use --method=api", ErrInvalidArgs, j.parsed.Provider)
+		}
+		j.log.Verbosef("Using api method for %s", j.sourceURL)
+		return c.runAPI(ctx, j)
+	}
+
+	if j.parsed.Provider == local.Scheme {
+		return c.runLocal(ctx, j)
+	}
+	if j.parsed.Provider == archive.Scheme {
+		return c.runArchive(ctx, j, downloader.ArchiveFormat(j.parsed.Repo))
+	}
+
+	switch c.method {
+	case methodZip:
+		j.log.Verbosef("Using zip method for %s", j.parsed)
+		return c.runZip(ctx, j, j.target)
+	case methodTar:
+		j.log.Verbosef("Using tar method for %s", j.parsed)
+		return c.runTar(ctx, j, j.target)
+	case methodAPI:
+		j.log.Verbosef("Using api method for %s", j.parsed)
+		return c.runAPI(ctx, j)
+	case methodRaw:
+		// Other services serve raw files through their APIs
+		if j.parsed.Provider != "" {
+			j.log.Verbosef("Using api method for %s: %s serves raw files through its API", j.parsed, j.parsed.Provider)
+			return c.runAPI(ctx, j)
+		}
+		j.log.Verbosef("Using raw method for %s", j.parsed)
+		return c.runRaw(ctx, j)
+	default:
+		return c.runAuto(ctx, j)
+	}
+}
+
+// writeManifest records the files a verified download wrote into its target
+// directory. Single files have nowhere to keep one.
+func (c *CLI) writeManifest(j *job) error {
+	if info, err := os.Stat(j.target); err != nil || !info.IsDir() {
+		j.log.Verbosef("Not recording a manifest for single file %s", j.target)
+		return nil
+	}
+
+	m, err := manifest.FromResult(j.target, j.collector.Result())
+	if err != nil {
+		return fmt.Errorf("failed to build manifest: %w", err)
+	}
+	if err := manifest.Write(j.target, m); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	j.log.Verbosef("Recorded %d files in %s", len(m.Files), filepath.Join(j.target, manifest.Name))
+	return nil
+}
+
+// runVerify checks a target directory against the manifest recorded by an
+// earlier download with --verify
+func (c *CLI) runVerify(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("%w: verify takes a single target directory", ErrInvalidArgs)
+	}
+	target := args[0]
+	log := logger.New(c.stderr, c.logLevel())
+
+	m, err := manifest.Read(target)
+	if err != nil {
+		return err
+	}
+
+	problems, err := manifest.Verify(target, m)
+	if err != nil {
+		return fmt.Errorf("failed to verify %s: %w", target, err)
+	}
+
+	for _, p := range problems {
+		fmt.Fprintf(c.stdout, "%s: %s\n", p.Reason, p.Path)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %d of %d files differ", manifest.ErrMismatch, len(problems), len(m.Files))
+	}
+
+	log.Infof("Verified %d files from %s", len(m.Files), m.Source)
+	return nil
+}
+
+// runDiff downloads both sides of the compare range a source names and
+// writes the changes between them to stdout as unified diffs
+func (c *CLI) runDiff(ctx context.Context, args []string, modes downloader.ModePolicy, limits downloader.Limits) error {
+	if len(args) != 1 {
+		return fmt.Errorf("%w: diff takes a single source with a base..head range", ErrInvalidArgs)
+	}
+	sourceURL := args[0]
+
+	parsedURL, err := c.parseSource(sourceURL)
+	if err != nil {
+		return err
+	}
+	baseRef, headRef, ok := parsedURL.CompareRefs()
+	if !ok {
+		return fmt.Errorf("%w: diff needs a base..head range, e.g. github:owner/repo@v1.0.0..main", ErrInvalidArgs)
+	}
+	if parsedURL.Asset != "" || isArchive(parsedURL) {
+		return fmt.Errorf("%w: diff compares repository refs, not release assets or archives", ErrInvalidArgs)
+	}
+
+	tempDir, err := os.MkdirTemp(c.tempDir, "xcp-diff-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// The downloads are only a means to the diff, so they are logged when
+	// asked for
+	level := logger.Quiet
+	if c.verbose || c.debug {
+		level = c.logLevel()
+	}
+	log := logger.New(c.stderr, level)
+
+	sides := []struct{ name, ref string }{{"base", baseRef}, {"head", headRef}}
+	for _, side := range sides {
+		sideURL := *parsedURL
+		sideURL.Ref = side.ref
+		sideURL.ExplicitRef = true
+
+		target := filepath.Join(tempDir, side.name)
+		if sideURL.IsFile() {
+			target = filepath.Join(target, path.Base(sideURL.Path))
+		}
+
+		j := c.newJob(sourceURL, &sideURL, target, false, modes, limits)
+		j.log = log
+		err := c.fetch(ctx, j)
+		// A path missing on one side was added or deleted by the other
+		if errors.Is(err, github.ErrFileNotFound) || errors.Is(err, github.ErrDirectoryNotFound) ||
+			errors.Is(err, downloader.ErrPathNotFoundInZip) {
+			log.Verbosef("%s is not in %s (%v)", parsedURL.Path, side.ref, err)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to download %s: %w", side.ref, err)
+		}
+	}
+
+	base, head := filepath.Join(tempDir, "base"), filepath.Join(tempDir, "head")
+	changes, err := diff.Compare(base, head)
+	if err != nil {
+		return fmt.Errorf("failed to compare %s and %s: %w", baseRef, headRef, err)
+	}
+
+	// Label files by their path in the repository
+	prefix := parsedURL.Path
+	if parsedURL.IsFile() {
+		prefix = path.Dir(prefix)
+	}
+	for _, change := range changes {
+		if err := diff.Write(c.stdout, base, head, prefix, change); err != nil {
+			return fmt.Errorf("failed to diff %s: %w", change.Path, err)
+		}
+	}
+
+	logger.New(c.stderr, c.logLevel()).Infof("%d files changed between %s and %s", len(changes), baseRef, headRef)
+	return nil
+}
+
+// runAuto picks the cheapest method for the source and falls back to the
+// other one when the first fails in a way the other can recover from
+func (c *CLI) runAuto(ctx context.Context, j *job) error {
+	// Only GitHub hosts have a raw content server; other services serve
+	// single files through their APIs
+	if j.parsed.Provider != "" && (j.opts.OutputToStdout || j.source.IsFile) {
+		j.log.Verbosef("Using api method for %s: single file", j.parsed)
+		return c.runAPI(ctx, j)
+	}
+
+	if j.opts.OutputToStdout || j.source.IsFile {
+		j.log.Verbosef("Using raw method for %s: single file", j.parsed)
+		err := c.runRaw(ctx, j)
+		if err == nil || !(errors.Is(err, github.ErrFileNotFound) || errors.Is(err, github.ErrRateLimitExceeded)) {
+			return err
+		}
+
+		// The path may be a directory after all, which the API can list
+		j.log.Infof("Raw download failed (%v); falling back to API method", err)
+		err = c.runAPI(ctx, j)
+		if err == nil || j.opts.OutputToStdout || !errors.Is(err, github.ErrRateLimitExceeded) {
+			return err
+		}
+
+		// The archive holds the file under its own name, so it can only
+		// stand in when the target keeps that name
+		if filepath.Base(j.target) != filepath.Base(j.source.Path) {
+			return err
+		}
+		j.log.Infof("API download failed (%v); falling back to zip method", err)
+		return c.runZip(ctx, j, filepath.Dir(j.target))
+	}
+
+	j.log.Verbosef("Using zip method for %s: directory", j.parsed)
+	err := c.runZip(ctx, j, j.target)
+	if errors.Is(err, downloader.ErrArchiveNotFound) || errors.Is(err, downloader.ErrArchivePrefixMismatch) {
+		j.log.Infof("Zip download failed (%v); falling back to API method", err)
+		return c.runAPI(ctx, j)
+	}
+	return err
+}
+
+// runLocal copies a local source: archives are extracted by their format,
+// directories are copied file by file
+func (c *CLI) runLocal(ctx context.Context, j *job) error {
+	format := downloader.ArchiveFormat(j.parsed.Repo)
+	if format == "" {
+		if c.method == methodZip || c.method == methodTar {
+			return fmt.Errorf("%w: local directories are not archives; use --method=api", ErrInvalidArgs)
+		}
+		j.log.Verbosef("Copying local directory %s", j.sourceURL)
+		return c.runAPI(ctx, j)
+	}
+	return c.runArchive(ctx, j, format)
+}
+
+// runArchive extracts the archive file a local or archive URL source names,
+// in format, with the method that reads it
+func (c *CLI) runArchive(ctx context.Context, j *job, format string) error {
+	method := methodTar
+	if format == downloader.FormatZip {
+		method = methodZip
+	}
+	if c.method != methodAuto && c.method != method {
+		return fmt.Errorf("%w: %s is read with --method=%s", ErrInvalidArgs, j.parsed.Repo, method)
+	}
+	if j.opts.OutputToStdout {
+		return fmt.Errorf("%w: files in archives cannot be written to stdout; give a target", ErrInvalidArgs)
+	}
+
+	// Archives hold a single file under its own name
+	target := j.target
+	if j.source.IsFile {
+		if filepath.Base(j.target) != filepath.Base(j.source.Path) {
+			return fmt.Errorf("%w: a file extracted from an archive keeps its name; give a directory as target", ErrInvalidArgs)
+		}
+		target = filepath.Dir(j.target)
+	}
+
+	j.log.Verbosef("Using %s method for archive %s", method, j.sourceURL)
+	if method == methodTar {
+		return c.runTar(ctx, j, target)
+	}
+	return c.runZip(ctx, j, target)
+}
+
+// runZip downloads the source as a zip archive and extracts it into target
+func (c *CLI) runZip(ctx context.Context, j *job, target string) error {
+	if j.collector != nil {
+		j.collector.SetMethod(methodZip)
+	}
+
+	archiver := c.archiver
+	if archiver == nil {
+		zipDownloader, err := c.newZipDownloader(j)
+		if err != nil {
+			return err
+		}
+		if c.verify && !isArchive(j.parsed) {
+			trees, err := c.client(j)
+			if err != nil {
+				return err
+			}
+			zipDownloader.SetVerify(trees)
+		}
+		archiver = zipDownloader
+	}
+
+	// Create download request from parsed URL
+	req, err := c.archiveRequest(j, target)
+	if err != nil {
+		return err
+	}
+
+	return archiver.Download(ctx, req)
+}
+
+// runTar downloads the source as a gzipped tarball and extracts it into target
+func (c *CLI) runTar(ctx context.Context, j *job, target string) error {
+	if j.collector != nil {
+		j.collector.SetMethod(methodTar)
+	}
+
+	archiver := c.tar
+	if archiver == nil {
+		tarDownloader, err := c.newTarDownloader(j)
+		if err != nil {
+			return err
+		}
+		if c.verify && !isArchive(j.parsed) {
+			trees, err := c.client(j)
+			if err != nil {
+				return err
+			}
+			tarDownloader.SetVerify(trees)
+		}
+		archiver = tarDownloader
+	}
+
+	req, err := c.archiveRequest(j, target)
+	if err != nil {
+		return err
+	}
+
+	return archiver.Download(ctx, req)
+}
+
+// newZipDownloader creates a zip downloader for the job's host, output and
+// extraction settings
+func (c *CLI) newZipDownloader(j *job) (*downloader.ZipDownloader, error) {
+	var zipDownloader *downloader.ZipDownloader
+	if c.tempDir != "" {
+		zipDownloader = downloader.NewZipDownloaderWithTempDir(c.tempDir, c.stdout, c.stderr)
+	} else {
+		zipDownloader = downloader.NewZipDownloader(c.stdout, c.stderr)
+	}
+	if err := zipDownloader.SetHost(j.host); err != nil {
+		return nil, err
+	}
+	zipDownloader.SetLogger(j.log)
+	zipDownloader.SetProgress(progress.New(c.stderr, j.log.Level() == logger.Quiet))
+	zipDownloader.SetRecorder(j.rec)
+	zipDownloader.SetSymlinkMode(downloader.SymlinkMode(c.symlinks))
+	zipDownloader.SetModePolicy(j.opts.Mode)
+	zipDownloader.SetLimits(j.limits)
+	return zipDownloader, nil
+}
+
+// newTarDownloader creates a tar downloader for the job's host, output and
+// extraction settings
+func (c *CLI) newTarDownloader(j *job) (*downloader.TarDownloader, error) {
+	tarDownloader := downloader.NewTarDownloader(c.stdout, c.stderr)
+	if err := tarDownloader.SetHost(j.host); err != nil {
+		return nil, err
+	}
+	tarDownloader.SetLogger(j.log)
+	tarDownloader.SetProgress(progress.New(c.stderr, j.log.Level() == logger.Quiet))
+	tarDownloader.SetRecorder(j.rec)
+	tarDownloader.SetSymlinkMode(downloader.SymlinkMode(c.symlinks))
+	tarDownloader.SetModePolicy(j.opts.Mode)
+	tarDownloader.SetLimits(j.limits)
+	return tarDownloader, nil
+}
+
+// runRelease downloads the release assets the source names, extracting the
+// archives among them with --extract
+func (c *CLI) runRelease(ctx context.Context, j *job) error {
+	if c.method != methodAuto {
+		return fmt.Errorf("%w: release assets take no --method", ErrInvalidArgs)
 	}
+	if j.collector != nil {
+		j.collector.SetMethod(methodRelease)
+	}
+	j.log.Verbosef("Downloading release assets for %s", j.parsed)
 
-	// Use zip downloader for new method (only if no custom downloader provided)
-	if c.method == "zip" && c.downloader == nil {
-		var zipDownloader *downloader.ZipDownloader
+	dl := c.release
+	if dl == nil {
+		client, err := c.client(j)
+		if err != nil {
+			return err
+		}
+		releases, ok := client.(downloader.ReleaseClient)
+		if !ok {
+			return fmt.Errorf("%w: %s sources have no release assets", ErrInvalidArgs, j.parsed.Provider)
+		}
+		releaseDownloader := downloader.NewReleaseDownloader(releases, c.stdout, c.stderr)
+		releaseDownloader.SetLogger(j.log)
+		releaseDownloader.SetRecorder(j.rec)
+		releaseDownloader.SetChecksums(c.checksums)
 		if c.tempDir != "" {
-			zipDownloader = downloader.NewZipDownloaderWithTempDir(c.tempDir, c.stdout, c.stderr)
-		} else {
-			zipDownloader = downloader.NewZipDownloader(c.stdout, c.stderr)
+			releaseDownloader.SetTempDir(c.tempDir)
+		}
+		if c.extract {
+			zip, tar, err := c.extractors(j)
+			if err != nil {
+				return err
+			}
+			releaseDownloader.SetExtract(zip, tar)
 		}
+		dl = releaseDownloader
+	}
 
-		// Create download request from parsed URL
-		req := downloader.DownloadRequest{
-			Owner:  parsedURL.Owner,
-			Repo:   parsedURL.Repo,
-			Path:   parsedURL.Path,
-			Ref:    parsedURL.Ref,
-			Target: targetPath,
+	return dl.Download(ctx, j.source, j.target, j.opts)
+}
+
+// extractors returns the downloaders that extract zip and tar archives
+// already on disk
+func (c *CLI) extractors(j *job) (downloader.Extractor, downloader.Extractor, error) {
+	var zip, tar downloader.Extractor = c.archiver, c.tar
+	if zip == nil {
+		zipDownloader, err := c.newZipDownloader(j)
+		if err != nil {
+			return nil, nil, err
+		}
+		zip = zipDownloader
+	}
+	if tar == nil {
+		tarDownloader, err := c.newTarDownloader(j)
+		if err != nil {
+			return nil, nil, err
 		}
+		tar = tarDownloader
+	}
+	return zip, tar, nil
+}
+
+// archiveRequest describes the archive download of the job's source into
+// target, locating the archive through the API client on services other
+// than GitHub and naming the file or URL of archive sources
+func (c *CLI) archiveRequest(j *job, target string) (downloader.DownloadRequest, error) {
+	req := downloader.DownloadRequest{
+		Owner:  j.parsed.Owner,
+		Repo:   j.parsed.Repo,
+		Path:   j.parsed.Path,
+		Ref:    j.parsed.Ref,
+		Target: target,
+	}
+
+	switch j.parsed.Provider {
+	case "":
+	case local.Scheme:
+		req.Archive = filepath.Join(j.parsed.Owner, j.parsed.Repo)
+	case archive.Scheme:
+		req.URL = archive.URL(j.parsed)
+	default:
+		client, err := c.client(j)
+		if err != nil {
+			return req, err
+		}
+		provider, ok := client.(downloader.Provider)
+		if !ok {
+			return req, fmt.Errorf("%w: %s sources have no archives", ErrInvalidArgs, j.parsed.Provider)
+		}
+		req.Provider = provider
+	}
+	req.StripComponents = c.strip
+	req.SHA256 = c.sha256
+	return req, nil
+}
+
+// runRaw fetches the single source file from the host's raw content server
+func (c *CLI) runRaw(ctx context.Context, j *job) error {
+	if j.collector != nil {
+		j.collector.SetMethod(methodRaw)
+	}
 
-		return zipDownloader.Download(req)
+	dl := c.raw
+	if dl == nil {
+		rawDownloader := downloader.NewRawDownloader(c.stdout, c.stderr)
+		if err := rawDownloader.SetHost(j.host); err != nil {
+			return err
+		}
+		trees, err := c.client(j)
+		if err != nil {
+			return err
+		}
+		rawDownloader.SetTrees(trees)
+		rawDownloader.SetLogger(j.log)
+		rawDownloader.SetRecorder(j.rec)
+		dl = rawDownloader
+	}
+
+	return dl.Download(ctx, j.source, j.target, j.opts)
+}
+
+// runAPI downloads the source file by file through the contents API
+func (c *CLI) runAPI(ctx context.Context, j *job) error {
+	if j.collector != nil {
+		j.collector.SetMethod(methodAPI)
 	}
 
 	// Create default API downloader if none provided
-	if c.downloader == nil {
-		client := github.NewClient()
-		c.downloader = downloader.NewDownloader(client, c.stdout, c.stderr)
+	dl := c.downloader
+	if dl == nil {
+		client, err := c.client(j)
+		if err != nil {
+			return err
+		}
+		apiDownloader := downloader.NewDownloader(client, c.stdout, c.stderr)
+		apiDownloader.SetLogger(j.log)
+		apiDownloader.SetRecorder(j.rec)
+		dl = apiDownloader
 	}
 
-	// Use the provided downloader (for tests) or fallback to API downloader
-	return c.downloader.Download(source, targetPath, opts)
+	return dl.Download(ctx, j.source, j.target, j.opts)
+}
+
+// client returns an API client for the job's provider and host
+func (c *CLI) client(j *job) (apiClient, error) {
+	var client apiClient
+	var err error
+	switch j.parsed.Provider {
+	case gitlab.Scheme:
+		client, err = gitlab.NewClient(j.host)
+	case bitbucket.Scheme:
+		client, err = bitbucket.NewClient(j.host)
+	case gitea.Scheme, gitea.ForgejoScheme:
+		client, err = gitea.NewClient(j.host)
+	case git.Scheme:
+		client, err = git.NewClient(j.host)
+	case local.Scheme:
+		client = local.NewClient()
+	case gist.Scheme:
+		client, err = gist.NewClient(j.host)
+	case archive.Scheme:
+		return nil, fmt.Errorf("%w: archive URLs have no refs or API; pin them with --sha256", ErrInvalidArgs)
+	default:
+		client, err = github.NewHostClient(j.host)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	client.SetLogger(j.log)
+	return client, nil
+}
+
+// loadConfig reads the config file named by --config, or the default one,
+// unless a config was supplied in Options
+func (c *CLI) loadConfig() error {
+	if c.config != nil {
+		return nil
+	}
+
+	path := c.configPath
+	if path == "" {
+		var err error
+		if path, err = config.Path(); err != nil {
+			c.config = &config.Config{}
+			return nil
+		}
+	} else if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("%w: --config: %v", ErrInvalidArgs, err)
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+	c.config = cfg
+	return nil
+}
+
+// errorCode maps err to the stable code reported in JSON output
+func errorCode(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	case errors.Is(err, github.ErrInvalidURL), errors.Is(err, github.ErrMissingOwner), errors.Is(err, github.ErrMissingRepo),
+		errors.Is(err, github.ErrMissingHost), errors.Is(err, gitlab.ErrInvalidURL), errors.Is(err, gitlab.ErrMissingProject),
+		errors.Is(err, bitbucket.ErrInvalidURL), errors.Is(err, gitea.ErrInvalidURL), errors.Is(err, git.ErrInvalidURL),
+		errors.Is(err, local.ErrInvalidPath), errors.Is(err, archive.ErrInvalidURL),
+		errors.Is(err, gist.ErrInvalidURL):
+		return "invalid_source"
+	case errors.Is(err, ErrStdoutInUse), errors.Is(err, ErrInvalidArgs), errors.Is(err, downloader.ErrInvalidDestination),
+		errors.Is(err, config.ErrInvalidConfig), errors.Is(err, github.ErrInvalidCABundle):
+		return "invalid_arguments"
+	case errors.Is(err, github.ErrRateLimitExceeded):
+		return "rate_limited"
+	case errors.Is(err, downloader.ErrLimitExceeded):
+		return "limit_exceeded"
+	case errors.Is(err, downloader.ErrDiskSpaceInsufficient):
+		return "insufficient_space"
+	case errors.Is(err, downloader.ErrIntegrityMismatch):
+		return "integrity_mismatch"
+	case errors.Is(err, downloader.ErrUnverifiable):
+		return "unverifiable"
+	case errors.Is(err, ErrUnpinnedRef), errors.Is(err, ErrSHAMismatch):
+		return "policy_violation"
+	case errors.Is(err, github.ErrRefNotFound), errors.Is(err, github.ErrNoMergeCommit):
+		return "not_found"
+	case errors.Is(err, github.ErrNetworkFailure):
+		return "network_error"
+	case errors.Is(err, github.ErrFileNotFound), errors.Is(err, github.ErrDirectoryNotFound),
+		errors.Is(err, github.ErrRepositoryNotFound), errors.Is(err, downloader.ErrPathNotFoundInZip),
+		errors.Is(err, github.ErrReleaseNotFound), errors.Is(err, github.ErrAssetNotFound):
+		return "not_found"
+	case errors.Is(err, downloader.ErrInvalidZipPath), errors.Is(err, downloader.ErrInvalidTarPath),
+		errors.Is(err, downloader.ErrUnsafeSymlink):
+		return "invalid_archive"
+	case errors.Is(err, downloader.ErrZipDownloadFailed), errors.Is(err, downloader.ErrTarDownloadFailed),
+		errors.Is(err, git.ErrProtocol), errors.Is(err, downloader.ErrUnsafeName):
+		return "download_failed"
+	case errors.Is(err, downloader.ErrZipExtractFailed), errors.Is(err, downloader.ErrTarExtractFailed),
+		errors.Is(err, downloader.ErrFailedToWriteFile),
+		errors.Is(err, downloader.ErrFailedToCreateDir):
+		return "write_failed"
+	default:
+		return "unknown"
+	}
+}
+
+// modePolicy builds the file permission policy from --preserve-mode and --mode
+func (c *CLI) modePolicy() (downloader.ModePolicy, error) {
+	policy := downloader.ModePolicy{Preserve: c.preserve}
+	if c.mode == "" {
+		return policy, nil
+	}
+
+	if c.preserve {
+		return policy, fmt.Errorf("%w: --mode and --preserve-mode cannot be combined", ErrInvalidArgs)
+	}
+	mode, err := downloader.ParseFileMode(c.mode)
+	if err != nil {
+		return policy, fmt.Errorf("%w: %v", ErrInvalidArgs, err)
+	}
+	policy.Override = mode
+	return policy, nil
+}
+
+// limits builds the extraction limits from --max-size and --max-files
+func (c *CLI) limits() (downloader.Limits, error) {
+	limits := downloader.DefaultLimits()
+
+	size, err := downloader.ParseSize(c.maxSize)
+	if err != nil {
+		return limits, fmt.Errorf("%w: --max-size: %v", ErrInvalidArgs, err)
+	}
+	if c.maxFiles < 0 {
+		return limits, fmt.Errorf("%w: --max-files must not be negative", ErrInvalidArgs)
+	}
+
+	limits.MaxSize = size
+	limits.MaxFiles = c.maxFiles
+	return limits, nil
+}
+
+// logLevel maps the output flags to a logger level
+func (c *CLI) logLevel() logger.Level {
+	switch {
+	case c.quiet:
+		return logger.Quiet
+	case c.debug:
+		return logger.Debug
+	case c.verbose:
+		return logger.Verbose
+	default:
+		return logger.Normal
+	}
 }
 
 // printHelp displays the help information
@@ -186,9 +1170,18 @@ func (c *CLI) printHelp() {
 	fmt.Fprintln(c.stderr)
 	fmt.Fprintln(c.stderr, "Usage:")
 	fmt.Fprintln(c.stderr, "  xcp [options] <source> [target]")
+	fmt.Fprintln(c.stderr, "  xcp verify <target>")
+	fmt.Fprintln(c.stderr, "  xcp diff [options] <source with base..head>")
 	fmt.Fprintln(c.stderr)
 	fmt.Fprintln(c.stderr, "Arguments:")
-	fmt.Fprintln(c.stderr, "  source:  github:owner/repo/path[@ref]")
+	fmt.Fprintln(c.stderr, "  source:  github:owner/repo/path[@ref], github@host:owner/repo/path[@ref],")
+	fmt.Fprintln(c.stderr, "           gitlab:group/subgroup/project[@ref][/path], bitbucket:workspace/repo[@ref][/path]")
+	fmt.Fprintln(c.stderr, "           gitea@host:owner/repo[@ref][/path], forgejo@host:owner/repo[@ref][/path]")
+	fmt.Fprintln(c.stderr, "           git+https://host/path/repo.git[@ref][//subdir], file:///path/to/repo[//subdir],")
+	fmt.Fprintln(c.stderr, "           ./repo.zip[//subdir], ./repo.tar.gz[//subdir], https://host/path/archive.tar.xz[//subdir]")
+	fmt.Fprintln(c.stderr, "           github:owner/repo[@tag]#asset=name-or-glob, gist:id[@revision][/filename]")
+	fmt.Fprintln(c.stderr, "           github:owner/repo@pr/123[/merge][/path], github:owner/repo@base..head[/path] (diff)")
+	fmt.Fprintln(c.stderr, "           or alias:owner/repo/path[@ref]")
 	fmt.Fprintln(c.stderr, "  target:  local directory or file (defaults to current directory)")
 	fmt.Fprintln(c.stderr)
 	fmt.Fprintln(c.stderr, "Options:")
@@ -201,5 +1194,16 @@ func (c *CLI) printHelp() {
 	fmt.Fprintln(c.stderr, "  xcp github:twilson63/foo/data.json | jq")
 	fmt.Fprintln(c.stderr, "  xcp github:twilson63/qa ./target/path")
 	fmt.Fprintln(c.stderr, "  xcp --method=api github:twilson63/qa")
+	fmt.Fprintln(c.stderr, "  xcp github@git.corp.example:platform/tools@v2")
+	fmt.Fprintln(c.stderr, "  xcp gitlab:group/ci/templates@main/jobs ./ci")
+	fmt.Fprintln(c.stderr, "  xcp bitbucket:atlassian/python-bitbucket@master/README.md")
+	fmt.Fprintln(c.stderr, "  xcp forgejo@git.corp.example:tools/scripts@v2/bin ./bin")
+	fmt.Fprintln(c.stderr, "  xcp git+https://git.example.com/team/tools.git@v1//ci ./ci")
+	fmt.Fprintln(c.stderr, "  xcp file:///srv/mirror/tools//ci ./ci")
+	fmt.Fprintln(c.stderr, "  xcp gist:aa5a315d61ae9438b18d/hello_world.rb")
+	fmt.Fprintln(c.stderr, "  xcp github:owner/repo@pr/123/docs ./docs")
+	fmt.Fprintln(c.stderr, "  xcp diff github:owner/repo@v1.0.0..pr/123/docs")
+	fmt.Fprintln(c.stderr, "  xcp --checksums=checksums.txt --extract github:owner/tools@v1.2.3#asset=tools-linux-amd64.tar.gz ./bin")
+	fmt.Fprintln(c.stderr, "  xcp --sha256=<digest> https://example.com/releases/tools-1.2.0.tar.gz//ci ./ci")
 	fmt.Fprintln(c.stderr, "  xcp --verbose --temp-dir=/tmp github:twilson63/qa")
 }
@@ -1,12 +1,37 @@
 package cli
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"xcp/internal/archive"
+	"xcp/internal/bitbucket"
+	"xcp/internal/config"
 	"xcp/internal/downloader"
+	"xcp/internal/gist"
+	"xcp/internal/git"
+	"xcp/internal/gitea"
 	"xcp/internal/github"
+	"xcp/internal/gitlab"
+	"xcp/internal/local"
+	"xcp/internal/manifest"
+	"xcp/internal/report"
 )
 
 // MockDownloader for testing
@@ -15,10 +40,12 @@ type MockDownloader struct {
 	Target string
 	Opts   downloader.DownloadOptions
 	Err    error
+	Calls  int
 }
 
 // Download implements the Downloader interface
-func (m *MockDownloader) Download(source *github.GitHubSource, target string, opts downloader.DownloadOptions) error {
+func (m *MockDownloader) Download(ctx context.Context, source *github.GitHubSource, target string, opts downloader.DownloadOptions) error {
+	m.Calls++
 	m.Source = source
 	m.Target = target
 	m.Opts = opts
@@ -214,3 +241,1274 @@ func TestCLI_ParseArgs(t *testing.T) {
 		})
 	}
 }
+
+func TestCLI_OutputJSON(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		expectCode string
+	}{
+		{
+			name:       "Invalid source",
+			args:       []string{"--output=json", "invalid-source"},
+			expectCode: "invalid_source",
+		},
+		{
+			name:       "File to stdout",
+			args:       []string{"--output=json", "github:owner/repo/file.txt"},
+			expectCode: "invalid_arguments",
+		},
+		{
+			name:       "Successful download",
+			args:       []string{"--output=json", "--method=api", "github:owner/repo", "/target/path"},
+			expectCode: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout := new(bytes.Buffer)
+			stderr := new(bytes.Buffer)
+
+			cli := New(Options{
+				Stdout:     stdout,
+				Stderr:     stderr,
+				Downloader: &MockDownloader{},
+			})
+
+			err := cli.Run(tt.args)
+			if (err != nil) != (tt.expectCode != "") {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			var result report.Result
+			if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+				t.Fatalf("stdout is not a JSON document: %v\n%s", err, stdout.String())
+			}
+
+			if tt.expectCode == "" {
+				if result.Error != nil {
+					t.Errorf("Expected no error in result, got %+v", result.Error)
+				}
+				if result.Source != "github:owner/repo" || result.Method != "api" {
+					t.Errorf("Unexpected result: %+v", result)
+				}
+				return
+			}
+
+			if result.Error == nil || result.Error.Code != tt.expectCode {
+				t.Errorf("Expected error code %q, got %+v", tt.expectCode, result.Error)
+			}
+		})
+	}
+}
+
+func TestCLI_OutputInvalid(t *testing.T) {
+	cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer)})
+
+	err := cli.Run([]string{"--output=yaml", "github:owner/repo"})
+	if !errors.Is(err, ErrInvalidArgs) {
+		t.Errorf("Expected ErrInvalidArgs, got %v", err)
+	}
+}
+
+// MockArchiveDownloader for testing
+type MockArchiveDownloader struct {
+	Req    *downloader.DownloadRequest
+	Err    error
+	Called bool
+}
+
+// Download implements the ArchiveDownloader interface
+func (m *MockArchiveDownloader) Download(ctx context.Context, req downloader.DownloadRequest) error {
+	m.Called = true
+	m.Req = &req
+	return m.Err
+}
+
+func TestCLI_MethodAuto(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		zipErr      error
+		apiErr      error
+		rawErr      error
+		expectZip   bool
+		expectAPI   bool
+		expectRaw   bool
+		expectError bool
+		expectLog   string
+	}{
+		{
+			name:      "Directory uses zip",
+			args:      []string{"--verbose", "github:owner/repo", "/target"},
+			expectZip: true,
+			expectLog: "Using zip method",
+		},
+		{
+			name:      "Archive not found falls back to API",
+			args:      []string{"github:owner/repo@v1", "/target"},
+			zipErr:    fmt.Errorf("%w: %w", downloader.ErrZipDownloadFailed, downloader.ErrArchiveNotFound),
+			expectZip: true,
+			expectAPI: true,
+			expectLog: "falling back to API method",
+		},
+		{
+			name:      "Prefix mismatch falls back to API",
+			args:      []string{"github:owner/repo@v1/dir", "/target"},
+			zipErr:    downloader.ErrArchivePrefixMismatch,
+			expectZip: true,
+			expectAPI: true,
+		},
+		{
+			name:        "Other zip errors are returned",
+			args:        []string{"github:owner/repo", "/target"},
+			zipErr:      downloader.ErrInvalidZipPath,
+			expectZip:   true,
+			expectError: true,
+		},
+		{
+			name:      "Single file uses raw",
+			args:      []string{"--verbose", "github:owner/repo/file.txt", "/target/file.txt"},
+			expectRaw: true,
+			expectLog: "Using raw method",
+		},
+		{
+			name:      "Raw not found falls back to API",
+			args:      []string{"github:owner/repo/dir.d", "/target"},
+			rawErr:    github.ErrFileNotFound,
+			expectRaw: true,
+			expectAPI: true,
+			expectLog: "falling back to API method",
+		},
+		{
+			name:      "Rate limited file falls back to zip",
+			args:      []string{"github:owner/repo/file.txt", "/target/file.txt"},
+			rawErr:    github.ErrRateLimitExceeded,
+			apiErr:    github.ErrRateLimitExceeded,
+			expectRaw: true,
+			expectAPI: true,
+			expectZip: true,
+			expectLog: "falling back to zip method",
+		},
+		{
+			name:        "Other providers skip raw",
+			args:        []string{"--verbose", "gitlab:group/project/-/ci/build.yml", "/target/build.yml"},
+			apiErr:      github.ErrFileNotFound,
+			expectAPI:   true,
+			expectError: true,
+			expectLog:   "Using api method",
+		},
+		{
+			name:        "Rate limited stdout has no zip fallback",
+			args:        []string{"github:owner/repo/file.txt"},
+			rawErr:      github.ErrRateLimitExceeded,
+			apiErr:      github.ErrRateLimitExceeded,
+			expectRaw:   true,
+			expectAPI:   true,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stderr := new(bytes.Buffer)
+			api := &MockDownloader{Err: tt.apiErr}
+			raw := &MockDownloader{Err: tt.rawErr}
+			zip := &MockArchiveDownloader{Err: tt.zipErr}
+
+			cli := New(Options{
+				Stdout:            new(bytes.Buffer),
+				Stderr:            stderr,
+				Downloader:        api,
+				ArchiveDownloader: zip,
+				RawDownloader:     raw,
+			})
+
+			err := cli.Run(tt.args)
+			if tt.expectError != (err != nil) {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			if zip.Called != tt.expectZip {
+				t.Errorf("Expected zip called %v, got %v", tt.expectZip, zip.Called)
+			}
+			if (api.Source != nil) != tt.expectAPI {
+				t.Errorf("Expected api called %v, got %v", tt.expectAPI, api.Source != nil)
+			}
+			if (raw.Source != nil) != tt.expectRaw {
+				t.Errorf("Expected raw called %v, got %v", tt.expectRaw, raw.Source != nil)
+			}
+			if api.Calls > 1 {
+				t.Errorf("Expected api called at most once, got %d calls", api.Calls)
+			}
+			if tt.expectLog != "" && !strings.Contains(stderr.String(), tt.expectLog) {
+				t.Errorf("Expected %q in stderr, got %q", tt.expectLog, stderr.String())
+			}
+		})
+	}
+}
+
+func TestCLI_MethodTar(t *testing.T) {
+	zip := &MockArchiveDownloader{}
+	tar := &MockArchiveDownloader{}
+
+	cli := New(Options{
+		Stdout:            new(bytes.Buffer),
+		Stderr:            new(bytes.Buffer),
+		ArchiveDownloader: zip,
+		TarDownloader:     tar,
+	})
+
+	if err := cli.Run([]string{"--method=tar", "github:owner/repo@v1/src", "/target"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if zip.Called {
+		t.Errorf("Expected zip downloader not to be called")
+	}
+	if tar.Req == nil {
+		t.Fatalf("Expected tar downloader to be called")
+	}
+
+	expected := downloader.DownloadRequest{Owner: "owner", Repo: "repo", Path: "src", Ref: "v1", Target: "/target"}
+	if *tar.Req != expected {
+		t.Errorf("Expected request %+v, got %+v", expected, *tar.Req)
+	}
+}
+
+func TestCLI_InvalidMethod(t *testing.T) {
+	cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer)})
+
+	err := cli.Run([]string{"--method=ftp", "github:owner/repo"})
+	if !errors.Is(err, ErrInvalidArgs) {
+		t.Errorf("Expected ErrInvalidArgs, got %v", err)
+	}
+}
+
+func TestCLI_ModeFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected downloader.ModePolicy
+		err      error
+	}{
+		{name: "Default", args: nil},
+		{name: "Preserve", args: []string{"--preserve-mode"}, expected: downloader.ModePolicy{Preserve: true}},
+		{name: "Override", args: []string{"--mode=0600"}, expected: downloader.ModePolicy{Override: 0600}},
+		{name: "Invalid mode", args: []string{"--mode=rw"}, err: ErrInvalidArgs},
+		{name: "Both", args: []string{"--mode=0600", "--preserve-mode"}, err: ErrInvalidArgs},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &MockDownloader{}
+			cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), Downloader: mock})
+
+			err := cli.Run(append(tt.args, "github:owner/repo", "/target"))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expected error %v, got %v", tt.err, err)
+			}
+			if err == nil && mock.Opts.Mode != tt.expected {
+				t.Errorf("Expected mode policy %+v, got %+v", tt.expected, mock.Opts.Mode)
+			}
+		})
+	}
+}
+
+func TestCLI_LimitFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		maxSize  int64
+		maxFiles int
+		err      error
+	}{
+		{name: "Defaults", maxSize: 8 << 30, maxFiles: downloader.DefaultLimits().MaxFiles},
+		{name: "Custom", args: []string{"--max-size=100M", "--max-files=10"}, maxSize: 100 << 20, maxFiles: 10},
+		{name: "Unlimited", args: []string{"--max-size=0", "--max-files=0"}},
+		{name: "Invalid size", args: []string{"--max-size=huge"}, err: ErrInvalidArgs},
+		{name: "Negative files", args: []string{"--max-files=-1"}, err: ErrInvalidArgs},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer)})
+			if err := cli.flagSet.Parse(tt.args); err != nil {
+				t.Fatalf("Failed to parse flags: %v", err)
+			}
+
+			limits, err := cli.limits()
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expected error %v, got %v", tt.err, err)
+			}
+			if err == nil && (limits.MaxSize != tt.maxSize || limits.MaxFiles != tt.maxFiles) {
+				t.Errorf("Expected max size %d and files %d, got %+v", tt.maxSize, tt.maxFiles, limits)
+			}
+		})
+	}
+}
+
+func TestCLI_Verify(t *testing.T) {
+	target := t.TempDir()
+	if err := os.WriteFile(filepath.Join(target, "hello.txt"), []byte("hello\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	m := &manifest.Manifest{Source: "github:owner/repo", Files: []manifest.File{{
+		Path:   "hello.txt",
+		Size:   6,
+		SHA256: "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03",
+	}}}
+	if err := manifest.Write(target, m); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+
+	stdout := new(bytes.Buffer)
+	cli := New(Options{Stdout: stdout, Stderr: new(bytes.Buffer)})
+	if err := cli.Run([]string{"verify", target}); err != nil {
+		t.Fatalf("Expected clean verification, got %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(target, "hello.txt"), []byte("changed\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	stdout.Reset()
+	cli = New(Options{Stdout: stdout, Stderr: new(bytes.Buffer)})
+	err := cli.Run([]string{"verify", target})
+	if !errors.Is(err, manifest.ErrMismatch) {
+		t.Fatalf("Expected manifest.ErrMismatch, got %v", err)
+	}
+	if !strings.Contains(stdout.String(), "modified: hello.txt") {
+		t.Errorf("Expected modified file in output, got %q", stdout.String())
+	}
+}
+
+func TestCLI_VerifyRecordsManifest(t *testing.T) {
+	target := t.TempDir()
+	cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), Downloader: &MockDownloader{}})
+
+	if err := cli.Run([]string{"--verify", "github:owner/repo", target}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	m, err := manifest.Read(target)
+	if err != nil {
+		t.Fatalf("Expected a manifest to be recorded: %v", err)
+	}
+	if m.Source != "github:owner/repo" {
+		t.Errorf("Unexpected manifest source %q", m.Source)
+	}
+}
+
+// newFakeHost serves handler as the GitHub Enterprise host example.com,
+// which the test server's certificate is issued for, and returns a config
+// reaching it through the alias "fake". Every connection the default
+// transport makes is sent to the server while the test runs.
+func newFakeHost(t *testing.T, handler http.Handler) *config.Config {
+	t.Helper()
+
+	server := httptest.NewTLSServer(handler)
+	t.Cleanup(server.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	block := &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(block), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	original := http.DefaultTransport
+	transport := original.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return new(net.Dialer).DialContext(ctx, network, server.Listener.Addr().String())
+	}
+	http.DefaultTransport = transport
+	t.Cleanup(func() { http.DefaultTransport = original })
+
+	return &config.Config{Hosts: map[string]config.HostConfig{
+		"example.com": {Alias: "fake", CAFile: caFile},
+	}}
+}
+
+func TestCLI_DefaultMethodKeepsExecutableBit(t *testing.T) {
+	cfg := newFakeHost(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/raw/owner/repo/HEAD/script.sh":
+			io.WriteString(w, "#!/bin/sh\n")
+		case "/api/v3/repos/owner/repo/git/trees/HEAD":
+			io.WriteString(w, `{"tree": [{"path": "script.sh", "mode": "100755", "type": "blob"}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	target := filepath.Join(t.TempDir(), "script.sh")
+	stderr := new(bytes.Buffer)
+	cli := New(Options{Stdout: new(bytes.Buffer), Stderr: stderr, Config: cfg})
+	if err := cli.Run([]string{"--verbose", "fake:owner/repo/script.sh", target}); err != nil {
+		t.Fatalf("Unexpected error: %v\n%s", err, stderr.String())
+	}
+
+	if !strings.Contains(stderr.String(), "Using raw method") {
+		t.Errorf("Expected the raw method, got %q", stderr.String())
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatalf("Expected script.sh to be written: %v", err)
+	}
+	if info.Mode().Perm()&0100 == 0 {
+		t.Errorf("Expected script.sh to be executable, got %v", info.Mode().Perm())
+	}
+}
+
+// MockResolver resolves every ref to a fixed kind and commit
+type MockResolver struct {
+	Kind   github.RefKind
+	Commit string
+	Ref    string
+}
+
+// ResolveRef implements the RefResolver interface
+func (m *MockResolver) ResolveRef(ctx context.Context, owner, repo, ref string) (*github.ResolvedRef, error) {
+	m.Ref = ref
+	return &github.ResolvedRef{Ref: ref, Kind: m.Kind, Commit: m.Commit}, nil
+}
+
+func TestCLI_Pinning(t *testing.T) {
+	const commit = "0123456789abcdef0123456789abcdef01234567"
+
+	tests := []struct {
+		name string
+		args []string
+		kind github.RefKind
+		err  error
+	}{
+		{name: "Tag is pinned", args: []string{"--require-pinned", "github:owner/repo@v1.0.0"}, kind: github.RefTag},
+		{name: "Commit is pinned", args: []string{"--require-pinned", "github:owner/repo@0123456"}, kind: github.RefCommit},
+		{name: "Branch is rejected", args: []string{"--require-pinned", "github:owner/repo@main"}, kind: github.RefBranch, err: ErrUnpinnedRef},
+		{name: "Default branch is rejected", args: []string{"--require-pinned", "github:owner/repo"}, kind: github.RefBranch, err: ErrUnpinnedRef},
+		{name: "Expected SHA matches", args: []string{"--expect-sha=0123456789", "github:owner/repo@main"}, kind: github.RefBranch},
+		{name: "Expected SHA differs", args: []string{"--expect-sha=fedcba9", "github:owner/repo@v1.0.0"}, kind: github.RefTag, err: ErrSHAMismatch},
+		{name: "Expected SHA invalid", args: []string{"--expect-sha=v1", "github:owner/repo@v1.0.0"}, err: ErrInvalidArgs},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout := new(bytes.Buffer)
+			zip := &MockArchiveDownloader{}
+			cli := New(Options{
+				Stdout:            stdout,
+				Stderr:            new(bytes.Buffer),
+				ArchiveDownloader: zip,
+				Resolver:          &MockResolver{Kind: tt.kind, Commit: commit},
+			})
+
+			err := cli.Run(append([]string{"--output=json", "--method=zip"}, append(tt.args, "/target")...))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expected error %v, got %v", tt.err, err)
+			}
+
+			if tt.err != nil {
+				if zip.Called {
+					t.Errorf("Expected nothing to be downloaded")
+				}
+				return
+			}
+
+			if zip.Req == nil || zip.Req.Ref != commit {
+				t.Fatalf("Expected download of commit %s, got %+v", commit, zip.Req)
+			}
+
+			var result report.Result
+			if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+				t.Fatalf("Invalid JSON output: %v", err)
+			}
+			if result.Commit != commit || result.Ref == commit || result.Ref == "" {
+				t.Errorf("Expected both ref and commit recorded, got ref %q commit %q", result.Ref, result.Commit)
+			}
+		})
+	}
+}
+
+func TestCLI_Hosts(t *testing.T) {
+	missingCA := filepath.Join(t.TempDir(), "missing.pem")
+	cfg := &config.Config{Hosts: map[string]config.HostConfig{
+		"git.corp.example": {Alias: "corp", CAFile: missingCA},
+	}}
+
+	t.Run("Alias names the host", func(t *testing.T) {
+		zip := &MockArchiveDownloader{}
+		cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), ArchiveDownloader: zip, Config: cfg})
+
+		if err := cli.Run([]string{"--method=zip", "corp:platform/tools@v2/bin", "/target"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if zip.Req.Owner != "platform" || zip.Req.Repo != "tools" || zip.Req.Ref != "v2" || zip.Req.Path != "bin" {
+			t.Errorf("Unexpected request %+v", zip.Req)
+		}
+	})
+
+	// The downloaders are built for the host, so its CA bundle is loaded
+	// before anything is fetched
+	for _, source := range []string{"corp:platform/tools", "github@git.corp.example:platform/tools"} {
+		t.Run("Host settings apply to "+source, func(t *testing.T) {
+			stdout := new(bytes.Buffer)
+			cli := New(Options{Stdout: stdout, Stderr: new(bytes.Buffer), Config: cfg})
+
+			err := cli.Run([]string{"--output=json", "--method=zip", source, t.TempDir()})
+			if !errors.Is(err, github.ErrInvalidCABundle) {
+				t.Fatalf("Expected ErrInvalidCABundle, got %v", err)
+			}
+			if !strings.Contains(stdout.String(), `"invalid_arguments"`) {
+				t.Errorf("Expected invalid_arguments code, got %s", stdout.String())
+			}
+		})
+	}
+
+	t.Run("Invalid config file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.json")
+		os.WriteFile(path, []byte(`{"hosts":`), 0600)
+
+		cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), ArchiveDownloader: &MockArchiveDownloader{}})
+		if err := cli.Run([]string{"--config=" + path, "github:owner/repo", "/target"}); !errors.Is(err, config.ErrInvalidConfig) {
+			t.Errorf("Expected ErrInvalidConfig, got %v", err)
+		}
+	})
+
+	t.Run("Missing config file", func(t *testing.T) {
+		cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), ArchiveDownloader: &MockArchiveDownloader{}})
+		err := cli.Run([]string{"--config=" + filepath.Join(t.TempDir(), "none.json"), "github:owner/repo", "/target"})
+		if !errors.Is(err, ErrInvalidArgs) {
+			t.Errorf("Expected ErrInvalidArgs, got %v", err)
+		}
+	})
+}
+
+func TestCLI_GitLab(t *testing.T) {
+	t.Run("Archive located through the GitLab API", func(t *testing.T) {
+		zip := &MockArchiveDownloader{}
+		cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), ArchiveDownloader: zip, Config: &config.Config{}})
+
+		if err := cli.Run([]string{"--method=zip", "gitlab:group/sub/project@v1/ci", "/target"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if zip.Req.Owner != "group/sub" || zip.Req.Repo != "project" || zip.Req.Ref != "v1" || zip.Req.Path != "ci" {
+			t.Errorf("Unexpected request %+v", zip.Req)
+		}
+		if _, ok := zip.Req.Provider.(*gitlab.Client); !ok {
+			t.Errorf("Expected a GitLab archive provider, got %T", zip.Req.Provider)
+		}
+	})
+
+	t.Run("GitHub archives need no provider", func(t *testing.T) {
+		zip := &MockArchiveDownloader{}
+		cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), ArchiveDownloader: zip, Config: &config.Config{}})
+
+		if err := cli.Run([]string{"--method=zip", "github:owner/repo", "/target"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if zip.Req.Provider != nil {
+			t.Errorf("Expected no provider for GitHub, got %T", zip.Req.Provider)
+		}
+	})
+
+	t.Run("Single files come from the files API", func(t *testing.T) {
+		api := &MockDownloader{}
+		raw := &MockDownloader{}
+		cli := New(Options{
+			Stdout:            new(bytes.Buffer),
+			Stderr:            new(bytes.Buffer),
+			Downloader:        api,
+			RawDownloader:     raw,
+			ArchiveDownloader: &MockArchiveDownloader{},
+			Config:            &config.Config{},
+		})
+
+		if err := cli.Run([]string{"gitlab:group/project/-/ci/build.yml", "/target/build.yml"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if raw.Source != nil {
+			t.Errorf("Expected the raw downloader not to be used")
+		}
+		if api.Source == nil || api.Source.Provider != gitlab.Scheme || api.Source.Path != "ci/build.yml" {
+			t.Errorf("Unexpected API source %+v", api.Source)
+		}
+	})
+
+	t.Run("Invalid project", func(t *testing.T) {
+		cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), ArchiveDownloader: &MockArchiveDownloader{}, Config: &config.Config{}})
+		if err := cli.Run([]string{"gitlab:project", "/target"}); !errors.Is(err, gitlab.ErrMissingProject) {
+			t.Errorf("Expected ErrMissingProject, got %v", err)
+		}
+	})
+}
+
+func TestCLI_Bitbucket(t *testing.T) {
+	t.Run("Archive located through the Bitbucket client", func(t *testing.T) {
+		zip := &MockArchiveDownloader{}
+		cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), ArchiveDownloader: zip, Config: &config.Config{}})
+
+		if err := cli.Run([]string{"--method=zip", "bitbucket:workspace/repo@v1/docs", "/target"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if zip.Req.Owner != "workspace" || zip.Req.Repo != "repo" || zip.Req.Ref != "v1" || zip.Req.Path != "docs" {
+			t.Errorf("Unexpected request %+v", zip.Req)
+		}
+		if _, ok := zip.Req.Provider.(*bitbucket.Client); !ok {
+			t.Errorf("Expected a Bitbucket archive provider, got %T", zip.Req.Provider)
+		}
+	})
+
+	t.Run("Single files come from the src endpoint", func(t *testing.T) {
+		api := &MockDownloader{}
+		raw := &MockDownloader{}
+		cli := New(Options{
+			Stdout:            new(bytes.Buffer),
+			Stderr:            new(bytes.Buffer),
+			Downloader:        api,
+			RawDownloader:     raw,
+			ArchiveDownloader: &MockArchiveDownloader{},
+			Config:            &config.Config{},
+		})
+
+		if err := cli.Run([]string{"bitbucket:workspace/repo/README.md", "/target/README.md"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if raw.Source != nil {
+			t.Errorf("Expected the raw downloader not to be used")
+		}
+		if api.Source == nil || api.Source.Provider != bitbucket.Scheme || api.Source.Path != "README.md" {
+			t.Errorf("Unexpected API source %+v", api.Source)
+		}
+	})
+
+	t.Run("Invalid source", func(t *testing.T) {
+		cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), ArchiveDownloader: &MockArchiveDownloader{}, Config: &config.Config{}})
+		if err := cli.Run([]string{"bitbucket:workspace", "/target"}); !errors.Is(err, bitbucket.ErrInvalidURL) {
+			t.Errorf("Expected ErrInvalidURL, got %v", err)
+		}
+		if errorCode(bitbucket.ErrInvalidURL) != "invalid_source" {
+			t.Errorf("Expected invalid_source for a malformed Bitbucket source")
+		}
+	})
+}
+
+func TestCLI_Gitea(t *testing.T) {
+	cfg := &config.Config{Hosts: map[string]config.HostConfig{
+		"git.corp.example": {Provider: config.ProviderForgejo, Alias: "forge"},
+	}}
+
+	tests := []struct {
+		name   string
+		source string
+		host   string
+	}{
+		{name: "Forgejo host", source: "forgejo@git.corp.example:tools/scripts@v2/bin", host: "git.corp.example"},
+		{name: "Forgejo alias", source: "forge:tools/scripts@v2/bin", host: "git.corp.example"},
+		{name: "Public Gitea", source: "gitea:tools/scripts@v2/bin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zip := &MockArchiveDownloader{}
+			cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), ArchiveDownloader: zip, Config: cfg})
+
+			if err := cli.Run([]string{"--method=zip", tt.source, "/target"}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if zip.Req.Owner != "tools" || zip.Req.Repo != "scripts" || zip.Req.Ref != "v2" || zip.Req.Path != "bin" {
+				t.Errorf("Unexpected request %+v", zip.Req)
+			}
+			if _, ok := zip.Req.Provider.(*gitea.Client); !ok {
+				t.Errorf("Expected a Gitea archive provider, got %T", zip.Req.Provider)
+			}
+		})
+	}
+
+	t.Run("Invalid host", func(t *testing.T) {
+		cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), ArchiveDownloader: &MockArchiveDownloader{}, Config: cfg})
+		if err := cli.Run([]string{"gitea@:tools/scripts", "/target"}); !errors.Is(err, gitea.ErrInvalidURL) {
+			t.Errorf("Expected ErrInvalidURL, got %v", err)
+		}
+	})
+}
+
+func TestCLI_GitRemote(t *testing.T) {
+	t.Run("Directories come through the protocol", func(t *testing.T) {
+		api := &MockDownloader{}
+		zip := &MockArchiveDownloader{}
+		cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), Downloader: api, ArchiveDownloader: zip, Config: &config.Config{}})
+
+		if err := cli.Run([]string{"git+https://git.example.com/team/tools.git@v1//ci", "/target"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if zip.Called {
+			t.Errorf("Expected no archive download, got %+v", zip.Req)
+		}
+		if api.Source == nil || api.Source.Provider != git.Scheme || api.Source.Repo != "tools.git" || api.Source.Path != "ci" || api.Source.Ref != "v1" {
+			t.Errorf("Unexpected API source %+v", api.Source)
+		}
+	})
+
+	t.Run("Archive methods rejected", func(t *testing.T) {
+		cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), Downloader: &MockDownloader{}, ArchiveDownloader: &MockArchiveDownloader{}, Config: &config.Config{}})
+		if err := cli.Run([]string{"--method=tar", "git+https://git.example.com/tools.git", "/target"}); !errors.Is(err, ErrInvalidArgs) {
+			t.Errorf("Expected ErrInvalidArgs, got %v", err)
+		}
+	})
+
+	t.Run("Invalid source", func(t *testing.T) {
+		cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), ArchiveDownloader: &MockArchiveDownloader{}, Config: &config.Config{}})
+		if err := cli.Run([]string{"git+https://git.example.com/", "/target"}); !errors.Is(err, git.ErrInvalidURL) {
+			t.Errorf("Expected ErrInvalidURL, got %v", err)
+		}
+		if errorCode(fmt.Errorf("fetch: %w", git.ErrProtocol)) != "download_failed" {
+			t.Errorf("Expected download_failed for protocol errors")
+		}
+	})
+}
+
+func TestCLI_Gist(t *testing.T) {
+	const id = "aa5a315d61ae9438b18d"
+
+	t.Run("All files through the API", func(t *testing.T) {
+		api := &MockDownloader{}
+		zip := &MockArchiveDownloader{}
+		cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), Downloader: api, ArchiveDownloader: zip, Config: &config.Config{}})
+
+		if err := cli.Run([]string{"--overwrite", "gist:" + id, "/target"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if zip.Called {
+			t.Errorf("Expected no archive download, got %+v", zip.Req)
+		}
+		if api.Source == nil || api.Source.Provider != gist.Scheme || api.Source.Repo != id || api.Source.Path != "" || !api.Opts.Overwrite {
+			t.Errorf("Unexpected API source %+v with %+v", api.Source, api.Opts)
+		}
+	})
+
+	t.Run("Named file to stdout", func(t *testing.T) {
+		api := &MockDownloader{}
+		cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), Downloader: api, RawDownloader: &MockDownloader{}, Config: &config.Config{}})
+
+		if err := cli.Run([]string{"gist:" + id + "@57a7f02/hello.py"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if api.Source == nil || api.Source.Path != "hello.py" || api.Source.Ref != "57a7f02" || !api.Opts.OutputToStdout {
+			t.Errorf("Unexpected API source %+v with %+v", api.Source, api.Opts)
+		}
+	})
+
+	t.Run("JSON output", func(t *testing.T) {
+		stdout := new(bytes.Buffer)
+		api := &MockDownloader{Err: fmt.Errorf("%w: gist %s", github.ErrRepositoryNotFound, id)}
+		cli := New(Options{Stdout: stdout, Stderr: new(bytes.Buffer), Downloader: api, ArchiveDownloader: &MockArchiveDownloader{}, Config: &config.Config{}})
+
+		if err := cli.Run([]string{"--output=json", "gist:" + id, "/target"}); !errors.Is(err, github.ErrRepositoryNotFound) {
+			t.Fatalf("Expected ErrRepositoryNotFound, got %v", err)
+		}
+		var result report.Result
+		if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+			t.Fatalf("Invalid JSON %q: %v", stdout.String(), err)
+		}
+		if result.Method != methodAPI || result.Error == nil || result.Error.Code != "not_found" {
+			t.Errorf("Unexpected result %+v", result)
+		}
+	})
+
+	t.Run("Archive methods rejected", func(t *testing.T) {
+		cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), Downloader: &MockDownloader{}, ArchiveDownloader: &MockArchiveDownloader{}, Config: &config.Config{}})
+		if err := cli.Run([]string{"--method=zip", "gist:" + id, "/target"}); !errors.Is(err, ErrInvalidArgs) {
+			t.Errorf("Expected ErrInvalidArgs, got %v", err)
+		}
+	})
+
+	t.Run("Invalid source", func(t *testing.T) {
+		cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), ArchiveDownloader: &MockArchiveDownloader{}, Config: &config.Config{}})
+		if err := cli.Run([]string{"gist:not-a-gist", "/target"}); !errors.Is(err, gist.ErrInvalidURL) {
+			t.Errorf("Expected ErrInvalidURL, got %v", err)
+		}
+		if errorCode(gist.ErrInvalidURL) != "invalid_source" {
+			t.Errorf("Expected invalid_source for a malformed gist source")
+		}
+	})
+}
+
+// createLocalSources lays out a checkout in dir, with a .git directory, and
+// returns it with a zip of it under a top-level directory and a flat tarball
+func createLocalSources(t *testing.T, dir string) (string, string, string) {
+	t.Helper()
+
+	files := []struct {
+		name    string
+		content string
+		mode    os.FileMode
+	}{
+		{"README.md", "# Local\n", 0644},
+		{"src/main.go", "package main\n", 0644},
+		{"bin/run.sh", "#!/bin/sh\n", 0755},
+	}
+
+	checkout := filepath.Join(dir, "repo")
+	if err := os.MkdirAll(filepath.Join(checkout, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(checkout, ".git", "HEAD"), []byte("ref: refs/heads/main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	zipBuf, tarBuf := new(bytes.Buffer), new(bytes.Buffer)
+	zw := zip.NewWriter(zipBuf)
+	gz := gzip.NewWriter(tarBuf)
+	tw := tar.NewWriter(gz)
+	for _, f := range files {
+		path := filepath.Join(checkout, filepath.FromSlash(f.name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(f.content), f.mode); err != nil {
+			t.Fatal(err)
+		}
+
+		w, err := zw.Create("repo-v1/" + f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(f.content))
+
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: f.name, Mode: int64(f.mode), Size: int64(len(f.content))}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(f.content))
+	}
+	zw.Close()
+	tw.Close()
+	gz.Close()
+
+	zipPath, tarPath := filepath.Join(dir, "repo.zip"), filepath.Join(dir, "repo.tar.gz")
+	if err := os.WriteFile(zipPath, zipBuf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(tarPath, tarBuf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return checkout, zipPath, tarPath
+}
+
+func TestCLI_LocalSources(t *testing.T) {
+	checkout, zipPath, tarPath := createLocalSources(t, t.TempDir())
+
+	run := func(args ...string) error {
+		cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), Config: &config.Config{}})
+		return cli.Run(args)
+	}
+
+	t.Run("Directory", func(t *testing.T) {
+		target := filepath.Join(t.TempDir(), "out")
+		if err := run("--verify", "file://"+checkout, target); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if content, err := os.ReadFile(filepath.Join(target, "src", "main.go")); err != nil || string(content) != "package main\n" {
+			t.Errorf("Unexpected src/main.go %q (%v)", content, err)
+		}
+		if info, err := os.Stat(filepath.Join(target, "bin", "run.sh")); err != nil || info.Mode().Perm()&0100 == 0 {
+			t.Errorf("Expected bin/run.sh to be executable (%v)", err)
+		}
+		if _, err := os.Stat(filepath.Join(target, ".git")); !os.IsNotExist(err) {
+			t.Errorf("Expected .git to be left out")
+		}
+		if m, err := manifest.Read(target); err != nil || len(m.Files) != 3 {
+			t.Errorf("Expected a manifest of 3 files, got %+v (%v)", m, err)
+		}
+
+		// Existing files are only replaced with --overwrite
+		if err := run("file://"+checkout+"//src", target+"/src"); err == nil {
+			t.Errorf("Expected a conflict with existing files")
+		}
+		if err := run("-f", "file://"+checkout+"//src", target+"/src"); err != nil {
+			t.Errorf("Unexpected error with --overwrite: %v", err)
+		}
+	})
+
+	t.Run("Zip archive", func(t *testing.T) {
+		target := filepath.Join(t.TempDir(), "out")
+		if err := run("--verify", zipPath+"//src", target); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(target, "main.go")); err != nil {
+			t.Errorf("Expected main.go under the archive's top-level directory: %v", err)
+		}
+		if _, err := manifest.Read(target); err != nil {
+			t.Errorf("Expected a manifest to be recorded: %v", err)
+		}
+	})
+
+	t.Run("Tarball file", func(t *testing.T) {
+		target := t.TempDir()
+		if err := run(tarPath+"//bin/run.sh", target); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if info, err := os.Stat(filepath.Join(target, "run.sh")); err != nil || info.Mode().Perm()&0100 == 0 {
+			t.Errorf("Expected run.sh to be extracted executable (%v)", err)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		target := t.TempDir()
+		if err := run("--method=tar", zipPath, target); !errors.Is(err, ErrInvalidArgs) {
+			t.Errorf("Expected ErrInvalidArgs for a mismatched method, got %v", err)
+		}
+		if err := run("--method=zip", "file://"+checkout, target); !errors.Is(err, ErrInvalidArgs) {
+			t.Errorf("Expected ErrInvalidArgs for an archive method on a directory, got %v", err)
+		}
+		if err := run(zipPath + "//README.md"); !errors.Is(err, ErrInvalidArgs) {
+			t.Errorf("Expected ErrInvalidArgs for stdout from an archive, got %v", err)
+		}
+		if err := run("file://relative/repo", target); !errors.Is(err, local.ErrInvalidPath) {
+			t.Errorf("Expected ErrInvalidPath, got %v", err)
+		}
+		if err := run("--require-pinned", "file://"+checkout, target); !errors.Is(err, github.ErrRefNotFound) {
+			t.Errorf("Expected ErrRefNotFound when pinning, got %v", err)
+		}
+	})
+}
+
+func TestCLI_ArchiveURLs(t *testing.T) {
+	digest := strings.Repeat("ab", 32)
+
+	t.Run("Format picks the method", func(t *testing.T) {
+		for _, tt := range []struct {
+			source string
+			tar    bool
+		}{
+			{"https://example.com/releases/v1/tools-1.0.zip//ci", false},
+			{"https://example.com/releases/v1/tools-1.0.tar.gz//ci", true},
+			{"https://example.com/releases/v1/tools-1.0.tar.xz//ci", true},
+		} {
+			zip := &MockArchiveDownloader{}
+			tar := &MockArchiveDownloader{}
+			cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), ArchiveDownloader: zip, TarDownloader: tar, Config: &config.Config{}})
+
+			if err := cli.Run([]string{"--strip-components=2", "--sha256=" + digest, tt.source, "/target"}); err != nil {
+				t.Fatalf("Unexpected error for %s: %v", tt.source, err)
+			}
+			used, unused := zip, tar
+			if tt.tar {
+				used, unused = tar, zip
+			}
+			if unused.Called || !used.Called {
+				t.Fatalf("Expected %s to be read by the other method", tt.source)
+			}
+			req := used.Req
+			if req.URL != strings.TrimSuffix(tt.source, "//ci") || req.Path != "ci" || req.Ref != "" || req.Provider != nil {
+				t.Errorf("Unexpected request %+v", req)
+			}
+			if req.StripComponents != 2 || req.SHA256 != digest {
+				t.Errorf("Expected strip and digest to be passed on, got %+v", req)
+			}
+		}
+	})
+
+	t.Run("Local archive", func(t *testing.T) {
+		_, _, tarPath := createLocalSources(t, t.TempDir())
+		data, err := os.ReadFile(tarPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(data)
+
+		target := filepath.Join(t.TempDir(), "out")
+		cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), Config: &config.Config{}})
+		if err := cli.Run([]string{"--strip-components=1", "--sha256=" + hex.EncodeToString(sum[:]), tarPath, target}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(target, "main.go")); err != nil {
+			t.Errorf("Expected main.go with src/ stripped: %v", err)
+		}
+
+		stdout := new(bytes.Buffer)
+		cli = New(Options{Stdout: stdout, Stderr: new(bytes.Buffer), Config: &config.Config{}})
+		err = cli.Run([]string{"--output=json", "--sha256=" + digest, tarPath, filepath.Join(t.TempDir(), "out")})
+		if !errors.Is(err, downloader.ErrIntegrityMismatch) {
+			t.Fatalf("Expected ErrIntegrityMismatch, got %v", err)
+		}
+		if !strings.Contains(stdout.String(), `"integrity_mismatch"`) {
+			t.Errorf("Expected integrity_mismatch code, got %s", stdout.String())
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			args   []string
+			expect error
+		}{
+			{"Digest too short", []string{"--sha256=abc", "https://example.com/tools.zip", "/target"}, ErrInvalidArgs},
+			{"Digest not hex", []string{"--sha256=" + strings.Repeat("zz", 32), "https://example.com/tools.zip", "/target"}, ErrInvalidArgs},
+			{"Negative strip", []string{"--strip-components=-1", "https://example.com/tools.zip", "/target"}, ErrInvalidArgs},
+			{"Digest for a repository", []string{"--sha256=" + digest, "github:owner/repo", "/target"}, ErrInvalidArgs},
+			{"Strip for a repository", []string{"--strip-components=1", "gitlab:group/project", "/target"}, ErrInvalidArgs},
+			{"Mismatched method", []string{"--method=zip", "https://example.com/tools.tar.xz", "/target"}, ErrInvalidArgs},
+			{"Stdout", []string{"https://example.com/tools.zip//README.md"}, ErrInvalidArgs},
+			{"Pinning", []string{"--require-pinned", "https://example.com/tools.zip", "/target"}, ErrInvalidArgs},
+			{"Query string", []string{"https://example.com/download?file=tools.zip", "/target"}, archive.ErrInvalidURL},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				zip := &MockArchiveDownloader{}
+				cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), ArchiveDownloader: zip, TarDownloader: zip, Config: &config.Config{}})
+				if err := cli.Run(tt.args); !errors.Is(err, tt.expect) {
+					t.Errorf("Expected %v, got %v", tt.expect, err)
+				}
+				if zip.Called {
+					t.Errorf("Expected nothing to be downloaded")
+				}
+			})
+		}
+	})
+}
+
+func TestCLI_InvalidSymlinks(t *testing.T) {
+	cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer)})
+
+	err := cli.Run([]string{"--symlinks=copy", "github:owner/repo"})
+	if !errors.Is(err, ErrInvalidArgs) {
+		t.Errorf("Expected ErrInvalidArgs, got %v", err)
+	}
+}
+
+func TestCLI_ReleaseAssets(t *testing.T) {
+	t.Run("Routed to the release downloader", func(t *testing.T) {
+		release := &MockDownloader{}
+		zip := &MockArchiveDownloader{}
+		cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), ReleaseDownloader: release, ArchiveDownloader: zip, TarDownloader: zip, Config: &config.Config{}})
+
+		if err := cli.Run([]string{"--checksums=checksums.txt", "--extract", "github:owner/tools@v1.2.3#asset=tools-*.tar.gz", "./bin"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if release.Source == nil || release.Source.Asset != "tools-*.tar.gz" || release.Source.Ref != "v1.2.3" || release.Target != "./bin" {
+			t.Errorf("Unexpected release download %+v to %q", release.Source, release.Target)
+		}
+		if zip.Called {
+			t.Errorf("Expected no archive download")
+		}
+	})
+
+	t.Run("Latest release into the current directory", func(t *testing.T) {
+		release := &MockDownloader{}
+		cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), ReleaseDownloader: release, Config: &config.Config{}})
+
+		if err := cli.Run([]string{"github:owner/tools#asset=checksums.txt"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if release.Source.Ref != "" || release.Target != "." || release.Opts.OutputToStdout {
+			t.Errorf("Unexpected release download %+v to %q", release.Source, release.Target)
+		}
+	})
+
+	t.Run("JSON output", func(t *testing.T) {
+		stdout := new(bytes.Buffer)
+		release := &MockDownloader{Err: fmt.Errorf("%w: no asset matches", github.ErrAssetNotFound)}
+		cli := New(Options{Stdout: stdout, Stderr: new(bytes.Buffer), ReleaseDownloader: release, Config: &config.Config{}})
+
+		err := cli.Run([]string{"--output=json", "github:owner/tools@v1#asset=*.zip", "./bin"})
+		if !errors.Is(err, github.ErrAssetNotFound) {
+			t.Fatalf("Expected ErrAssetNotFound, got %v", err)
+		}
+		var result report.Result
+		if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+			t.Fatalf("Invalid JSON %q: %v", stdout.String(), err)
+		}
+		if result.Method != methodRelease || result.Error == nil || result.Error.Code != "not_found" {
+			t.Errorf("Unexpected result %+v", result)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		tests := []struct {
+			name string
+			args []string
+		}{
+			{"Checksums for a repository", []string{"--checksums=checksums.txt", "github:owner/tools", "./bin"}},
+			{"Extract for a repository", []string{"--extract", "github:owner/tools", "./bin"}},
+			{"Pinned", []string{"--require-pinned", "github:owner/tools@v1#asset=tools.zip", "./bin"}},
+			{"Method", []string{"--method=zip", "github:owner/tools@v1#asset=tools.zip", "./bin"}},
+			{"Gitea", []string{"gitea@git.example.com:owner/tools#asset=tools.zip", "./bin"}},
+			{"Bitbucket", []string{"bitbucket:owner/tools#asset=tools.zip", "./bin"}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				release := &MockDownloader{}
+				cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), ReleaseDownloader: release, Config: &config.Config{}})
+				if err := cli.Run(tt.args); !errors.Is(err, ErrInvalidArgs) {
+					t.Errorf("Expected ErrInvalidArgs, got %v", err)
+				}
+				if release.Source != nil {
+					t.Errorf("Expected nothing to be downloaded")
+				}
+			})
+		}
+	})
+}
+
+func TestCLI_PullRefs(t *testing.T) {
+	const commit = "89abcdef0123456789abcdef0123456789abcdef"
+
+	t.Run("Head is pinned", func(t *testing.T) {
+		stdout := new(bytes.Buffer)
+		zip := &MockArchiveDownloader{}
+		resolver := &MockResolver{Kind: github.RefPull, Commit: commit}
+		cli := New(Options{Stdout: stdout, Stderr: new(bytes.Buffer), ArchiveDownloader: zip, Resolver: resolver, Config: &config.Config{}})
+
+		if err := cli.Run([]string{"--output=json", "--method=zip", "github:owner/repo@pr/123/docs", "/target"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if resolver.Ref != "pr/123" {
+			t.Errorf("Expected pr/123 to be resolved, got %q", resolver.Ref)
+		}
+		if zip.Req == nil || zip.Req.Ref != commit || zip.Req.Path != "docs" {
+			t.Fatalf("Expected download of docs at %s, got %+v", commit, zip.Req)
+		}
+
+		var result report.Result
+		if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+			t.Fatalf("Invalid JSON output: %v", err)
+		}
+		if result.Ref != "pr/123" || result.Commit != commit {
+			t.Errorf("Expected ref pr/123 at %s, got ref %q commit %q", commit, result.Ref, result.Commit)
+		}
+	})
+
+	t.Run("Not pinned", func(t *testing.T) {
+		zip := &MockArchiveDownloader{}
+		resolver := &MockResolver{Kind: github.RefPull, Commit: commit}
+		cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), ArchiveDownloader: zip, Resolver: resolver, Config: &config.Config{}})
+
+		err := cli.Run([]string{"--require-pinned", "--method=zip", "github:owner/repo@pr/123/merge", "/target"})
+		if !errors.Is(err, ErrUnpinnedRef) {
+			t.Fatalf("Expected ErrUnpinnedRef, got %v", err)
+		}
+		if resolver.Ref != "pr/123/merge" || zip.Called {
+			t.Errorf("Expected pr/123/merge resolved and nothing downloaded, got %q", resolver.Ref)
+		}
+	})
+
+	t.Run("Compare range needs diff", func(t *testing.T) {
+		api := &MockDownloader{}
+		cli := New(Options{Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer), Downloader: api, Config: &config.Config{}})
+		if err := cli.Run([]string{"github:owner/repo@v1..v2", "/target"}); !errors.Is(err, ErrInvalidArgs) {
+			t.Errorf("Expected ErrInvalidArgs, got %v", err)
+		}
+		if api.Source != nil {
+			t.Errorf("Expected nothing to be downloaded, got %+v", api.Source)
+		}
+	})
+
+	if errorCode(fmt.Errorf("%w: pull request 7", github.ErrNoMergeCommit)) != "not_found" {
+		t.Errorf("Expected not_found for a pull request without a merge commit")
+	}
+}
+
+// refTrees writes the files of the tree at the ref asked for
+type refTrees map[string]map[string]string
+
+// Download implements the Downloader interface
+func (r refTrees) Download(ctx context.Context, source *github.GitHubSource, target string, opts downloader.DownloadOptions) error {
+	tree, ok := r[source.Ref]
+	if !ok {
+		return fmt.Errorf("%w: %s", github.ErrRefNotFound, source.Ref)
+	}
+
+	found := false
+	for name, content := range tree {
+		rel, ok := strings.CutPrefix(name, source.Path)
+		if !ok {
+			continue
+		}
+		found = true
+		dest := filepath.Join(target, filepath.FromSlash(rel))
+		if source.IsFile {
+			dest = target
+		}
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(dest, []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", github.ErrFileNotFound, source.Path)
+	}
+	return nil
+}
+
+func TestCLI_Diff(t *testing.T) {
+	trees := refTrees{
+		"v1": {"docs/index.md": "# Docs\nold\n", "docs/gone.md": "gone\n", "README.md": "readme\n"},
+		"v2": {"docs/index.md": "# Docs\nnew\n", "docs/added.md": "added\n", "README.md": "readme\n"},
+	}
+
+	run := func(args ...string) (string, error) {
+		stdout := new(bytes.Buffer)
+		cli := New(Options{Stdout: stdout, Stderr: new(bytes.Buffer), Downloader: trees, Config: &config.Config{}})
+		err := cli.Run(args)
+		return stdout.String(), err
+	}
+
+	t.Run("Directory", func(t *testing.T) {
+		out, err := run("diff", "--temp-dir="+t.TempDir(), "github:owner/repo@v1..v2/docs")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expect := "--- /dev/null\n+++ b/docs/added.md\n@@ -0,0 +1 @@\n+added\n" +
+			"--- a/docs/gone.md\n+++ /dev/null\n@@ -1 +0,0 @@\n-gone\n" +
+			"--- a/docs/index.md\n+++ b/docs/index.md\n@@ -1,2 +1,2 @@\n # Docs\n-old\n+new\n"
+		if out != expect {
+			t.Errorf("Expected:\n%s\ngot:\n%s", expect, out)
+		}
+	})
+
+	t.Run("File added", func(t *testing.T) {
+		out, err := run("diff", "github:owner/repo@v1..v2/docs/added.md")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if expect := "--- /dev/null\n+++ b/docs/added.md\n@@ -0,0 +1 @@\n+added\n"; out != expect {
+			t.Errorf("Expected:\n%s\ngot:\n%s", expect, out)
+		}
+	})
+
+	t.Run("No changes", func(t *testing.T) {
+		out, err := run("diff", "github:owner/repo@v1..v2/README.md")
+		if err != nil || out != "" {
+			t.Errorf("Expected no output, got %q (%v)", out, err)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			args   []string
+			expect error
+		}{
+			{"No range", []string{"diff", "github:owner/repo@v1/docs"}, ErrInvalidArgs},
+			{"Two sources", []string{"diff", "github:owner/repo@v1..v2", "/target"}, ErrInvalidArgs},
+			{"JSON output", []string{"diff", "--output=json", "github:owner/repo@v1..v2"}, ErrInvalidArgs},
+			{"Unknown ref", []string{"diff", "github:owner/repo@v1..v3/docs"}, github.ErrRefNotFound},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if _, err := run(tt.args...); !errors.Is(err, tt.expect) {
+					t.Errorf("Expected %v, got %v", tt.expect, err)
+				}
+			})
+		}
+	})
+}
@@ -1,40 +1,71 @@
 package cli
 
 import (
+	"archive/zip"
 	"bytes"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+	"xcp/internal/config"
 )
 
-// TestCLI_ZipDownloadIntegration tests the zip download functionality with a real (small) repository
-func TestCLI_ZipDownloadIntegration(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping integration test in short mode")
-	}
+// helloWorldREADME is the only file of the fake octocat/Hello-World
+const helloWorldREADME = "Hello World!\n"
+
+// newHelloWorldHost serves a copy of octocat/Hello-World through the
+// archive, contents and tree endpoints of a fake GitHub host, so the tests
+// below run the whole pipeline without the network
+func newHelloWorldHost(t *testing.T) *config.Config {
+	t.Helper()
 
-	// Create temporary directory for the test
-	tmpDir, err := os.MkdirTemp("", "xcp-integration-test")
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	fw, err := zw.Create("Hello-World-main/README")
 	if err != nil {
-		t.Fatalf("Failed to create temp dir: %v", err)
+		t.Fatal(err)
 	}
-	defer os.RemoveAll(tmpDir)
+	io.WriteString(fw, helloWorldREADME)
+	zw.Close()
+	archive := buf.Bytes()
+
+	return newFakeHost(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch path := r.URL.Path; {
+		case strings.HasPrefix(path, "/octocat/Hello-World/archive/") && strings.HasSuffix(path, ".zip"):
+			http.ServeContent(w, r, "Hello-World.zip", time.Time{}, bytes.NewReader(archive))
+		case path == "/api/v3/repos/octocat/Hello-World":
+			io.WriteString(w, `{"name": "Hello-World"}`)
+		case path == "/api/v3/repos/octocat/Hello-World/contents/":
+			io.WriteString(w, `[{"type": "file", "name": "README", "path": "README", "sha": "980a0d5f19a64b4b30a87d4206aade58726b60e3", "size": 13}]`)
+		case path == "/api/v3/repos/octocat/Hello-World/contents/README":
+			io.WriteString(w, helloWorldREADME)
+		case strings.HasPrefix(path, "/api/v3/repos/octocat/Hello-World/git/trees/"):
+			io.WriteString(w, `{"tree": [{"path": "README", "mode": "100644", "type": "blob", "sha": "980a0d5f19a64b4b30a87d4206aade58726b60e3", "size": 13}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
 
+// TestCLI_ZipDownloadIntegration tests the zip download functionality end to end
+func TestCLI_ZipDownloadIntegration(t *testing.T) {
 	stdout := new(bytes.Buffer)
 	stderr := new(bytes.Buffer)
 
-	// Test downloading a small public repository using zip method
+	// Test downloading a small repository using zip method
 	cli := New(Options{
 		Stdout: stdout,
 		Stderr: stderr,
+		Config: newHelloWorldHost(t),
 	})
 
-	// Use a small, stable repository for testing
-	// This repo should exist and be small to avoid test flakiness
-	targetPath := filepath.Join(tmpDir, "test-repo")
-	args := []string{"--method=zip", "--verbose", "github:octocat/Hello-World", targetPath}
+	targetPath := filepath.Join(t.TempDir(), "test-repo")
+	args := []string{"--method=zip", "--verbose", "fake:octocat/Hello-World", targetPath}
 
-	err = cli.Run(args)
+	err := cli.Run(args)
 	if err != nil {
 		t.Logf("stderr: %s", stderr.String())
 		t.Logf("stdout: %s", stdout.String())
@@ -62,38 +93,28 @@ func TestCLI_ZipDownloadIntegration(t *testing.T) {
 
 // TestCLI_ZipDownloadWithRef tests downloading from a specific branch/tag
 func TestCLI_ZipDownloadWithRef(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping integration test in short mode")
-	}
-
-	// Create temporary directory for the test
-	tmpDir, err := os.MkdirTemp("", "xcp-ref-test")
-	if err != nil {
-		t.Fatalf("Failed to create temp dir: %v", err)
-	}
-	defer os.RemoveAll(tmpDir)
-
 	stdout := new(bytes.Buffer)
 	stderr := new(bytes.Buffer)
 
 	cli := New(Options{
 		Stdout: stdout,
 		Stderr: stderr,
+		Config: newHelloWorldHost(t),
 	})
 
 	// Test with a specific branch/ref - using main branch explicitly
-	targetPath := filepath.Join(tmpDir, "test-repo-main")
-	args := []string{"--method=zip", "github:octocat/Hello-World@main", targetPath}
+	targetPath := filepath.Join(t.TempDir(), "test-repo-main")
+	args := []string{"--method=zip", "fake:octocat/Hello-World@main", targetPath}
 
-	err = cli.Run(args)
+	err := cli.Run(args)
 	if err != nil {
 		t.Logf("stderr: %s", stderr.String())
 		t.Fatalf("CLI run with ref failed: %v", err)
 	}
 
 	// Verify that files were downloaded
-	if _, err := os.Stat(targetPath); os.IsNotExist(err) {
-		t.Errorf("Target directory was not created")
+	if content, err := os.ReadFile(filepath.Join(targetPath, "README")); err != nil || string(content) != helloWorldREADME {
+		t.Errorf("Unexpected README %q (%v)", content, err)
 	}
 
 	t.Logf("Successfully downloaded with ref @main")
@@ -101,38 +122,28 @@ func TestCLI_ZipDownloadWithRef(t *testing.T) {
 
 // TestCLI_APIFallback tests the API fallback method
 func TestCLI_APIFallback(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping integration test in short mode")
-	}
-
-	// Create temporary directory for the test
-	tmpDir, err := os.MkdirTemp("", "xcp-api-test")
-	if err != nil {
-		t.Fatalf("Failed to create temp dir: %v", err)
-	}
-	defer os.RemoveAll(tmpDir)
-
 	stdout := new(bytes.Buffer)
 	stderr := new(bytes.Buffer)
 
 	cli := New(Options{
 		Stdout: stdout,
 		Stderr: stderr,
+		Config: newHelloWorldHost(t),
 	})
 
-	// Test using API method explicitly
-	targetPath := filepath.Join(tmpDir, "test-repo-api")
-	args := []string{"--method=api", "github:octocat/Hello-World", targetPath}
+	// Test using API method explicitly, checking every file
+	targetPath := filepath.Join(t.TempDir(), "test-repo-api")
+	args := []string{"--method=api", "--verify", "fake:octocat/Hello-World", targetPath}
 
-	err = cli.Run(args)
+	err := cli.Run(args)
 	if err != nil {
 		t.Logf("stderr: %s", stderr.String())
 		t.Fatalf("CLI run with API method failed: %v", err)
 	}
 
 	// Verify that files were downloaded
-	if _, err := os.Stat(targetPath); os.IsNotExist(err) {
-		t.Errorf("Target directory was not created")
+	if content, err := os.ReadFile(filepath.Join(targetPath, "README")); err != nil || string(content) != helloWorldREADME {
+		t.Errorf("Unexpected README %q (%v)", content, err)
 	}
 
 	t.Logf("Successfully downloaded with API method")
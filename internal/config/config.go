@@ -0,0 +1,205 @@
+// Package config reads the user's xcp configuration, which describes the
+// hosts sources may name: their provider, tokens, CA bundles and aliases
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"xcp/internal/archive"
+	"xcp/internal/bitbucket"
+	"xcp/internal/gist"
+	"xcp/internal/git"
+	"xcp/internal/gitea"
+	"xcp/internal/github"
+	"xcp/internal/gitlab"
+	"xcp/internal/local"
+)
+
+// EnvPath names the environment variable that overrides the config file location
+const EnvPath = "XCP_CONFIG"
+
+var ErrInvalidConfig = errors.New("invalid configuration")
+
+// Providers a host may run, as named in the config file and source schemes
+const (
+	ProviderGitHub    = "github"
+	ProviderGitLab    = gitlab.Scheme
+	ProviderBitbucket = bitbucket.Scheme
+	ProviderGitea     = gitea.Scheme
+	ProviderForgejo   = gitea.ForgejoScheme
+	ProviderGit       = git.Scheme
+	ProviderFile      = local.Scheme
+	ProviderArchive   = archive.Scheme
+	ProviderGist      = gist.Scheme
+)
+
+// HostConfig configures access to a single host
+type HostConfig struct {
+	// Provider is the service the host runs: github (the default), gitlab,
+	// gitea or forgejo
+	Provider string `json:"provider,omitempty"`
+	// Alias lets sources write "alias:owner/repo" for the host
+	Alias string `json:"alias,omitempty"`
+	// Token authenticates requests; TokenEnv names a variable holding it instead
+	Token    string `json:"token,omitempty"`
+	TokenEnv string `json:"token_env,omitempty"`
+	// CAFile is a PEM bundle trusted in addition to the system roots
+	CAFile string `json:"ca_file,omitempty"`
+}
+
+// Config is the contents of the config file
+type Config struct {
+	Hosts map[string]HostConfig `json:"hosts,omitempty"`
+}
+
+// Path returns where the config file is read from: $XCP_CONFIG, or
+// xcp/config.json in the user's config directory
+func Path() (string, error) {
+	if path := os.Getenv(EnvPath); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "xcp", "config.json"), nil
+}
+
+// Load reads the config file at path. A missing file is an empty config.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, path, err)
+	}
+	return &cfg, nil
+}
+
+// validate rejects aliases that are ambiguous or shadow a source scheme
+func (c *Config) validate() error {
+	seen := make(map[string]string)
+	for name, host := range c.Hosts {
+		if name == "" || strings.ContainsAny(name, "/:@") {
+			return fmt.Errorf("invalid host name %q", name)
+		}
+		switch host.Provider {
+		case "", ProviderGitHub, ProviderGitLab, ProviderGitea, ProviderForgejo:
+		default:
+			return fmt.Errorf("unknown provider %q for %s", host.Provider, name)
+		}
+
+		alias := host.Alias
+		if alias == "" {
+			continue
+		}
+		if isProvider(alias) || strings.ContainsAny(alias, "/:@") {
+			return fmt.Errorf("invalid alias %q for %s", alias, name)
+		}
+		if other, ok := seen[alias]; ok {
+			return fmt.Errorf("alias %q is used by both %s and %s", alias, other, name)
+		}
+		seen[alias] = name
+	}
+	return nil
+}
+
+// isProvider reports whether name is a provider, and so a source scheme
+func isProvider(name string) bool {
+	switch name {
+	case ProviderGitHub, ProviderGitLab, ProviderBitbucket, ProviderGitea, ProviderForgejo, ProviderFile, ProviderArchive, ProviderGist:
+		return true
+	}
+	return false
+}
+
+// Expand rewrites a source naming a host by its alias, "alias:owner/repo",
+// to the "provider@host:owner/repo" form. Other sources are returned as is.
+func (c *Config) Expand(source string) string {
+	alias, rest, ok := strings.Cut(source, ":")
+	if !ok || alias == "" {
+		return source
+	}
+	for name, host := range c.Hosts {
+		if host.Alias == alias {
+			return host.provider() + "@" + name + ":" + rest
+		}
+	}
+	return source
+}
+
+// provider returns the provider the host runs
+func (hc HostConfig) provider() string {
+	if hc.Provider == "" {
+		return ProviderGitHub
+	}
+	return hc.Provider
+}
+
+// Host returns the named host of provider with its token and CA bundle
+// filled in. An empty name is the provider's public instance. Without a
+// configured token the provider's default variable is consulted:
+// GITHUB_TOKEN for github.com, GH_ENTERPRISE_TOKEN for other GitHub hosts,
+// GITLAB_TOKEN for GitLab, BITBUCKET_TOKEN for Bitbucket Cloud, and
+// GITEA_TOKEN or FORGEJO_TOKEN for Gitea and Forgejo. Gists are read from
+// github.com like repositories. Git remotes and archive servers only use
+// configured tokens.
+func (c *Config) Host(provider, name string) github.Host {
+	var host github.Host
+	switch provider {
+	case ProviderGitLab:
+		host = gitlab.NewHost(name)
+	case ProviderBitbucket:
+		host = bitbucket.NewHost()
+	case ProviderGitea, ProviderForgejo:
+		host = gitea.NewHost(provider, name)
+	case ProviderGit:
+		host = git.NewHost(name)
+	case ProviderArchive:
+		host = archive.NewHost(name)
+	case ProviderFile:
+		// Local sources are never fetched from a host
+		return github.Host{}
+	default:
+		host = github.NewHost(name)
+	}
+	hc := c.Hosts[host.Name]
+
+	host.CAFile = hc.CAFile
+	host.Token = hc.Token
+	if host.Token == "" && hc.TokenEnv != "" {
+		host.Token = os.Getenv(hc.TokenEnv)
+	}
+	if host.Token == "" {
+		switch {
+		case provider == ProviderGitLab:
+			host.Token = os.Getenv("GITLAB_TOKEN")
+		case provider == ProviderBitbucket:
+			host.Token = os.Getenv("BITBUCKET_TOKEN")
+		case provider == ProviderGitea:
+			host.Token = os.Getenv("GITEA_TOKEN")
+		case provider == ProviderForgejo:
+			host.Token = os.Getenv("FORGEJO_TOKEN")
+		case provider == ProviderGit, provider == ProviderArchive:
+			// Plain git and file servers have no conventional variable
+		case host.IsPublic():
+			host.Token = os.Getenv("GITHUB_TOKEN")
+		default:
+			host.Token = os.Getenv("GH_ENTERPRISE_TOKEN")
+		}
+	}
+	return host
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeConfig writes content to a config file in a temporary directory
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     error
+	}{
+		{name: "Hosts with aliases", content: `{"hosts":{"git.corp.example":{"alias":"corp"},"ghe.example":{"alias":"ghe"}}}`},
+		{name: "Malformed JSON", content: `{"hosts":`, err: ErrInvalidConfig},
+		{name: "Alias shadows github", content: `{"hosts":{"git.corp.example":{"alias":"github"}}}`, err: ErrInvalidConfig},
+		{name: "Duplicate alias", content: `{"hosts":{"a.example":{"alias":"corp"},"b.example":{"alias":"corp"}}}`, err: ErrInvalidConfig},
+		{name: "Host with path", content: `{"hosts":{"git.corp.example/api":{}}}`, err: ErrInvalidConfig},
+		{name: "GitLab host", content: `{"hosts":{"gitlab.corp.example":{"provider":"gitlab","alias":"glc"}}}`},
+		{name: "Alias shadows bitbucket", content: `{"hosts":{"git.corp.example":{"alias":"bitbucket"}}}`, err: ErrInvalidConfig},
+		{name: "Forgejo host", content: `{"hosts":{"git.corp.example":{"provider":"forgejo","alias":"forge"}}}`},
+		{name: "Alias shadows gitea", content: `{"hosts":{"git.corp.example":{"alias":"gitea"}}}`, err: ErrInvalidConfig},
+		{name: "Alias shadows file", content: `{"hosts":{"git.corp.example":{"alias":"file"}}}`, err: ErrInvalidConfig},
+		{name: "Alias shadows https", content: `{"hosts":{"git.corp.example":{"alias":"https"}}}`, err: ErrInvalidConfig},
+		{name: "Alias shadows gist", content: `{"hosts":{"git.corp.example":{"alias":"gist"}}}`, err: ErrInvalidConfig},
+		{name: "Unknown provider", content: `{"hosts":{"git.corp.example":{"provider":"svn"}}}`, err: ErrInvalidConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, tt.content))
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Expected error %v, got %v", tt.err, err)
+			}
+		})
+	}
+
+	cfg, err := Load(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil || len(cfg.Hosts) != 0 {
+		t.Errorf("Expected an empty config for a missing file, got %+v, %v", cfg, err)
+	}
+}
+
+func TestConfig_Expand(t *testing.T) {
+	cfg := &Config{Hosts: map[string]HostConfig{
+		"git.corp.example":    {Alias: "corp"},
+		"gitlab.corp.example": {Alias: "glc", Provider: ProviderGitLab},
+		"forge.corp.example":  {Alias: "forge", Provider: ProviderForgejo},
+	}}
+
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{source: "corp:platform/tools@v1/bin", want: "github@git.corp.example:platform/tools@v1/bin"},
+		{source: "glc:group/sub/project@main", want: "gitlab@gitlab.corp.example:group/sub/project@main"},
+		{source: "forge:tools/scripts@v2", want: "forgejo@forge.corp.example:tools/scripts@v2"},
+		{source: "github:owner/repo", want: "github:owner/repo"},
+		{source: "other:owner/repo", want: "other:owner/repo"},
+		{source: "./local", want: "./local"},
+	}
+
+	for _, tt := range tests {
+		if got := cfg.Expand(tt.source); got != tt.want {
+			t.Errorf("Expand(%q) = %q, want %q", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestConfig_Host(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "public-token")
+	t.Setenv("GH_ENTERPRISE_TOKEN", "enterprise-token")
+	t.Setenv("CORP_TOKEN", "corp-token")
+	t.Setenv("GITLAB_TOKEN", "gitlab-token")
+	t.Setenv("BITBUCKET_TOKEN", "bitbucket-token")
+	t.Setenv("FORGEJO_TOKEN", "forgejo-token")
+
+	cfg := &Config{Hosts: map[string]HostConfig{
+		"git.corp.example":    {TokenEnv: "CORP_TOKEN", CAFile: "/etc/ssl/corp.pem"},
+		"ghe.example":         {Token: "inline-token"},
+		"gitlab.corp.example": {Provider: ProviderGitLab, Token: "self-managed-token"},
+		"bitbucket.org":       {CAFile: "/etc/ssl/proxy.pem"},
+		"forge.corp.example":  {Provider: ProviderForgejo, TokenEnv: "CORP_TOKEN"},
+	}}
+
+	tests := []struct {
+		name     string
+		provider string
+		host     string
+		token    string
+		caFile   string
+		api      string
+	}{
+		{name: "Public", host: "", token: "public-token", api: "https://api.github.com"},
+		{name: "Token from named variable", host: "git.corp.example", token: "corp-token", caFile: "/etc/ssl/corp.pem", api: "https://git.corp.example/api/v3"},
+		{name: "Inline token", host: "ghe.example", token: "inline-token", api: "https://ghe.example/api/v3"},
+		{name: "Unconfigured enterprise host", host: "other.example", token: "enterprise-token", api: "https://other.example/api/v3"},
+		{name: "GitLab", provider: ProviderGitLab, token: "gitlab-token", api: "https://gitlab.com/api/v4"},
+		{name: "Self-managed GitLab", provider: ProviderGitLab, host: "gitlab.corp.example", token: "self-managed-token", api: "https://gitlab.corp.example/api/v4"},
+		{name: "Bitbucket", provider: ProviderBitbucket, token: "bitbucket-token", caFile: "/etc/ssl/proxy.pem", api: "https://api.bitbucket.org/2.0"},
+		{name: "Self-hosted Forgejo", provider: ProviderForgejo, host: "forge.corp.example", token: "corp-token", api: "https://forge.corp.example/api/v1"},
+		{name: "Codeberg", provider: ProviderForgejo, token: "forgejo-token", api: "https://codeberg.org/api/v1"},
+		{name: "Archive server", provider: ProviderArchive, host: "git.corp.example", token: "corp-token", caFile: "/etc/ssl/corp.pem"},
+		{name: "Unconfigured archive server", provider: ProviderArchive, host: "files.example"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host := cfg.Host(tt.provider, tt.host)
+			if host.Token != tt.token || host.CAFile != tt.caFile || host.API != tt.api {
+				t.Errorf("Unexpected host %+v", host)
+			}
+		})
+	}
+}
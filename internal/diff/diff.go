@@ -0,0 +1,360 @@
+// Package diff compares two copies of a source, such as the base and head
+// of a pull request, and renders the changes between them as unified diffs
+package diff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// contextLines is the number of unchanged lines shown around changes
+	contextLines = 3
+	// maxEdits bounds the work spent on a file; files differing in more
+	// lines are shown as replaced in full
+	maxEdits = 2000
+	// binarySniffLen is how much of a file is checked for NUL bytes
+	binarySniffLen = 8000
+)
+
+// Status tells how a file changed
+type Status string
+
+const (
+	Added    Status = "added"
+	Deleted  Status = "deleted"
+	Modified Status = "modified"
+)
+
+// Change is a file that differs between the two copies
+type Change struct {
+	Path   string // Slash-separated, relative to the roots compared
+	Status Status
+}
+
+// Compare returns the files that differ between the directories base and
+// head, sorted by path. A root that does not exist holds no files.
+func Compare(base, head string) ([]Change, error) {
+	baseFiles, err := listFiles(base)
+	if err != nil {
+		return nil, err
+	}
+	headFiles, err := listFiles(head)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	for rel := range baseFiles {
+		if !headFiles[rel] {
+			changes = append(changes, Change{Path: rel, Status: Deleted})
+			continue
+		}
+		same, err := sameContent(filepath.Join(base, rel), filepath.Join(head, rel))
+		if err != nil {
+			return nil, err
+		}
+		if !same {
+			changes = append(changes, Change{Path: rel, Status: Modified})
+		}
+	}
+	for rel := range headFiles {
+		if !baseFiles[rel] {
+			changes = append(changes, Change{Path: rel, Status: Added})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// listFiles returns the slash-separated paths of the regular files and
+// symlinks under root
+func listFiles(root string) (map[string]bool, error) {
+	files := make(map[string]bool)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = true
+		return nil
+	})
+	return files, err
+}
+
+// sameContent reports whether the files at a and b hold the same bytes
+func sameContent(a, b string) (bool, error) {
+	aData, err := readFile(a)
+	if err != nil {
+		return false, err
+	}
+	bData, err := readFile(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(aData, bData), nil
+}
+
+// readFile returns the content of the file at p, or the target of the
+// symlink at p, as git shows links
+func readFile(p string) ([]byte, error) {
+	info, err := os.Lstat(p)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(p)
+		return []byte(target), err
+	}
+	return os.ReadFile(p)
+}
+
+// Write writes the unified diff of change to w, reading the file from under
+// base and head and labelling it with its path under prefix
+func Write(w io.Writer, base, head, prefix string, change Change) error {
+	var before, after []byte
+	var err error
+	if change.Status != Added {
+		if before, err = readFile(filepath.Join(base, filepath.FromSlash(change.Path))); err != nil {
+			return err
+		}
+	}
+	if change.Status != Deleted {
+		if after, err = readFile(filepath.Join(head, filepath.FromSlash(change.Path))); err != nil {
+			return err
+		}
+	}
+
+	name := path.Join(prefix, change.Path)
+	fromLabel, toLabel := "a/"+name, "b/"+name
+	if change.Status == Added {
+		fromLabel = "/dev/null"
+	}
+	if change.Status == Deleted {
+		toLabel = "/dev/null"
+	}
+
+	if isBinary(before) || isBinary(after) {
+		_, err := fmt.Fprintf(w, "Binary files %s and %s differ\n", fromLabel, toLabel)
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "--- %s\n+++ %s\n", fromLabel, toLabel); err != nil {
+		return err
+	}
+	return writeHunks(w, splitLines(before), splitLines(after))
+}
+
+// isBinary reports whether data looks like binary rather than text
+func isBinary(data []byte) bool {
+	if len(data) > binarySniffLen {
+		data = data[:binarySniffLen]
+	}
+	return bytes.IndexByte(data, 0) != -1
+}
+
+// splitLines splits data into lines that keep their newlines, so a last
+// line without one differs from the same line with one
+func splitLines(data []byte) []string {
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// op is a step of an edit script
+type op byte
+
+const (
+	opEqual  op = ' '
+	opDelete op = '-'
+	opInsert op = '+'
+)
+
+// edit is a line kept, deleted from the old lines or inserted from the new
+type edit struct {
+	op   op
+	line string
+}
+
+// editScript returns the shortest sequence of edits turning a into b, found
+// with Myers' algorithm. When more than maxEdits are needed, a is deleted
+// and b inserted in full instead.
+func editScript(a, b []string) []edit {
+	n, m := len(a), len(b)
+
+	// trace[d] holds, for each diagonal k in [-d, d], the furthest x
+	// reached with d-1 edits, indexed by k+d
+	var trace [][]int
+	v := []int{0, 0}
+	for d := 0; d <= n+m && d <= maxEdits; d++ {
+		next := make([]int, 2*d+3)
+		trace = append(trace, v)
+		at := func(k int) int { return v[k+d] }
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && at(k-1) < at(k+1)) {
+				x = at(k + 1)
+			} else {
+				x = at(k-1) + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			next[k+d+1] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b)
+			}
+		}
+		v = next
+	}
+
+	script := make([]edit, 0, n+m)
+	for _, line := range a {
+		script = append(script, edit{opDelete, line})
+	}
+	for _, line := range b {
+		script = append(script, edit{opInsert, line})
+	}
+	return script
+}
+
+// backtrack walks the furthest points recorded by editScript back from the
+// end of both inputs, recovering the edits that led there
+func backtrack(trace [][]int, a, b []string) []edit {
+	var script []edit
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		at := func(k int) int { return v[k+d] }
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX, prevY := 0, 0
+		if d > 0 {
+			prevX = at(prevK)
+			prevY = prevX - prevK
+		}
+
+		for x > prevX && y > prevY {
+			script = append(script, edit{opEqual, a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				script = append(script, edit{opInsert, b[y-1]})
+			} else {
+				script = append(script, edit{opDelete, a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(script)-1; i < j; i, j = i+1, j-1 {
+		script[i], script[j] = script[j], script[i]
+	}
+	return script
+}
+
+// writeHunks writes the changes between a and b as unified diff hunks with
+// contextLines of unchanged lines around them
+func writeHunks(w io.Writer, a, b []string) error {
+	script := editScript(a, b)
+
+	for start := 0; start < len(script); {
+		// Find the next change and the end of the hunk around it, which
+		// runs until more than twice the context separates two changes
+		first := start
+		for first < len(script) && script[first].op == opEqual {
+			first++
+		}
+		if first == len(script) {
+			return nil
+		}
+		last := first
+		for i := first; i < len(script); i++ {
+			if script[i].op != opEqual {
+				last = i
+			} else if i-last > 2*contextLines {
+				break
+			}
+		}
+
+		from := max(first-contextLines, start)
+		to := min(last+contextLines+1, len(script))
+
+		// Line numbers of the hunk in each file
+		aLine, bLine := 0, 0
+		for _, e := range script[:from] {
+			if e.op != opInsert {
+				aLine++
+			}
+			if e.op != opDelete {
+				bLine++
+			}
+		}
+		aCount, bCount := 0, 0
+		for _, e := range script[from:to] {
+			if e.op != opInsert {
+				aCount++
+			}
+			if e.op != opDelete {
+				bCount++
+			}
+		}
+
+		if _, err := fmt.Fprintf(w, "@@ -%s +%s @@\n", hunkRange(aLine, aCount), hunkRange(bLine, bCount)); err != nil {
+			return err
+		}
+		for _, e := range script[from:to] {
+			line := e.line
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n\\ No newline at end of file\n"
+			}
+			if _, err := fmt.Fprintf(w, "%c%s", e.op, line); err != nil {
+				return err
+			}
+		}
+		start = to
+	}
+	return nil
+}
+
+// hunkRange formats the range of a hunk that starts after line lines and
+// spans count lines
+func hunkRange(line, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", line)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", line+1)
+	}
+	return fmt.Sprintf("%d,%d", line+1, count)
+}
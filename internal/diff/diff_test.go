@@ -0,0 +1,166 @@
+package diff
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestCompare(t *testing.T) {
+	base := writeTree(t, map[string]string{
+		"README.md":  "readme\n",
+		"src/a.go":   "package a\n",
+		"src/old.go": "package old\n",
+	})
+	head := writeTree(t, map[string]string{
+		"README.md":  "readme\n",
+		"src/a.go":   "package a // changed\n",
+		"src/new.go": "package new\n",
+	})
+
+	changes, err := Compare(base, head)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expect := []Change{
+		{Path: "src/a.go", Status: Modified},
+		{Path: "src/new.go", Status: Added},
+		{Path: "src/old.go", Status: Deleted},
+	}
+	if !reflect.DeepEqual(changes, expect) {
+		t.Errorf("Expected %v, got %v", expect, changes)
+	}
+
+	t.Run("Missing root", func(t *testing.T) {
+		changes, err := Compare(filepath.Join(t.TempDir(), "missing"), head)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(changes) != 3 || changes[0].Status != Added {
+			t.Errorf("Expected every file added, got %v", changes)
+		}
+	})
+}
+
+func TestEditScript(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{"Equal", "a b c", "a b c"},
+		{"Empty to lines", "", "a b"},
+		{"Lines to empty", "a b", ""},
+		{"Insert", "a c", "a b c"},
+		{"Delete", "a b c", "a c"},
+		{"Replace", "a b c d", "a x c y"},
+		{"Reorder", "a b c a b b a", "c b a b a c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := strings.Fields(tt.a), strings.Fields(tt.b)
+			script := editScript(a, b)
+
+			// Replaying the script must turn a into b
+			var gotA, gotB []string
+			for _, e := range script {
+				if e.op != opInsert {
+					gotA = append(gotA, e.line)
+				}
+				if e.op != opDelete {
+					gotB = append(gotB, e.line)
+				}
+			}
+			if strings.Join(gotA, " ") != tt.a || strings.Join(gotB, " ") != tt.b {
+				t.Errorf("Script %v does not turn %q into %q", script, tt.a, tt.b)
+			}
+		})
+	}
+
+	t.Run("Shortest", func(t *testing.T) {
+		// The classic example from Myers' paper needs 5 edits
+		script := editScript(strings.Split("ABCABBA", ""), strings.Split("CBABAC", ""))
+		edits := 0
+		for _, e := range script {
+			if e.op != opEqual {
+				edits++
+			}
+		}
+		if edits != 5 {
+			t.Errorf("Expected 5 edits, got %d", edits)
+		}
+	})
+}
+
+func TestWrite(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 20; i++ {
+		lines = append(lines, "line "+strings.Repeat("x", i%3))
+	}
+	old := strings.Join(lines, "\n") + "\n"
+	lines[1] = "changed 2"
+	lines[17] = "changed 18"
+	changed := strings.Join(lines, "\n")
+
+	base := writeTree(t, map[string]string{"f.txt": old, "bin": "a\x00b", "gone.txt": "bye\n"})
+	head := writeTree(t, map[string]string{"f.txt": changed, "bin": "a\x00c", "new.txt": "hi\n"})
+
+	tests := []struct {
+		name   string
+		change Change
+		expect string
+	}{
+		{
+			name:   "Modified",
+			change: Change{Path: "f.txt", Status: Modified},
+			expect: "--- a/docs/f.txt\n+++ b/docs/f.txt\n" +
+				"@@ -1,5 +1,5 @@\n line x\n-line xx\n+changed 2\n line \n line x\n line xx\n" +
+				"@@ -15,6 +15,6 @@\n line \n line x\n line xx\n-line \n+changed 18\n line x\n-line xx\n+line xx\n\\ No newline at end of file\n",
+		},
+		{
+			name:   "Added",
+			change: Change{Path: "new.txt", Status: Added},
+			expect: "--- /dev/null\n+++ b/docs/new.txt\n@@ -0,0 +1 @@\n+hi\n",
+		},
+		{
+			name:   "Deleted",
+			change: Change{Path: "gone.txt", Status: Deleted},
+			expect: "--- a/docs/gone.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-bye\n",
+		},
+		{
+			name:   "Binary",
+			change: Change{Path: "bin", Status: Modified},
+			expect: "Binary files a/docs/bin and b/docs/bin differ\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Write(&out, base, head, "docs", tt.change); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if out.String() != tt.expect {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expect, out.String())
+			}
+		})
+	}
+}
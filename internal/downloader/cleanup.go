@@ -0,0 +1,73 @@
+package downloader
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// createdPaths records the files and directories written during a download so
+// that partial output can be removed if the download is cancelled. A nil
+// *createdPaths is valid and records nothing.
+type createdPaths struct {
+	paths []string
+}
+
+// add records a path created by the download
+func (c *createdPaths) add(path string) {
+	if c == nil {
+		return
+	}
+	c.paths = append(c.paths, path)
+}
+
+// mkdirAll behaves like os.MkdirAll but records every directory it creates
+func (c *createdPaths) mkdirAll(path string, perm os.FileMode) error {
+	var missing []string
+	for dir := filepath.Clean(path); ; dir = filepath.Dir(dir) {
+		if _, err := os.Lstat(dir); err == nil {
+			break
+		}
+		missing = append(missing, dir)
+		if parent := filepath.Dir(dir); parent == dir {
+			break
+		}
+	}
+
+	if err := os.MkdirAll(path, perm); err != nil {
+		return err
+	}
+
+	// Record parents before children so removal can run in reverse
+	for i := len(missing) - 1; i >= 0; i-- {
+		c.add(missing[i])
+	}
+	return nil
+}
+
+// removeAll deletes every recorded path, children before parents. Directories
+// that still contain files not created by this download are left in place.
+func (c *createdPaths) removeAll() {
+	if c == nil {
+		return
+	}
+	for i := len(c.paths) - 1; i >= 0; i-- {
+		os.Remove(c.paths[i])
+	}
+	c.paths = nil
+}
+
+// contextReader aborts reads once its context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read implements io.Reader
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
@@ -1,12 +1,17 @@
 package downloader
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"xcp/internal/github"
+	"xcp/internal/logger"
+	"xcp/internal/report"
 )
 
 var (
@@ -14,13 +19,15 @@ var (
 	ErrFailedToWriteFile  = errors.New("failed to write file")
 	ErrNoContentToWrite   = errors.New("no content to write")
 	ErrInvalidDestination = errors.New("invalid destination path")
+	ErrUnsafeName         = errors.New("unsafe file name in directory listing")
 )
 
 // GitHubClient interface for GitHub API operations
 type GitHubClient interface {
-	GetFileContent(owner, repo, path string) ([]byte, error)
-	GetDirectoryContents(owner, repo, path string) (github.DirectoryContents, error)
-	RepositoryExists(owner, repo string) (bool, error)
+	OpenFile(ctx context.Context, owner, repo, ref, path string) (io.ReadCloser, github.FileInfo, error)
+	GetDirectoryContents(ctx context.Context, owner, repo, ref, path string) (github.DirectoryContents, error)
+	GetTree(ctx context.Context, owner, repo, ref string) (*github.Tree, error)
+	RepositoryExists(ctx context.Context, owner, repo string) (bool, error)
 }
 
 // Downloader is responsible for downloading files from GitHub
@@ -28,12 +35,24 @@ type Downloader struct {
 	client GitHubClient
 	stdout io.Writer
 	stderr io.Writer
+	log    *logger.Logger
+	rec    report.Recorder
+
+	// blobs holds the tree entries known for the download in progress, by
+	// repository path, giving each file's mode and expected blob SHA. It is
+	// read from the tree of treeSource on first need; treeErr says why it
+	// could not be.
+	blobs      map[string]github.TreeEntry
+	treeSource *github.GitHubSource
+	treeErr    error
 }
 
 // DownloadOptions configures how files are downloaded
 type DownloadOptions struct {
 	OutputToStdout bool
 	Overwrite      bool
+	Mode           ModePolicy
+	Verify         bool // Fail any file that cannot be checked against its blob SHA
 }
 
 // NewDownloader creates a new Downloader
@@ -42,76 +61,154 @@ func NewDownloader(client GitHubClient, stdout, stderr io.Writer) *Downloader {
 		client: client,
 		stdout: stdout,
 		stderr: stderr,
+		log:    logger.New(stderr, logger.Normal),
+		rec:    report.Nop{},
 	}
 }
 
-// DownloadFile downloads a single file from GitHub
-func (d *Downloader) DownloadFile(source *github.GitHubSource, destPath string, opts DownloadOptions) error {
-	// Get file content from GitHub
-	content, err := d.client.GetFileContent(source.Owner, source.Repo, source.Path)
+// SetRecorder sets the recorder told about every file handled
+func (d *Downloader) SetRecorder(rec report.Recorder) {
+	d.rec = rec
+}
+
+// SetLogger sets the logger used for status and diagnostic output
+func (d *Downloader) SetLogger(l *logger.Logger) {
+	d.log = l
+}
+
+// DownloadFile downloads a single file from GitHub, streaming it straight to
+// the destination (or stdout) without buffering it in memory
+func (d *Downloader) DownloadFile(ctx context.Context, source *github.GitHubSource, destPath string, opts DownloadOptions) error {
+	return d.downloadFile(ctx, source, destPath, opts, nil)
+}
+
+func (d *Downloader) downloadFile(ctx context.Context, source *github.GitHubSource, destPath string, opts DownloadOptions, created *createdPaths) error {
+	// Open a stream over the file content from GitHub
+	d.log.Verbosef("Fetching %s/%s/%s via API", source.Owner, source.Repo, source.Path)
+	body, info, err := d.client.OpenFile(ctx, source.Owner, source.Repo, source.Ref, source.Path)
 	if err != nil {
 		return fmt.Errorf("failed to download file: %w", err)
 	}
+	defer body.Close()
+
+	// A file written to disk needs its mode from the tree, and a verified
+	// one its blob SHA
+	if !opts.OutputToStdout || opts.Verify {
+		d.loadBlobs(ctx)
+	}
+
+	// Check the content against the blob the tree or listing reported
+	var content io.Reader = &contextReader{ctx: ctx, r: body}
+	blob, known := d.blobs[source.Path]
+	if known && blob.Size < 0 {
+		// Services whose trees carry no sizes leave them to the response
+		blob.Size = info.Size
+	}
+	if known && blob.Sha != "" && blob.Size >= 0 {
+		content = newBlobReader(content, source.Path, blob)
+	} else if opts.Verify {
+		if d.treeErr != nil {
+			return fmt.Errorf("%w: %s: failed to read repository tree: %w", ErrUnverifiable, source.Path, d.treeErr)
+		}
+		return fmt.Errorf("%w: no blob SHA known for %s", ErrUnverifiable, source.Path)
+	}
 
+	hash := sha256.New()
 	if opts.OutputToStdout {
-		_, err := d.stdout.Write(content)
-		return err
+		n, err := io.Copy(io.MultiWriter(d.stdout, hash), content)
+		if err != nil {
+			return err
+		}
+		d.rec.File(report.File{Path: "-", Action: report.Written, Size: n, SHA256: hex.EncodeToString(hash.Sum(nil))})
+		return nil
 	}
 
 	// Create destination directory if it doesn't exist
 	destDir := filepath.Dir(destPath)
-	if err := os.MkdirAll(destDir, 0755); err != nil {
+	if err := created.mkdirAll(destDir, 0755); err != nil {
 		return fmt.Errorf("%w: %s: %v", ErrFailedToCreateDir, destDir, err)
 	}
 
 	// Check if file exists
-	if !opts.Overwrite {
-		if _, err := os.Stat(destPath); err == nil {
-			return fmt.Errorf("file already exists: %s", destPath)
-		}
+	_, statErr := os.Stat(destPath)
+	if statErr == nil && !opts.Overwrite {
+		return fmt.Errorf("file already exists: %s", destPath)
 	}
 
-	// Write file to destination
-	if err := os.WriteFile(destPath, content, 0644); err != nil {
-		return fmt.Errorf("%w: %s: %v", ErrFailedToWriteFile, destPath, err)
+	mode := os.FileMode(0644)
+	if blob.Mode == github.ExecutableMode {
+		mode = 0755
 	}
 
-	fmt.Fprintf(d.stderr, "Downloaded %s to %s\n", source.Path, destPath)
+	// Write file to a temporary name and rename it into place
+	n, err := writeFileAtomic(destPath, io.TeeReader(content, hash), opts.Mode.fileMode(mode))
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrFailedToWriteFile, destPath, err)
+	}
+
+	action := report.Overwritten
+	if os.IsNotExist(statErr) {
+		action = report.Written
+		created.add(destPath)
+	}
+	d.rec.File(report.File{Path: destPath, Action: action, Size: n, SHA256: hex.EncodeToString(hash.Sum(nil))})
+
+	d.log.Infof("Downloaded %s to %s", source.Path, destPath)
 	return nil
 }
 
 // DownloadDirectory recursively downloads a directory from GitHub
-func (d *Downloader) DownloadDirectory(source *github.GitHubSource, destPath string, opts DownloadOptions) error {
+func (d *Downloader) DownloadDirectory(ctx context.Context, source *github.GitHubSource, destPath string, opts DownloadOptions) error {
+	return d.downloadDirectory(ctx, source, destPath, opts, nil)
+}
+
+func (d *Downloader) downloadDirectory(ctx context.Context, source *github.GitHubSource, destPath string, opts DownloadOptions, created *createdPaths) error {
 	// Don't allow stdout for directories
 	if opts.OutputToStdout {
 		return errors.New("cannot output directory to stdout")
 	}
 
 	// Get directory contents from GitHub
-	contents, err := d.client.GetDirectoryContents(source.Owner, source.Repo, source.Path)
+	contents, err := d.client.GetDirectoryContents(ctx, source.Owner, source.Repo, source.Ref, source.Path)
 	if err != nil {
 		return fmt.Errorf("failed to list directory contents: %w", err)
 	}
+	d.loadBlobs(ctx)
 
 	// Create destination directory if it doesn't exist
-	if err := os.MkdirAll(destPath, 0755); err != nil {
+	if err := created.mkdirAll(destPath, 0755); err != nil {
 		return fmt.Errorf("%w: %s: %v", ErrFailedToCreateDir, destPath, err)
 	}
 
 	for _, item := range contents {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Listings come from the server; each name must stay a single
+		// entry of destPath
 		itemDestPath := filepath.Join(destPath, item.Name)
+		if filepath.Base(itemDestPath) != item.Name || !withinRoot(destPath, itemDestPath) {
+			return fmt.Errorf("%w: %q in %s", ErrUnsafeName, item.Name, source.Path)
+		}
 
 		switch item.Type {
 		case github.FileContent:
+			// Listings carry the blob SHA even when the tree was unavailable
+			if _, ok := d.blobs[item.Path]; !ok && item.Sha != "" && d.blobs != nil {
+				d.blobs[item.Path] = github.TreeEntry{Path: item.Path, Type: "blob", Sha: item.Sha, Size: int64(item.Size)}
+			}
+
 			// Create a new source for each file
 			fileSource := &github.GitHubSource{
 				Owner:  source.Owner,
 				Repo:   source.Repo,
 				Path:   item.Path,
+				Ref:    source.Ref,
 				IsFile: true,
 			}
 
-			if err := d.DownloadFile(fileSource, itemDestPath, opts); err != nil {
+			if err := d.downloadFile(ctx, fileSource, itemDestPath, opts, created); err != nil {
 				return err
 			}
 
@@ -121,52 +218,104 @@ func (d *Downloader) DownloadDirectory(source *github.GitHubSource, destPath str
 				Owner:  source.Owner,
 				Repo:   source.Repo,
 				Path:   item.Path,
+				Ref:    source.Ref,
 				IsFile: false,
 			}
 
-			if err := d.DownloadDirectory(dirSource, itemDestPath, opts); err != nil {
+			if err := d.downloadDirectory(ctx, dirSource, itemDestPath, opts, created); err != nil {
 				return err
 			}
 
 		default:
-			fmt.Fprintf(d.stderr, "Skipping unknown content type: %s for %s\n", item.Type, item.Path)
+			d.log.Warnf("skipping unknown content type: %s for %s", item.Type, item.Path)
+			d.rec.File(report.File{Path: itemDestPath, Action: report.Skipped, Size: int64(item.Size)})
 		}
 	}
 
 	return nil
 }
 
-// Download handles downloading either a file or directory based on the source
-func (d *Downloader) Download(source *github.GitHubSource, destPath string, opts DownloadOptions) error {
+// Download handles downloading either a file or directory based on the source.
+// If ctx is cancelled part-way through, any files and directories already
+// written by this call are removed.
+func (d *Downloader) Download(ctx context.Context, source *github.GitHubSource, destPath string, opts DownloadOptions) error {
 	// Validate destination path
 	if destPath == "" && !opts.OutputToStdout {
 		return ErrInvalidDestination
 	}
 
 	// Check if the repository exists
-	exists, err := d.client.RepositoryExists(source.Owner, source.Repo)
+	exists, err := d.client.RepositoryExists(ctx, source.Owner, source.Repo)
 	if err != nil {
 		return fmt.Errorf("failed to check repository: %w", err)
 	}
 
 	if !exists {
-		return fmt.Errorf("repository not found: %s/%s", source.Owner, source.Repo)
+		return fmt.Errorf("%w: %s/%s", github.ErrRepositoryNotFound, source.Owner, source.Repo)
+	}
+
+	// The contents API does not report file modes or hashes; the tree does,
+	// and is read once something needs it
+	d.treeSource = source
+	defer func() { d.blobs, d.treeSource, d.treeErr = nil, nil, nil }()
+
+	created := &createdPaths{}
+	err = d.download(ctx, source, destPath, opts, created)
+	if err != nil && ctx.Err() != nil {
+		created.removeAll()
+	}
+	return err
+}
+
+// loadBlobs reads the tree of the download in progress unless it has been
+// read already. A single file streamed to stdout without verification never
+// needs it, which saves a recursive tree request for what is otherwise one
+// request.
+func (d *Downloader) loadBlobs(ctx context.Context) {
+	if d.blobs == nil && d.treeSource != nil {
+		d.blobs, d.treeErr = d.loadTree(ctx, d.treeSource)
+	}
+}
+
+// loadTree returns the blobs in the tree of source's ref by path. Failing to
+// read the tree only costs the executable bits and the hashes of files not
+// found through a directory listing, unless the download is verified; the
+// error is returned along with an empty map.
+func (d *Downloader) loadTree(ctx context.Context, source *github.GitHubSource) (map[string]github.TreeEntry, error) {
+	blobs := make(map[string]github.TreeEntry)
+
+	tree, err := d.client.GetTree(ctx, source.Owner, source.Repo, source.Ref)
+	if err != nil {
+		d.log.Verbosef("Could not read repository tree (%v); executable bits will not be set", err)
+		return blobs, err
 	}
+	if tree.Truncated {
+		d.log.Verbosef("Repository tree is truncated; some executable bits may be missing")
+	}
+
+	for _, entry := range tree.Entries {
+		if entry.Type == "blob" {
+			blobs[entry.Path] = entry
+		}
+	}
+	return blobs, nil
+}
 
+func (d *Downloader) download(ctx context.Context, source *github.GitHubSource, destPath string, opts DownloadOptions, created *createdPaths) error {
 	// If path is empty, download the entire repository
 	if source.Path == "" {
-		return d.DownloadDirectory(source, destPath, opts)
+		return d.downloadDirectory(ctx, source, destPath, opts, created)
 	}
 
 	// Try to download as a file first
-	fileErr := d.DownloadFile(source, destPath, opts)
+	fileErr := d.downloadFile(ctx, source, destPath, opts, created)
 	if fileErr == nil {
 		return nil
 	}
 
 	// If it's not a file, try to download as a directory
 	if errors.Is(fileErr, github.ErrFileNotFound) {
-		return d.DownloadDirectory(source, destPath, opts)
+		return d.downloadDirectory(ctx, source, destPath, opts, created)
 	}
 
 	// Return the original error
@@ -2,6 +2,8 @@ package downloader
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -40,7 +42,7 @@ func TestDownloadFile(t *testing.T) {
 	destPath := filepath.Join(tempDir, "downloaded.txt")
 
 	// Download file
-	err := dl.DownloadFile(source, destPath, DownloadOptions{
+	err := dl.DownloadFile(context.Background(), source, destPath, DownloadOptions{
 		OutputToStdout: false,
 		Overwrite:      true,
 	})
@@ -63,7 +65,7 @@ func TestDownloadFile(t *testing.T) {
 	stdout.Reset()
 	stderr.Reset()
 
-	err = dl.DownloadFile(source, "", DownloadOptions{
+	err = dl.DownloadFile(context.Background(), source, "", DownloadOptions{
 		OutputToStdout: true,
 		Overwrite:      false,
 	})
@@ -84,7 +86,7 @@ func TestDownloadFile(t *testing.T) {
 		IsFile: true,
 	}
 
-	err = dl.DownloadFile(notFoundSource, destPath, DownloadOptions{})
+	err = dl.DownloadFile(context.Background(), notFoundSource, destPath, DownloadOptions{})
 	if err == nil {
 		t.Errorf("Expected error for non-existent file")
 	}
@@ -97,14 +99,14 @@ func TestDownloadFile(t *testing.T) {
 		IsFile: true,
 	}
 
-	err = dl.DownloadFile(unknownRepoSource, destPath, DownloadOptions{})
+	err = dl.DownloadFile(context.Background(), unknownRepoSource, destPath, DownloadOptions{})
 	if err == nil {
 		t.Errorf("Expected error for unknown repository")
 	}
 
 	// Test GitHub API failure
 	mockClient.FailGetFileContent = true
-	err = dl.DownloadFile(source, destPath, DownloadOptions{})
+	err = dl.DownloadFile(context.Background(), source, destPath, DownloadOptions{})
 	if err == nil {
 		t.Errorf("Expected error for GitHub API failure")
 	}
@@ -179,7 +181,7 @@ func TestDownloadDirectory(t *testing.T) {
 	tempDir := t.TempDir()
 
 	// Download directory
-	err := dl.DownloadDirectory(source, tempDir, DownloadOptions{
+	err := dl.DownloadDirectory(context.Background(), source, tempDir, DownloadOptions{
 		OutputToStdout: false, // Cannot output directory to stdout
 		Overwrite:      true,
 	})
@@ -218,13 +220,13 @@ func TestDownloadDirectory(t *testing.T) {
 		IsFile: false,
 	}
 
-	err = dl.DownloadDirectory(notFoundSource, tempDir, DownloadOptions{})
+	err = dl.DownloadDirectory(context.Background(), notFoundSource, tempDir, DownloadOptions{})
 	if err == nil {
 		t.Errorf("Expected error for non-existent directory")
 	}
 
 	// Test attempting to output directory to stdout
-	err = dl.DownloadDirectory(source, "", DownloadOptions{
+	err = dl.DownloadDirectory(context.Background(), source, "", DownloadOptions{
 		OutputToStdout: true,
 	})
 	if err == nil {
@@ -233,11 +235,24 @@ func TestDownloadDirectory(t *testing.T) {
 
 	// Test GitHub API failure
 	mockClient.FailGetDirContent = true
-	err = dl.DownloadDirectory(source, tempDir, DownloadOptions{})
+	err = dl.DownloadDirectory(context.Background(), source, tempDir, DownloadOptions{})
 	if err == nil {
 		t.Errorf("Expected error for GitHub API failure")
 	}
 	mockClient.FailGetDirContent = false
+
+	// Test names from the listing that would escape the target
+	for _, name := range []string{"..", "../../.bashrc", "sub/file", ""} {
+		mockClient.AddDirectory(owner, repo, "hostile", github.DirectoryContents{
+			{Type: github.FileContent, Name: name, Path: "hostile/x"},
+		})
+		mockClient.AddFile(owner, repo, "hostile/x", []byte("x"))
+		hostile := &github.GitHubSource{Owner: owner, Repo: repo, Path: "hostile"}
+		err = dl.DownloadDirectory(context.Background(), hostile, filepath.Join(tempDir, "hostile"), DownloadOptions{})
+		if !errors.Is(err, ErrUnsafeName) {
+			t.Errorf("Expected ErrUnsafeName for %q, got %v", name, err)
+		}
+	}
 }
 
 func TestDownload(t *testing.T) {
@@ -390,7 +405,7 @@ func TestDownload(t *testing.T) {
 			}
 
 			// Run the download
-			err := dl.Download(tt.source, destPath, tt.options)
+			err := dl.Download(context.Background(), tt.source, destPath, tt.options)
 
 			if tt.expectError && err == nil {
 				t.Errorf("Expected error, got nil")
@@ -408,3 +423,89 @@ func TestDownload(t *testing.T) {
 		})
 	}
 }
+
+func TestDownload_FileModes(t *testing.T) {
+	mockClient := xtest.NewMockGitHubClient()
+	mockClient.AddRepository("owner", "repo", true)
+	mockClient.AddDirectory("owner", "repo", "bin", github.DirectoryContents{
+		{Type: github.FileContent, Name: "run.sh", Path: "bin/run.sh"},
+		{Type: github.FileContent, Name: "notes.txt", Path: "bin/notes.txt"},
+	})
+	mockClient.AddFile("owner", "repo", "bin/run.sh", []byte("#!/bin/sh\n"))
+	mockClient.AddFile("owner", "repo", "bin/notes.txt", []byte("notes\n"))
+	mockClient.AddTree("owner", "repo", &github.Tree{Entries: []github.TreeEntry{
+		{Path: "bin/run.sh", Mode: github.ExecutableMode, Type: "blob"},
+		{Path: "bin/notes.txt", Mode: "100644", Type: "blob"},
+	}})
+
+	tests := []struct {
+		name   string
+		policy ModePolicy
+		run    os.FileMode
+		notes  os.FileMode
+	}{
+		{name: "Executable bit from tree", run: 0777 &^ umask(), notes: 0666 &^ umask()},
+		{name: "Override", policy: ModePolicy{Override: 0600}, run: 0600, notes: 0600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dl := NewDownloader(mockClient, new(bytes.Buffer), new(bytes.Buffer))
+			source := &github.GitHubSource{Owner: "owner", Repo: "repo", Path: "bin"}
+			dest := filepath.Join(t.TempDir(), "bin")
+
+			if err := dl.Download(context.Background(), source, dest, DownloadOptions{Mode: tt.policy}); err != nil {
+				t.Fatalf("Download unexpected error: %v", err)
+			}
+
+			for name, want := range map[string]os.FileMode{"run.sh": tt.run, "notes.txt": tt.notes} {
+				info, err := os.Stat(filepath.Join(dest, name))
+				if err != nil {
+					t.Fatalf("Expected %s to exist: %v", name, err)
+				}
+				if got := info.Mode().Perm(); got != want {
+					t.Errorf("Expected %s mode %v, got %v", name, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDownload_TreeRequests(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		stdout bool
+		want   int
+	}{
+		{name: "Single file to stdout", path: "bin/run.sh", stdout: true, want: 0},
+		{name: "Single file to disk", path: "bin/run.sh", want: 1},
+		{name: "Directory", path: "bin", want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := xtest.NewMockGitHubClient()
+			mockClient.AddRepository("owner", "repo", true)
+			mockClient.AddDirectory("owner", "repo", "bin", github.DirectoryContents{
+				{Type: github.FileContent, Name: "run.sh", Path: "bin/run.sh"},
+				{Type: github.FileContent, Name: "notes.txt", Path: "bin/notes.txt"},
+			})
+			mockClient.AddFile("owner", "repo", "bin/run.sh", []byte("#!/bin/sh\n"))
+			mockClient.AddFile("owner", "repo", "bin/notes.txt", []byte("notes\n"))
+			mockClient.AddTree("owner", "repo", &github.Tree{Entries: []github.TreeEntry{
+				{Path: "bin/run.sh", Mode: github.ExecutableMode, Type: "blob"},
+			}})
+
+			dl := NewDownloader(mockClient, new(bytes.Buffer), new(bytes.Buffer))
+			source := &github.GitHubSource{Owner: "owner", Repo: "repo", Path: tt.path}
+			dest := filepath.Join(t.TempDir(), "out")
+			if err := dl.Download(context.Background(), source, dest, DownloadOptions{OutputToStdout: tt.stdout}); err != nil {
+				t.Fatalf("Download unexpected error: %v", err)
+			}
+			if mockClient.TreeRequests != tt.want {
+				t.Errorf("Expected %d tree requests, got %d", tt.want, mockClient.TreeRequests)
+			}
+		})
+	}
+}
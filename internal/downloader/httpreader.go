@@ -0,0 +1,171 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+const (
+	// rangeBlockSize is the minimum amount fetched per range request, so the
+	// many small reads archive/zip makes are served from a few requests
+	rangeBlockSize = 1 << 20
+	// rangeMaxBlocks bounds how many fetched blocks are kept in memory
+	rangeMaxBlocks = 8
+)
+
+// ErrRangeNotSupported is returned when a server cannot serve byte ranges
+var ErrRangeNotSupported = errors.New("server does not support range requests")
+
+// httpReaderAt is an io.ReaderAt over a remote file, backed by HTTP range
+// requests and a small cache of recently fetched blocks. A range request
+// that fails, whether the server answers it with the whole file or the
+// connection drops, fails every later read too; see failed.
+type httpReaderAt struct {
+	ctx    context.Context
+	client *http.Client
+	url    string
+	size   int64
+
+	mu     sync.Mutex
+	blocks []rangeBlock
+	err    error // First failed range request
+}
+
+// rangeBlock is a contiguous span of the remote file
+type rangeBlock struct {
+	off  int64
+	data []byte
+}
+
+// newHTTPReaderAt probes url and returns a reader for it if the server
+// advertises byte-range support and a content length
+func newHTTPReaderAt(ctx context.Context, client *http.Client, url string) (*httpReaderAt, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrArchiveNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Accept-Ranges") != "bytes" || resp.ContentLength <= 0 {
+		return nil, ErrRangeNotSupported
+	}
+
+	return &httpReaderAt{
+		ctx:    ctx,
+		client: client,
+		// Range requests go straight to wherever the redirects ended up
+		url:  resp.Request.URL.String(),
+		size: resp.ContentLength,
+	}, nil
+}
+
+// Size returns the length of the remote file
+func (r *httpReaderAt) Size() int64 {
+	return r.size
+}
+
+// failed returns the error of the first range request that failed, if any,
+// so that callers can tell a broken transfer from a bad archive
+func (r *httpReaderAt) failed() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// ReadAt implements io.ReaderAt
+func (r *httpReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for n < len(p) && off+int64(n) < r.size {
+		pos := off + int64(n)
+		block, err := r.block(pos, int64(len(p)-n))
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], block.data[pos-block.off:])
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// block returns a cached block containing pos, fetching at least want bytes
+// from pos when none is cached
+func (r *httpReaderAt) block(pos, want int64) (rangeBlock, error) {
+	for _, b := range r.blocks {
+		if pos >= b.off && pos < b.off+int64(len(b.data)) {
+			return b, nil
+		}
+	}
+
+	if r.err != nil {
+		return rangeBlock{}, r.err
+	}
+
+	length := max(want, rangeBlockSize)
+	end := min(pos+length, r.size)
+
+	data, err := r.fetch(pos, end)
+	if err != nil {
+		r.err = err
+		return rangeBlock{}, err
+	}
+
+	b := rangeBlock{off: pos, data: data}
+	r.blocks = append(r.blocks, b)
+	if len(r.blocks) > rangeMaxBlocks {
+		r.blocks = r.blocks[1:]
+	}
+	return b, nil
+}
+
+// fetch retrieves bytes [start, end) of the remote file
+func (r *httpReaderAt) fetch(start, end int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("%w: status %d for range request", ErrRangeNotSupported, resp.StatusCode)
+	}
+
+	data := make([]byte, end-start)
+	if _, err := io.ReadFull(resp.Body, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,226 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// archiveServer serves zipData at /owner/repo/archive/main.zip, optionally
+// with byte-range support, and records whether any full GET was made
+type archiveServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	fullGETs  int
+	rangeGETs int
+}
+
+func newArchiveServer(t *testing.T, zipData []byte, ranges bool) *archiveServer {
+	t.Helper()
+
+	as := &archiveServer{}
+	as.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/owner/repo/archive/main.zip" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		as.mu.Lock()
+		if r.Method == http.MethodGet {
+			if r.Header.Get("Range") != "" {
+				as.rangeGETs++
+			} else {
+				as.fullGETs++
+			}
+		}
+		as.mu.Unlock()
+
+		if !ranges {
+			// Streamed archives have neither a length nor range support
+			w.Header().Set("Content-Type", "application/zip")
+			if r.Method == http.MethodGet {
+				w.Write(zipData)
+			}
+			return
+		}
+		http.ServeContent(w, r, "main.zip", time.Time{}, bytes.NewReader(zipData))
+	}))
+	t.Cleanup(as.Close)
+
+	return as
+}
+
+func TestZipDownloader_DownloadWithRanges(t *testing.T) {
+	tempDir := t.TempDir()
+	zipPath := filepath.Join(tempDir, "test.zip")
+	createTestZip(t, zipPath)
+	zipData, err := os.ReadFile(zipPath)
+	if err != nil {
+		t.Fatalf("Failed to read test zip: %v", err)
+	}
+
+	for _, ranges := range []bool{true, false} {
+		name := "without ranges"
+		if ranges {
+			name = "with ranges"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			server := newArchiveServer(t, zipData, ranges)
+
+			zd := NewZipDownloaderWithTempDir(t.TempDir(), new(bytes.Buffer), new(bytes.Buffer))
+			zd.httpClient = server.Client()
+			zd.baseURL = server.URL
+
+			target := filepath.Join(t.TempDir(), "out")
+			err := zd.Download(context.Background(), DownloadRequest{
+				Owner:  "owner",
+				Repo:   "repo",
+				Ref:    "main",
+				Path:   "src",
+				Target: target,
+			})
+			if err != nil {
+				t.Fatalf("Download unexpected error: %v", err)
+			}
+
+			got, err := os.ReadFile(filepath.Join(target, "main.go"))
+			if err != nil || string(got) != "package main\n\nfunc main() {}\n" {
+				t.Errorf("Unexpected extracted content %q (%v)", got, err)
+			}
+
+			if ranges && (server.fullGETs != 0 || server.rangeGETs == 0) {
+				t.Errorf("Expected only range requests, got %d full and %d range GETs", server.fullGETs, server.rangeGETs)
+			}
+			if !ranges && server.fullGETs != 1 {
+				t.Errorf("Expected one full download, got %d", server.fullGETs)
+			}
+		})
+	}
+}
+
+func TestHTTPReaderAt_ReadAt(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), rangeBlockSize/5)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "blob", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	remote, err := newHTTPReaderAt(context.Background(), server.Client(), server.URL)
+	if err != nil {
+		t.Fatalf("newHTTPReaderAt unexpected error: %v", err)
+	}
+	if remote.Size() != int64(len(data)) {
+		t.Fatalf("Size = %d, expected %d", remote.Size(), len(data))
+	}
+
+	// A read spanning a block boundary
+	off := int64(rangeBlockSize - 5)
+	buf := make([]byte, 10)
+	if _, err := remote.ReadAt(buf, 0); err != nil {
+		t.Fatalf("ReadAt unexpected error: %v", err)
+	}
+	if _, err := remote.ReadAt(buf, off); err != nil {
+		t.Fatalf("ReadAt unexpected error: %v", err)
+	}
+	if !bytes.Equal(buf, data[off:off+10]) {
+		t.Errorf("ReadAt = %q, expected %q", buf, data[off:off+10])
+	}
+
+	// A read past the end
+	n, err := remote.ReadAt(buf, int64(len(data)-4))
+	if n != 4 || err == nil {
+		t.Errorf("ReadAt at end = %d, %v; expected 4, EOF", n, err)
+	}
+}
+
+func TestZipDownloader_RangeFailurePartway(t *testing.T) {
+	// Incompressible padding after the wanted entry puts it out of reach of
+	// the range request that reads the central directory
+	padding := make([]byte, 2*rangeBlockSize)
+	rand.Read(padding)
+	zipPath := filepath.Join(t.TempDir(), "test.zip")
+	createLinkZip(t, zipPath, []zipEntry{
+		{name: "repo-main/src/main.go", content: "package main\n\nfunc main() {}\n"},
+		{name: "repo-main/padding.bin", content: string(padding)},
+	})
+	zipData, err := os.ReadFile(zipPath)
+	if err != nil {
+		t.Fatalf("Failed to read test zip: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		fail func(w http.ResponseWriter)
+	}{
+		{
+			name: "Whole file instead of a range",
+			fail: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusOK)
+				w.Write(zipData)
+			},
+		},
+		{
+			name: "Dropped connection",
+			fail: func(w http.ResponseWriter) {
+				conn, _, err := w.(http.Hijacker).Hijack()
+				if err == nil {
+					conn.Close()
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			rangeGETs, fullGETs := 0, 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				if r.Method == http.MethodGet && r.Header.Get("Range") == "" {
+					fullGETs++
+				} else if r.Method == http.MethodGet {
+					// The central directory comes through; the entries don't
+					if rangeGETs++; rangeGETs > 1 {
+						tt.fail(w)
+						return
+					}
+				}
+				http.ServeContent(w, r, "main.zip", time.Time{}, bytes.NewReader(zipData))
+			}))
+			defer server.Close()
+
+			zd := NewZipDownloaderWithTempDir(t.TempDir(), new(bytes.Buffer), new(bytes.Buffer))
+			zd.httpClient = server.Client()
+			zd.baseURL = server.URL
+
+			target := filepath.Join(t.TempDir(), "out")
+			err := zd.Download(context.Background(), DownloadRequest{
+				Owner:  "owner",
+				Repo:   "repo",
+				Ref:    "main",
+				Path:   "src",
+				Target: target,
+			})
+			if err != nil {
+				t.Fatalf("Download unexpected error: %v", err)
+			}
+
+			got, err := os.ReadFile(filepath.Join(target, "main.go"))
+			if err != nil || string(got) != "package main\n\nfunc main() {}\n" {
+				t.Errorf("Unexpected extracted content %q (%v)", got, err)
+			}
+			if rangeGETs < 2 || fullGETs != 1 {
+				t.Errorf("Expected a failed range request then one full download, got %d range and %d full GETs", rangeGETs, fullGETs)
+			}
+		})
+	}
+}
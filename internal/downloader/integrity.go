@@ -0,0 +1,182 @@
+package downloader
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"xcp/internal/github"
+)
+
+var (
+	ErrIntegrityMismatch = errors.New("downloaded content does not match the repository")
+	ErrUnverifiable      = errors.New("downloaded content cannot be verified")
+)
+
+// TreeSource fetches the git trees downloads are verified against
+type TreeSource interface {
+	GetTree(ctx context.Context, owner, repo, ref string) (*github.Tree, error)
+}
+
+// newBlobHash returns a hash that yields the git blob SHA-1 of size bytes
+// written to it
+func newBlobHash(size int64) hash.Hash {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", size)
+	return h
+}
+
+// blobReader hashes everything read through it as a git blob and fails at
+// the end of the stream when the result differs from the expected SHA
+type blobReader struct {
+	r        io.Reader
+	hash     hash.Hash
+	expected string
+	path     string
+}
+
+func newBlobReader(r io.Reader, path string, blob github.TreeEntry) *blobReader {
+	return &blobReader{r: r, hash: newBlobHash(blob.Size), expected: blob.Sha, path: path}
+}
+
+func (br *blobReader) Read(p []byte) (int, error) {
+	n, err := br.r.Read(p)
+	br.hash.Write(p[:n])
+	if err == io.EOF {
+		if got := hex.EncodeToString(br.hash.Sum(nil)); got != br.expected {
+			return n, fmt.Errorf("%w: %s has blob %s, expected %s", ErrIntegrityMismatch, br.path, got, br.expected)
+		}
+	}
+	return n, err
+}
+
+// stagedBlob pairs a file written to staging with its path in the repository
+type stagedBlob struct {
+	repoPath   string
+	stagedPath string
+}
+
+// treeCheck verifies extracted files against the tree of the commit they
+// were extracted from
+type treeCheck struct {
+	trees TreeSource
+	owner string
+	repo  string
+	ref   string
+}
+
+// verify compares the git blob SHA-1 of every staged file with the tree
+func (tc *treeCheck) verify(ctx context.Context, blobs []stagedBlob) error {
+	tree, err := tc.trees.GetTree(ctx, tc.owner, tc.repo, tc.ref)
+	if err != nil {
+		return fmt.Errorf("failed to fetch tree for verification: %w", err)
+	}
+
+	entries := make(map[string]github.TreeEntry, len(tree.Entries))
+	for _, entry := range tree.Entries {
+		entries[entry.Path] = entry
+	}
+
+	for _, blob := range blobs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		entry, ok := entries[blob.repoPath]
+		if !ok {
+			if tree.Truncated {
+				continue
+			}
+			return fmt.Errorf("%w: %s is not in the repository tree", ErrIntegrityMismatch, blob.repoPath)
+		}
+
+		got, err := blobSHA(blob.stagedPath)
+		if err != nil {
+			return err
+		}
+		if got != entry.Sha {
+			return fmt.Errorf("%w: %s has blob %s, expected %s", ErrIntegrityMismatch, blob.repoPath, got, entry.Sha)
+		}
+	}
+
+	return nil
+}
+
+// blobSHA returns the git blob SHA-1 of the file at path
+func blobSHA(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	h := newBlobHash(info.Size())
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// repoPath strips the top-level directory GitHub wraps archive entries in
+func repoPath(name string) string {
+	if i := strings.Index(name, "/"); i != -1 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// checkSHA256 reads r to the end and fails unless it has the hex SHA-256
+// digest want. An empty want checks nothing.
+func checkSHA256(r io.Reader, want string) error {
+	if want == "" {
+		return nil
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, want) {
+		return fmt.Errorf("%w: archive has SHA-256 %s, expected %s", ErrIntegrityMismatch, got, strings.ToLower(want))
+	}
+	return nil
+}
+
+// sha256Reader hashes everything read through it and, when a digest is
+// expected, fails at the end of the stream unless the result matches
+type sha256Reader struct {
+	r        io.Reader
+	hash     hash.Hash
+	expected string
+	name     string
+}
+
+func newSHA256Reader(r io.Reader, name, expected string) *sha256Reader {
+	return &sha256Reader{r: r, hash: sha256.New(), expected: expected, name: name}
+}
+
+func (sr *sha256Reader) Read(p []byte) (int, error) {
+	n, err := sr.r.Read(p)
+	sr.hash.Write(p[:n])
+	if err == io.EOF && sr.expected != "" {
+		if got := sr.sum(); !strings.EqualFold(got, sr.expected) {
+			return n, fmt.Errorf("%w: %s has SHA-256 %s, expected %s", ErrIntegrityMismatch, sr.name, got, sr.expected)
+		}
+	}
+	return n, err
+}
+
+// sum returns the hex SHA-256 digest of everything read so far
+func (sr *sha256Reader) sum() string {
+	return hex.EncodeToString(sr.hash.Sum(nil))
+}
@@ -0,0 +1,247 @@
+package downloader
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"xcp/internal/github"
+	xtest "xcp/internal/testing"
+)
+
+// git hash-object of "hello\n"
+const helloBlob = "ce013625030ba8dba906f756967f9e9ca394464a"
+
+// fakeTrees serves a fixed tree and remembers the ref asked for
+type fakeTrees struct {
+	tree *github.Tree
+	ref  string
+}
+
+func (f *fakeTrees) GetTree(ctx context.Context, owner, repo, ref string) (*github.Tree, error) {
+	f.ref = ref
+	return f.tree, nil
+}
+
+func TestBlobReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		expect  error
+	}{
+		{name: "Match", content: "hello\n"},
+		{name: "Mismatch", content: "hello!\n", expect: ErrIntegrityMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blob := github.TreeEntry{Sha: helloBlob, Size: int64(len(tt.content))}
+			_, err := io.Copy(io.Discard, newBlobReader(bytes.NewReader([]byte(tt.content)), "hello.txt", blob))
+			if !errors.Is(err, tt.expect) {
+				t.Errorf("Expected %v, got %v", tt.expect, err)
+			}
+		})
+	}
+}
+
+func TestZipDownloader_extractVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		sha    string
+		expect error
+	}{
+		{name: "Matching tree", sha: helloBlob},
+		{name: "Mismatching tree", sha: "0000000000000000000000000000000000000000", expect: ErrIntegrityMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			zipPath := filepath.Join(tempDir, "test.zip")
+			createLinkZip(t, zipPath, []zipEntry{{name: "repo-main/hello.txt", content: "hello\n"}})
+
+			trees := &fakeTrees{tree: &github.Tree{Entries: []github.TreeEntry{
+				{Path: "hello.txt", Type: "blob", Sha: tt.sha, Size: 6},
+			}}}
+			zd := NewZipDownloader(new(bytes.Buffer), new(bytes.Buffer))
+			zd.SetVerify(trees)
+			ex := zd.newExtraction("owner", "repo", "abc123", 0)
+
+			target := filepath.Join(tempDir, "target")
+			err := zd.extractPath(context.Background(), zipPath, "repo-main", target, ex)
+			if !errors.Is(err, tt.expect) {
+				t.Fatalf("Expected %v, got %v", tt.expect, err)
+			}
+			if trees.ref != "abc123" {
+				t.Errorf("Expected tree for abc123, got %q", trees.ref)
+			}
+
+			_, statErr := os.Stat(target)
+			if (tt.expect == nil) != (statErr == nil) {
+				t.Errorf("Expected target written only on success, stat error %v", statErr)
+			}
+		})
+	}
+}
+
+func TestZipDownloader_extractBadCRC(t *testing.T) {
+	tempDir := t.TempDir()
+	zipPath := filepath.Join(tempDir, "test.zip")
+
+	// Store the entry uncompressed so its bytes can be flipped in place
+	buf := new(bytes.Buffer)
+	writer := zip.NewWriter(buf)
+	fw, err := writer.CreateHeader(&zip.FileHeader{Name: "repo-main/hello.txt", Method: zip.Store})
+	if err != nil {
+		t.Fatalf("Failed to create file in zip: %v", err)
+	}
+	io.WriteString(fw, "hello\n")
+	writer.Close()
+
+	data := bytes.Replace(buf.Bytes(), []byte("hello\n"), []byte("jello\n"), 1)
+	if err := os.WriteFile(zipPath, data, 0644); err != nil {
+		t.Fatalf("Failed to write zip: %v", err)
+	}
+
+	zd := NewZipDownloader(new(bytes.Buffer), new(bytes.Buffer))
+	err = zd.extractPath(context.Background(), zipPath, "repo-main", filepath.Join(tempDir, "target"), extraction{})
+	if !errors.Is(err, ErrIntegrityMismatch) {
+		t.Fatalf("Expected ErrIntegrityMismatch, got %v", err)
+	}
+}
+
+func TestDownload_BlobMismatch(t *testing.T) {
+	mockClient := xtest.NewMockGitHubClient()
+	mockClient.AddRepository("owner", "repo", true)
+
+	tests := []struct {
+		name    string
+		size    int
+		content string
+		expect  error
+	}{
+		{name: "Content matches listing", size: 6, content: "hello\n"},
+		{name: "Content differs from listing", size: 6, content: "howdy\n", expect: ErrIntegrityMismatch},
+		// Services that list no sizes are checked against the response length
+		{name: "Size from response", size: -1, content: "hello\n"},
+		{name: "Size from response differs", size: -1, content: "howdy\n", expect: ErrIntegrityMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient.AddDirectory("owner", "repo", "dir", github.DirectoryContents{
+				{Type: github.FileContent, Name: "hello.txt", Path: "dir/hello.txt", Sha: helloBlob, Size: tt.size},
+			})
+			mockClient.AddFile("owner", "repo", "dir/hello.txt", []byte(tt.content))
+			dl := NewDownloader(mockClient, new(bytes.Buffer), new(bytes.Buffer))
+			dest := filepath.Join(t.TempDir(), "dir")
+
+			source := &github.GitHubSource{Owner: "owner", Repo: "repo", Path: "dir"}
+			err := dl.Download(context.Background(), source, dest, DownloadOptions{})
+			if !errors.Is(err, tt.expect) {
+				t.Fatalf("Expected %v, got %v", tt.expect, err)
+			}
+
+			_, statErr := os.Stat(filepath.Join(dest, "hello.txt"))
+			if (tt.expect == nil) != (statErr == nil) {
+				t.Errorf("Expected file written only when it matches, stat error %v", statErr)
+			}
+		})
+	}
+}
+
+func TestDownload_Verify(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		tree    bool
+		stdout  bool
+		verify  bool
+		expect  error
+	}{
+		{name: "Stdout checked against tree", content: "hello\n", tree: true, stdout: true, verify: true},
+		{name: "Stdout differs from tree", content: "howdy\n", tree: true, stdout: true, verify: true, expect: ErrIntegrityMismatch},
+		{name: "Stdout without tree", content: "hello\n", stdout: true, verify: true, expect: ErrUnverifiable},
+		{name: "File without tree", content: "hello\n", verify: true, expect: ErrUnverifiable},
+		{name: "File without tree unverified", content: "hello\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := xtest.NewMockGitHubClient()
+			mockClient.AddRepository("owner", "repo", true)
+			mockClient.AddFile("owner", "repo", "hello.txt", []byte(tt.content))
+			if tt.tree {
+				mockClient.AddTree("owner", "repo", &github.Tree{Entries: []github.TreeEntry{
+					{Path: "hello.txt", Type: "blob", Sha: helloBlob, Size: 6},
+				}})
+			}
+
+			dl := NewDownloader(mockClient, new(bytes.Buffer), new(bytes.Buffer))
+			source := &github.GitHubSource{Owner: "owner", Repo: "repo", Path: "hello.txt", IsFile: true}
+			dest := filepath.Join(t.TempDir(), "hello.txt")
+			opts := DownloadOptions{OutputToStdout: tt.stdout, Verify: tt.verify}
+			if err := dl.Download(context.Background(), source, dest, opts); !errors.Is(err, tt.expect) {
+				t.Fatalf("Expected %v, got %v", tt.expect, err)
+			}
+		})
+	}
+}
+
+func TestRawDownloader_Verify(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello\n")
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		entry  *github.TreeEntry
+		stdout bool
+		expect error
+	}{
+		{name: "Matching tree", entry: &github.TreeEntry{Sha: helloBlob, Size: 6}},
+		{name: "Matching tree to stdout", entry: &github.TreeEntry{Sha: helloBlob, Size: 6}, stdout: true},
+		{name: "Mismatching tree", entry: &github.TreeEntry{Sha: "0000000000000000000000000000000000000000", Size: 6}, expect: ErrIntegrityMismatch},
+		{name: "Tree without SHA", entry: &github.TreeEntry{Size: 6}, expect: ErrUnverifiable},
+		{name: "No tree", stdout: true, expect: ErrUnverifiable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout := new(bytes.Buffer)
+			rd := NewRawDownloader(stdout, new(bytes.Buffer))
+			rd.httpClient = server.Client()
+			rd.baseURL = server.URL
+			if tt.entry != nil {
+				entry := *tt.entry
+				entry.Path, entry.Type = "hello.txt", "blob"
+				rd.SetTrees(&fakeTrees{tree: &github.Tree{Entries: []github.TreeEntry{entry}}})
+			}
+
+			source := &github.GitHubSource{Owner: "owner", Repo: "repo", Path: "hello.txt", IsFile: true}
+			dest := filepath.Join(t.TempDir(), "hello.txt")
+			err := rd.Download(context.Background(), source, dest, DownloadOptions{OutputToStdout: tt.stdout, Verify: true})
+			if !errors.Is(err, tt.expect) {
+				t.Fatalf("Expected %v, got %v", tt.expect, err)
+			}
+
+			if tt.stdout {
+				if tt.expect == nil && stdout.String() != "hello\n" {
+					t.Errorf("Expected content on stdout, got %q", stdout.String())
+				}
+				return
+			}
+			_, statErr := os.Stat(dest)
+			if (tt.expect == nil) != (statErr == nil) {
+				t.Errorf("Expected file written only when verified, stat error %v", statErr)
+			}
+		})
+	}
+}
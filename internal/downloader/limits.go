@@ -0,0 +1,148 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var ErrLimitExceeded = errors.New("extraction limit exceeded")
+
+// Names of the limits reported in LimitError
+const (
+	LimitMaxSize     = "max-size"
+	LimitMaxFiles    = "max-files"
+	LimitMaxFileSize = "max-file-size"
+	LimitRatio       = "compression-ratio"
+)
+
+// ratioMinSize is how much an entry must expand to before its compression
+// ratio is checked, so small highly compressible files are not flagged
+const ratioMinSize = 1 << 20
+
+// Limits caps the resources an archive may consume when extracted. A zero
+// field means no limit.
+type Limits struct {
+	MaxSize     int64 // total uncompressed bytes written
+	MaxFiles    int   // number of files, links and directories written
+	MaxFileSize int64 // uncompressed bytes of a single file
+	MaxRatio    int64 // uncompressed to compressed size of a single file
+}
+
+// DefaultLimits returns limits generous enough for any real repository
+func DefaultLimits() Limits {
+	return Limits{
+		MaxSize:     8 << 30,
+		MaxFiles:    500000,
+		MaxFileSize: 2 << 30,
+		MaxRatio:    500,
+	}
+}
+
+// LimitError reports that extraction stopped because an archive went over
+// one of its Limits
+type LimitError struct {
+	Limit string // one of the Limit* names
+	Max   int64
+	Path  string // archive entry being extracted when the limit tripped
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v: %s limit of %d reached at %s", ErrLimitExceeded, e.Limit, e.Max, e.Path)
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// ParseSize parses a byte count with an optional K, M or G suffix (powers of
+// 1024), as accepted by --max-size
+func ParseSize(s string) (int64, error) {
+	shift := 0
+	num := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	switch {
+	case strings.HasSuffix(num, "K"):
+		shift = 10
+	case strings.HasSuffix(num, "M"):
+		shift = 20
+	case strings.HasSuffix(num, "G"):
+		shift = 30
+	}
+	if shift > 0 {
+		num = num[:len(num)-1]
+	}
+
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 || n > (1<<62)>>shift {
+		return 0, fmt.Errorf("invalid size %q (want bytes or a number with K, M or G)", s)
+	}
+	return n << shift, nil
+}
+
+// extractionBudget enforces Limits against the bytes actually written,
+// which may differ from what archive headers claim
+type extractionBudget struct {
+	limits Limits
+	files  int
+	total  int64
+}
+
+// checkDeclared fails early when the sizes an archive declares already go
+// over the limits
+func (b *extractionBudget) checkDeclared(files int, size int64, path string) error {
+	if b.limits.MaxFiles > 0 && files > b.limits.MaxFiles {
+		return &LimitError{Limit: LimitMaxFiles, Max: int64(b.limits.MaxFiles), Path: path}
+	}
+	if b.limits.MaxSize > 0 && size > b.limits.MaxSize {
+		return &LimitError{Limit: LimitMaxSize, Max: b.limits.MaxSize, Path: path}
+	}
+	return nil
+}
+
+// entry accounts for one more entry named path, such as a directory or a
+// link, that has no content to read
+func (b *extractionBudget) entry(path string) error {
+	b.files++
+	if b.limits.MaxFiles > 0 && b.files > b.limits.MaxFiles {
+		return &LimitError{Limit: LimitMaxFiles, Max: int64(b.limits.MaxFiles), Path: path}
+	}
+	return nil
+}
+
+// file accounts for one more file named path and returns a reader over its
+// content r that fails once a limit is crossed. compressed is the entry's
+// compressed size, or 0 when unknown.
+func (b *extractionBudget) file(path string, r io.Reader, compressed int64) (io.Reader, error) {
+	if err := b.entry(path); err != nil {
+		return nil, err
+	}
+	return &budgetReader{budget: b, path: path, r: r, compressed: compressed}, nil
+}
+
+// budgetReader counts the bytes of one file against its budget
+type budgetReader struct {
+	budget     *extractionBudget
+	path       string
+	r          io.Reader
+	n          int64
+	compressed int64
+}
+
+func (br *budgetReader) Read(p []byte) (int, error) {
+	n, err := br.r.Read(p)
+	br.n += int64(n)
+	br.budget.total += int64(n)
+
+	limits := br.budget.limits
+	switch {
+	case limits.MaxFileSize > 0 && br.n > limits.MaxFileSize:
+		return n, &LimitError{Limit: LimitMaxFileSize, Max: limits.MaxFileSize, Path: br.path}
+	case limits.MaxSize > 0 && br.budget.total > limits.MaxSize:
+		return n, &LimitError{Limit: LimitMaxSize, Max: limits.MaxSize, Path: br.path}
+	case limits.MaxRatio > 0 && br.compressed > 0 && br.n > ratioMinSize && br.n/br.compressed > limits.MaxRatio:
+		return n, &LimitError{Limit: LimitRatio, Max: limits.MaxRatio, Path: br.path}
+	}
+	return n, err
+}
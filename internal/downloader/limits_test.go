@@ -0,0 +1,176 @@
+package downloader
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+		wantErr  bool
+	}{
+		{"1024", 1024, false},
+		{"0", 0, false},
+		{"10K", 10 << 10, false},
+		{"500M", 500 << 20, false},
+		{"2g", 2 << 30, false},
+		{"2GB", 2 << 30, false},
+		{"", 0, true},
+		{"-1", 0, true},
+		{"lots", 0, true},
+	}
+
+	for _, tt := range tests {
+		size, err := ParseSize(tt.input)
+		if (err != nil) != tt.wantErr || size != tt.expected {
+			t.Errorf("ParseSize(%q) = %d, %v; expected %d (error %v)", tt.input, size, err, tt.expected, tt.wantErr)
+		}
+	}
+}
+
+// writeBombZip creates an archive whose single entry expands to size bytes
+// of zeros
+func writeBombZip(t *testing.T, zipPath string, size int) {
+	t.Helper()
+
+	file, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatalf("Failed to create zip file: %v", err)
+	}
+	defer file.Close()
+
+	writer := zip.NewWriter(file)
+	defer writer.Close()
+
+	fw, err := writer.Create("repo-main/zeros.bin")
+	if err != nil {
+		t.Fatalf("Failed to create file in zip: %v", err)
+	}
+	if _, err := fw.Write(make([]byte, size)); err != nil {
+		t.Fatalf("Failed to write file content: %v", err)
+	}
+}
+
+func TestZipDownloader_extractLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		limits Limits
+		limit  string
+	}{
+		{name: "Declared size over max-size", size: 4 << 10, limits: Limits{MaxSize: 1 << 10}, limit: LimitMaxSize},
+		{name: "Within default limits", size: 4 << 10, limits: DefaultLimits()},
+		{name: "Per-file size", size: 64 << 10, limits: Limits{MaxFileSize: 1 << 10}, limit: LimitMaxFileSize},
+		{name: "Compression ratio", size: 4 << 20, limits: Limits{MaxRatio: 100}, limit: LimitRatio},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			zipPath := filepath.Join(tempDir, "bomb.zip")
+			writeBombZip(t, zipPath, tt.size)
+
+			target := filepath.Join(tempDir, "target")
+			zd := NewZipDownloader(new(bytes.Buffer), new(bytes.Buffer))
+			zd.SetLimits(tt.limits)
+
+			err := zd.extractPath(context.Background(), zipPath, "repo-main", target, extraction{})
+			if tt.limit == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+
+			var limitErr *LimitError
+			if !errors.As(err, &limitErr) || limitErr.Limit != tt.limit {
+				t.Fatalf("Expected %s LimitError, got %v", tt.limit, err)
+			}
+			if !errors.Is(err, ErrLimitExceeded) {
+				t.Errorf("Expected error to match ErrLimitExceeded")
+			}
+			if _, err := os.Stat(target); !os.IsNotExist(err) {
+				t.Errorf("Expected target to be left untouched")
+			}
+		})
+	}
+}
+
+func TestZipDownloader_extractMaxFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	zipPath := filepath.Join(tempDir, "test.zip")
+	createTestZip(t, zipPath)
+
+	zd := NewZipDownloader(new(bytes.Buffer), new(bytes.Buffer))
+	zd.SetLimits(Limits{MaxFiles: 2})
+
+	err := zd.extractPath(context.Background(), zipPath, "repo-main", filepath.Join(tempDir, "target"), extraction{})
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != LimitMaxFiles {
+		t.Fatalf("Expected max-files LimitError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "max-files limit of 2") {
+		t.Errorf("Unexpected message: %v", err)
+	}
+}
+
+func TestTarDownloader_extractLimits(t *testing.T) {
+	// Tarballs can only be checked while streaming
+	td := newTarTestDownloader(t, createTestTarball(t))
+	td.SetLimits(Limits{MaxSize: 8})
+
+	target := filepath.Join(t.TempDir(), "out")
+	err := td.Download(context.Background(), DownloadRequest{Owner: "owner", Repo: "repo", Target: target})
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("Expected ErrLimitExceeded, got %v", err)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("Expected target to be left untouched")
+	}
+}
+
+func TestTarDownloader_extractMaxFiles(t *testing.T) {
+	// Links count like files, or they would go uncounted
+	links := []*tar.Header{
+		{Typeflag: tar.TypeSymlink, Name: "repo-main/a", Linkname: "README.md"},
+		{Typeflag: tar.TypeSymlink, Name: "repo-main/b", Linkname: "README.md"},
+		{Typeflag: tar.TypeSymlink, Name: "repo-main/c", Linkname: "README.md"},
+	}
+	td := newTarTestDownloader(t, createTestTarball(t, links...))
+	td.SetLimits(Limits{MaxFiles: 5})
+
+	target := filepath.Join(t.TempDir(), "out")
+	err := td.Download(context.Background(), DownloadRequest{Owner: "owner", Repo: "repo", Target: target})
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != LimitMaxFiles {
+		t.Fatalf("Expected max-files LimitError, got %v", err)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("Expected target to be left untouched")
+	}
+}
+
+func TestTarDownloader_extractDiskSpace(t *testing.T) {
+	originalFreeSpace := freeSpace
+	defer func() { freeSpace = originalFreeSpace }()
+	freeSpace = func(dir string) (int64, error) { return 8, nil }
+
+	td := newTarTestDownloader(t, createTestTarball(t))
+	target := filepath.Join(t.TempDir(), "out")
+	err := td.Download(context.Background(), DownloadRequest{Owner: "owner", Repo: "repo", Target: target})
+	if !errors.Is(err, ErrDiskSpaceInsufficient) {
+		t.Fatalf("Expected ErrDiskSpaceInsufficient, got %v", err)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("Expected target to be left untouched")
+	}
+}
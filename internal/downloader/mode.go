@@ -0,0 +1,65 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+var ErrInvalidFileMode = errors.New("invalid file mode")
+
+// ModePolicy decides the permissions given to files and directories written
+// from an archive or the API. The zero value keeps only the executable bit
+// of the source and applies the process umask.
+type ModePolicy struct {
+	// Preserve keeps the permission bits recorded in the source as they are
+	Preserve bool
+	// Override, when non-zero, is given to every file written
+	Override os.FileMode
+}
+
+// umask is read once; reading it means briefly changing it
+var umask = sync.OnceValue(currentUmask)
+
+// ParseFileMode parses an octal --mode value such as 0644
+func ParseFileMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode == 0 || mode > 0777 {
+		return 0, fmt.Errorf("%w %q (want octal permissions such as 0644)", ErrInvalidFileMode, s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// fileMode returns the permissions for a file recorded with mode in its source
+func (p ModePolicy) fileMode(mode os.FileMode) os.FileMode {
+	switch {
+	case p.Override != 0:
+		return p.Override
+	case p.Preserve:
+		return mode.Perm()
+	case mode&0111 != 0:
+		return 0777 &^ umask()
+	default:
+		return 0666 &^ umask()
+	}
+}
+
+// dirMode returns the permissions for a directory recorded with mode in its
+// source. Directories always stay usable by their owner.
+func (p ModePolicy) dirMode(mode os.FileMode) os.FileMode {
+	if p.Preserve && mode.Perm() != 0 {
+		return mode.Perm() | 0700
+	}
+	return 0777 &^ umask()
+}
+
+// mkdirMode creates path and any missing parents, giving path itself perm
+// regardless of the umask
+func mkdirMode(path string, perm os.FileMode) error {
+	if err := os.MkdirAll(path, perm); err != nil {
+		return err
+	}
+	return os.Chmod(path, perm)
+}
@@ -0,0 +1,59 @@
+package downloader
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestParseFileMode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected os.FileMode
+		err      error
+	}{
+		{"0644", 0644, nil},
+		{"755", 0755, nil},
+		{"0", 0, ErrInvalidFileMode},
+		{"0999", 0, ErrInvalidFileMode},
+		{"01777", 0, ErrInvalidFileMode},
+		{"rw-r--r--", 0, ErrInvalidFileMode},
+	}
+
+	for _, tt := range tests {
+		mode, err := ParseFileMode(tt.input)
+		if !errors.Is(err, tt.err) || mode != tt.expected {
+			t.Errorf("ParseFileMode(%q) = %v, %v; expected %v, %v", tt.input, mode, err, tt.expected, tt.err)
+		}
+	}
+}
+
+func TestModePolicy(t *testing.T) {
+	mask := umask()
+
+	tests := []struct {
+		name   string
+		policy ModePolicy
+		source os.FileMode
+		file   os.FileMode
+		dir    os.FileMode
+	}{
+		{name: "World writable is normalized", source: 0666, file: 0666 &^ mask, dir: 0777 &^ mask},
+		{name: "Executable bit is kept", source: 0700, file: 0777 &^ mask, dir: 0777 &^ mask},
+		{name: "Unreadable is normalized", source: 0, file: 0666 &^ mask, dir: 0777 &^ mask},
+		{name: "Preserve", policy: ModePolicy{Preserve: true}, source: 0640, file: 0640, dir: 0740},
+		{name: "Preserve keeps directories usable", policy: ModePolicy{Preserve: true}, source: 0, file: 0, dir: 0777 &^ mask},
+		{name: "Override", policy: ModePolicy{Override: 0600}, source: 0755, file: 0600, dir: 0777 &^ mask},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.fileMode(tt.source); got != tt.file {
+				t.Errorf("fileMode(%v) = %v, expected %v", tt.source, got, tt.file)
+			}
+			if got := tt.policy.dirMode(tt.source); got != tt.dir {
+				t.Errorf("dirMode(%v) = %v, expected %v", tt.source, got, tt.dir)
+			}
+		})
+	}
+}
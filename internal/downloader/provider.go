@@ -0,0 +1,112 @@
+package downloader
+
+import (
+	"archive/zip"
+	"fmt"
+	"strings"
+)
+
+// Archive formats a Provider may be asked for
+const (
+	FormatZip   = "zip"
+	FormatTarGz = "tar.gz"
+	FormatTarXz = "tar.xz"
+)
+
+// ArchiveFormat returns the format of the archive file named name, or "" when
+// its extension is not one of an archive
+func ArchiveFormat(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return FormatZip
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return FormatTarGz
+	case strings.HasSuffix(name, ".tar.xz"):
+		return FormatTarXz
+	default:
+		return ""
+	}
+}
+
+// Provider locates repository archives on a hosting service other than
+// github.com, whose layout is used when a request names no provider
+type Provider interface {
+	// ArchiveURL returns the URL of an archive of owner/repo at ref in format.
+	// Services that can archive a subtree restrict the archive to path.
+	ArchiveURL(owner, repo, ref, path, format string) string
+	// ArchivePrefix returns the top-level directory the archive's entries are
+	// under, or "" when the service's naming cannot be predicted and the
+	// directory is taken from the archive itself
+	ArchivePrefix(repo, ref string) string
+}
+
+// archiveURL returns the URL of req's archive in format
+func (zd *ZipDownloader) archiveURL(req DownloadRequest, format string) string {
+	if req.URL != "" {
+		return req.URL
+	}
+	if req.Provider != nil {
+		return req.Provider.ArchiveURL(req.Owner, req.Repo, req.Ref, req.Path, format)
+	}
+	return fmt.Sprintf("%s/%s/%s/archive/%s.%s", zd.baseURL, req.Owner, req.Repo, req.Ref, format)
+}
+
+// archivePrefix returns the top-level directory of req's archive, or "" when
+// it has to be detected or stripped
+func archivePrefix(req DownloadRequest) string {
+	if req.givenArchive() {
+		return ""
+	}
+	if req.Provider != nil {
+		return req.Provider.ArchivePrefix(req.Repo, req.Ref)
+	}
+	return fmt.Sprintf("%s-%s", req.Repo, req.Ref)
+}
+
+// givenArchive reports whether req names its archive itself rather than a
+// repository to archive, so the archive's layout is not known in advance
+func (req DownloadRequest) givenArchive() bool {
+	return req.Archive != "" || req.URL != ""
+}
+
+// entryName returns an entry name with the leading components being stripped
+// removed, and false for entries that lie entirely within them
+func (ex extraction) entryName(name string) (string, bool) {
+	for i := 0; i < ex.strip; i++ {
+		_, rest, ok := strings.Cut(name, "/")
+		if !ok || rest == "" {
+			return "", false
+		}
+		name = rest
+	}
+	return name, true
+}
+
+// archiveRoot returns the directory every entry of the archive lives under,
+// or "" when the entries do not share one
+func archiveRoot(reader *zip.Reader) string {
+	names := make([]string, len(reader.File))
+	for i, file := range reader.File {
+		names[i] = file.Name
+	}
+	return sharedRoot(names)
+}
+
+// sharedRoot returns the directory every name lives under, or "" when the
+// names do not share one. Directory names end in a slash.
+func sharedRoot(names []string) string {
+	root := ""
+	for _, name := range names {
+		top, _, nested := strings.Cut(name, "/")
+		if !nested {
+			// A file at the top level
+			return ""
+		}
+		if root == "" {
+			root = top
+		} else if top != root {
+			return ""
+		}
+	}
+	return root
+}
@@ -0,0 +1,145 @@
+package downloader
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// stubProvider serves archives from base with unpredictable top-level names
+type stubProvider struct {
+	base string
+}
+
+func (p stubProvider) ArchiveURL(owner, repo, ref, path, format string) string {
+	return p.base + "/projects/" + repo + "/archive." + format + "?sha=" + ref
+}
+
+func (p stubProvider) ArchivePrefix(repo, ref string) string {
+	return ""
+}
+
+// writeZip builds a zip archive holding files
+func writeZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	writer := zip.NewWriter(buf)
+	for name, content := range files {
+		fw, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(content))
+	}
+	writer.Close()
+	return buf.Bytes()
+}
+
+func TestZipDownloader_Provider(t *testing.T) {
+	archives := map[string][]byte{
+		"/projects/repo/archive.zip": writeZip(t, map[string]string{
+			"repo-main-0123abc/README.md":  "# Test\n",
+			"repo-main-0123abc/ci/test.sh": "#!/bin/sh\n",
+		}),
+		"/projects/split/archive.zip": writeZip(t, map[string]string{
+			"one/README.md": "# One\n",
+			"two/README.md": "# Two\n",
+		}),
+		"/projects/repo/archive.tar.gz": createTestTarball(t),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := archives[r.URL.Path]
+		if !ok || r.URL.Query().Get("sha") != "main" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	provider := stubProvider{base: server.URL}
+
+	t.Run("Zip prefix detected", func(t *testing.T) {
+		zd := NewZipDownloaderWithTempDir(t.TempDir(), new(bytes.Buffer), new(bytes.Buffer))
+		zd.httpClient = server.Client()
+
+		target := filepath.Join(t.TempDir(), "out")
+		err := zd.Download(context.Background(), DownloadRequest{Owner: "group", Repo: "repo", Ref: "main", Path: "ci", Target: target, Provider: provider})
+		if err != nil {
+			t.Fatalf("Download unexpected error: %v", err)
+		}
+		if got, err := os.ReadFile(filepath.Join(target, "test.sh")); err != nil || string(got) != "#!/bin/sh\n" {
+			t.Errorf("Unexpected extracted content %q (%v)", got, err)
+		}
+	})
+
+	t.Run("Zip without single top-level directory", func(t *testing.T) {
+		zd := NewZipDownloaderWithTempDir(t.TempDir(), new(bytes.Buffer), new(bytes.Buffer))
+		zd.httpClient = server.Client()
+
+		err := zd.Download(context.Background(), DownloadRequest{Owner: "group", Repo: "split", Ref: "main", Target: t.TempDir(), Provider: provider})
+		if !errors.Is(err, ErrArchivePrefixMismatch) {
+			t.Errorf("Expected ErrArchivePrefixMismatch, got %v", err)
+		}
+	})
+
+	t.Run("Tar prefix detected", func(t *testing.T) {
+		td := NewTarDownloader(new(bytes.Buffer), new(bytes.Buffer))
+		td.httpClient = server.Client()
+
+		target := filepath.Join(t.TempDir(), "out")
+		err := td.Download(context.Background(), DownloadRequest{Owner: "group", Repo: "repo", Ref: "main", Path: "bin", Target: target, Provider: provider})
+		if err != nil {
+			t.Fatalf("Download unexpected error: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(target, "run.sh")); err != nil {
+			t.Errorf("Expected run.sh to be extracted: %v", err)
+		}
+	})
+}
+
+func TestArchiveFormat(t *testing.T) {
+	tests := map[string]string{
+		"repo.zip":    FormatZip,
+		"repo.tar.gz": FormatTarGz,
+		"repo.tgz":    FormatTarGz,
+		"repo.tar.xz": FormatTarXz,
+		"repo":        "",
+		"repo.v2":     "",
+		"repo.xz":     "",
+	}
+	for name, expected := range tests {
+		if got := ArchiveFormat(name); got != expected {
+			t.Errorf("ArchiveFormat(%q) = %q, expected %q", name, got, expected)
+		}
+	}
+}
+
+func TestZipDownloader_EntryName(t *testing.T) {
+	tests := []struct {
+		name     string
+		strip    int
+		expected string
+		ok       bool
+	}{
+		{"pkg/README.md", 0, "pkg/README.md", true},
+		{"pkg/README.md", 1, "README.md", true},
+		{"pkg-1.0/src/main.go", 2, "main.go", true},
+		{"pkg/", 1, "", false},
+		{"pkg/src/", 1, "src/", true},
+		{"README.md", 1, "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := extraction{strip: tt.strip}.entryName(tt.name)
+		if got != tt.expected || ok != tt.ok {
+			t.Errorf("entryName(%q) with %d stripped = %q, %v, expected %q, %v", tt.name, tt.strip, got, ok, tt.expected, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package downloader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"xcp/internal/github"
+	"xcp/internal/logger"
+	"xcp/internal/report"
+)
+
+const rawBaseURL = "https://raw.githubusercontent.com"
+
+// RawDownloader fetches single files from raw.githubusercontent.com (or a
+// GitHub Enterprise host's /raw), which costs no API quota and transfers only the file itself
+type RawDownloader struct {
+	httpClient *http.Client
+	baseURL    string
+	stdout     io.Writer
+	stderr     io.Writer
+	log        *logger.Logger
+	rec        report.Recorder
+	trees      TreeSource
+}
+
+// NewRawDownloader creates a new RawDownloader
+func NewRawDownloader(stdout, stderr io.Writer) *RawDownloader {
+	return &RawDownloader{
+		httpClient: &http.Client{
+			Timeout: 5 * time.Minute,
+		},
+		baseURL: rawBaseURL,
+		stdout:  stdout,
+		stderr:  stderr,
+		log:     logger.New(stderr, logger.Normal),
+		rec:     report.Nop{},
+	}
+}
+
+// SetLogger sets the logger used for status and diagnostic output
+func (rd *RawDownloader) SetLogger(l *logger.Logger) {
+	rd.log = l
+	logger.WrapClient(rd.httpClient, l)
+}
+
+// SetHost fetches files from host's raw content server, authenticating with
+// its token and trusting its CA bundle. Call it before SetLogger, which logs
+// through the client it installs.
+func (rd *RawDownloader) SetHost(host github.Host) error {
+	client, err := host.HTTPClient(rd.httpClient.Timeout)
+	if err != nil {
+		return err
+	}
+	rd.httpClient = client
+	rd.baseURL = host.Raw
+	return nil
+}
+
+// SetRecorder sets the recorder told about the file written
+func (rd *RawDownloader) SetRecorder(rec report.Recorder) {
+	rd.rec = rec
+}
+
+// SetTrees sets where the tree giving a file's mode and blob SHA is read
+// from. The raw server reports neither, so without it every file is written
+// 0644 and none can be verified.
+func (rd *RawDownloader) SetTrees(trees TreeSource) {
+	rd.trees = trees
+}
+
+// rawURL returns the raw content URL for source. A source without a ref
+// resolves to the repository's default branch through HEAD.
+func (rd *RawDownloader) rawURL(source *github.GitHubSource) string {
+	ref := source.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	return fmt.Sprintf("%s/%s/%s/%s/%s", rd.baseURL, url.PathEscape(source.Owner), url.PathEscape(source.Repo),
+		escapeSegments(ref), escapeSegments(source.Path))
+}
+
+// escapeSegments escapes each /-separated segment of p, so characters such
+// as # and ? stay part of the path while the separators are kept
+func escapeSegments(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// Download streams the single file named by source to destPath or stdout
+func (rd *RawDownloader) Download(ctx context.Context, source *github.GitHubSource, destPath string, opts DownloadOptions) error {
+	if destPath == "" && !opts.OutputToStdout {
+		return ErrInvalidDestination
+	}
+	if source.Path == "" {
+		return fmt.Errorf("%w: raw method requires a file path", github.ErrFileNotFound)
+	}
+
+	// Check if file exists before spending a request
+	_, statErr := os.Stat(destPath)
+	if !opts.OutputToStdout && statErr == nil && !opts.Overwrite {
+		return fmt.Errorf("file already exists: %s", destPath)
+	}
+
+	rawURL := rd.rawURL(source)
+	rd.log.Verbosef("Fetching %s", rawURL)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := rd.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%w: %v", github.ErrNetworkFailure, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return fmt.Errorf("failed to download file: %w", github.ErrFileNotFound)
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		return fmt.Errorf("failed to download file: %w", github.ErrRateLimitExceeded)
+	default:
+		return fmt.Errorf("failed to download file: unexpected status code: %d", resp.StatusCode)
+	}
+
+	// A file written to disk needs its mode from the tree, and a verified
+	// one its blob SHA
+	var blob github.TreeEntry
+	if !opts.OutputToStdout || opts.Verify {
+		if blob, err = rd.lookup(ctx, source); err != nil {
+			if opts.Verify {
+				return fmt.Errorf("%w: %s: %w", ErrUnverifiable, source.Path, err)
+			}
+			rd.log.Verbosef("Could not read the mode of %s (%v); the executable bit will not be set", source.Path, err)
+		}
+	}
+
+	var body io.Reader = &contextReader{ctx: ctx, r: resp.Body}
+	if blob.Sha != "" && blob.Size >= 0 {
+		body = newBlobReader(body, source.Path, blob)
+	} else if opts.Verify {
+		return fmt.Errorf("%w: no blob SHA known for %s", ErrUnverifiable, source.Path)
+	}
+	hash := sha256.New()
+
+	if opts.OutputToStdout {
+		n, err := io.Copy(io.MultiWriter(rd.stdout, hash), body)
+		if err != nil {
+			return err
+		}
+		rd.rec.File(report.File{Path: "-", Action: report.Written, Size: n, SHA256: hex.EncodeToString(hash.Sum(nil))})
+		return nil
+	}
+
+	// Create destination directory if it doesn't exist
+	destDir := filepath.Dir(destPath)
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrFailedToCreateDir, destDir, err)
+	}
+
+	mode := os.FileMode(0644)
+	if blob.Mode == github.ExecutableMode {
+		mode = 0755
+	}
+
+	n, err := writeFileAtomic(destPath, io.TeeReader(body, hash), opts.Mode.fileMode(mode))
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrFailedToWriteFile, destPath, err)
+	}
+
+	action := report.Overwritten
+	if os.IsNotExist(statErr) {
+		action = report.Written
+	}
+	rd.rec.File(report.File{Path: destPath, Action: action, Size: n, SHA256: hex.EncodeToString(hash.Sum(nil))})
+
+	rd.log.Infof("Downloaded %s to %s", source.Path, destPath)
+	return nil
+}
+
+// lookup returns the entry of source's file in the tree of its ref
+func (rd *RawDownloader) lookup(ctx context.Context, source *github.GitHubSource) (github.TreeEntry, error) {
+	if rd.trees == nil {
+		return github.TreeEntry{}, errors.New("no repository tree available")
+	}
+
+	tree, err := rd.trees.GetTree(ctx, source.Owner, source.Repo, source.Ref)
+	if err != nil {
+		return github.TreeEntry{}, err
+	}
+	for _, entry := range tree.Entries {
+		if entry.Type == "blob" && entry.Path == source.Path {
+			return entry, nil
+		}
+	}
+	if tree.Truncated {
+		return github.TreeEntry{}, errors.New("repository tree is truncated")
+	}
+	return github.TreeEntry{}, fmt.Errorf("%s is not in the repository tree", source.Path)
+}
@@ -0,0 +1,187 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"xcp/internal/github"
+	xtest "xcp/internal/testing"
+)
+
+func TestRawDownloader_Download(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/owner/repo/HEAD/dir/file.txt", "/owner/repo/v1.0.0/dir/file.txt":
+			io.WriteString(w, "raw content")
+		case "/owner/repo/HEAD/dir/a #1?50%.txt":
+			io.WriteString(w, "special content")
+		case "/owner/repo/HEAD/limited.txt":
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	stdout := new(bytes.Buffer)
+	rd := NewRawDownloader(stdout, new(bytes.Buffer))
+	rd.httpClient = server.Client()
+	rd.baseURL = server.URL
+
+	source := &github.GitHubSource{Owner: "owner", Repo: "repo", Path: "dir/file.txt", IsFile: true}
+	destPath := filepath.Join(t.TempDir(), "out", "file.txt")
+
+	// Default branch to a file
+	if err := rd.Download(context.Background(), source, destPath, DownloadOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got, err := os.ReadFile(destPath)
+	if err != nil || string(got) != "raw content" {
+		t.Errorf("Expected raw content in %s, got %q (%v)", destPath, got, err)
+	}
+
+	// Existing file without overwrite
+	if err := rd.Download(context.Background(), source, destPath, DownloadOptions{}); err == nil {
+		t.Errorf("Expected error for existing file")
+	}
+
+	// Explicit ref to stdout
+	tagged := *source
+	tagged.Ref = "v1.0.0"
+	if err := rd.Download(context.Background(), &tagged, "", DownloadOptions{OutputToStdout: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if stdout.String() != "raw content" {
+		t.Errorf("Expected raw content on stdout, got %q", stdout.String())
+	}
+
+	// Characters that would otherwise end the path or start an escape
+	stdout.Reset()
+	special := &github.GitHubSource{Owner: "owner", Repo: "repo", Path: "dir/a #1?50%.txt", IsFile: true}
+	if err := rd.Download(context.Background(), special, "", DownloadOptions{OutputToStdout: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if stdout.String() != "special content" {
+		t.Errorf("Expected special content on stdout, got %q", stdout.String())
+	}
+
+	// Missing file
+	missing := &github.GitHubSource{Owner: "owner", Repo: "repo", Path: "missing.txt", IsFile: true}
+	err = rd.Download(context.Background(), missing, "", DownloadOptions{OutputToStdout: true})
+	if !errors.Is(err, github.ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound, got %v", err)
+	}
+
+	// Rate limited
+	limited := &github.GitHubSource{Owner: "owner", Repo: "repo", Path: "limited.txt", IsFile: true}
+	err = rd.Download(context.Background(), limited, "", DownloadOptions{OutputToStdout: true})
+	if !errors.Is(err, github.ErrRateLimitExceeded) {
+		t.Errorf("Expected ErrRateLimitExceeded, got %v", err)
+	}
+}
+
+func TestRawDownloader_Modes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "#!/bin/sh\n")
+	}))
+	defer server.Close()
+
+	trees := xtest.NewMockGitHubClient()
+	trees.AddTree("owner", "repo", &github.Tree{Entries: []github.TreeEntry{
+		{Path: "bin", Type: "tree", Mode: "040000"},
+		{Path: "bin/run.sh", Type: "blob", Mode: github.ExecutableMode},
+		{Path: "bin/notes.txt", Type: "blob", Mode: "100644"},
+	}})
+
+	tests := []struct {
+		path  string
+		trees TreeSource
+		want  os.FileMode
+	}{
+		{path: "bin/run.sh", trees: trees, want: 0755},
+		{path: "bin/notes.txt", trees: trees, want: 0644},
+		{path: "bin/run.sh", want: 0644},
+		{path: "other/run.sh", trees: trees, want: 0644},
+	}
+
+	for _, tt := range tests {
+		rd := NewRawDownloader(new(bytes.Buffer), new(bytes.Buffer))
+		rd.httpClient = server.Client()
+		rd.baseURL = server.URL
+		if tt.trees != nil {
+			rd.SetTrees(tt.trees)
+		}
+
+		source := &github.GitHubSource{Owner: "owner", Repo: "repo", Path: tt.path, IsFile: true}
+		destPath := filepath.Join(t.TempDir(), "out")
+		if err := rd.Download(context.Background(), source, destPath, DownloadOptions{}); err != nil {
+			t.Fatalf("Unexpected error for %s: %v", tt.path, err)
+		}
+		info, err := os.Stat(destPath)
+		if err != nil {
+			t.Fatalf("Expected %s written: %v", tt.path, err)
+		}
+		if info.Mode().Perm() != tt.want {
+			t.Errorf("Expected %s written %v, got %v", tt.path, tt.want, info.Mode().Perm())
+		}
+	}
+}
+
+func TestRawDownloader_rawURL(t *testing.T) {
+	rd := NewRawDownloader(new(bytes.Buffer), new(bytes.Buffer))
+	rd.baseURL = "https://raw.example.com"
+
+	source := &github.GitHubSource{Owner: "owner", Repo: "repo", Ref: "feature/50%", Path: "docs/a #1?.md", IsFile: true}
+	want := "https://raw.example.com/owner/repo/feature/50%25/docs/a%20%231%3F.md"
+	if got := rd.rawURL(source); got != want {
+		t.Errorf("rawURL() = %q, want %q", got, want)
+	}
+}
+
+func TestRawDownloader_SetHost(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.URL.Path == "/raw/platform/tools/HEAD/run.sh" {
+			io.WriteString(w, "enterprise content")
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	block := &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(block), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := new(bytes.Buffer)
+	rd := NewRawDownloader(stdout, new(bytes.Buffer))
+	host := github.Host{Name: "ghe", Web: server.URL, Raw: server.URL + "/raw", Token: "secret", CAFile: caFile}
+	if err := rd.SetHost(host); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	source := &github.GitHubSource{Host: "ghe", Owner: "platform", Repo: "tools", Path: "run.sh", IsFile: true}
+	if err := rd.Download(context.Background(), source, "", DownloadOptions{OutputToStdout: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if stdout.String() != "enterprise content" {
+		t.Errorf("Expected enterprise content, got %q", stdout.String())
+	}
+
+	host.CAFile = filepath.Join(t.TempDir(), "missing.pem")
+	if err := rd.SetHost(host); !errors.Is(err, github.ErrInvalidCABundle) {
+		t.Errorf("Expected ErrInvalidCABundle, got %v", err)
+	}
+}
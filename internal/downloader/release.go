@@ -0,0 +1,276 @@
+package downloader
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"xcp/internal/github"
+	"xcp/internal/logger"
+	"xcp/internal/report"
+)
+
+// maxChecksumsSize bounds the checksums asset, which is read into memory
+const maxChecksumsSize = 1 << 20
+
+var ErrNoAsset = errors.New("source names no release asset")
+
+// ReleaseClient looks up releases and streams the assets attached to them
+type ReleaseClient interface {
+	GetRelease(ctx context.Context, owner, repo, tag string) (*github.Release, error)
+	OpenAsset(ctx context.Context, asset github.ReleaseAsset) (io.ReadCloser, github.FileInfo, error)
+}
+
+// Extractor extracts the local archive a request names, as the zip and tar
+// downloaders do
+type Extractor interface {
+	Download(ctx context.Context, req DownloadRequest) error
+}
+
+// ReleaseDownloader downloads the assets of a GitHub release that match a
+// name or glob, optionally checking them against a checksums asset and
+// extracting the archives among them
+type ReleaseDownloader struct {
+	client    ReleaseClient
+	stdout    io.Writer
+	stderr    io.Writer
+	tempDir   string
+	log       *logger.Logger
+	rec       report.Recorder
+	checksums string
+	zip       Extractor
+	tar       Extractor
+}
+
+// NewReleaseDownloader creates a new ReleaseDownloader
+func NewReleaseDownloader(client ReleaseClient, stdout, stderr io.Writer) *ReleaseDownloader {
+	return &ReleaseDownloader{
+		client:  client,
+		stdout:  stdout,
+		stderr:  stderr,
+		tempDir: os.TempDir(),
+		log:     logger.New(stderr, logger.Normal),
+		rec:     report.Nop{},
+	}
+}
+
+// SetLogger sets the logger used for status and diagnostic output
+func (rd *ReleaseDownloader) SetLogger(l *logger.Logger) {
+	rd.log = l
+}
+
+// SetRecorder sets the recorder told about the release tag and every asset
+// written
+func (rd *ReleaseDownloader) SetRecorder(rec report.Recorder) {
+	rd.rec = rec
+}
+
+// SetTempDir sets where archives are spooled before they are extracted
+func (rd *ReleaseDownloader) SetTempDir(dir string) {
+	rd.tempDir = dir
+}
+
+// SetChecksums checks every asset against the SHA-256 digest listed for it
+// in the release asset named name, in the format sha256sum writes
+func (rd *ReleaseDownloader) SetChecksums(name string) {
+	rd.checksums = name
+}
+
+// SetExtract extracts zip assets with zip and tarballs with tar into the
+// target directory instead of writing them as they are
+func (rd *ReleaseDownloader) SetExtract(zip, tar Extractor) {
+	rd.zip = zip
+	rd.tar = tar
+}
+
+// Download fetches the assets of the release tagged source.Ref, or the
+// latest release, that match source.Asset. A single asset is written to
+// destPath unless it is a directory; several are written into it.
+func (rd *ReleaseDownloader) Download(ctx context.Context, source *github.GitHubSource, destPath string, opts DownloadOptions) error {
+	if source.Asset == "" {
+		return ErrNoAsset
+	}
+	if destPath == "" || opts.OutputToStdout {
+		return ErrInvalidDestination
+	}
+
+	release, err := rd.client.GetRelease(ctx, source.Owner, source.Repo, source.Ref)
+	if err != nil {
+		return fmt.Errorf("failed to look up release: %w", err)
+	}
+	rd.log.Verbosef("Found release %s of %s/%s with %d assets", release.TagName, source.Owner, source.Repo, len(release.Assets))
+	rd.rec.Resolved(release.TagName, "")
+
+	assets, err := release.MatchAssets(source.Asset)
+	if err != nil {
+		return err
+	}
+
+	var sums map[string]string
+	if rd.checksums != "" {
+		if sums, err = rd.readChecksums(ctx, release); err != nil {
+			return err
+		}
+	}
+
+	// Several assets, or any extracted, need a directory to go into
+	intoDir := len(assets) > 1 || rd.zip != nil || strings.HasSuffix(destPath, string(os.PathSeparator))
+	if info, err := os.Stat(destPath); err == nil && info.IsDir() {
+		intoDir = true
+	}
+
+	for _, asset := range assets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		want := ""
+		if sums != nil && asset.Name != rd.checksums {
+			var listed bool
+			if want, listed = sums[asset.Name]; !listed {
+				return fmt.Errorf("%w: %s is not listed in %s", ErrIntegrityMismatch, asset.Name, rd.checksums)
+			}
+		}
+
+		format := ArchiveFormat(asset.Name)
+		switch {
+		case rd.zip != nil && format != "":
+			err = rd.extractAsset(ctx, source, asset, format, want, destPath)
+		case intoDir:
+			err = rd.writeAsset(ctx, asset, want, filepath.Join(destPath, asset.Name), opts)
+		default:
+			err = rd.writeAsset(ctx, asset, want, destPath, opts)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readChecksums reads the checksums asset of release into a map of asset
+// names to their SHA-256 digests
+func (rd *ReleaseDownloader) readChecksums(ctx context.Context, release *github.Release) (map[string]string, error) {
+	var asset *github.ReleaseAsset
+	for i := range release.Assets {
+		if release.Assets[i].Name == rd.checksums {
+			asset = &release.Assets[i]
+			break
+		}
+	}
+	if asset == nil {
+		return nil, fmt.Errorf("%w: release %s has no %s", github.ErrAssetNotFound, release.TagName, rd.checksums)
+	}
+
+	body, _, err := rd.client.OpenAsset(ctx, *asset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", rd.checksums, err)
+	}
+	defer body.Close()
+
+	sums, err := parseChecksums(io.LimitReader(&contextReader{ctx: ctx, r: body}, maxChecksumsSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", rd.checksums, err)
+	}
+	rd.log.Verbosef("Checking assets against %d digests in %s", len(sums), rd.checksums)
+	return sums, nil
+}
+
+// parseChecksums reads lines of a SHA-256 digest followed by a file name, as
+// written by sha256sum, skipping lines with digests of other lengths
+func parseChecksums(r io.Reader) (map[string]string, error) {
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		digest, name, ok := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		if !ok || len(digest) != sha256.Size*2 {
+			continue
+		}
+		if _, err := hex.DecodeString(digest); err != nil {
+			continue
+		}
+		// A leading * marks files hashed in binary mode
+		name = strings.TrimPrefix(strings.TrimSpace(name), "*")
+		sums[name] = strings.ToLower(digest)
+	}
+	return sums, scanner.Err()
+}
+
+// writeAsset streams asset to destPath, failing before it is put in place
+// when it does not have the digest want
+func (rd *ReleaseDownloader) writeAsset(ctx context.Context, asset github.ReleaseAsset, want, destPath string, opts DownloadOptions) error {
+	_, statErr := os.Stat(destPath)
+	if statErr == nil && !opts.Overwrite {
+		return fmt.Errorf("file already exists: %s", destPath)
+	}
+
+	body, _, err := rd.client.OpenAsset(ctx, asset)
+	if err != nil {
+		return fmt.Errorf("failed to download asset: %w", err)
+	}
+	defer body.Close()
+
+	destDir := filepath.Dir(destPath)
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrFailedToCreateDir, destDir, err)
+	}
+
+	content := newSHA256Reader(&contextReader{ctx: ctx, r: body}, asset.Name, want)
+	n, err := writeFileAtomic(destPath, content, opts.Mode.fileMode(0644))
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrFailedToWriteFile, destPath, err)
+	}
+
+	action := report.Overwritten
+	if os.IsNotExist(statErr) {
+		action = report.Written
+	}
+	rd.rec.File(report.File{Path: destPath, Action: action, Size: n, SHA256: content.sum()})
+
+	rd.log.Infof("Downloaded %s to %s", asset.Name, destPath)
+	return nil
+}
+
+// extractAsset spools the archive asset to a temporary file and extracts it
+// into target with the extractor for its format
+func (rd *ReleaseDownloader) extractAsset(ctx context.Context, source *github.GitHubSource, asset github.ReleaseAsset, format, want, target string) error {
+	body, _, err := rd.client.OpenAsset(ctx, asset)
+	if err != nil {
+		return fmt.Errorf("failed to download asset: %w", err)
+	}
+	defer body.Close()
+
+	// Keep the asset's name so the extractor recognises its format
+	tempFile, err := os.CreateTemp(rd.tempDir, "xcp-asset-*-"+asset.Name)
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tempFile.Name())
+
+	rd.log.Verbosef("Downloading %s to %s", asset.Name, tempFile.Name())
+	_, err = io.Copy(tempFile, newSHA256Reader(&contextReader{ctx: ctx, r: body}, asset.Name, want))
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download asset: %w", err)
+	}
+
+	extractor := rd.tar
+	if format == FormatZip {
+		extractor = rd.zip
+	}
+	return extractor.Download(ctx, DownloadRequest{
+		Owner:   source.Owner,
+		Repo:    source.Repo,
+		Target:  target,
+		Archive: tempFile.Name(),
+	})
+}
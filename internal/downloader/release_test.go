@@ -0,0 +1,168 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"xcp/internal/github"
+)
+
+// stubReleases serves a single release whose assets hold the given content
+type stubReleases struct {
+	tag    string
+	assets map[string][]byte
+}
+
+func (s stubReleases) GetRelease(ctx context.Context, owner, repo, tag string) (*github.Release, error) {
+	if tag != "" && tag != github.LatestRelease && tag != s.tag {
+		return nil, github.ErrReleaseNotFound
+	}
+	release := &github.Release{TagName: s.tag}
+	for name, content := range s.assets {
+		release.Assets = append(release.Assets, github.ReleaseAsset{Name: name, Size: int64(len(content)), URL: name})
+	}
+	return release, nil
+}
+
+func (s stubReleases) OpenAsset(ctx context.Context, asset github.ReleaseAsset) (io.ReadCloser, github.FileInfo, error) {
+	content, ok := s.assets[asset.URL]
+	if !ok {
+		return nil, github.FileInfo{}, github.ErrAssetNotFound
+	}
+	return io.NopCloser(bytes.NewReader(content)), github.FileInfo{Name: asset.Name, Size: int64(len(content))}, nil
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestReleaseDownloader_Download(t *testing.T) {
+	linux := []byte("linux binary")
+	darwin := []byte("darwin binary")
+	releases := stubReleases{tag: "v1.2.3", assets: map[string][]byte{
+		"xcp-linux-amd64":  linux,
+		"xcp-darwin-arm64": darwin,
+		"checksums.txt": []byte(fmt.Sprintf("%s  xcp-linux-amd64\n%s *xcp-darwin-arm64\n",
+			sha256Hex(linux), strings.Repeat("0", 64))),
+	}}
+
+	t.Run("Single asset to a file", func(t *testing.T) {
+		rd := NewReleaseDownloader(releases, new(bytes.Buffer), new(bytes.Buffer))
+		rd.SetChecksums("checksums.txt")
+		dest := filepath.Join(t.TempDir(), "bin", "xcp")
+
+		source := &github.GitHubSource{Owner: "owner", Repo: "repo", Asset: "xcp-linux-*"}
+		if err := rd.Download(context.Background(), source, dest, DownloadOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got, err := os.ReadFile(dest); err != nil || !bytes.Equal(got, linux) {
+			t.Errorf("Expected linux binary in %s, got %q (%v)", dest, got, err)
+		}
+
+		if err := rd.Download(context.Background(), source, dest, DownloadOptions{}); err == nil {
+			t.Errorf("Expected error for existing file")
+		}
+	})
+
+	t.Run("Several assets into a directory", func(t *testing.T) {
+		rd := NewReleaseDownloader(releases, new(bytes.Buffer), new(bytes.Buffer))
+		dest := t.TempDir()
+
+		source := &github.GitHubSource{Owner: "owner", Repo: "repo", Ref: "v1.2.3", Asset: "xcp-*"}
+		if err := rd.Download(context.Background(), source, dest, DownloadOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for _, name := range []string{"xcp-linux-amd64", "xcp-darwin-arm64"} {
+			if _, err := os.Stat(filepath.Join(dest, name)); err != nil {
+				t.Errorf("Expected %s: %v", name, err)
+			}
+		}
+	})
+
+	t.Run("Checksum mismatch", func(t *testing.T) {
+		rd := NewReleaseDownloader(releases, new(bytes.Buffer), new(bytes.Buffer))
+		rd.SetChecksums("checksums.txt")
+		dest := filepath.Join(t.TempDir(), "xcp")
+
+		source := &github.GitHubSource{Owner: "owner", Repo: "repo", Asset: "xcp-darwin-arm64"}
+		err := rd.Download(context.Background(), source, dest, DownloadOptions{})
+		if !errors.Is(err, ErrIntegrityMismatch) {
+			t.Fatalf("Expected ErrIntegrityMismatch, got %v", err)
+		}
+		if _, err := os.Stat(dest); !os.IsNotExist(err) {
+			t.Errorf("Expected no file after a mismatch, got %v", err)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		tests := []struct {
+			name      string
+			source    *github.GitHubSource
+			checksums string
+			expect    error
+		}{
+			{"Unknown tag", &github.GitHubSource{Owner: "owner", Repo: "repo", Ref: "v9", Asset: "xcp-*"}, "", github.ErrReleaseNotFound},
+			{"No matching asset", &github.GitHubSource{Owner: "owner", Repo: "repo", Asset: "*.zip"}, "", github.ErrAssetNotFound},
+			{"No checksums asset", &github.GitHubSource{Owner: "owner", Repo: "repo", Asset: "xcp-*"}, "SHA256SUMS", github.ErrAssetNotFound},
+			{"No asset", &github.GitHubSource{Owner: "owner", Repo: "repo"}, "", ErrNoAsset},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				rd := NewReleaseDownloader(releases, new(bytes.Buffer), new(bytes.Buffer))
+				rd.SetChecksums(tt.checksums)
+				err := rd.Download(context.Background(), tt.source, t.TempDir(), DownloadOptions{})
+				if !errors.Is(err, tt.expect) {
+					t.Errorf("Expected %v, got %v", tt.expect, err)
+				}
+			})
+		}
+	})
+}
+
+func TestReleaseDownloader_Extract(t *testing.T) {
+	archive := writeZip(t, map[string]string{"xcp-1.2.3/bin/xcp": "binary", "xcp-1.2.3/README.md": "readme"})
+	releases := stubReleases{tag: "v1.2.3", assets: map[string][]byte{
+		"xcp-linux-amd64.zip": archive,
+		"checksums.txt":       []byte(sha256Hex(archive) + "  xcp-linux-amd64.zip\n"),
+	}}
+
+	rd := NewReleaseDownloader(releases, new(bytes.Buffer), new(bytes.Buffer))
+	rd.SetTempDir(t.TempDir())
+	rd.SetChecksums("checksums.txt")
+	rd.SetExtract(NewZipDownloader(new(bytes.Buffer), new(bytes.Buffer)), NewTarDownloader(new(bytes.Buffer), new(bytes.Buffer)))
+	dest := filepath.Join(t.TempDir(), "tools")
+
+	source := &github.GitHubSource{Owner: "owner", Repo: "repo", Asset: "*.zip"}
+	if err := rd.Download(context.Background(), source, dest, DownloadOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dest, "bin", "xcp")); err != nil || string(got) != "binary" {
+		t.Errorf("Expected bin/xcp extracted from the top-level directory, got %q (%v)", got, err)
+	}
+}
+
+func TestParseChecksums(t *testing.T) {
+	digest := strings.Repeat("ab", 32)
+	input := digest + "  tools.tar.gz\n" +
+		strings.ToUpper(digest) + " *tools.zip\n" +
+		"d41d8cd98f00b204e9800998ecf8427e  md5-only.txt\n" +
+		"\n"
+
+	sums, err := parseChecksums(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(sums) != 2 || sums["tools.tar.gz"] != digest || sums["tools.zip"] != digest {
+		t.Errorf("Unexpected checksums %v", sums)
+	}
+}
@@ -0,0 +1,237 @@
+package downloader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"xcp/internal/report"
+)
+
+// stagingPrefix names the temporary directories and files that hold output
+// until it is complete
+const stagingPrefix = ".xcp-staging-"
+
+// newStagingDir creates an empty directory on the same filesystem as
+// targetPath into which output can be written before being committed. It
+// reports whether targetPath already existed.
+func newStagingDir(targetPath string) (string, bool, error) {
+	parent := targetPath
+	targetExists := true
+
+	if _, err := os.Stat(targetPath); os.IsNotExist(err) {
+		targetExists = false
+		parent = filepath.Dir(targetPath)
+		if err := os.MkdirAll(parent, 0755); err != nil {
+			return "", false, err
+		}
+	} else if err != nil {
+		return "", false, err
+	}
+
+	staging, err := os.MkdirTemp(parent, stagingPrefix+"*")
+	if err != nil {
+		return "", false, err
+	}
+
+	return staging, targetExists, nil
+}
+
+// withinRoot reports whether path is root or lies underneath it, guarding
+// against archive entries that try to escape the extraction directory
+func withinRoot(root, path string) bool {
+	cleanRoot := filepath.Clean(root)
+	cleanPath := filepath.Clean(path)
+	return cleanPath == cleanRoot || strings.HasPrefix(cleanPath, cleanRoot+string(os.PathSeparator))
+}
+
+// commitStaging moves the contents of staging into targetPath. A target that
+// did not exist is swapped in with a single rename. Otherwise each file is
+// renamed into place, so no file is ever observed half-written, and files
+// it replaces are set aside until every rename has succeeded; if one fails,
+// the files already moved are rolled back. A crash mid-commit can still
+// leave the target partly updated, with the replaced files kept in a
+// staging directory next to it.
+func commitStaging(staging, targetPath string, targetExists bool) error {
+	if !targetExists {
+		// The staging directory was created private; give it the mode a
+		// freshly made directory would have
+		if err := os.Chmod(staging, ModePolicy{}.dirMode(0)); err != nil {
+			return err
+		}
+		return os.Rename(staging, targetPath)
+	}
+
+	var c stagingCommit
+	err := filepath.WalkDir(staging, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(staging, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		dest := filepath.Join(targetPath, rel)
+
+		if d.IsDir() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			return c.mkdir(dest, info.Mode().Perm()|0700)
+		}
+
+		return c.rename(staging, path, dest)
+	})
+	if err != nil {
+		c.rollback()
+		return fmt.Errorf("failed to move extracted files into place: %w", err)
+	}
+
+	if c.backup != "" {
+		os.RemoveAll(c.backup)
+	}
+	return os.RemoveAll(staging)
+}
+
+// stagingCommit records what committing a staging directory into an
+// existing target changed, so it can be undone
+type stagingCommit struct {
+	backup  string   // Directory holding the files that were replaced
+	dirs    []string // Directories created in the target
+	renamed []stagedRename
+}
+
+// stagedRename is a file moved into the target, with where the file it
+// replaced was set aside
+type stagedRename struct {
+	dest, replaced string
+}
+
+// mkdir creates dest unless it exists, remembering it if it was created
+func (c *stagingCommit) mkdir(dest string, perm os.FileMode) error {
+	if _, err := os.Lstat(dest); err == nil {
+		return nil
+	}
+	if err := os.Mkdir(dest, perm); err != nil {
+		return err
+	}
+	c.dirs = append(c.dirs, dest)
+	return nil
+}
+
+// rename moves the staged file path to dest, first setting aside any file
+// already there in a backup directory next to staging
+func (c *stagingCommit) rename(staging, path, dest string) error {
+	replaced := ""
+	if _, err := os.Lstat(dest); err == nil {
+		if c.backup == "" {
+			backup, err := os.MkdirTemp(filepath.Dir(staging), stagingPrefix+"replaced-*")
+			if err != nil {
+				return err
+			}
+			c.backup = backup
+		}
+		replaced = filepath.Join(c.backup, strconv.Itoa(len(c.renamed)))
+		if err := os.Rename(dest, replaced); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Rename(path, dest); err != nil {
+		if replaced != "" {
+			os.Rename(replaced, dest)
+		}
+		return err
+	}
+	c.renamed = append(c.renamed, stagedRename{dest: dest, replaced: replaced})
+	return nil
+}
+
+// rollback undoes the renames and directories of a failed commit, newest
+// first, restoring the files that were replaced
+func (c *stagingCommit) rollback() {
+	for i := len(c.renamed) - 1; i >= 0; i-- {
+		r := c.renamed[i]
+		os.Remove(r.dest)
+		if r.replaced != "" {
+			os.Rename(r.replaced, r.dest)
+		}
+	}
+	for i := len(c.dirs) - 1; i >= 0; i-- {
+		os.Remove(c.dirs[i])
+	}
+	if c.backup != "" {
+		os.RemoveAll(c.backup)
+	}
+}
+
+// writeFileAtomic streams r into a temporary file next to destPath and
+// renames it over destPath once the copy has fully succeeded. It returns the
+// number of bytes written.
+func writeFileAtomic(destPath string, r io.Reader, perm os.FileMode) (int64, error) {
+	tempFile, err := os.CreateTemp(filepath.Dir(destPath), stagingPrefix+filepath.Base(destPath)+"-*")
+	if err != nil {
+		return 0, err
+	}
+	tempPath := tempFile.Name()
+
+	n, err := io.Copy(tempFile, r)
+	if err != nil {
+		tempFile.Close()
+		os.Remove(tempPath)
+		return 0, err
+	}
+
+	if err := tempFile.Close(); err != nil {
+		os.Remove(tempPath)
+		return 0, err
+	}
+
+	if err := os.Chmod(tempPath, perm); err != nil {
+		os.Remove(tempPath)
+		return 0, err
+	}
+
+	if err := os.Rename(tempPath, destPath); err != nil {
+		os.Remove(tempPath)
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// writeStagedFile writes r to path, returning its size and SHA-256 digest
+func writeStagedFile(r io.Reader, path string, perm os.FileMode) (report.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return report.File{}, fmt.Errorf("failed to create parent directory: %v", err)
+	}
+
+	outFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return report.File{}, fmt.Errorf("failed to create target file: %v", err)
+	}
+	defer outFile.Close()
+
+	// Creation is subject to the umask, which perm already accounts for
+	if err := outFile.Chmod(perm); err != nil {
+		return report.File{}, fmt.Errorf("failed to set file mode: %v", err)
+	}
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(outFile, hash), r)
+	if err != nil {
+		return report.File{}, fmt.Errorf("failed to copy file content: %w", err)
+	}
+
+	return report.File{Size: n, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
@@ -0,0 +1,99 @@
+package downloader
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommitStaging(t *testing.T) {
+	write := func(t *testing.T, path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(path string) string {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err.Error()
+		}
+		return string(content)
+	}
+	leftovers := func(t *testing.T, dir string) {
+		t.Helper()
+		entries, _ := os.ReadDir(dir)
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), stagingPrefix) {
+				t.Errorf("Expected no staging leftovers, found %s", entry.Name())
+			}
+		}
+	}
+
+	t.Run("New target gets a normal directory mode", func(t *testing.T) {
+		target := filepath.Join(t.TempDir(), "out")
+		staging, exists, err := newStagingDir(target)
+		if err != nil || exists {
+			t.Fatalf("Unexpected staging %v, %v", exists, err)
+		}
+		write(t, filepath.Join(staging, "a.txt"), "new")
+
+		if err := commitStaging(staging, target, exists); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		info, err := os.Stat(target)
+		if err != nil || info.Mode().Perm() != (ModePolicy{}).dirMode(0) {
+			t.Errorf("Expected mode %v, got %v (%v)", ModePolicy{}.dirMode(0), info.Mode().Perm(), err)
+		}
+	})
+
+	t.Run("Existing target is updated", func(t *testing.T) {
+		target := t.TempDir()
+		write(t, filepath.Join(target, "a.txt"), "old")
+		staging, exists, err := newStagingDir(target)
+		if err != nil || !exists {
+			t.Fatalf("Unexpected staging %v, %v", exists, err)
+		}
+		write(t, filepath.Join(staging, "a.txt"), "new")
+		write(t, filepath.Join(staging, "sub", "b.txt"), "b")
+
+		if err := commitStaging(staging, target, exists); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if read(filepath.Join(target, "a.txt")) != "new" || read(filepath.Join(target, "sub", "b.txt")) != "b" {
+			t.Errorf("Expected the staged files in place")
+		}
+		leftovers(t, target)
+	})
+
+	t.Run("Failure rolls back", func(t *testing.T) {
+		target := t.TempDir()
+		write(t, filepath.Join(target, "a.txt"), "old")
+		// A file where the staging holds a directory makes the last rename fail
+		write(t, filepath.Join(target, "b"), "blocker")
+		staging, exists, err := newStagingDir(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		write(t, filepath.Join(staging, "a.txt"), "new")
+		write(t, filepath.Join(staging, "a_new", "x.txt"), "x")
+		write(t, filepath.Join(staging, "b", "c.txt"), "c")
+
+		if err := commitStaging(staging, target, exists); err == nil {
+			t.Fatalf("Expected an error")
+		}
+		if got := read(filepath.Join(target, "a.txt")); got != "old" {
+			t.Errorf("Expected a.txt restored, got %q", got)
+		}
+		if _, err := os.Stat(filepath.Join(target, "a_new")); !os.IsNotExist(err) {
+			t.Errorf("Expected the created directory removed, got %v", err)
+		}
+		if got := read(filepath.Join(target, "b")); got != "blocker" {
+			t.Errorf("Expected b untouched, got %q", got)
+		}
+	})
+}
@@ -0,0 +1,298 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"xcp/internal/logger"
+	"xcp/internal/report"
+)
+
+// SymlinkMode selects how symbolic links found in an archive are extracted
+type SymlinkMode string
+
+const (
+	// SymlinksPreserve recreates links as symlinks
+	SymlinksPreserve SymlinkMode = "preserve"
+	// SymlinksFollow replaces links with a copy of what they point to
+	SymlinksFollow SymlinkMode = "follow"
+	// SymlinksSkip leaves links out of the output
+	SymlinksSkip SymlinkMode = "skip"
+)
+
+var (
+	ErrInvalidSymlinkMode = errors.New("invalid symlink mode")
+	ErrUnsafeSymlink      = errors.New("unsafe symlink in archive")
+)
+
+const (
+	// maxSymlinkTarget bounds how much of a zip symlink entry is read as its target
+	maxSymlinkTarget = 4096
+	// maxSymlinkDepth bounds how many links are followed while resolving a path
+	maxSymlinkDepth = 40
+)
+
+// ParseSymlinkMode validates a --symlinks value
+func ParseSymlinkMode(s string) (SymlinkMode, error) {
+	switch m := SymlinkMode(s); m {
+	case SymlinksPreserve, SymlinksFollow, SymlinksSkip:
+		return m, nil
+	default:
+		return "", fmt.Errorf("%w %q (want follow, preserve or skip)", ErrInvalidSymlinkMode, s)
+	}
+}
+
+// readLinkTarget reads the target of a symlink stored as entry content
+func readLinkTarget(r io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxSymlinkTarget+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxSymlinkTarget {
+		return "", fmt.Errorf("symlink target longer than %d bytes", maxSymlinkTarget)
+	}
+	return string(data), nil
+}
+
+// linkExtractor creates the symlinks of an archive inside a staging
+// directory and makes sure neither they nor writes through them leave it
+type linkExtractor struct {
+	mode  SymlinkMode
+	root  string
+	log   *logger.Logger
+	links []string
+}
+
+func newLinkExtractor(mode SymlinkMode, root string, log *logger.Logger) *linkExtractor {
+	if mode == "" {
+		mode = SymlinksPreserve
+	}
+	return &linkExtractor{mode: mode, root: root, log: log}
+}
+
+// add creates the link at path pointing to target, unless links are skipped
+func (le *linkExtractor) add(path, target string) error {
+	if le.mode == SymlinksSkip {
+		le.log.Debugf("skipping symlink %s -> %s", path, target)
+		return nil
+	}
+
+	// Catch the obvious escapes before anything is created
+	if target == "" || filepath.IsAbs(target) || strings.HasPrefix(target, "/") ||
+		!withinRoot(le.root, filepath.Join(filepath.Dir(path), target)) {
+		return fmt.Errorf("%w: %s -> %s escapes target", ErrUnsafeSymlink, le.rel(path), target)
+	}
+	if err := le.checkWrite(path); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(path); err == nil {
+		return fmt.Errorf("%w: %s appears more than once", ErrUnsafeSymlink, le.rel(path))
+	}
+
+	// Then the ones that only show up through links already created, such
+	// as a target that climbs out of a link to the root
+	parent, err := le.resolve(le.root, le.rel(filepath.Dir(path)), 0)
+	if err != nil {
+		return err
+	}
+	if _, err := le.resolve(parent, target, 0); err != nil {
+		return fmt.Errorf("%w: %s -> %s escapes target", ErrUnsafeSymlink, le.rel(path), target)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create parent directory: %v", err)
+	}
+	if err := os.Symlink(target, path); err != nil {
+		return fmt.Errorf("failed to create symlink: %v", err)
+	}
+
+	le.links = append(le.links, path)
+	return nil
+}
+
+// checkWrite rejects writing path when a link created earlier would carry
+// the write elsewhere: through one of its parents, possibly outside the
+// root, or by being path itself, which opening the file would follow
+func (le *linkExtractor) checkWrite(path string) error {
+	if len(le.links) == 0 {
+		return nil
+	}
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("%w: %s would be written through a symlink", ErrUnsafeSymlink, le.rel(path))
+	}
+	_, err := le.resolve(le.root, le.rel(filepath.Dir(path)), 0)
+	return err
+}
+
+// finish verifies every link created resolves inside the root and, when
+// following links, replaces each with a copy of its target. Files written
+// as copies are returned.
+func (le *linkExtractor) finish() ([]report.File, error) {
+	resolved := make([]string, len(le.links))
+	for i, link := range le.links {
+		dest, err := le.resolve(le.root, le.rel(link), 0)
+		if err != nil {
+			return nil, err
+		}
+		resolved[i] = dest
+	}
+
+	if le.mode != SymlinksFollow {
+		return nil, nil
+	}
+
+	var copies []report.File
+	for i, link := range le.links {
+		if _, err := os.Lstat(resolved[i]); os.IsNotExist(err) {
+			le.log.Infof("Skipping dangling symlink %s", le.rel(link))
+			if err := os.Remove(link); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if err := os.Remove(link); err != nil {
+			return nil, err
+		}
+		files, err := le.copy(link, resolved[i], link, 0)
+		if err != nil {
+			return nil, err
+		}
+		copies = append(copies, files...)
+	}
+
+	return copies, nil
+}
+
+// copy copies src, which link resolved to, to dest, dereferencing any links
+// found along the way
+func (le *linkExtractor) copy(link, src, dest string, depth int) ([]report.File, error) {
+	if depth >= maxSymlinkDepth {
+		return nil, fmt.Errorf("%w: too many levels of symbolic links: %s", ErrUnsafeSymlink, le.rel(link))
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		in, err := os.Open(src)
+		if err != nil {
+			return nil, err
+		}
+		defer in.Close()
+
+		result, err := writeStagedFile(in, dest, info.Mode().Perm())
+		if err != nil {
+			return nil, err
+		}
+		result.Path = dest
+		return []report.File{result}, nil
+	}
+
+	// A link to one of its own ancestors would copy forever
+	if withinRoot(src, link) {
+		return nil, fmt.Errorf("%w: symlink loop: %s", ErrUnsafeSymlink, le.rel(link))
+	}
+
+	var files []report.File
+	err = filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			inner, err := le.resolve(le.root, le.rel(path), 0)
+			if err != nil {
+				return err
+			}
+			if _, err := os.Lstat(inner); os.IsNotExist(err) {
+				le.log.Infof("Skipping dangling symlink %s", le.rel(path))
+				return nil
+			}
+			copied, err := le.copy(path, inner, target, depth+1)
+			if err != nil {
+				return err
+			}
+			files = append(files, copied...)
+		case d.IsDir():
+			return os.MkdirAll(target, 0755)
+		default:
+			copied, err := le.copy(path, path, target, depth)
+			if err != nil {
+				return err
+			}
+			files = append(files, copied...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// resolve follows rel component by component from base the way the kernel
+// would, expanding links as they are met, and fails as soon as a step leaves
+// the root. Components that do not exist yet are taken literally.
+func (le *linkExtractor) resolve(base, rel string, depth int) (string, error) {
+	if depth >= maxSymlinkDepth {
+		return "", fmt.Errorf("%w: too many levels of symbolic links: %s", ErrUnsafeSymlink, rel)
+	}
+
+	current := base
+	for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			current = filepath.Dir(current)
+		default:
+			current = filepath.Join(current, part)
+		}
+
+		if !withinRoot(le.root, current) {
+			return "", fmt.Errorf("%w: %s escapes target", ErrUnsafeSymlink, rel)
+		}
+
+		info, err := os.Lstat(current)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+
+		target, err := os.Readlink(current)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			return "", fmt.Errorf("%w: %s -> %s escapes target", ErrUnsafeSymlink, le.rel(current), target)
+		}
+		current, err = le.resolve(filepath.Dir(current), target, depth+1)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return current, nil
+}
+
+// rel returns path relative to the root for messages
+func (le *linkExtractor) rel(path string) string {
+	if rel, err := filepath.Rel(le.root, path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
@@ -0,0 +1,228 @@
+package downloader
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// zipEntry describes one entry of a test archive; a non-empty link makes it
+// a symlink pointing there
+type zipEntry struct {
+	name    string
+	content string
+	link    string
+}
+
+// createLinkZip creates a zip holding entries, marking links the way
+// GitHub does through the Unix mode in the external attributes
+func createLinkZip(t *testing.T, zipPath string, entries []zipEntry) {
+	t.Helper()
+
+	file, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatalf("Failed to create zip file: %v", err)
+	}
+	defer file.Close()
+
+	writer := zip.NewWriter(file)
+	defer writer.Close()
+
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		content := e.content
+		if e.link != "" {
+			hdr.SetMode(os.ModeSymlink | 0777)
+			content = e.link
+		} else {
+			hdr.SetMode(0644)
+		}
+
+		fw, err := writer.CreateHeader(hdr)
+		if err != nil {
+			t.Fatalf("Failed to create file in zip: %v", err)
+		}
+		if _, err := io.WriteString(fw, content); err != nil {
+			t.Fatalf("Failed to write file content: %v", err)
+		}
+	}
+}
+
+func TestParseSymlinkMode(t *testing.T) {
+	for _, s := range []string{"follow", "preserve", "skip"} {
+		if mode, err := ParseSymlinkMode(s); err != nil || string(mode) != s {
+			t.Errorf("ParseSymlinkMode(%q) = %q, %v", s, mode, err)
+		}
+	}
+
+	if _, err := ParseSymlinkMode("copy"); !errors.Is(err, ErrInvalidSymlinkMode) {
+		t.Errorf("Expected ErrInvalidSymlinkMode, got %v", err)
+	}
+}
+
+func TestZipDownloader_extractSymlinks(t *testing.T) {
+	entries := []zipEntry{
+		{name: "repo-main/docs/guide.md", content: "# Guide\n"},
+		{name: "repo-main/GUIDE.md", link: "docs/guide.md"},
+		{name: "repo-main/manual", link: "docs"},
+	}
+
+	tests := []struct {
+		mode   SymlinkMode
+		verify func(t *testing.T, target string)
+	}{
+		{
+			mode: SymlinksPreserve,
+			verify: func(t *testing.T, target string) {
+				if link, err := os.Readlink(filepath.Join(target, "GUIDE.md")); err != nil || link != "docs/guide.md" {
+					t.Errorf("Expected GUIDE.md -> docs/guide.md, got %q (%v)", link, err)
+				}
+				if link, err := os.Readlink(filepath.Join(target, "manual")); err != nil || link != "docs" {
+					t.Errorf("Expected manual -> docs, got %q (%v)", link, err)
+				}
+			},
+		},
+		{
+			mode: SymlinksFollow,
+			verify: func(t *testing.T, target string) {
+				for _, name := range []string{"GUIDE.md", filepath.Join("manual", "guide.md")} {
+					path := filepath.Join(target, name)
+					info, err := os.Lstat(path)
+					if err != nil || !info.Mode().IsRegular() {
+						t.Errorf("Expected %s to be a regular file, got %v (%v)", name, info, err)
+						continue
+					}
+					if content, _ := os.ReadFile(path); string(content) != "# Guide\n" {
+						t.Errorf("Unexpected %s content %q", name, content)
+					}
+				}
+			},
+		},
+		{
+			mode: SymlinksSkip,
+			verify: func(t *testing.T, target string) {
+				for _, name := range []string{"GUIDE.md", "manual"} {
+					if _, err := os.Lstat(filepath.Join(target, name)); !os.IsNotExist(err) {
+						t.Errorf("Expected %s to be skipped", name)
+					}
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			tempDir := t.TempDir()
+			zipPath := filepath.Join(tempDir, "links.zip")
+			createLinkZip(t, zipPath, entries)
+
+			target := filepath.Join(tempDir, "target")
+			zd := NewZipDownloader(new(bytes.Buffer), new(bytes.Buffer))
+			zd.SetSymlinkMode(tt.mode)
+
+			if err := zd.extractPath(context.Background(), zipPath, "repo-main", target, extraction{}); err != nil {
+				t.Fatalf("extractPath unexpected error: %v", err)
+			}
+
+			if content, err := os.ReadFile(filepath.Join(target, "docs", "guide.md")); err != nil || string(content) != "# Guide\n" {
+				t.Errorf("Unexpected guide content %q (%v)", content, err)
+			}
+			tt.verify(t, target)
+		})
+	}
+}
+
+func TestZipDownloader_extractUnsafeSymlinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []zipEntry
+		mode    SymlinkMode
+	}{
+		{
+			name:    "Absolute target",
+			entries: []zipEntry{{name: "repo-main/passwd", link: "/etc/passwd"}},
+		},
+		{
+			name:    "Relative escape",
+			entries: []zipEntry{{name: "repo-main/sub/up", link: "../../outside"}},
+		},
+		{
+			name: "Escape through another link",
+			entries: []zipEntry{
+				{name: "repo-main/here", link: "."},
+				{name: "repo-main/up", link: "here/.."},
+			},
+		},
+		{
+			name: "Write through link",
+			entries: []zipEntry{
+				{name: "repo-main/here", link: "."},
+				{name: "repo-main/up", link: "here/.."},
+				{name: "repo-main/up/evil.txt", content: "evil"},
+			},
+		},
+		{
+			name: "Escape through a chain of links",
+			entries: []zipEntry{
+				{name: "repo-main/a/b/l2", link: "../.."},
+				{name: "repo-main/a/b/l1", link: "l2/../../pwned"},
+				{name: "repo-main/a/b/l1", content: "pwned"},
+			},
+		},
+		{
+			name: "File written onto a link",
+			entries: []zipEntry{
+				{name: "repo-main/a/l1", link: "l2"},
+				{name: "repo-main/a/l1", content: "data"},
+			},
+		},
+		{
+			name: "Link named twice",
+			entries: []zipEntry{
+				{name: "repo-main/a/l1", link: "x"},
+				{name: "repo-main/a/l1", link: "y"},
+			},
+		},
+		{
+			name: "Loop when following",
+			entries: []zipEntry{
+				{name: "repo-main/dir/file.txt", content: "data"},
+				{name: "repo-main/dir/self", link: ".."},
+			},
+			mode: SymlinksFollow,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			zipPath := filepath.Join(tempDir, "links.zip")
+			createLinkZip(t, zipPath, tt.entries)
+
+			target := filepath.Join(tempDir, "target")
+			zd := NewZipDownloader(new(bytes.Buffer), new(bytes.Buffer))
+			zd.SetSymlinkMode(tt.mode)
+
+			err := zd.extractPath(context.Background(), zipPath, "repo-main", target, extraction{})
+			if !errors.Is(err, ErrInvalidZipPath) || !errors.Is(err, ErrUnsafeSymlink) {
+				t.Fatalf("Expected ErrUnsafeSymlink, got %v", err)
+			}
+
+			if _, err := os.Stat(target); !os.IsNotExist(err) {
+				t.Errorf("Expected target to be left untouched")
+			}
+			for _, dir := range []string{tempDir, filepath.Dir(tempDir)} {
+				for _, name := range []string{"evil.txt", "pwned"} {
+					if _, err := os.Lstat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+						t.Errorf("Expected nothing written outside the target, found %s", name)
+					}
+				}
+			}
+		})
+	}
+}
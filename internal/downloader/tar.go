@@ -0,0 +1,433 @@
+package downloader
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"xcp/internal/progress"
+	"xcp/internal/report"
+	"xcp/internal/xz"
+)
+
+var (
+	ErrTarDownloadFailed = errors.New("failed to download tar archive")
+	ErrTarExtractFailed  = errors.New("failed to extract tar archive")
+	ErrInvalidTarPath    = errors.New("invalid path in tar archive")
+)
+
+// TarDownloader downloads GitHub repositories as gzipped tarballs, extracting
+// them straight from the response body without spooling to a temporary file.
+// Unlike zip archives, tarballs carry symlinks and executable bits faithfully.
+// Tarballs given by URL or file may also be compressed with xz.
+type TarDownloader struct {
+	*ZipDownloader
+}
+
+// NewTarDownloader creates a new TarDownloader
+func NewTarDownloader(stdout, stderr io.Writer) *TarDownloader {
+	return &TarDownloader{ZipDownloader: NewZipDownloader(stdout, stderr)}
+}
+
+// Download downloads a repository using the tarball method
+func (td *TarDownloader) Download(ctx context.Context, req DownloadRequest) error {
+	// Default ref to main if not specified
+	if req.Ref == "" && !req.givenArchive() {
+		req.Ref = "main"
+	}
+
+	// Extract specific path or entire repository
+	repoPrefix := archivePrefix(req)
+	detect := repoPrefix == ""
+	format := FormatTarGz
+
+	start := time.Now()
+	var archive io.ReadCloser
+	var size int64
+	var err error
+	if req.givenArchive() {
+		// Archives given by URL are spooled so they can be checked and
+		// scanned for their top-level directory like local ones
+		path := req.Archive
+		if req.URL != "" {
+			td.log.Verbosef("Downloading %s", req.URL)
+			format = ArchiveFormat(req.URL)
+			path, err = td.downloadArchive(ctx, req.URL, format, ErrTarDownloadFailed)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if err := os.Remove(path); err != nil {
+					td.log.Warnf("failed to clean up tarball %s: %v", path, err)
+				}
+			}()
+		} else {
+			td.log.Verbosef("Reading tarball %s", req.Archive)
+			format = ArchiveFormat(req.Archive)
+		}
+		archive, size, repoPrefix, err = openLocalTar(path, format, req.SHA256)
+		detect = false
+		if req.StripComponents > 0 {
+			repoPrefix = ""
+		}
+	} else {
+		td.log.Verbosef("Downloading %s/%s@%s as tarball", req.Owner, req.Repo, req.Ref)
+		archive, size, err = td.openTar(ctx, td.archiveURL(req, FormatTarGz))
+	}
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	td.log.Debugf("using archive prefix %q, extracting %q", repoPrefix, req.Path)
+
+	bar := progress.Begin(td.progress, "Downloading", size, progress.Bytes)
+	defer bar.Stop()
+	body := &progress.Reader{R: &contextReader{ctx: ctx, r: archive}, Reporter: td.progress}
+
+	// The commit replaces the ref once the archive header names it
+	ex := td.newExtraction(req.Owner, req.Repo, req.Ref, req.StripComponents)
+
+	err = td.extractTar(ctx, body, bar, format, repoPrefix, detect, req.Path, req.Target, req.Ref, ex)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("failed to extract path from tarball: %w", err)
+	}
+	td.log.Debugf("download and extraction finished in %s", time.Since(start).Round(time.Millisecond))
+
+	td.log.Infof("Successfully downloaded %s/%s to %s", req.Owner, req.Repo, req.Target)
+	return nil
+}
+
+// openTar requests the tarball at url and returns its body and length, -1
+// when unknown
+func (td *TarDownloader) openTar(ctx context.Context, url string) (io.ReadCloser, int64, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrTarDownloadFailed, err)
+	}
+
+	resp, err := td.httpClient.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, 0, ctx.Err()
+		}
+		return nil, 0, fmt.Errorf("%w: network error: %v", ErrTarDownloadFailed, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, 0, fmt.Errorf("%w: %w", ErrTarDownloadFailed, ErrArchiveNotFound)
+		}
+		return nil, 0, fmt.Errorf("%w: unexpected status code %d", ErrTarDownloadFailed, resp.StatusCode)
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+// openLocalTar opens the tarball in format at path and returns it with its
+// size and the directory all its entries live under, or "" when they do not
+// share one. Finding the directory takes a pass over the whole archive, as
+// does checking it has the SHA-256 digest sum, which comes first.
+func openLocalTar(path, format, sum string) (*os.File, int64, string, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, 0, "", fmt.Errorf("%w: %w", ErrTarDownloadFailed, ErrArchiveNotFound)
+	}
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("%w: %v", ErrTarExtractFailed, err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, "", fmt.Errorf("%w: %v", ErrTarExtractFailed, err)
+	}
+	if err := checkSHA256(f, sum); err != nil {
+		f.Close()
+		if errors.Is(err, ErrIntegrityMismatch) {
+			return nil, 0, "", err
+		}
+		return nil, 0, "", fmt.Errorf("%w: %v", ErrTarExtractFailed, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, 0, "", fmt.Errorf("%w: %v", ErrTarExtractFailed, err)
+	}
+	root, err := tarRoot(f, format)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, 0, "", fmt.Errorf("%w: %v", ErrTarExtractFailed, err)
+	}
+	return f, info.Size(), root, nil
+}
+
+// tarRoot returns the directory every entry of a tar stream compressed in
+// format lives under, or "" when the entries do not share one
+func tarRoot(r io.Reader, format string) (string, error) {
+	dr, err := decompress(r, format)
+	if err != nil {
+		return "", err
+	}
+	defer dr.Close()
+
+	var names []string
+	tr := tar.NewReader(dr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return sharedRoot(names), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeXGlobalHeader:
+		case tar.TypeDir:
+			names = append(names, strings.TrimSuffix(hdr.Name, "/")+"/")
+		default:
+			names = append(names, hdr.Name)
+		}
+	}
+}
+
+// decompress returns a reader over the tar stream compressed in format
+func decompress(r io.Reader, format string) (io.ReadCloser, error) {
+	if format == FormatTarXz {
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(xr), nil
+	}
+	return gzip.NewReader(r)
+}
+
+// isChecksumError reports whether err is a failed checksum of the
+// compression format
+func isChecksumError(err error) bool {
+	return errors.Is(err, gzip.ErrChecksum) || errors.Is(err, xz.ErrChecksum)
+}
+
+// extractTar extracts path, relative to the repoPrefix directory, from a
+// tar stream compressed in format into targetPath through a staging
+// directory, applying the same path filtering and traversal protection as
+// extractPath. With detect set, repoPrefix is taken from the first entry;
+// otherwise an empty repoPrefix is the root of the archive. bar, which
+// reading r reports to, is finished once every entry has been read.
+func (td *TarDownloader) extractTar(ctx context.Context, r io.Reader, bar *progress.Task, format, repoPrefix string, detect bool, path, targetPath, ref string, ex extraction) error {
+	gz, err := decompress(r, format)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTarExtractFailed, err)
+	}
+	defer gz.Close()
+
+	// Stage output next to the target
+	stagingPath, targetExists, err := newStagingDir(targetPath)
+	if err != nil {
+		return fmt.Errorf("%w: failed to create staging directory: %v", ErrTarExtractFailed, err)
+	}
+	defer os.RemoveAll(stagingPath)
+
+	tr := tar.NewReader(gz)
+	found := false
+	// Archives extracted from their root always have the prefix
+	sawPrefix := repoPrefix == "" && !detect
+	var extracted []report.File
+	var blobs []stagedBlob
+	links := newLinkExtractor(td.symlinks, stagingPath, td.log)
+	budget := &extractionBudget{limits: td.limits}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if isChecksumError(err) {
+				return fmt.Errorf("%w: %v", ErrIntegrityMismatch, err)
+			}
+			return fmt.Errorf("%w: %v", ErrTarExtractFailed, err)
+		}
+
+		// GitHub records the commit in the global header comment
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			if commit := hdr.PAXRecords["comment"]; commit != "" {
+				td.log.Debugf("archive commit: %s", commit)
+				td.rec.Resolved(ref, commit)
+				if ex.check != nil {
+					ex.check.ref = commit
+				}
+			}
+			continue
+		}
+
+		name, ok := ex.entryName(strings.TrimSuffix(hdr.Name, "/"))
+		if !ok {
+			continue
+		}
+		if detect {
+			repoPrefix, _, _ = strings.Cut(name, "/")
+			detect = false
+		}
+		sourcePath := repoPrefix
+		if path != "" {
+			sourcePath = filepath.Join(repoPrefix, path)
+		}
+		if repoPrefix == "" || strings.HasPrefix(name, repoPrefix+"/") || name == repoPrefix {
+			sawPrefix = true
+		}
+		if !td.pathMatches(name, sourcePath) {
+			continue
+		}
+
+		found = true
+
+		// Calculate relative path from source to target
+		relPath, err := td.getRelativePath(name, sourcePath)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidTarPath, err)
+		}
+
+		// Skip if this is the source directory itself (not its contents)
+		if relPath == "" && hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		// Build staged file path - handle the case where we're extracting a single file
+		stagedPath := filepath.Join(stagingPath, relPath)
+		if relPath == "" {
+			stagedPath = filepath.Join(stagingPath, filepath.Base(name))
+		}
+
+		// Validate path to prevent tar slip attacks
+		if !withinRoot(stagingPath, stagedPath) {
+			return fmt.Errorf("%w: path traversal attempt: %s", ErrInvalidTarPath, hdr.Name)
+		}
+
+		// Never write through a link that leads out of the staging directory
+		if err := links.checkWrite(stagedPath); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidTarPath, err)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := budget.entry(hdr.Name); err != nil {
+				return err
+			}
+			if err := mkdirMode(stagedPath, td.modes.dirMode(hdr.FileInfo().Mode())); err != nil {
+				return fmt.Errorf("%w: failed to create directory %s: %v", ErrTarExtractFailed, relPath, err)
+			}
+
+		case tar.TypeReg:
+			// Tar entries are not compressed individually, so only sizes
+			// and counts are limited
+			content, err := budget.file(hdr.Name, tr, 0)
+			if err != nil {
+				return err
+			}
+			// A stream declares no total up front, so each file is
+			// checked against what is left as it comes
+			if err := checkFreeSpace(stagingPath, hdr.Size); err != nil {
+				return err
+			}
+			result, err := writeStagedFile(content, stagedPath, td.modes.fileMode(hdr.FileInfo().Mode()))
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				var limitErr *LimitError
+				if errors.As(err, &limitErr) {
+					return limitErr
+				}
+				if isChecksumError(err) {
+					return fmt.Errorf("%w: %v", ErrIntegrityMismatch, err)
+				}
+				return fmt.Errorf("%w: failed to extract file %s: %v", ErrTarExtractFailed, hdr.Name, err)
+			}
+			extracted = append(extracted, td.stagedResult(result, stagingPath, stagedPath, targetPath))
+			blobs = append(blobs, stagedBlob{repoPath: repoPath(name), stagedPath: stagedPath})
+			td.log.Debugf("extracted %s", hdr.Name)
+
+		case tar.TypeSymlink:
+			if err := budget.entry(hdr.Name); err != nil {
+				return err
+			}
+			if err := links.add(stagedPath, hdr.Linkname); err != nil {
+				if errors.Is(err, ErrUnsafeSymlink) {
+					return fmt.Errorf("%w: %w", ErrInvalidTarPath, err)
+				}
+				return fmt.Errorf("%w: failed to create symlink %s: %v", ErrTarExtractFailed, hdr.Name, err)
+			}
+			td.log.Debugf("linked %s -> %s", hdr.Name, hdr.Linkname)
+
+		default:
+			td.log.Debugf("skipping %s: unsupported tar entry type %q", hdr.Name, hdr.Typeflag)
+		}
+	}
+	bar.Finish()
+
+	if !found {
+		if !sawPrefix {
+			return fmt.Errorf("%w: no %s/ directory in archive", ErrArchivePrefixMismatch, repoPrefix)
+		}
+		return fmt.Errorf("%w: path '%s' not found in repository", ErrPathNotFoundInZip, filepath.Join(repoPrefix, path))
+	}
+
+	copies, err := links.finish()
+	if err != nil {
+		if errors.Is(err, ErrUnsafeSymlink) {
+			return fmt.Errorf("%w: %w", ErrInvalidTarPath, err)
+		}
+		return fmt.Errorf("%w: failed to copy symlink target: %v", ErrTarExtractFailed, err)
+	}
+	for _, result := range copies {
+		extracted = append(extracted, td.stagedResult(result, stagingPath, result.Path, targetPath))
+	}
+
+	// The stream's checksum is only read once it is exhausted
+	if _, err := io.Copy(io.Discard, gz); err != nil {
+		if isChecksumError(err) {
+			return fmt.Errorf("%w: %v", ErrIntegrityMismatch, err)
+		}
+		return fmt.Errorf("%w: %v", ErrTarExtractFailed, err)
+	}
+
+	if ex.check != nil {
+		td.log.Verbosef("Verifying %d files against the repository tree", len(blobs))
+		if err := ex.check.verify(ctx, blobs); err != nil {
+			return err
+		}
+	}
+
+	// Everything extracted cleanly; move it into the target
+	if err := commitStaging(stagingPath, targetPath, targetExists); err != nil {
+		return fmt.Errorf("%w: %v", ErrTarExtractFailed, err)
+	}
+
+	for _, f := range extracted {
+		td.rec.File(f)
+	}
+
+	if len(extracted) > 0 {
+		td.log.Infof("Extracted %d files", len(extracted))
+	}
+
+	return nil
+}
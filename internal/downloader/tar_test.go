@@ -0,0 +1,303 @@
+package downloader
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"xcp/internal/report"
+)
+
+const testCommit = "0123456789abcdef0123456789abcdef01234567"
+
+// createTestTarball builds a gzipped tarball laid out like GitHub's, with the
+// given extra entries appended
+func createTestTarball(t *testing.T, extra ...*tar.Header) []byte {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+
+	entries := []struct {
+		hdr     *tar.Header
+		content string
+	}{
+		{&tar.Header{Typeflag: tar.TypeXGlobalHeader, Name: "pax_global_header", PAXRecords: map[string]string{"comment": testCommit}}, ""},
+		{&tar.Header{Typeflag: tar.TypeDir, Name: "repo-main/", Mode: 0755}, ""},
+		{&tar.Header{Typeflag: tar.TypeReg, Name: "repo-main/README.md", Mode: 0644}, "# Test Repository\n"},
+		{&tar.Header{Typeflag: tar.TypeDir, Name: "repo-main/bin/", Mode: 0755}, ""},
+		{&tar.Header{Typeflag: tar.TypeReg, Name: "repo-main/bin/run.sh", Mode: 0755}, "#!/bin/sh\n"},
+		{&tar.Header{Typeflag: tar.TypeSymlink, Name: "repo-main/bin/run", Linkname: "run.sh"}, ""},
+	}
+	for _, hdr := range extra {
+		entries = append(entries, struct {
+			hdr     *tar.Header
+			content string
+		}{hdr, ""})
+	}
+
+	for _, e := range entries {
+		e.hdr.Size = int64(len(e.content))
+		if e.hdr.Typeflag == tar.TypeXGlobalHeader {
+			e.hdr.Format = tar.FormatPAX
+		}
+		if err := tw.WriteHeader(e.hdr); err != nil {
+			t.Fatalf("Failed to write tar header: %v", err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatalf("Failed to write tar content: %v", err)
+		}
+	}
+
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func newTarTestDownloader(t *testing.T, data []byte) *TarDownloader {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/owner/repo/archive/main.tar.gz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+
+	td := NewTarDownloader(new(bytes.Buffer), new(bytes.Buffer))
+	td.httpClient = server.Client()
+	td.baseURL = server.URL
+	return td
+}
+
+func TestTarDownloader_Download(t *testing.T) {
+	td := newTarTestDownloader(t, createTestTarball(t))
+	collector := report.NewCollector(new(bytes.Buffer), report.JSON)
+	td.SetRecorder(collector)
+
+	target := filepath.Join(t.TempDir(), "out")
+	err := td.Download(context.Background(), DownloadRequest{Owner: "owner", Repo: "repo", Target: target})
+	if err != nil {
+		t.Fatalf("Download unexpected error: %v", err)
+	}
+
+	if got, err := os.ReadFile(filepath.Join(target, "README.md")); err != nil || string(got) != "# Test Repository\n" {
+		t.Errorf("Unexpected README content %q (%v)", got, err)
+	}
+
+	info, err := os.Stat(filepath.Join(target, "bin", "run.sh"))
+	if err != nil {
+		t.Fatalf("Expected run.sh to exist: %v", err)
+	}
+	if info.Mode().Perm()&0100 == 0 {
+		t.Errorf("Expected run.sh to be executable, got %v", info.Mode())
+	}
+
+	if link, err := os.Readlink(filepath.Join(target, "bin", "run")); err != nil || link != "run.sh" {
+		t.Errorf("Expected bin/run -> run.sh symlink, got %q (%v)", link, err)
+	}
+
+	result := collector.Result()
+	if result.Commit != testCommit {
+		t.Errorf("Expected commit %s, got %q", testCommit, result.Commit)
+	}
+	if len(result.Files) != 2 {
+		t.Errorf("Expected 2 recorded files, got %+v", result.Files)
+	}
+}
+
+func TestTarDownloader_DownloadErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		extra  *tar.Header
+		req    DownloadRequest
+		expect error
+	}{
+		{
+			name:   "Path traversal",
+			extra:  &tar.Header{Typeflag: tar.TypeReg, Name: "repo-main/../../evil.txt", Mode: 0644},
+			req:    DownloadRequest{Owner: "owner", Repo: "repo"},
+			expect: ErrInvalidTarPath,
+		},
+		{
+			name:   "Escaping symlink",
+			extra:  &tar.Header{Typeflag: tar.TypeSymlink, Name: "repo-main/passwd", Linkname: "../../../etc/passwd"},
+			req:    DownloadRequest{Owner: "owner", Repo: "repo"},
+			expect: ErrInvalidTarPath,
+		},
+		{
+			name:   "Missing path",
+			req:    DownloadRequest{Owner: "owner", Repo: "repo", Path: "nonexistent"},
+			expect: ErrPathNotFoundInZip,
+		},
+		{
+			name:   "Missing archive",
+			req:    DownloadRequest{Owner: "owner", Repo: "other"},
+			expect: ErrArchiveNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var extra []*tar.Header
+			if tt.extra != nil {
+				extra = append(extra, tt.extra)
+			}
+			td := newTarTestDownloader(t, createTestTarball(t, extra...))
+			bar := &countingProgress{}
+			td.SetProgress(bar)
+
+			target := filepath.Join(t.TempDir(), "out")
+			tt.req.Target = target
+			err := td.Download(context.Background(), tt.req)
+			if !errors.Is(err, tt.expect) {
+				t.Fatalf("Expected %v, got %v", tt.expect, err)
+			}
+
+			// A bar that was started must end, so the error starts a line
+			if bar.started != bar.finished+bar.stopped {
+				t.Errorf("Expected every progress bar ended once, got %+v", bar)
+			}
+
+			if _, err := os.Stat(target); !os.IsNotExist(err) {
+				t.Errorf("Expected target to be left untouched")
+			}
+		})
+	}
+}
+
+func TestTarDownloader_ChainedSymlinkEscape(t *testing.T) {
+	// Each link passes a lexical check on its own; only resolved through
+	// the first does the second lead outside, and the file then written
+	// onto it would follow it
+	td := newTarTestDownloader(t, createTestTarball(t,
+		&tar.Header{Typeflag: tar.TypeSymlink, Name: "repo-main/a/b/l2", Linkname: "../.."},
+		&tar.Header{Typeflag: tar.TypeSymlink, Name: "repo-main/a/b/l1", Linkname: "l2/../../pwned"},
+		&tar.Header{Typeflag: tar.TypeReg, Name: "repo-main/a/b/l1", Mode: 0644},
+	))
+
+	tempDir := t.TempDir()
+	target := filepath.Join(tempDir, "out")
+	err := td.Download(context.Background(), DownloadRequest{Owner: "owner", Repo: "repo", Target: target})
+	if !errors.Is(err, ErrInvalidTarPath) || !errors.Is(err, ErrUnsafeSymlink) {
+		t.Fatalf("Expected ErrUnsafeSymlink, got %v", err)
+	}
+
+	for _, dir := range []string{tempDir, filepath.Dir(tempDir)} {
+		if _, err := os.Lstat(filepath.Join(dir, "pwned")); !os.IsNotExist(err) {
+			t.Errorf("Expected nothing written outside the target, found %s", filepath.Join(dir, "pwned"))
+		}
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("Expected target to be left untouched")
+	}
+}
+
+func TestTarDownloader_DownloadLocalArchive(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "repo.tar.gz")
+	if err := os.WriteFile(archive, createTestTarball(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	td := NewTarDownloader(new(bytes.Buffer), new(bytes.Buffer))
+	collector := report.NewCollector(new(bytes.Buffer), report.JSON)
+	td.SetRecorder(collector)
+
+	target := filepath.Join(t.TempDir(), "out")
+	err := td.Download(context.Background(), DownloadRequest{Archive: archive, Path: "bin", Target: target})
+	if err != nil {
+		t.Fatalf("Download unexpected error: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(target, "run.sh")); err != nil {
+		t.Errorf("Expected run.sh to be extracted: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "README.md")); !os.IsNotExist(err) {
+		t.Errorf("Expected only bin/ to be extracted")
+	}
+	if result := collector.Result(); result.Commit != testCommit {
+		t.Errorf("Expected commit %s, got %q", testCommit, result.Commit)
+	}
+
+	err = td.Download(context.Background(), DownloadRequest{Archive: archive + ".gone", Target: target})
+	if !errors.Is(err, ErrArchiveNotFound) {
+		t.Errorf("Expected ErrArchiveNotFound, got %v", err)
+	}
+}
+
+// testTarXz is pkg-1.0/README.md and pkg-1.0/src/main.go, compressed with xz
+const testTarXz = "/Td6WFoAAATm1rRGAgAhARYAAAB0L+Wj4Cf/AK1dADgayRV3cRwtFCbpK9R3qk9nlSZcUKzDZPT3eSRonAYTfxThm+o6R1AgOytS6YquVfwpuWqnxUc1bvC0WVZv7+E2HPN1SMMcqOR7DsrXsdg/qVBLlkN83JJAqLk5+vqXypNMCjXQ76L/wyDocfoiAyqEn9tern2X4p2j0Pq+vXukT56JUZhXRZwdMsa991P7VkVdONIPBMnbdM008eV3r8VukWuRjoNynLXaCCAAAAAAAMs/vLhrKOzsAAHJAYBQAACaKjdJscRn+wIAAAAABFla"
+
+func TestTarDownloader_DownloadURL(t *testing.T) {
+	tarXz, err := base64.StdEncoding.DecodeString(testTarXz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tarGz := createTestTarball(t)
+	archives := map[string][]byte{"/pkg-1.0.tar.xz": tarXz, "/repo.tgz": tarGz}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := archives[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	sum := sha256.Sum256(tarXz)
+	tests := []struct {
+		name   string
+		req    DownloadRequest
+		files  []string
+		expect error
+	}{
+		{name: "xz tarball", req: DownloadRequest{URL: server.URL + "/pkg-1.0.tar.xz", Path: "src"}, files: []string{"main.go"}},
+		{name: "Gzipped tarball", req: DownloadRequest{URL: server.URL + "/repo.tgz", Path: "bin"}, files: []string{"run.sh"}},
+		{name: "Strip components", req: DownloadRequest{URL: server.URL + "/pkg-1.0.tar.xz", StripComponents: 2}, files: []string{"main.go"}},
+		{name: "Matching digest", req: DownloadRequest{URL: server.URL + "/pkg-1.0.tar.xz", SHA256: hex.EncodeToString(sum[:])}, files: []string{"README.md", filepath.Join("src", "main.go")}},
+		{name: "Digest mismatch", req: DownloadRequest{URL: server.URL + "/repo.tgz", SHA256: hex.EncodeToString(sum[:])}, expect: ErrIntegrityMismatch},
+		{name: "Missing archive", req: DownloadRequest{URL: server.URL + "/gone.tar.xz"}, expect: ErrArchiveNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			td := NewTarDownloader(new(bytes.Buffer), new(bytes.Buffer))
+			td.httpClient = server.Client()
+			target := filepath.Join(t.TempDir(), "out")
+			tt.req.Target = target
+
+			err := td.Download(context.Background(), tt.req)
+			if tt.expect != nil {
+				if !errors.Is(err, tt.expect) {
+					t.Fatalf("Expected %v, got %v", tt.expect, err)
+				}
+				if _, err := os.Stat(target); !os.IsNotExist(err) {
+					t.Errorf("Expected nothing to be extracted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Download unexpected error: %v", err)
+			}
+			for _, name := range tt.files {
+				if _, err := os.Stat(filepath.Join(target, name)); err != nil {
+					t.Errorf("Expected %s to be extracted: %v", name, err)
+				}
+			}
+		})
+	}
+}
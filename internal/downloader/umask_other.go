@@ -0,0 +1,10 @@
+//go:build !unix
+
+package downloader
+
+import "os"
+
+// currentUmask returns the conventional umask on platforms without one
+func currentUmask() os.FileMode {
+	return 0022
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package downloader
+
+import (
+	"os"
+	"syscall"
+)
+
+// currentUmask returns the process umask, which can only be read by setting it
+func currentUmask() os.FileMode {
+	mask := syscall.Umask(0)
+	syscall.Umask(mask)
+	return os.FileMode(mask)
+}
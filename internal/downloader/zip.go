@@ -2,15 +2,21 @@ package downloader
 
 import (
 	"archive/zip"
+	"context"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 	"xcp/internal/github"
+	"xcp/internal/logger"
+	"xcp/internal/progress"
+	"xcp/internal/report"
 )
 
 var (
@@ -19,14 +25,26 @@ var (
 	ErrPathNotFoundInZip     = errors.New("path not found in zip archive")
 	ErrInvalidZipPath        = errors.New("invalid path in zip archive")
 	ErrDiskSpaceInsufficient = errors.New("insufficient disk space")
+	ErrArchiveNotFound       = errors.New("repository or reference not found (404)")
+	ErrArchivePrefixMismatch = errors.New("archive layout does not match the requested ref")
 )
 
+const githubBaseURL = "https://github.com"
+
 // ZipDownloader downloads GitHub repositories as zip archives
 type ZipDownloader struct {
 	httpClient *http.Client
+	baseURL    string
 	tempDir    string
 	stdout     io.Writer
 	stderr     io.Writer
+	progress   progress.Reporter
+	log        *logger.Logger
+	rec        report.Recorder
+	symlinks   SymlinkMode
+	modes      ModePolicy
+	limits     Limits
+	trees      TreeSource
 }
 
 // DownloadRequest contains the parameters for a zip download
@@ -36,6 +54,19 @@ type DownloadRequest struct {
 	Path   string // Optional: specific path within repo
 	Ref    string // Branch, tag, or commit (default: main)
 	Target string // Local target directory
+
+	// Provider locates the archive on services other than GitHub
+	Provider Provider
+	// Archive is a local archive file read instead of downloading one, and
+	// URL an archive downloaded instead of one of a repository. A single
+	// top-level directory of either is taken as the repository root, unless
+	// StripComponents removes that many leading path components instead.
+	Archive         string
+	URL             string
+	StripComponents int
+	// SHA256 is the hex digest an Archive or URL archive must have; it is
+	// checked before anything is extracted
+	SHA256 string
 }
 
 // NewZipDownloader creates a new ZipDownloader
@@ -44,9 +75,14 @@ func NewZipDownloader(stdout, stderr io.Writer) *ZipDownloader {
 		httpClient: &http.Client{
 			Timeout: 5 * time.Minute, // Longer timeout for large repositories
 		},
-		tempDir: os.TempDir(),
-		stdout:  stdout,
-		stderr:  stderr,
+		baseURL:  githubBaseURL,
+		tempDir:  os.TempDir(),
+		stdout:   stdout,
+		stderr:   stderr,
+		progress: progress.Nop{},
+		log:      logger.New(stderr, logger.Normal),
+		rec:      report.Nop{},
+		limits:   DefaultLimits(),
 	}
 }
 
@@ -56,97 +92,334 @@ func NewZipDownloaderWithTempDir(tempDir string, stdout, stderr io.Writer) *ZipD
 		httpClient: &http.Client{
 			Timeout: 5 * time.Minute,
 		},
-		tempDir: tempDir,
-		stdout:  stdout,
-		stderr:  stderr,
+		baseURL:  githubBaseURL,
+		tempDir:  tempDir,
+		stdout:   stdout,
+		stderr:   stderr,
+		progress: progress.Nop{},
+		log:      logger.New(stderr, logger.Normal),
+		rec:      report.Nop{},
+		limits:   DefaultLimits(),
+	}
+}
+
+// SetLogger sets the logger used for status and diagnostic output. HTTP
+// requests made by the downloader are logged at debug level.
+func (zd *ZipDownloader) SetLogger(l *logger.Logger) {
+	zd.log = l
+	logger.WrapClient(zd.httpClient, l)
+}
+
+// SetHost downloads archives from host, authenticating with its token and
+// trusting its CA bundle. Call it before SetLogger, which logs through the
+// client it installs.
+func (zd *ZipDownloader) SetHost(host github.Host) error {
+	client, err := host.HTTPClient(zd.httpClient.Timeout)
+	if err != nil {
+		return err
+	}
+	zd.httpClient = client
+	zd.baseURL = host.Web
+	return nil
+}
+
+// SetRecorder sets the recorder told about the resolved commit and every
+// file extracted
+func (zd *ZipDownloader) SetRecorder(rec report.Recorder) {
+	zd.rec = rec
+}
+
+// SetProgress sets the reporter fed with download and extraction progress
+func (zd *ZipDownloader) SetProgress(reporter progress.Reporter) {
+	zd.progress = reporter
+}
+
+// SetSymlinkMode sets how symbolic links in the archive are extracted. Links
+// are preserved by default.
+func (zd *ZipDownloader) SetSymlinkMode(mode SymlinkMode) {
+	zd.symlinks = mode
+}
+
+// SetModePolicy sets how the permissions of extracted files are chosen
+func (zd *ZipDownloader) SetModePolicy(policy ModePolicy) {
+	zd.modes = policy
+}
+
+// SetLimits sets the caps on what extracting an archive may consume
+func (zd *ZipDownloader) SetLimits(limits Limits) {
+	zd.limits = limits
+}
+
+// SetVerify makes the downloader compare every extracted file with the git
+// tree of the downloaded commit, fetched from trees. A nil trees turns the
+// comparison off; CRCs are always checked.
+func (zd *ZipDownloader) SetVerify(trees TreeSource) {
+	zd.trees = trees
+}
+
+// extraction is what a single extraction does besides writing entries out.
+// It is passed to each extraction rather than kept on the downloader.
+type extraction struct {
+	strip int        // Leading components dropped from entry names
+	check *treeCheck // Tree extracted files are compared with, or nil
+}
+
+// newExtraction returns the settings for extracting an archive of owner/repo
+// at ref with strip leading components dropped, checked against the tree
+// when verification is on
+func (zd *ZipDownloader) newExtraction(owner, repo, ref string, strip int) extraction {
+	ex := extraction{strip: strip}
+	if zd.trees != nil {
+		ex.check = &treeCheck{trees: zd.trees, owner: owner, repo: repo, ref: ref}
 	}
+	return ex
 }
 
-// Download downloads a repository using the zip method
-func (zd *ZipDownloader) Download(req DownloadRequest) error {
+// Download downloads a repository using the zip method. Cancelling ctx aborts
+// the transfer and removes the temporary archive and any staged output.
+func (zd *ZipDownloader) Download(ctx context.Context, req DownloadRequest) error {
 	// Default ref to main if not specified
-	if req.Ref == "" {
+	if req.Ref == "" && !req.givenArchive() {
 		req.Ref = "main"
 	}
 
-	// Build zip URL
-	zipURL := fmt.Sprintf("https://github.com/%s/%s/archive/%s.zip", req.Owner, req.Repo, req.Ref)
+	var reader *zip.Reader
+	var remote *httpReaderAt
+	var closeArchive func()
+	var err error
+	start := time.Now()
+	if req.Archive != "" {
+		zd.log.Verbosef("Reading zip archive %s", req.Archive)
+		reader, closeArchive, err = openLocalZip(req.Archive, req.SHA256)
+		if err != nil {
+			return err
+		}
+	} else {
+		// Open the archive, reading only the parts needed when a path is
+		// requested and the archive as a whole need not be checked
+		if req.URL != "" {
+			zd.log.Verbosef("Downloading %s", req.URL)
+		} else {
+			zd.log.Verbosef("Downloading %s/%s@%s as zip archive", req.Owner, req.Repo, req.Ref)
+		}
+		reader, remote, closeArchive, err = zd.openArchive(ctx, zd.archiveURL(req, FormatZip), req.Path != "", req.SHA256)
+		if err != nil {
+			return fmt.Errorf("failed to download repository zip: %w", err)
+		}
+	}
+	defer func() { closeArchive() }()
+	zd.log.Debugf("archive opened in %s", time.Since(start).Round(time.Millisecond))
 
-	// Download zip file
-	zipPath, err := zd.downloadZip(zipURL)
-	if err != nil {
-		return fmt.Errorf("failed to download repository zip: %w", err)
+	commit := archiveCommit(reader)
+	zd.log.Debugf("archive commit: %s", commit)
+	if req.Ref != "" || commit != "" {
+		zd.rec.Resolved(req.Ref, commit)
 	}
 
-	// Ensure cleanup
-	defer func() {
-		if err := os.Remove(zipPath); err != nil {
-			fmt.Fprintf(zd.stderr, "Warning: failed to clean up zip file %s: %v\n", zipPath, err)
-		}
-	}()
+	// Verify against the exact commit the archive was built from
+	verifyRef := commit
+	if verifyRef == "" {
+		verifyRef = req.Ref
+	}
+	ex := zd.newExtraction(req.Owner, req.Repo, verifyRef, req.StripComponents)
 
 	// Extract specific path or entire repository
-	repoPrefix := fmt.Sprintf("%s-%s", req.Repo, req.Ref)
+	repoPrefix := archivePrefix(req)
+	if repoPrefix == "" && req.StripComponents == 0 {
+		// Given archives without a top-level directory are extracted from
+		// their root
+		if repoPrefix = archiveRoot(reader); repoPrefix == "" && !req.givenArchive() {
+			return fmt.Errorf("%w: archive has no single top-level directory", ErrArchivePrefixMismatch)
+		}
+	}
 	sourcePath := req.Path
 	if sourcePath != "" {
 		sourcePath = filepath.Join(repoPrefix, req.Path)
 	} else {
 		sourcePath = repoPrefix
 	}
-
-	err = zd.extractPath(zipPath, sourcePath, req.Target)
+	zd.log.Debugf("using archive prefix %q, extracting %q", repoPrefix, sourcePath)
+
+	start = time.Now()
+	err = zd.extract(ctx, reader, sourcePath, req.Target, ex)
+	if err != nil && remote != nil && remote.failed() != nil && ctx.Err() == nil {
+		// A range request failed partway. Nothing was committed, so start
+		// over from the whole archive.
+		zd.log.Debugf("range request failed (%v), downloading full archive", remote.failed())
+		closeArchive()
+		reader, _, closeArchive, err = zd.openArchive(ctx, zd.archiveURL(req, FormatZip), false, req.SHA256)
+		if err != nil {
+			closeArchive = func() {}
+			return fmt.Errorf("failed to download repository zip: %w", err)
+		}
+		err = zd.extract(ctx, reader, sourcePath, req.Target, ex)
+	}
+	if errors.Is(err, ErrPathNotFoundInZip) && repoPrefix != "" && !archiveHasPrefix(reader, repoPrefix) {
+		// GitHub names the top-level directory differently for some refs
+		// (e.g. tags with a leading "v"), so the path may well exist
+		return fmt.Errorf("%w: no %s/ directory in archive", ErrArchivePrefixMismatch, repoPrefix)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to extract path from zip: %w", err)
 	}
+	zd.log.Debugf("extraction finished in %s", time.Since(start).Round(time.Millisecond))
 
-	fmt.Fprintf(zd.stderr, "Successfully downloaded %s/%s to %s\n", req.Owner, req.Repo, req.Target)
+	zd.log.Infof("Successfully downloaded %s/%s to %s", req.Owner, req.Repo, req.Target)
 	return nil
 }
 
-// downloadZip downloads a zip file from the given URL and returns the local path
-func (zd *ZipDownloader) downloadZip(url string) (string, error) {
+// openArchive returns a reader over the zip archive at url and a function
+// that releases it. When partial is set and the server supports byte ranges,
+// only the central directory and the entries actually read are fetched, and
+// the remote file being read is returned too; otherwise the whole archive is
+// spooled to a temporary file. An archive expected to have the SHA-256
+// digest sum is always spooled and checked.
+func (zd *ZipDownloader) openArchive(ctx context.Context, url string, partial bool, sum string) (*zip.Reader, *httpReaderAt, func(), error) {
+	if partial && sum == "" {
+		reader, remote, err := zd.openRemoteArchive(ctx, url)
+		if err == nil {
+			return reader, remote, func() {}, nil
+		}
+		if ctx.Err() != nil {
+			return nil, nil, nil, ctx.Err()
+		}
+		if errors.Is(err, ErrArchiveNotFound) {
+			return nil, nil, nil, fmt.Errorf("%w: %w", ErrZipDownloadFailed, err)
+		}
+		zd.log.Debugf("range requests unavailable (%v), downloading full archive", err)
+	}
+
+	zipPath, err := zd.downloadArchive(ctx, url, FormatZip, ErrZipDownloadFailed)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	removeZip := func() {
+		if err := os.Remove(zipPath); err != nil {
+			zd.log.Warnf("failed to clean up zip file %s: %v", zipPath, err)
+		}
+	}
+
+	reader, closeZip, err := openLocalZip(zipPath, sum)
+	if err != nil {
+		removeZip()
+		return nil, nil, nil, err
+	}
+
+	return reader, nil, func() {
+		closeZip()
+		removeZip()
+	}, nil
+}
+
+// openLocalZip opens the zip archive at path, after checking it has the
+// SHA-256 digest sum, and returns a function that closes it
+func openLocalZip(path, sum string) (*zip.Reader, func(), error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, fmt.Errorf("%w: %w", ErrZipDownloadFailed, ErrArchiveNotFound)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: failed to open zip file: %v", ErrZipExtractFailed, err)
+	}
+
+	info, err := f.Stat()
+	if err == nil {
+		err = checkSHA256(f, sum)
+	}
+	var reader *zip.Reader
+	if err == nil {
+		reader, err = zip.NewReader(f, info.Size())
+	}
+	if err != nil {
+		f.Close()
+		if errors.Is(err, ErrIntegrityMismatch) {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("%w: failed to open zip file: %v", ErrZipExtractFailed, err)
+	}
+	return reader, func() { f.Close() }, nil
+}
+
+// openRemoteArchive opens the archive at url through HTTP range requests
+func (zd *ZipDownloader) openRemoteArchive(ctx context.Context, url string) (*zip.Reader, *httpReaderAt, error) {
+	remote, err := newHTTPReaderAt(ctx, zd.httpClient, url)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader, err := zip.NewReader(remote, remote.Size())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	zd.log.Debugf("reading %d byte archive with range requests", remote.Size())
+	return reader, remote, nil
+}
+
+// downloadArchive downloads an archive in format from the given URL to a
+// temporary file and returns its path. Failures are reported as failed.
+func (zd *ZipDownloader) downloadArchive(ctx context.Context, url, format string, failed error) (string, error) {
 	// Create HTTP request
-	resp, err := zd.httpClient.Get(url)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", failed, err)
+	}
+
+	resp, err := zd.httpClient.Do(httpReq)
 	if err != nil {
-		return "", fmt.Errorf("%w: network error: %v", ErrZipDownloadFailed, err)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", fmt.Errorf("%w: network error: %v", failed, err)
 	}
 	defer resp.Body.Close()
 
 	// Check response status
 	if resp.StatusCode == http.StatusNotFound {
-		return "", fmt.Errorf("%w: repository or reference not found (404)", ErrZipDownloadFailed)
+		return "", fmt.Errorf("%w: %w", failed, ErrArchiveNotFound)
 	}
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("%w: unexpected status code %d", ErrZipDownloadFailed, resp.StatusCode)
+		return "", fmt.Errorf("%w: unexpected status code %d", failed, resp.StatusCode)
 	}
 
 	// Create temporary file
-	tempFile, err := os.CreateTemp(zd.tempDir, "xcp-download-*.zip")
+	tempFile, err := os.CreateTemp(zd.tempDir, "xcp-download-*."+format)
 	if err != nil {
-		return "", fmt.Errorf("%w: failed to create temp file: %v", ErrZipDownloadFailed, err)
+		return "", fmt.Errorf("%w: failed to create temp file: %v", failed, err)
 	}
 	defer tempFile.Close()
 
 	// Check available disk space (simple heuristic)
 	if resp.ContentLength > 0 {
-		if err := zd.checkDiskSpace(tempFile.Name(), resp.ContentLength); err != nil {
+		if err := zd.checkDiskSpace(filepath.Dir(tempFile.Name()), resp.ContentLength); err != nil {
 			os.Remove(tempFile.Name())
 			return "", err
 		}
 	}
 
 	// Copy response body to file
-	_, err = io.Copy(tempFile, resp.Body)
+	bar := progress.Begin(zd.progress, "Downloading", resp.ContentLength, progress.Bytes)
+	defer bar.Stop()
+	_, err = io.Copy(tempFile, &progress.Reader{R: resp.Body, Reporter: zd.progress})
 	if err != nil {
+		tempFile.Close()
 		os.Remove(tempFile.Name())
-		return "", fmt.Errorf("%w: failed to write zip file: %v", ErrZipDownloadFailed, err)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", fmt.Errorf("%w: failed to write archive: %v", failed, err)
 	}
+	bar.Finish()
 
 	return tempFile.Name(), nil
 }
 
-// extractPath extracts a specific path from the zip archive to the target directory
-func (zd *ZipDownloader) extractPath(zipPath, sourcePath, targetPath string) error {
+// extractPath extracts a specific path from the zip archive to the target
+// directory. Entries are first written to a staging directory and only moved
+// into the target once every entry has been extracted, so a failed or
+// cancelled extraction leaves the target untouched.
+func (zd *ZipDownloader) extractPath(ctx context.Context, zipPath, sourcePath, targetPath string, ex extraction) error {
 	// Open zip file
 	reader, err := zip.OpenReader(zipPath)
 	if err != nil {
@@ -154,25 +427,71 @@ func (zd *ZipDownloader) extractPath(zipPath, sourcePath, targetPath string) err
 	}
 	defer reader.Close()
 
-	// Ensure target directory exists
-	if err := os.MkdirAll(targetPath, 0755); err != nil {
-		return fmt.Errorf("%w: failed to create target directory: %v", ErrZipExtractFailed, err)
+	return zd.extract(ctx, &reader.Reader, sourcePath, targetPath, ex)
+}
+
+// extract extracts sourcePath from an opened archive into targetPath, see
+// extractPath
+func (zd *ZipDownloader) extract(ctx context.Context, reader *zip.Reader, sourcePath, targetPath string, ex extraction) error {
+	// Stage output next to the target
+	stagingPath, targetExists, err := newStagingDir(targetPath)
+	if err != nil {
+		return fmt.Errorf("%w: failed to create staging directory: %v", ErrZipExtractFailed, err)
+	}
+	defer os.RemoveAll(stagingPath)
+
+	// Count the files to extract so progress can be reported against a total,
+	// and refuse archives that admit to going over the limits up front
+	var entries int
+	var total, size int64
+	for _, file := range reader.File {
+		name, ok := ex.entryName(file.Name)
+		if !ok || !zd.pathMatches(name, sourcePath) {
+			continue
+		}
+		if !file.FileInfo().IsDir() {
+			total++
+			size += int64(file.UncompressedSize64)
+			entries++
+		} else if relPath, err := zd.getRelativePath(name, sourcePath); err != nil || relPath != "" {
+			entries++
+		}
+	}
+	budget := &extractionBudget{limits: zd.limits}
+	if err := budget.checkDeclared(entries, size, sourcePath); err != nil {
+		return err
+	}
+	if err := zd.checkDiskSpace(stagingPath, size); err != nil {
+		return err
+	}
+	var bar *progress.Task
+	if total > 0 {
+		bar = progress.Begin(zd.progress, "Extracting", total, progress.Items)
+		defer bar.Stop()
 	}
 
 	found := false
 	extractedCount := 0
+	var extracted []report.File
+	var blobs []stagedBlob
+	links := newLinkExtractor(zd.symlinks, stagingPath, zd.log)
 
 	// Process each file in the zip
 	for _, file := range reader.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		// Check if this file matches our source path
-		if !zd.pathMatches(file.Name, sourcePath) {
+		name, ok := ex.entryName(file.Name)
+		if !ok || !zd.pathMatches(name, sourcePath) {
 			continue
 		}
 
 		found = true
 
 		// Calculate relative path from source to target
-		relPath, err := zd.getRelativePath(file.Name, sourcePath)
+		relPath, err := zd.getRelativePath(name, sourcePath)
 		if err != nil {
 			return fmt.Errorf("%w: %v", ErrInvalidZipPath, err)
 		}
@@ -182,55 +501,129 @@ func (zd *ZipDownloader) extractPath(zipPath, sourcePath, targetPath string) err
 			continue
 		}
 
-		// Build target file path - handle the case where we're extracting a single file
-		var targetFilePath string
+		// Build staged file path - handle the case where we're extracting a single file
+		var stagedFilePath string
 		if relPath == "" {
 			// This is the exact file we want to extract
-			targetFilePath = filepath.Join(targetPath, filepath.Base(file.Name))
+			stagedFilePath = filepath.Join(stagingPath, filepath.Base(name))
 		} else {
-			targetFilePath = filepath.Join(targetPath, relPath)
+			stagedFilePath = filepath.Join(stagingPath, relPath)
 		}
 
 		// Validate path to prevent zip slip attacks
-		cleanTarget := filepath.Clean(targetPath)
-		cleanTargetFile := filepath.Clean(targetFilePath)
-		if !strings.HasPrefix(cleanTargetFile, cleanTarget+string(os.PathSeparator)) &&
-			cleanTargetFile != cleanTarget {
+		if !withinRoot(stagingPath, stagedFilePath) {
 			return fmt.Errorf("%w: path traversal attempt: %s", ErrInvalidZipPath, file.Name)
 		}
 
-		// Extract file or directory
-		if file.FileInfo().IsDir() {
-			if err := os.MkdirAll(targetFilePath, file.FileInfo().Mode()); err != nil {
-				return fmt.Errorf("%w: failed to create directory %s: %v", ErrZipExtractFailed, targetFilePath, err)
+		// Never write through a link that leads out of the staging directory
+		if err := links.checkWrite(stagedFilePath); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidZipPath, err)
+		}
+
+		// Extract file, symlink or directory
+		switch {
+		case file.FileInfo().IsDir():
+			if err := budget.entry(file.Name); err != nil {
+				return err
 			}
-		} else {
-			if err := zd.extractFile(file, targetFilePath); err != nil {
+			if err := mkdirMode(stagedFilePath, zd.modes.dirMode(file.Mode())); err != nil {
+				return fmt.Errorf("%w: failed to create directory %s: %v", ErrZipExtractFailed, relPath, err)
+			}
+
+		case file.Mode()&os.ModeSymlink != 0:
+			if err := budget.entry(file.Name); err != nil {
+				return err
+			}
+			if err := zd.extractSymlink(file, stagedFilePath, links); err != nil {
+				return err
+			}
+			zd.progress.Add(1)
+
+		default:
+			result, err := zd.extractFile(ctx, file, stagedFilePath, budget)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				var limitErr *LimitError
+				if errors.As(err, &limitErr) {
+					return limitErr
+				}
+				if errors.Is(err, zip.ErrChecksum) {
+					return fmt.Errorf("%w: %s: %v", ErrIntegrityMismatch, file.Name, err)
+				}
 				return fmt.Errorf("%w: failed to extract file %s: %v", ErrZipExtractFailed, file.Name, err)
 			}
+			blobs = append(blobs, stagedBlob{repoPath: repoPath(name), stagedPath: stagedFilePath})
 			extractedCount++
+			zd.progress.Add(1)
+
+			extracted = append(extracted, zd.stagedResult(result, stagingPath, stagedFilePath, targetPath))
+			zd.log.Debugf("extracted %s", file.Name)
 		}
 	}
 
+	// End the bar before anything else is reported
+	bar.Finish()
+
 	if !found {
 		return fmt.Errorf("%w: path '%s' not found in repository", ErrPathNotFoundInZip, sourcePath)
 	}
 
+	copies, err := links.finish()
+	if err != nil {
+		if errors.Is(err, ErrUnsafeSymlink) {
+			return fmt.Errorf("%w: %w", ErrInvalidZipPath, err)
+		}
+		return fmt.Errorf("%w: failed to copy symlink target: %v", ErrZipExtractFailed, err)
+	}
+	for _, result := range copies {
+		extracted = append(extracted, zd.stagedResult(result, stagingPath, result.Path, targetPath))
+	}
+
+	if ex.check != nil {
+		zd.log.Verbosef("Verifying %d files against the repository tree", len(blobs))
+		if err := ex.check.verify(ctx, blobs); err != nil {
+			return err
+		}
+	}
+
+	// Everything extracted cleanly; move it into the target
+	if err := commitStaging(stagingPath, targetPath, targetExists); err != nil {
+		return fmt.Errorf("%w: %v", ErrZipExtractFailed, err)
+	}
+
+	for _, f := range extracted {
+		zd.rec.File(f)
+	}
+
 	if extractedCount > 0 {
-		fmt.Fprintf(zd.stderr, "Extracted %d files\n", extractedCount)
+		zd.log.Infof("Extracted %d files", extractedCount)
 	}
 
 	return nil
 }
 
+// stagedResult fills in where a staged file will land and whether it
+// replaces an existing one
+func (zd *ZipDownloader) stagedResult(result report.File, stagingPath, stagedPath, targetPath string) report.File {
+	rel, _ := filepath.Rel(stagingPath, stagedPath)
+	result.Path = filepath.Join(targetPath, rel)
+	result.Action = report.Written
+	if _, err := os.Lstat(result.Path); err == nil {
+		result.Action = report.Overwritten
+	}
+	return result
+}
+
 // pathMatches checks if a zip file path matches the source path we want to extract
 func (zd *ZipDownloader) pathMatches(zipPath, sourcePath string) bool {
 	// Normalize paths
 	zipPath = filepath.ToSlash(zipPath)
 	sourcePath = filepath.ToSlash(sourcePath)
 
-	// Exact match
-	if zipPath == sourcePath {
+	// Exact match, or the whole archive
+	if zipPath == sourcePath || sourcePath == "" {
 		return true
 	}
 
@@ -253,6 +646,11 @@ func (zd *ZipDownloader) getRelativePath(zipPath, sourcePath string) (string, er
 		return "", nil
 	}
 
+	// Everything is under the archive root
+	if sourcePath == "" {
+		return zipPath, nil
+	}
+
 	// If zipPath is under sourcePath, return the relative part
 	if strings.HasPrefix(zipPath, sourcePath+"/") {
 		return strings.TrimPrefix(zipPath, sourcePath+"/"), nil
@@ -261,64 +659,103 @@ func (zd *ZipDownloader) getRelativePath(zipPath, sourcePath string) (string, er
 	return "", fmt.Errorf("path %s is not under source path %s", zipPath, sourcePath)
 }
 
-// extractFile extracts a single file from the zip archive
-func (zd *ZipDownloader) extractFile(file *zip.File, targetPath string) error {
-	// Ensure parent directory exists
-	if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
-		return fmt.Errorf("failed to create parent directory: %v", err)
-	}
-
+// extractFile extracts a single file from the zip archive, returning its size
+// and SHA-256 digest
+func (zd *ZipDownloader) extractFile(ctx context.Context, file *zip.File, targetPath string, budget *extractionBudget) (report.File, error) {
 	// Open file in zip
 	rc, err := file.Open()
 	if err != nil {
-		return fmt.Errorf("failed to open file in zip: %v", err)
+		return report.File{}, fmt.Errorf("failed to open file in zip: %v", err)
 	}
 	defer rc.Close()
 
-	// Create target file
-	outFile, err := os.OpenFile(targetPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.FileInfo().Mode())
+	// Headers can lie about sizes, so count what is actually written
+	r, err := budget.file(file.Name, rc, int64(file.CompressedSize64))
 	if err != nil {
-		return fmt.Errorf("failed to create target file: %v", err)
+		return report.File{}, err
 	}
-	defer outFile.Close()
 
-	// Copy content
-	_, err = io.Copy(outFile, rc)
+	return writeStagedFile(&contextReader{ctx: ctx, r: r}, targetPath, zd.modes.fileMode(file.Mode()))
+}
+
+// extractSymlink recreates a symlink entry, whose content is the link target
+func (zd *ZipDownloader) extractSymlink(file *zip.File, targetPath string, links *linkExtractor) error {
+	rc, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("%w: failed to open file in zip: %v", ErrZipExtractFailed, err)
+	}
+	defer rc.Close()
+
+	target, err := readLinkTarget(rc)
 	if err != nil {
-		return fmt.Errorf("failed to copy file content: %v", err)
+		return fmt.Errorf("%w: failed to read symlink %s: %v", ErrZipExtractFailed, file.Name, err)
+	}
+
+	if err := links.add(targetPath, target); err != nil {
+		if errors.Is(err, ErrUnsafeSymlink) {
+			return fmt.Errorf("%w: %w", ErrInvalidZipPath, err)
+		}
+		return fmt.Errorf("%w: failed to create symlink %s: %v", ErrZipExtractFailed, file.Name, err)
 	}
 
+	zd.log.Debugf("linked %s -> %s", file.Name, target)
 	return nil
 }
 
-// checkDiskSpace performs a basic check for available disk space
-func (zd *ZipDownloader) checkDiskSpace(filePath string, requiredBytes int64) error {
-	// Get file system stats
-	var stat os.FileInfo
-	var err error
+// archiveHasPrefix reports whether any entry of the archive lives under prefix
+func archiveHasPrefix(reader *zip.Reader, prefix string) bool {
+	for _, file := range reader.File {
+		if strings.HasPrefix(file.Name, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
 
-	// Try to get stats of the directory
-	dir := filepath.Dir(filePath)
-	stat, err = os.Stat(dir)
-	if err != nil {
-		return fmt.Errorf("failed to check disk space: %v", err)
+// archiveCommit returns the commit SHA GitHub stores in the archive comment,
+// or an empty string if the archive has none
+func archiveCommit(reader *zip.Reader) string {
+	comment := strings.TrimSpace(reader.Comment)
+	if len(comment) != 40 {
+		return ""
 	}
+	if _, err := hex.DecodeString(comment); err != nil {
+		return ""
+	}
+	return comment
+}
 
-	// This is a basic check - in a real implementation, you might want to use
-	// syscalls to get actual available space. For now, we'll just check if we
-	// can create the file.
-	_ = stat
+// checkDiskSpace fails when the filesystem holding dir has less than
+// requiredBytes available, and warns when that is a lot
+func (zd *ZipDownloader) checkDiskSpace(dir string, requiredBytes int64) error {
+	if err := checkFreeSpace(dir, requiredBytes); err != nil {
+		return err
+	}
 
-	// Simple heuristic: if the required size is very large (>1GB), warn the user
 	if requiredBytes > 1<<30 {
-		fmt.Fprintf(zd.stderr, "Warning: downloading large repository (%.1f MB)\n", float64(requiredBytes)/(1<<20))
+		zd.log.Warnf("writing large repository (%.1f MB)", float64(requiredBytes)/(1<<20))
 	}
 
 	return nil
 }
 
+// checkFreeSpace fails when the filesystem holding dir has less than
+// requiredBytes available
+func checkFreeSpace(dir string, requiredBytes int64) error {
+	available, err := freeSpace(dir)
+	if err != nil {
+		return fmt.Errorf("failed to check disk space: %v", err)
+	}
+
+	if available >= 0 && requiredBytes > available {
+		return fmt.Errorf("%w: need %.1f MB in %s, %.1f MB available", ErrDiskSpaceInsufficient,
+			float64(requiredBytes)/(1<<20), dir, float64(available)/(1<<20))
+	}
+	return nil
+}
+
 // DownloadFromSource downloads using a GitHubSource (adapter for existing interface)
-func (zd *ZipDownloader) DownloadFromSource(source *github.GitHubSource, targetPath string, ref string) error {
+func (zd *ZipDownloader) DownloadFromSource(ctx context.Context, source *github.GitHubSource, targetPath string, ref string) error {
 	req := DownloadRequest{
 		Owner:  source.Owner,
 		Repo:   source.Repo,
@@ -327,5 +764,5 @@ func (zd *ZipDownloader) DownloadFromSource(source *github.GitHubSource, targetP
 		Target: targetPath,
 	}
 
-	return zd.Download(req)
+	return zd.Download(ctx, req)
 }
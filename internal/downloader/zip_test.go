@@ -3,13 +3,32 @@ package downloader
 import (
 	"archive/zip"
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+	"xcp/internal/progress"
+	"xcp/internal/report"
 )
 
+// countingProgress counts the bars started and how they ended
+type countingProgress struct {
+	started, finished, stopped int
+}
+
+func (p *countingProgress) Start(string, int64, progress.Unit) { p.started++ }
+func (p *countingProgress) Add(int64)                          {}
+func (p *countingProgress) Finish()                            { p.finished++ }
+func (p *countingProgress) Stop()                              { p.stopped++ }
+
 func TestZipDownloader_pathMatches(t *testing.T) {
 	zd := &ZipDownloader{}
 
@@ -43,6 +62,12 @@ func TestZipDownloader_pathMatches(t *testing.T) {
 			sourcePath: "repo-main",
 			expected:   true,
 		},
+		{
+			name:       "Archive root matches everything",
+			zipPath:    "src/file.go",
+			sourcePath: "",
+			expected:   true,
+		},
 		{
 			name:       "Partial name match should not match",
 			zipPath:    "repo-main/source-file.txt",
@@ -92,6 +117,13 @@ func TestZipDownloader_getRelativePath(t *testing.T) {
 			expected:    "internal/pkg/file.go",
 			expectError: false,
 		},
+		{
+			name:        "Archive root",
+			zipPath:     "src/file.go",
+			sourcePath:  "",
+			expected:    "src/file.go",
+			expectError: false,
+		},
 		{
 			name:        "Path not under source",
 			zipPath:     "repo-main/other/file.go",
@@ -175,7 +207,7 @@ func TestZipDownloader_extractPath(t *testing.T) {
 			// Create a fresh target directory for each test
 			targetDir := filepath.Join(tempDir, "target-"+strings.ReplaceAll(tt.name, " ", "-"))
 
-			err := zd.extractPath(zipPath, tt.sourcePath, targetDir)
+			err := zd.extractPath(context.Background(), zipPath, tt.sourcePath, targetDir, extraction{})
 
 			if tt.expectError {
 				if err == nil {
@@ -200,6 +232,237 @@ func TestZipDownloader_extractPath(t *testing.T) {
 	}
 }
 
+func TestZipDownloader_extractPathCancelled(t *testing.T) {
+	tempDir := t.TempDir()
+	zipPath := filepath.Join(tempDir, "test.zip")
+	createTestZip(t, zipPath)
+
+	zd := NewZipDownloader(new(bytes.Buffer), new(bytes.Buffer))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	targetDir := filepath.Join(tempDir, "target")
+	err := zd.extractPath(ctx, zipPath, "repo-main", targetDir, extraction{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("extractPath expected context.Canceled, got %v", err)
+	}
+
+	// Nothing should be left behind, including the target directory itself
+	if _, err := os.Stat(targetDir); !os.IsNotExist(err) {
+		t.Errorf("Expected target directory to be removed after cancellation")
+	}
+}
+
+func TestZipDownloader_extractPathFailureLeavesTargetUntouched(t *testing.T) {
+	tempDir := t.TempDir()
+	zipPath := filepath.Join(tempDir, "bad.zip")
+
+	// A valid entry followed by one that escapes the target
+	file, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatalf("Failed to create zip file: %v", err)
+	}
+	writer := zip.NewWriter(file)
+	for _, name := range []string{"repo-main/good.txt", "repo-main/../../evil.txt"} {
+		fw, err := writer.Create(name)
+		if err != nil {
+			t.Fatalf("Failed to create file in zip: %v", err)
+		}
+		io.WriteString(fw, "content")
+	}
+	writer.Close()
+	file.Close()
+
+	targetDir := filepath.Join(tempDir, "target")
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		t.Fatalf("Failed to create target: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(targetDir, "existing.txt"), []byte("keep"), 0644); err != nil {
+		t.Fatalf("Failed to write existing file: %v", err)
+	}
+
+	bar := &countingProgress{}
+	zd := NewZipDownloader(new(bytes.Buffer), new(bytes.Buffer))
+	zd.SetProgress(bar)
+	err = zd.extractPath(context.Background(), zipPath, "repo-main", targetDir, extraction{})
+	if !errors.Is(err, ErrInvalidZipPath) {
+		t.Fatalf("extractPath expected ErrInvalidZipPath, got %v", err)
+	}
+	if bar.started != 1 || bar.stopped != 1 || bar.finished != 0 {
+		t.Errorf("Expected the progress bar stopped, not finished, got %+v", bar)
+	}
+
+	entries, err := os.ReadDir(targetDir)
+	if err != nil {
+		t.Fatalf("Failed to read target directory: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "existing.txt" {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("Expected target to contain only existing.txt, got %v", names)
+	}
+}
+
+func TestZipDownloader_extractPathRecordsFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	zipPath := filepath.Join(tempDir, "test.zip")
+	createTestZip(t, zipPath)
+
+	targetDir := filepath.Join(tempDir, "target")
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		t.Fatalf("Failed to create target: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(targetDir, "main.go"), []byte("old"), 0644); err != nil {
+		t.Fatalf("Failed to write existing file: %v", err)
+	}
+
+	collector := report.NewCollector(io.Discard, report.JSON)
+	bar := &countingProgress{}
+	zd := NewZipDownloader(new(bytes.Buffer), new(bytes.Buffer))
+	zd.SetRecorder(collector)
+	zd.SetProgress(bar)
+
+	if err := zd.extractPath(context.Background(), zipPath, "repo-main/src", targetDir, extraction{}); err != nil {
+		t.Fatalf("extractPath unexpected error: %v", err)
+	}
+	if bar.started != 1 || bar.finished != 1 || bar.stopped != 0 {
+		t.Errorf("Expected the progress bar finished once, got %+v", bar)
+	}
+
+	files := collector.Result().Files
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 recorded file, got %+v", files)
+	}
+
+	content := "package main\n\nfunc main() {}\n"
+	sum := sha256.Sum256([]byte(content))
+	want := report.File{
+		Path:   filepath.Join(targetDir, "main.go"),
+		Action: report.Overwritten,
+		Size:   int64(len(content)),
+		SHA256: hex.EncodeToString(sum[:]),
+	}
+	if files[0] != want {
+		t.Errorf("Recorded %+v, expected %+v", files[0], want)
+	}
+}
+
+func TestZipDownloader_DownloadLocalArchive(t *testing.T) {
+	dir := t.TempDir()
+	rooted := filepath.Join(dir, "rooted.zip")
+	createTestZip(t, rooted)
+	flat := filepath.Join(dir, "flat.zip")
+	createLinkZip(t, flat, []zipEntry{
+		{name: "README.md", content: "# Flat\n"},
+		{name: "src/main.go", content: "package main\n"},
+	})
+
+	tests := []struct {
+		name    string
+		archive string
+		path    string
+		files   []string
+		expect  error
+	}{
+		{name: "Top-level directory is the root", archive: rooted, path: "src", files: []string{"main.go"}},
+		{name: "Whole flat archive", archive: flat, files: []string{"README.md", filepath.Join("src", "main.go")}},
+		{name: "Path in flat archive", archive: flat, path: "src/main.go", files: []string{"main.go"}},
+		{name: "Missing path", archive: flat, path: "docs", expect: ErrPathNotFoundInZip},
+		{name: "Missing archive", archive: filepath.Join(dir, "gone.zip"), expect: ErrArchiveNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zd := NewZipDownloader(new(bytes.Buffer), new(bytes.Buffer))
+			target := filepath.Join(t.TempDir(), "out")
+
+			err := zd.Download(context.Background(), DownloadRequest{Archive: tt.archive, Path: tt.path, Target: target})
+			if tt.expect != nil {
+				if !errors.Is(err, tt.expect) {
+					t.Fatalf("Expected %v, got %v", tt.expect, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Download unexpected error: %v", err)
+			}
+			for _, name := range tt.files {
+				if _, err := os.Stat(filepath.Join(target, name)); err != nil {
+					t.Errorf("Expected %s to be extracted: %v", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestZipDownloader_DownloadURL(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "rooted.zip")
+	createTestZip(t, archive)
+	data, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/releases/v1/rooted.zip" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		http.ServeContent(w, r, "rooted.zip", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+	url := server.URL + "/releases/v1/rooted.zip"
+
+	tests := []struct {
+		name   string
+		req    DownloadRequest
+		files  []string
+		expect error
+	}{
+		{name: "Top-level directory is the root", req: DownloadRequest{URL: url, Path: "src"}, files: []string{"main.go"}},
+		{name: "Strip components", req: DownloadRequest{URL: url, StripComponents: 1, Path: "docs/guide.md"}, files: []string{"guide.md"}},
+		{name: "Matching digest", req: DownloadRequest{URL: url, Path: "src", SHA256: strings.ToUpper(hex.EncodeToString(sum[:]))}, files: []string{"main.go"}},
+		{name: "Digest mismatch", req: DownloadRequest{URL: url, Path: "src", SHA256: strings.Repeat("0", 64)}, expect: ErrIntegrityMismatch},
+		{name: "Local digest mismatch", req: DownloadRequest{Archive: archive, SHA256: strings.Repeat("0", 64)}, expect: ErrIntegrityMismatch},
+		{name: "Missing archive", req: DownloadRequest{URL: server.URL + "/gone.zip"}, expect: ErrArchiveNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zd := NewZipDownloader(new(bytes.Buffer), new(bytes.Buffer))
+			zd.httpClient = server.Client()
+			zd.tempDir = t.TempDir()
+			target := filepath.Join(t.TempDir(), "out")
+			tt.req.Target = target
+
+			err := zd.Download(context.Background(), tt.req)
+			if tt.expect != nil {
+				if !errors.Is(err, tt.expect) {
+					t.Fatalf("Expected %v, got %v", tt.expect, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Download unexpected error: %v", err)
+			}
+			for _, name := range tt.files {
+				if _, err := os.Stat(filepath.Join(target, name)); err != nil {
+					t.Errorf("Expected %s to be extracted: %v", name, err)
+				}
+			}
+
+			// Spooled archives are removed once extracted
+			if entries, _ := os.ReadDir(zd.tempDir); len(entries) != 0 {
+				t.Errorf("Expected temporary archive to be removed, found %d entries", len(entries))
+			}
+		})
+	}
+}
+
 func TestDownloadRequest_validation(t *testing.T) {
 	stdout := new(bytes.Buffer)
 	stderr := new(bytes.Buffer)
@@ -238,7 +501,7 @@ func TestDownloadRequest_validation(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := zd.Download(tt.req)
+			err := zd.Download(context.Background(), tt.req)
 
 			if tt.expectError {
 				if err == nil {
@@ -258,18 +521,21 @@ func TestZipDownloader_checkDiskSpace(t *testing.T) {
 	stderr := new(bytes.Buffer)
 	zd := NewZipDownloader(stdout, stderr)
 
+	originalFreeSpace := freeSpace
+	defer func() { freeSpace = originalFreeSpace }()
+	freeSpace = func(dir string) (int64, error) { return 4 << 30, nil }
+
 	tempDir := t.TempDir()
-	filePath := filepath.Join(tempDir, "test.zip")
 
-	// Test with small file size (should not error)
-	err := zd.checkDiskSpace(filePath, 1024)
+	// Test with small size (should not error)
+	err := zd.checkDiskSpace(tempDir, 1024)
 	if err != nil {
 		t.Errorf("checkDiskSpace with small size unexpected error: %v", err)
 	}
 
-	// Test with large file size (should warn but not error)
+	// Test with large size that still fits (should warn but not error)
 	stderr.Reset()
-	err = zd.checkDiskSpace(filePath, 2<<30) // 2GB
+	err = zd.checkDiskSpace(tempDir, 2<<30) // 2GB
 	if err != nil {
 		t.Errorf("checkDiskSpace with large size unexpected error: %v", err)
 	}
@@ -278,6 +544,12 @@ func TestZipDownloader_checkDiskSpace(t *testing.T) {
 	if !strings.Contains(stderr.String(), "Warning") {
 		t.Errorf("Expected warning for large file, got: %s", stderr.String())
 	}
+
+	// Test with more than is available
+	err = zd.checkDiskSpace(tempDir, 8<<30)
+	if !errors.Is(err, ErrDiskSpaceInsufficient) {
+		t.Errorf("Expected ErrDiskSpaceInsufficient, got %v", err)
+	}
 }
 
 func TestNewZipDownloader(t *testing.T) {
@@ -0,0 +1,221 @@
+package gist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"xcp/internal/github"
+	"xcp/internal/logger"
+)
+
+const defaultTimeout = 30 * time.Second
+
+var ErrTreeUnavailable = errors.New("gists do not serve git trees")
+
+// Client reads gists through the GitHub gists API. It offers the same
+// operations as the GitHub client, reporting results in the same types, so
+// downloaders work with either. Repos are gist IDs, owners are ignored and
+// refs are revisions.
+type Client struct {
+	httpClient *http.Client
+	host       github.Host
+
+	mu    sync.Mutex
+	gists map[string]*Gist // By ID and revision
+}
+
+// File is a file of a gist. Content is left out of responses for large
+// files, which are marked truncated and read from RawURL instead.
+type File struct {
+	Filename  string `json:"filename"`
+	Size      int64  `json:"size"`
+	RawURL    string `json:"raw_url"`
+	Truncated bool   `json:"truncated"`
+	Content   string `json:"content"`
+}
+
+// Gist is a gist at one revision
+type Gist struct {
+	ID      string          `json:"id"`
+	Files   map[string]File `json:"files"`
+	History []struct {
+		Version string `json:"version"`
+	} `json:"history"`
+}
+
+// NewClient creates a client for the gists of the GitHub host described by
+// host
+func NewClient(host github.Host) (*Client, error) {
+	httpClient, err := host.HTTPClient(defaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{httpClient: httpClient, host: host, gists: make(map[string]*Gist)}, nil
+}
+
+// SetLogger logs every request made by the client at debug level
+func (c *Client) SetLogger(l *logger.Logger) {
+	logger.WrapClient(c.httpClient, l)
+}
+
+// gistURL returns the API URL of gist id at revision, or at its latest
+// revision when revision is empty
+func (c *Client) gistURL(id, revision string) string {
+	if revision == "" {
+		return fmt.Sprintf("%s/gists/%s", c.host.API, url.PathEscape(id))
+	}
+	return fmt.Sprintf("%s/gists/%s/%s", c.host.API, url.PathEscape(id), url.PathEscape(revision))
+}
+
+// get requests apiURL and returns the response when it succeeded. A 404 is
+// reported as notFound.
+func (c *Client) get(ctx context.Context, apiURL string, notFound error) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", github.ErrNetworkFailure, err)
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, notFound
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		return nil, github.ErrRateLimitExceeded
+	default:
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+}
+
+// GetGist fetches gist id at revision, or at its latest revision when
+// revision is empty. Gists are cached, so a download reads each revision once.
+func (c *Client) GetGist(ctx context.Context, id, revision string) (*Gist, error) {
+	key := id + "@" + revision
+	c.mu.Lock()
+	cached, ok := c.gists[key]
+	c.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	resp, err := c.get(ctx, c.gistURL(id, revision), fmt.Errorf("%w: gist %s", github.ErrRepositoryNotFound, key))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var gist Gist
+	if err := json.NewDecoder(resp.Body).Decode(&gist); err != nil {
+		return nil, fmt.Errorf("failed to parse gist: %w", err)
+	}
+
+	c.mu.Lock()
+	c.gists[key] = &gist
+	c.mu.Unlock()
+	return &gist, nil
+}
+
+// OpenFile opens a streaming reader over a file of the gist repo at ref.
+// Content the metadata holds is served from it; truncated files are read
+// from their raw URL. The caller must close the returned reader.
+func (c *Client) OpenFile(ctx context.Context, owner, repo, ref, path string) (io.ReadCloser, github.FileInfo, error) {
+	gist, err := c.GetGist(ctx, repo, ref)
+	if err != nil {
+		return nil, github.FileInfo{}, err
+	}
+
+	file, ok := gist.Files[path]
+	if !ok {
+		return nil, github.FileInfo{}, fmt.Errorf("%w: %s", github.ErrFileNotFound, path)
+	}
+	info := github.FileInfo{Name: file.Filename, Path: file.Filename, Size: file.Size}
+	if !file.Truncated {
+		return io.NopCloser(strings.NewReader(file.Content)), info, nil
+	}
+
+	resp, err := c.get(ctx, file.RawURL, fmt.Errorf("%w: %s", github.ErrFileNotFound, path))
+	if err != nil {
+		return nil, github.FileInfo{}, err
+	}
+	if resp.ContentLength >= 0 {
+		info.Size = resp.ContentLength
+	}
+	return resp.Body, info, nil
+}
+
+// GetDirectoryContents lists the files of the gist repo at ref, sorted by
+// name. Gists have no directories, so path must be empty.
+func (c *Client) GetDirectoryContents(ctx context.Context, owner, repo, ref, path string) (github.DirectoryContents, error) {
+	if strings.Trim(path, "/") != "" {
+		return nil, fmt.Errorf("%w: gists have no directories", github.ErrDirectoryNotFound)
+	}
+
+	gist, err := c.GetGist(ctx, repo, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	contents := make(github.DirectoryContents, 0, len(gist.Files))
+	for name, file := range gist.Files {
+		contents = append(contents, github.ContentResponse{
+			Type: github.FileContent,
+			Name: name,
+			Path: name,
+			Size: int(file.Size),
+		})
+	}
+	sort.Slice(contents, func(i, j int) bool { return contents[i].Name < contents[j].Name })
+	return contents, nil
+}
+
+// GetTree fails: the gists API reports no blob SHAs or modes
+func (c *Client) GetTree(ctx context.Context, owner, repo, ref string) (*github.Tree, error) {
+	return nil, ErrTreeUnavailable
+}
+
+// RepositoryExists checks if the gist repo exists and is visible
+func (c *Client) RepositoryExists(ctx context.Context, owner, repo string) (bool, error) {
+	_, err := c.GetGist(ctx, repo, "")
+	if errors.Is(err, github.ErrRepositoryNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ResolveRef finds the revision of the gist repo that ref names. An empty
+// ref is the latest revision, which moves like a branch; revisions, given
+// in full or abbreviated, are commits.
+func (c *Client) ResolveRef(ctx context.Context, owner, repo, ref string) (*github.ResolvedRef, error) {
+	gist, err := c.GetGist(ctx, repo, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(gist.History) == 0 {
+		return nil, fmt.Errorf("%w: gist %s has no revisions", github.ErrRefNotFound, repo)
+	}
+
+	if ref == "" {
+		return &github.ResolvedRef{Ref: ref, Kind: github.RefBranch, Commit: gist.History[0].Version}, nil
+	}
+	for _, revision := range gist.History {
+		if strings.HasPrefix(revision.Version, strings.ToLower(ref)) {
+			return &github.ResolvedRef{Ref: ref, Kind: github.RefCommit, Commit: revision.Version}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: gist %s has no revision %s", github.ErrRefNotFound, repo, ref)
+}
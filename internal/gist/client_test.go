@@ -0,0 +1,141 @@
+package gist
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"xcp/internal/github"
+)
+
+const (
+	gistID      = "aa5a315d61ae9438b18d"
+	latestRev   = "57a7f021a713b1c5a6a199b54cc514735d2d462f"
+	previousRev = "1f4ab1ee2b6c5fbd4b8fbbc5ee6c8b8aa2e0c6c1"
+)
+
+// newTestServer serves the gists API for the gist gistID at two revisions
+func newTestServer(t *testing.T) (*httptest.Server, *Client) {
+	t.Helper()
+
+	history := `"history":[{"version":"` + latestRev + `"},{"version":"` + previousRev + `"}]`
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gists/" + gistID, "/gists/" + gistID + "/" + latestRev:
+			io.WriteString(w, `{"id":"`+gistID+`","files":{
+				"hello.py":{"filename":"hello.py","size":14,"content":"print('hello')"},
+				"big.csv":{"filename":"big.csv","size":9,"truncated":true,"raw_url":"`+server.URL+`/raw/big.csv"}},`+history+`}`)
+		case "/gists/" + gistID + "/" + previousRev:
+			io.WriteString(w, `{"id":"`+gistID+`","files":{"hello.py":{"filename":"hello.py","size":5,"content":"print"}},`+history+`}`)
+		case "/raw/big.csv":
+			io.WriteString(w, "a,b\n1,2\n")
+		case "/gists/ffff":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(github.Host{API: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, client
+}
+
+func TestClient_OpenFile(t *testing.T) {
+	_, client := newTestServer(t)
+
+	tests := []struct {
+		ref      string
+		path     string
+		expected string
+		err      error
+	}{
+		{path: "hello.py", expected: "print('hello')"},
+		{path: "big.csv", expected: "a,b\n1,2\n"},
+		{ref: previousRev, path: "hello.py", expected: "print"},
+		{ref: previousRev, path: "big.csv", err: github.ErrFileNotFound},
+		{path: "", err: github.ErrFileNotFound},
+	}
+
+	for _, tt := range tests {
+		body, info, err := client.OpenFile(context.Background(), "", gistID, tt.ref, tt.path)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s@%s: expected error %v, got %v", tt.path, tt.ref, tt.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		content, _ := io.ReadAll(body)
+		body.Close()
+		if string(content) != tt.expected || info.Name != tt.path {
+			t.Errorf("%s@%s: unexpected file %q %+v", tt.path, tt.ref, content, info)
+		}
+	}
+}
+
+func TestClient_GetDirectoryContents(t *testing.T) {
+	_, client := newTestServer(t)
+
+	contents, err := client.GetDirectoryContents(context.Background(), "", gistID, "", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(contents) != 2 || contents[0].Name != "big.csv" || contents[1].Name != "hello.py" || contents[1].Type != github.FileContent {
+		t.Errorf("Unexpected listing %+v", contents)
+	}
+
+	if _, err := client.GetDirectoryContents(context.Background(), "", gistID, "", "dir"); !errors.Is(err, github.ErrDirectoryNotFound) {
+		t.Errorf("Expected ErrDirectoryNotFound, got %v", err)
+	}
+}
+
+func TestClient_RepositoryExists(t *testing.T) {
+	_, client := newTestServer(t)
+
+	if exists, err := client.RepositoryExists(context.Background(), "", gistID); !exists || err != nil {
+		t.Errorf("Expected gist to exist, got %v (%v)", exists, err)
+	}
+	if exists, err := client.RepositoryExists(context.Background(), "", "abcdef"); exists || err != nil {
+		t.Errorf("Expected missing gist, got %v (%v)", exists, err)
+	}
+	if _, err := client.RepositoryExists(context.Background(), "", "ffff"); !errors.Is(err, github.ErrRateLimitExceeded) {
+		t.Errorf("Expected ErrRateLimitExceeded, got %v", err)
+	}
+}
+
+func TestClient_ResolveRef(t *testing.T) {
+	_, client := newTestServer(t)
+
+	tests := []struct {
+		ref    string
+		kind   github.RefKind
+		commit string
+		err    error
+	}{
+		{ref: "", kind: github.RefBranch, commit: latestRev},
+		{ref: "1f4ab1e", kind: github.RefCommit, commit: previousRev},
+		{ref: latestRev, kind: github.RefCommit, commit: latestRev},
+		{ref: "abcdef0", err: github.ErrRefNotFound},
+	}
+
+	for _, tt := range tests {
+		resolved, err := client.ResolveRef(context.Background(), "", gistID, tt.ref)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%q: expected error %v, got %v", tt.ref, tt.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if resolved.Kind != tt.kind || resolved.Commit != tt.commit || resolved.Ref != tt.ref {
+			t.Errorf("%q: unexpected resolution %+v", tt.ref, resolved)
+		}
+	}
+}
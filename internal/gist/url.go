@@ -0,0 +1,62 @@
+// Package gist reads GitHub gists. Sources are parsed into github.ParsedURL
+// with the gist provider, the gist ID as repo and no owner, so they flow
+// through the same API downloader as repository sources.
+package gist
+
+import (
+	"errors"
+	"strings"
+	"xcp/internal/github"
+)
+
+// Scheme prefixes gist sources and names the provider
+const Scheme = "gist"
+
+var ErrInvalidURL = errors.New("invalid gist URL format")
+
+// IsSource reports whether url is a gist source
+func IsSource(url string) bool {
+	return strings.HasPrefix(url, Scheme+":")
+}
+
+// ParseGistURL parses a gist source. Supported formats:
+//   - gist:id
+//   - gist:id@revision
+//   - gist:id/filename
+//   - gist:id@revision/filename
+//
+// Gists hold files but no directories, so a path names a single file.
+func ParseGistURL(url string) (*github.ParsedURL, error) {
+	rest, ok := strings.CutPrefix(url, Scheme+":")
+	if !ok {
+		return nil, ErrInvalidURL
+	}
+
+	rest, file, _ := strings.Cut(rest, "/")
+	id, revision, explicitRef := strings.Cut(rest, "@")
+	if !isHex(id) || (explicitRef && !isHex(revision)) || strings.Contains(file, "/") {
+		return nil, ErrInvalidURL
+	}
+
+	return &github.ParsedURL{
+		Provider:    Scheme,
+		Repo:        strings.ToLower(id),
+		Path:        file,
+		Ref:         strings.ToLower(revision),
+		ExplicitRef: explicitRef,
+	}, nil
+}
+
+// isHex reports whether s is a non-empty string of hex digits, as gist IDs
+// and revisions are
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range strings.ToLower(s) {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package gist
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseGistURL(t *testing.T) {
+	tests := []struct {
+		name         string
+		url          string
+		expectedRepo string
+		expectedPath string
+		expectedRef  string
+		explicitRef  bool
+		expectedErr  error
+	}{
+		{
+			name:         "Gist",
+			url:          "gist:aa5a315d61ae9438b18d",
+			expectedRepo: "aa5a315d61ae9438b18d",
+		},
+		{
+			name:         "Revision and file",
+			url:          "gist:aa5a315d61ae9438b18d@57A7F021A713B1C5A6A199B54CC514735D2D462F/hello.py",
+			expectedRepo: "aa5a315d61ae9438b18d",
+			expectedPath: "hello.py",
+			expectedRef:  "57a7f021a713b1c5a6a199b54cc514735d2d462f",
+			explicitRef:  true,
+		},
+		{
+			name:         "File at the latest revision",
+			url:          "gist:aa5a315d61ae9438b18d/notes.md",
+			expectedRepo: "aa5a315d61ae9438b18d",
+			expectedPath: "notes.md",
+		},
+		{
+			name:        "Missing ID",
+			url:         "gist:",
+			expectedErr: ErrInvalidURL,
+		},
+		{
+			name:        "Owner and ID",
+			url:         "gist:octocat/aa5a315d61ae9438b18d",
+			expectedErr: ErrInvalidURL,
+		},
+		{
+			name:        "Empty revision",
+			url:         "gist:aa5a315d61ae9438b18d@/hello.py",
+			expectedErr: ErrInvalidURL,
+		},
+		{
+			name:        "Nested path",
+			url:         "gist:aa5a315d61ae9438b18d/dir/hello.py",
+			expectedErr: ErrInvalidURL,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseGistURL(tt.url)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if parsed.Provider != Scheme || parsed.Owner != "" || parsed.Repo != tt.expectedRepo {
+				t.Errorf("Expected gist %s, got %s:%s/%s", tt.expectedRepo, parsed.Provider, parsed.Owner, parsed.Repo)
+			}
+			if parsed.Path != tt.expectedPath {
+				t.Errorf("Expected path %q, got %q", tt.expectedPath, parsed.Path)
+			}
+			if parsed.Ref != tt.expectedRef || parsed.ExplicitRef != tt.explicitRef {
+				t.Errorf("Expected ref %q (explicit %v), got %q (%v)", tt.expectedRef, tt.explicitRef, parsed.Ref, parsed.ExplicitRef)
+			}
+
+			again, err := ParseGistURL(parsed.String())
+			if err != nil || *again != *parsed {
+				t.Errorf("Expected %s to round trip, got %+v (%v)", parsed.String(), again, err)
+			}
+		})
+	}
+}
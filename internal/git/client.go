@@ -0,0 +1,623 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+	"xcp/internal/github"
+	"xcp/internal/logger"
+)
+
+const (
+	defaultTimeout = 5 * time.Minute
+	// tokenUser is the user name sent with a token; git servers check only
+	// the password
+	tokenUser = "x-access-token"
+)
+
+// Client reads repositories from a git server over the smart HTTP protocol.
+// It offers the same operations as the GitHub client, reporting results in
+// the same types, so downloaders work with either. Owners are the path of
+// the repository on the server up to its last segment.
+type Client struct {
+	httpClient *http.Client
+	host       github.Host
+
+	mu      sync.Mutex
+	remotes map[string]*remote
+}
+
+// remote is what is known about a single repository on the server
+type remote struct {
+	url  string
+	caps map[string]string
+
+	refs     []advertisedRef
+	resolved map[string]*github.ResolvedRef
+	objects  map[string]*object
+}
+
+// advertisedRef is a ref listed by ls-refs
+type advertisedRef struct {
+	id     string
+	name   string
+	symref string // Target of a symbolic ref such as HEAD
+	peeled string // Commit an annotated tag points to
+}
+
+// NewClient creates a client for the git server described by host
+func NewClient(host github.Host) (*Client, error) {
+	httpClient, err := host.HTTPClient(defaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{httpClient: httpClient, host: host, remotes: make(map[string]*remote)}, nil
+}
+
+// SetLogger logs every request made by the client at debug level
+func (c *Client) SetLogger(l *logger.Logger) {
+	logger.WrapClient(c.httpClient, l)
+}
+
+// do sends req with the headers of protocol v2 and the host's token
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("Git-Protocol", "version=2")
+	if c.host.Token != "" {
+		req.SetBasicAuth(tokenUser, c.host.Token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", github.ErrNetworkFailure, err)
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusUnauthorized, http.StatusForbidden:
+		return nil, github.ErrRepositoryNotFound
+	case http.StatusTooManyRequests:
+		return nil, github.ErrRateLimitExceeded
+	default:
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+}
+
+// remote returns the repository owner/repo, asking the server for its
+// capabilities the first time
+func (c *Client) remote(ctx context.Context, owner, repo string) (*remote, error) {
+	remoteURL := c.host.Web + "/" + path.Join(owner, repo)
+	if r, ok := c.remotes[remoteURL]; ok {
+		return r, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, remoteURL+"/info/refs?service=git-upload-pack", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	caps, err := readCapabilities(&pktReader{r: resp.Body})
+	if err != nil {
+		return nil, err
+	}
+	if format := caps["object-format"]; format != "" && format != "sha1" {
+		return nil, fmt.Errorf("%w: unsupported object format %s", ErrProtocol, format)
+	}
+
+	r := &remote{
+		url:      remoteURL,
+		caps:     caps,
+		resolved: make(map[string]*github.ResolvedRef),
+		objects:  make(map[string]*object),
+	}
+	c.remotes[remoteURL] = r
+	return r, nil
+}
+
+// readCapabilities reads the capability advertisement of protocol v2
+func readCapabilities(pr *pktReader) (map[string]string, error) {
+	line, kind, err := pr.line()
+	if err != nil {
+		return nil, err
+	}
+	// Some servers open with the service announcement of protocol v0
+	if strings.HasPrefix(line, "# service=") {
+		if _, kind, err = pr.line(); err != nil || kind != pktFlush {
+			return nil, fmt.Errorf("%w: malformed service announcement", ErrProtocol)
+		}
+		if line, kind, err = pr.line(); err != nil {
+			return nil, err
+		}
+	}
+	if kind != pktData || line != "version 2" {
+		return nil, fmt.Errorf("%w: server does not speak protocol version 2", ErrProtocol)
+	}
+
+	caps := make(map[string]string)
+	for {
+		line, kind, err := pr.line()
+		if err != nil {
+			return nil, err
+		}
+		if kind == pktFlush {
+			return caps, nil
+		}
+		name, value, _ := strings.Cut(line, "=")
+		caps[name] = value
+	}
+}
+
+// command sends a protocol v2 command with its arguments and returns a
+// reader over the response
+func (c *Client) command(ctx context.Context, r *remote, name string, args []string) (*http.Response, error) {
+	var w pktWriter
+	w.line("command=" + name + "\n")
+	w.delim()
+	for _, arg := range args {
+		w.line(arg + "\n")
+	}
+	w.flush()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url+"/git-upload-pack", &w.buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-git-upload-pack-request")
+	req.Header.Set("Accept", "application/x-git-upload-pack-result")
+	return c.do(req)
+}
+
+// listRefs lists the remote's HEAD, branches and tags, once
+func (c *Client) listRefs(ctx context.Context, r *remote) ([]advertisedRef, error) {
+	if r.refs != nil {
+		return r.refs, nil
+	}
+
+	resp, err := c.command(ctx, r, "ls-refs", []string{
+		"symrefs", "peel", "ref-prefix HEAD", "ref-prefix refs/heads/", "ref-prefix refs/tags/",
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	refs := []advertisedRef{}
+	pr := &pktReader{r: resp.Body}
+	for {
+		line, kind, err := pr.line()
+		if err != nil {
+			return nil, err
+		}
+		if kind == pktFlush {
+			break
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%w: malformed ref %q", ErrProtocol, line)
+		}
+		ref := advertisedRef{id: fields[0], name: fields[1]}
+		for _, attr := range fields[2:] {
+			if target, ok := strings.CutPrefix(attr, "symref-target:"); ok {
+				ref.symref = target
+			} else if peeled, ok := strings.CutPrefix(attr, "peeled:"); ok {
+				ref.peeled = peeled
+			}
+		}
+		refs = append(refs, ref)
+	}
+
+	r.refs = refs
+	return refs, nil
+}
+
+// resolve finds the commit ref names on the remote
+func (c *Client) resolve(ctx context.Context, r *remote, ref string) (*github.ResolvedRef, error) {
+	if resolved, ok := r.resolved[ref]; ok {
+		return resolved, nil
+	}
+	if len(ref) == 40 && github.IsCommitSHA(ref) {
+		return &github.ResolvedRef{Ref: ref, Kind: github.RefCommit, Commit: strings.ToLower(ref)}, nil
+	}
+
+	refs, err := c.listRefs(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	lookup := ref
+	if lookup == "" {
+		lookup = defaultRef
+	}
+	var resolved *github.ResolvedRef
+	for _, candidate := range refs {
+		switch {
+		case candidate.name == defaultRef && lookup == defaultRef:
+			kind := github.RefCommit
+			if strings.HasPrefix(candidate.symref, "refs/heads/") {
+				kind = github.RefBranch
+			}
+			resolved = &github.ResolvedRef{Ref: ref, Kind: kind, Commit: candidate.id}
+		case candidate.name == "refs/heads/"+lookup || candidate.name == lookup && strings.HasPrefix(lookup, "refs/heads/"):
+			resolved = &github.ResolvedRef{Ref: ref, Kind: github.RefBranch, Commit: candidate.id}
+		case candidate.name == "refs/tags/"+lookup || candidate.name == lookup && strings.HasPrefix(lookup, "refs/tags/"):
+			commit := candidate.id
+			if candidate.peeled != "" {
+				commit = candidate.peeled
+			}
+			// Branches win over tags of the same name, as they do for git
+			if resolved == nil {
+				resolved = &github.ResolvedRef{Ref: ref, Kind: github.RefTag, Commit: commit}
+			}
+		}
+		if resolved != nil && resolved.Kind == github.RefBranch {
+			break
+		}
+	}
+
+	if resolved == nil {
+		if github.IsCommitSHA(ref) {
+			return nil, fmt.Errorf("%w: %s (git remotes need full 40-character commit SHAs)", github.ErrRefNotFound, ref)
+		}
+		return nil, fmt.Errorf("%w: %s", github.ErrRefNotFound, ref)
+	}
+	r.resolved[ref] = resolved
+	return resolved, nil
+}
+
+// fetch asks the remote for the objects wants and unpacks them. Commits
+// are fetched shallowly, without the blobs when the server can leave them
+// out; blobs are then fetched by ID as they are needed.
+func (c *Client) fetch(ctx context.Context, r *remote, wants []string, commit bool) error {
+	args := []string{"no-progress", "ofs-delta"}
+	if commit {
+		features := strings.Fields(r.caps["fetch"])
+		for _, feature := range features {
+			switch feature {
+			case "shallow":
+				args = append(args, "deepen 1")
+			case "filter":
+				args = append(args, "filter blob:none")
+			}
+		}
+	}
+	for _, id := range wants {
+		args = append(args, "want "+id)
+	}
+	args = append(args, "done")
+
+	resp, err := c.command(ctx, r, "fetch", args)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Offset deltas point anywhere back in the pack, so it is held whole
+	// while it is unpacked. Objects are inflated into buffers of their own,
+	// leaving the pack to be collected once this returns.
+	pack, err := readPackfile(&pktReader{r: resp.Body})
+	if err != nil {
+		return err
+	}
+	return unpack(pack, r.objects)
+}
+
+// readPackfile reads the sections of a fetch response and returns the
+// packfile, demultiplexed from its progress and error messages
+func readPackfile(pr *pktReader) ([]byte, error) {
+	for {
+		section, kind, err := pr.line()
+		if err != nil {
+			return nil, err
+		}
+		if kind != pktData {
+			return nil, fmt.Errorf("%w: fetch response has no packfile", ErrProtocol)
+		}
+
+		if section != "packfile" {
+			// Skip sections such as shallow-info, which hold nothing needed
+			for kind != pktDelim && kind != pktFlush {
+				if _, kind, err = pr.line(); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		var pack bytes.Buffer
+		for {
+			kind, data, err := pr.next()
+			if err != nil {
+				return nil, err
+			}
+			if kind == pktFlush {
+				return pack.Bytes(), nil
+			}
+			if kind != pktData || len(data) == 0 {
+				continue
+			}
+			switch data[0] {
+			case 1:
+				pack.Write(data[1:])
+			case 3:
+				return nil, fmt.Errorf("%w: server error: %s", ErrProtocol, bytes.TrimSpace(data[1:]))
+			}
+		}
+	}
+}
+
+// rootTree returns the ID of the root tree of ref, fetching its commit
+func (c *Client) rootTree(ctx context.Context, r *remote, ref string) (string, error) {
+	resolved, err := c.resolve(ctx, r, ref)
+	if err != nil {
+		return "", err
+	}
+
+	commit, ok := r.objects[resolved.Commit]
+	if !ok {
+		if err := c.fetch(ctx, r, []string{resolved.Commit}, true); err != nil {
+			return "", err
+		}
+		if commit, ok = r.objects[resolved.Commit]; !ok {
+			return "", fmt.Errorf("%w: %s", github.ErrRefNotFound, ref)
+		}
+	}
+	if commit.typ != objCommit {
+		return "", fmt.Errorf("%w: %s is not a commit", github.ErrRefNotFound, ref)
+	}
+	return commitTree(commit.data)
+}
+
+// lookup finds the entry at path below the root tree. The root itself is
+// returned for an empty path.
+func (r *remote) lookup(root, path string) (treeEntry, bool, error) {
+	entry := treeEntry{mode: modeTree, id: root}
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		if entry.mode != modeTree {
+			return treeEntry{}, false, nil
+		}
+		entries, err := r.tree(entry.id)
+		if err != nil {
+			return treeEntry{}, false, err
+		}
+
+		found := false
+		for _, e := range entries {
+			if e.name == name {
+				entry, found = e, true
+				break
+			}
+		}
+		if !found {
+			return treeEntry{}, false, nil
+		}
+	}
+	return entry, true, nil
+}
+
+// tree returns the entries of the tree object id
+func (r *remote) tree(id string) ([]treeEntry, error) {
+	obj, ok := r.objects[id]
+	if !ok || obj.typ != objTree {
+		return nil, fmt.Errorf("%w: tree %s is missing from the packfile", ErrProtocol, id)
+	}
+	return parseTree(obj.data)
+}
+
+// walk calls fn for every entry below the tree id, with its path
+func (r *remote) walk(id, dir string, fn func(path string, entry treeEntry)) error {
+	entries, err := r.tree(id)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		entryPath := path.Join(dir, entry.name)
+		fn(entryPath, entry)
+		if entry.mode == modeTree {
+			if err := r.walk(entry.id, entryPath, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fetchBlobs fetches those of the blobs ids that were left out of the
+// commit's packfile, in a single request
+func (c *Client) fetchBlobs(ctx context.Context, r *remote, ids []string) error {
+	var missing []string
+	for _, id := range ids {
+		if _, ok := r.objects[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return c.fetch(ctx, r, missing, false)
+}
+
+// blobSize returns the size of the blob id, or -1 while it is not fetched
+func (r *remote) blobSize(id string) int64 {
+	if obj, ok := r.objects[id]; ok {
+		return int64(len(obj.data))
+	}
+	return -1
+}
+
+// OpenFile returns a reader over the content of a file. An empty ref
+// selects the remote's HEAD.
+func (c *Client) OpenFile(ctx context.Context, owner, repo, ref, filePath string) (io.ReadCloser, github.FileInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r, err := c.remote(ctx, owner, repo)
+	if err != nil {
+		return nil, github.FileInfo{}, err
+	}
+	root, err := c.rootTree(ctx, r, ref)
+	if err != nil {
+		return nil, github.FileInfo{}, err
+	}
+	entry, ok, err := r.lookup(root, filePath)
+	if err != nil {
+		return nil, github.FileInfo{}, err
+	}
+	if !ok || entry.mode == modeTree || entry.mode == modeGitlink {
+		return nil, github.FileInfo{}, github.ErrFileNotFound
+	}
+
+	if err := c.fetchBlobs(ctx, r, []string{entry.id}); err != nil {
+		return nil, github.FileInfo{}, err
+	}
+	blob, ok := r.objects[entry.id]
+	if !ok {
+		return nil, github.FileInfo{}, fmt.Errorf("%w: blob %s was not sent", ErrProtocol, entry.id)
+	}
+	// Each blob is read once, so it is dropped as it is handed out; memory
+	// then holds only the trees and the files not yet written. Fetches send
+	// no haves, so later packs never delta against it.
+	delete(r.objects, entry.id)
+
+	info := github.FileInfo{Name: path.Base(filePath), Path: filePath, Size: int64(len(blob.data))}
+	return io.NopCloser(bytes.NewReader(blob.data)), info, nil
+}
+
+// GetDirectoryContents lists a directory. The blobs of everything below it
+// are fetched at once, as the directory is about to be downloaded. An empty
+// ref selects the remote's HEAD.
+func (c *Client) GetDirectoryContents(ctx context.Context, owner, repo, ref, dirPath string) (github.DirectoryContents, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r, err := c.remote(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	root, err := c.rootTree(ctx, r, ref)
+	if err != nil {
+		return nil, err
+	}
+	dir, ok, err := r.lookup(root, dirPath)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || dir.mode != modeTree {
+		return nil, github.ErrDirectoryNotFound
+	}
+
+	var blobs []string
+	err = r.walk(dir.id, "", func(_ string, entry treeEntry) {
+		if entryType(entry.mode) == "blob" {
+			blobs = append(blobs, entry.id)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.fetchBlobs(ctx, r, blobs); err != nil {
+		return nil, err
+	}
+
+	entries, err := r.tree(dir.id)
+	if err != nil {
+		return nil, err
+	}
+	contents := make(github.DirectoryContents, 0, len(entries))
+	for _, entry := range entries {
+		item := github.ContentResponse{
+			Name: entry.name,
+			Path: path.Join(strings.Trim(dirPath, "/"), entry.name),
+			Sha:  entry.id,
+			Size: int(r.blobSize(entry.id)),
+		}
+		switch entry.mode {
+		case modeTree:
+			item.Type = github.DirectoryContent
+			item.Size = 0
+		case modeSymlink:
+			item.Type = "symlink"
+		case modeGitlink:
+			item.Type = "submodule"
+			item.Size = 0
+		default:
+			item.Type = github.FileContent
+		}
+		contents = append(contents, item)
+	}
+	return contents, nil
+}
+
+// GetTree returns the recursive tree of ref, giving files their modes and
+// blob SHAs. Sizes of blobs not fetched yet are -1. An empty ref selects
+// the remote's HEAD.
+func (c *Client) GetTree(ctx context.Context, owner, repo, ref string) (*github.Tree, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r, err := c.remote(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	root, err := c.rootTree(ctx, r, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := &github.Tree{Sha: root}
+	err = r.walk(root, "", func(entryPath string, entry treeEntry) {
+		typ := entryType(entry.mode)
+		size := int64(0)
+		if typ == "blob" {
+			size = r.blobSize(entry.id)
+		}
+		tree.Entries = append(tree.Entries, github.TreeEntry{Path: entryPath, Mode: treeMode(entry.mode), Type: typ, Sha: entry.id, Size: size})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// RepositoryExists checks if the server serves the repository
+func (c *Client) RepositoryExists(ctx context.Context, owner, repo string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := c.remote(ctx, owner, repo)
+	if errors.Is(err, github.ErrRepositoryNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ResolveRef finds out whether ref is a branch, tag or commit and which
+// commit it points to. An empty ref resolves the remote's HEAD. Commits
+// must be given as full SHAs, as the protocol cannot expand abbreviations.
+func (c *Client) ResolveRef(ctx context.Context, owner, repo, ref string) (*github.ResolvedRef, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r, err := c.remote(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	return c.resolve(ctx, r, ref)
+}
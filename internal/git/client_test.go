@@ -0,0 +1,241 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"xcp/internal/downloader"
+	"xcp/internal/github"
+)
+
+// gitFixture is a repository served by git http-backend
+type gitFixture struct {
+	client *Client
+	head   string // Commit of main
+	first  string // Commit tagged v1
+}
+
+// runGit runs git in dir with a fixed identity and no user configuration
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=xcp", "GIT_AUTHOR_EMAIL=xcp@example.com",
+		"GIT_COMMITTER_NAME=xcp", "GIT_COMMITTER_EMAIL=xcp@example.com",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// writeFiles writes files, relative to dir, with the given modes
+func writeFiles(t *testing.T, dir string, files map[string]string, exec ...string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range exec {
+		os.Chmod(filepath.Join(dir, name), 0755)
+	}
+}
+
+// newGitFixture builds a repository with two commits and serves it over
+// smart HTTP, optionally allowing blob filters. Requests must carry token
+// as their password.
+func newGitFixture(t *testing.T, allowFilter bool) *gitFixture {
+	t.Helper()
+	backend, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is not installed")
+	}
+	backend = filepath.Join(runGit(t, ".", "--exec-path"), "git-http-backend")
+	if _, err := os.Stat(backend); err != nil {
+		t.Skip("git http-backend is not installed")
+	}
+
+	root := t.TempDir()
+	work := filepath.Join(root, "work")
+	os.MkdirAll(work, 0755)
+	runGit(t, work, "init", "-q", "-b", "main")
+
+	// Large, similar files give the packfile deltas to resolve
+	long := strings.Repeat("line of a long document\n", 200)
+	writeFiles(t, work, map[string]string{
+		"README.md":      "# Tools\n",
+		"bin/run.sh":     "#!/bin/sh\necho run\n",
+		"docs/guide.md":  long,
+		"docs/guide2.md": long + "more\n",
+	}, "bin/run.sh")
+	runGit(t, work, "add", "-A")
+	runGit(t, work, "commit", "-q", "-m", "first")
+	runGit(t, work, "tag", "-a", "v1", "-m", "v1")
+	first := runGit(t, work, "rev-parse", "HEAD")
+
+	writeFiles(t, work, map[string]string{"docs/guide.md": long + "changed\n"})
+	runGit(t, work, "commit", "-q", "-am", "second")
+	head := runGit(t, work, "rev-parse", "HEAD")
+
+	runGit(t, root, "clone", "-q", "--bare", work, filepath.Join(root, "team", "tools.git"))
+	bare := filepath.Join(root, "team", "tools.git")
+	runGit(t, bare, "repack", "-adq")
+	runGit(t, bare, "config", "uploadpack.allowFilter", map[bool]string{true: "true", false: "false"}[allowFilter])
+
+	handler := &cgi.Handler{
+		Path:   backend,
+		Stderr: io.Discard,
+		Env:    []string{"GIT_PROJECT_ROOT=" + root, "GIT_HTTP_EXPORT_ALL=1", "GIT_CONFIG_NOSYSTEM=1"},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, password, _ := r.BasicAuth(); password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(github.Host{Name: "git.test", Web: server.URL, Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &gitFixture{client: client, head: head, first: first}
+}
+
+func TestClient_ResolveRef(t *testing.T) {
+	f := newGitFixture(t, false)
+
+	tests := []struct {
+		ref    string
+		kind   github.RefKind
+		commit string
+		err    error
+	}{
+		{ref: "", kind: github.RefBranch, commit: f.head},
+		{ref: "main", kind: github.RefBranch, commit: f.head},
+		{ref: "v1", kind: github.RefTag, commit: f.first},
+		{ref: f.first, kind: github.RefCommit, commit: f.first},
+		{ref: f.first[:7], err: github.ErrRefNotFound},
+		{ref: "gone", err: github.ErrRefNotFound},
+	}
+
+	for _, tt := range tests {
+		resolved, err := f.client.ResolveRef(context.Background(), "team", "tools.git", tt.ref)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%q: expected error %v, got %v", tt.ref, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.ref, err)
+			continue
+		}
+		if resolved.Kind != tt.kind || resolved.Commit != tt.commit {
+			t.Errorf("%q: unexpected resolution %+v", tt.ref, resolved)
+		}
+	}
+}
+
+func TestClient_Contents(t *testing.T) {
+	for _, allowFilter := range []bool{false, true} {
+		f := newGitFixture(t, allowFilter)
+		ctx := context.Background()
+
+		body, info, err := f.client.OpenFile(ctx, "team", "tools.git", "v1", "bin/run.sh")
+		if err != nil {
+			t.Fatalf("filter %v: unexpected error: %v", allowFilter, err)
+		}
+		content, _ := io.ReadAll(body)
+		if string(content) != "#!/bin/sh\necho run\n" || info.Size != int64(len(content)) {
+			t.Errorf("filter %v: unexpected file %q (%+v)", allowFilter, content, info)
+		}
+
+		// Blobs are dropped once read and fetched again if read twice
+		if body, _, err := f.client.OpenFile(ctx, "team", "tools.git", "v1", "bin/run.sh"); err != nil {
+			t.Errorf("filter %v: unexpected error reading bin/run.sh again: %v", allowFilter, err)
+		} else if content, _ := io.ReadAll(body); string(content) != "#!/bin/sh\necho run\n" {
+			t.Errorf("filter %v: unexpected file read again %q", allowFilter, content)
+		}
+
+		if _, _, err := f.client.OpenFile(ctx, "team", "tools.git", "", "docs"); !errors.Is(err, github.ErrFileNotFound) {
+			t.Errorf("filter %v: expected ErrFileNotFound, got %v", allowFilter, err)
+		}
+
+		contents, err := f.client.GetDirectoryContents(ctx, "team", "tools.git", "", "docs")
+		if err != nil {
+			t.Fatalf("filter %v: unexpected error: %v", allowFilter, err)
+		}
+		if len(contents) != 2 || contents[0].Path != "docs/guide.md" || contents[0].Size != 4808 {
+			t.Errorf("filter %v: unexpected listing %+v", allowFilter, contents)
+		}
+		if _, err := f.client.GetDirectoryContents(ctx, "team", "tools.git", "", "missing"); !errors.Is(err, github.ErrDirectoryNotFound) {
+			t.Errorf("filter %v: expected ErrDirectoryNotFound, got %v", allowFilter, err)
+		}
+
+		tree, err := f.client.GetTree(ctx, "team", "tools.git", "")
+		if err != nil {
+			t.Fatalf("filter %v: unexpected error: %v", allowFilter, err)
+		}
+		modes := make(map[string]string)
+		sizes := make(map[string]int64)
+		for _, entry := range tree.Entries {
+			modes[entry.Path] = entry.Mode
+			sizes[entry.Path] = entry.Size
+		}
+		// Filtered fetches leave out blobs nothing asked for
+		if filtered := sizes["README.md"] == -1; filtered != allowFilter {
+			t.Errorf("filter %v: unexpected README.md size %d", allowFilter, sizes["README.md"])
+		}
+		if modes["bin/run.sh"] != github.ExecutableMode || modes["docs"] != "040000" || len(tree.Entries) != 6 {
+			t.Errorf("filter %v: unexpected tree %+v", allowFilter, tree.Entries)
+		}
+	}
+}
+
+func TestClient_RepositoryExists(t *testing.T) {
+	f := newGitFixture(t, false)
+	ctx := context.Background()
+
+	if exists, err := f.client.RepositoryExists(ctx, "team", "tools.git"); err != nil || !exists {
+		t.Errorf("Expected repository to exist, got %v, %v", exists, err)
+	}
+	if exists, err := f.client.RepositoryExists(ctx, "team", "other.git"); err != nil || exists {
+		t.Errorf("Expected repository not to exist, got %v, %v", exists, err)
+	}
+}
+
+func TestClient_Download(t *testing.T) {
+	f := newGitFixture(t, true)
+
+	target := filepath.Join(t.TempDir(), "out")
+	dl := downloader.NewDownloader(f.client, new(bytes.Buffer), new(bytes.Buffer))
+	source := &github.GitHubSource{Provider: Scheme, Owner: "team", Repo: "tools.git", Path: "bin"}
+	if err := dl.Download(context.Background(), source, target, downloader.DownloadOptions{}); err != nil {
+		t.Fatalf("Download unexpected error: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(target, "run.sh"))
+	if err != nil {
+		t.Fatalf("Expected run.sh to be downloaded: %v", err)
+	}
+	if info.Mode().Perm()&0100 == 0 {
+		t.Errorf("Expected run.sh to be executable, got %v", info.Mode())
+	}
+}
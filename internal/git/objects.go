@@ -0,0 +1,92 @@
+package git
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Modes of tree entries that are not regular files
+const (
+	modeTree    = "40000"
+	modeSymlink = "120000"
+	modeGitlink = "160000"
+)
+
+// treeEntry is an entry of a tree object
+type treeEntry struct {
+	mode string
+	name string
+	id   string
+}
+
+// parseTree splits the data of a tree object into its entries. Names that
+// git fsck refuses are rejected, since trees come from untrusted servers
+// and their names become paths on disk.
+func parseTree(data []byte) ([]treeEntry, error) {
+	var entries []treeEntry
+	for len(data) > 0 {
+		space := bytes.IndexByte(data, ' ')
+		nul := bytes.IndexByte(data, 0)
+		if space == -1 || nul < space || nul+21 > len(data) {
+			return nil, fmt.Errorf("%w: malformed tree", ErrProtocol)
+		}
+		name := string(data[space+1 : nul])
+		if !validEntryName(name) {
+			return nil, fmt.Errorf("%w: tree entry has invalid name %q", ErrProtocol, name)
+		}
+		entries = append(entries, treeEntry{
+			mode: string(data[:space]),
+			name: name,
+			id:   hex.EncodeToString(data[nul+1 : nul+21]),
+		})
+		data = data[nul+21:]
+	}
+	return entries, nil
+}
+
+// validEntryName reports whether name can be a single entry of a tree: not
+// empty, not a relative reference like "..", and free of separators. NUL
+// ends the name in the tree format, so it can never appear.
+func validEntryName(name string) bool {
+	switch {
+	case name == "", name == ".", name == "..", strings.EqualFold(name, ".git"):
+		return false
+	case strings.ContainsAny(name, "/\x00"):
+		return false
+	}
+	return true
+}
+
+// commitTree returns the ID of the root tree of a commit object
+func commitTree(data []byte) (string, error) {
+	header, _, _ := bytes.Cut(data, []byte("\n\n"))
+	for _, line := range strings.Split(string(header), "\n") {
+		if id, ok := strings.CutPrefix(line, "tree "); ok {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("%w: commit has no tree", ErrProtocol)
+}
+
+// treeMode returns the mode of an entry as the GitHub tree API writes it,
+// with directories zero-padded to six digits
+func treeMode(mode string) string {
+	if mode == modeTree {
+		return "0" + mode
+	}
+	return mode
+}
+
+// entryType returns the tree listing type of an entry with mode
+func entryType(mode string) string {
+	switch mode {
+	case modeTree:
+		return "tree"
+	case modeGitlink:
+		return "commit"
+	default:
+		return "blob"
+	}
+}
@@ -0,0 +1,309 @@
+package git
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// objectType is the type of a git object, numbered as in packfiles
+type objectType int
+
+const (
+	objCommit   objectType = 1
+	objTree     objectType = 2
+	objBlob     objectType = 3
+	objTag      objectType = 4
+	objOfsDelta objectType = 6
+	objRefDelta objectType = 7
+)
+
+// String returns the name git gives the type in object headers
+func (t objectType) String() string {
+	switch t {
+	case objCommit:
+		return "commit"
+	case objTree:
+		return "tree"
+	case objBlob:
+		return "blob"
+	case objTag:
+		return "tag"
+	default:
+		return fmt.Sprintf("type %d", int(t))
+	}
+}
+
+const (
+	// minEntrySize is the smallest a packed object can be: a type and size
+	// byte, a zlib header, an empty deflate block and its checksum
+	minEntrySize = 1 + 2 + 2 + 4
+	// maxExpansion bounds how much larger than the packfile an object may
+	// claim to be; deflate cannot expand data more than about a thousandfold
+	maxExpansion = 1032
+	// maxPrealloc caps buffers sized from what the server claims before the
+	// data has been seen to back the claim
+	maxPrealloc = 1 << 20
+)
+
+// object is an unpacked git object
+type object struct {
+	typ  objectType
+	data []byte
+}
+
+// hashObject returns the ID git gives an object of typ holding data
+func hashObject(typ objectType, data []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s %d\x00", typ, len(data))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// packEntry is an object as stored in a packfile, possibly a delta
+type packEntry struct {
+	offset  int64
+	typ     objectType
+	data    []byte // Inflated object, or delta instructions
+	baseOfs int64  // Base of an offset delta
+	baseID  string // Base of a reference delta
+
+	resolved *object
+	id       string
+}
+
+// unpack reads every object of the packfile pack into objects, keyed by ID.
+// Deltas may be based on objects already in objects, as well as on objects
+// of the pack itself.
+func unpack(pack []byte, objects map[string]*object) error {
+	if len(pack) < 32 || !bytes.Equal(pack[:4], []byte("PACK")) {
+		return fmt.Errorf("%w: not a packfile", ErrProtocol)
+	}
+	if version := binary.BigEndian.Uint32(pack[4:8]); version != 2 && version != 3 {
+		return fmt.Errorf("%w: unsupported packfile version %d", ErrProtocol, version)
+	}
+
+	body, trailer := pack[:len(pack)-sha1.Size], pack[len(pack)-sha1.Size:]
+	if sum := sha1.Sum(body); !bytes.Equal(sum[:], trailer) {
+		return fmt.Errorf("%w: packfile checksum mismatch", ErrProtocol)
+	}
+
+	// The count is the server's word; the pack must have room for it
+	count := binary.BigEndian.Uint32(pack[8:12])
+	if uint64(count) > uint64(len(body)-12)/minEntrySize {
+		return fmt.Errorf("%w: packfile of %d bytes cannot hold %d objects", ErrProtocol, len(pack), count)
+	}
+	r := bytes.NewReader(body)
+	r.Seek(12, io.SeekStart)
+
+	entries := make([]*packEntry, 0, count)
+	byOffset := make(map[int64]*packEntry, count)
+	for i := uint32(0); i < count; i++ {
+		entry, err := readEntry(r, int64(len(body))-int64(r.Len()))
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+		byOffset[entry.offset] = entry
+	}
+
+	byID := make(map[string]*packEntry)
+	for _, entry := range entries {
+		if entry.typ != objOfsDelta && entry.typ != objRefDelta {
+			entry.resolved = &object{typ: entry.typ, data: entry.data}
+			entry.id = hashObject(entry.typ, entry.data)
+			byID[entry.id] = entry
+		}
+	}
+
+	// Resolve deltas, repeating while chains of them remain
+	for pending := true; pending; {
+		pending = false
+		progress := false
+		for _, entry := range entries {
+			if entry.resolved != nil {
+				continue
+			}
+
+			var base *object
+			if entry.typ == objOfsDelta {
+				if b := byOffset[entry.baseOfs]; b != nil {
+					base = b.resolved
+				} else {
+					return fmt.Errorf("%w: delta base at offset %d is missing", ErrProtocol, entry.baseOfs)
+				}
+			} else if b := byID[entry.baseID]; b != nil {
+				base = b.resolved
+			} else if o := objects[entry.baseID]; o != nil {
+				base = o
+			}
+			if base == nil {
+				pending = true
+				continue
+			}
+
+			data, err := applyDelta(base.data, entry.data, uint64(len(pack))*maxExpansion)
+			if err != nil {
+				return err
+			}
+			entry.resolved = &object{typ: base.typ, data: data}
+			entry.id = hashObject(base.typ, data)
+			byID[entry.id] = entry
+			progress = true
+		}
+		if pending && !progress {
+			return fmt.Errorf("%w: packfile holds deltas against missing objects", ErrProtocol)
+		}
+	}
+
+	for _, entry := range entries {
+		objects[entry.id] = entry.resolved
+	}
+	return nil
+}
+
+// readEntry reads the packed object starting at offset, where r is positioned
+func readEntry(r *bytes.Reader, offset int64) (*packEntry, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("%w: truncated packfile", ErrProtocol)
+	}
+	entry := &packEntry{offset: offset, typ: objectType(c >> 4 & 7)}
+	size := uint64(c & 0x0f)
+	for shift := 4; c&0x80 != 0; shift += 7 {
+		if c, err = r.ReadByte(); err != nil {
+			return nil, fmt.Errorf("%w: truncated packfile", ErrProtocol)
+		}
+		size |= uint64(c&0x7f) << shift
+	}
+
+	// Larger sizes are lies that must not be allocated
+	if size > uint64(r.Size())*maxExpansion {
+		return nil, fmt.Errorf("%w: object at offset %d claims %d bytes", ErrProtocol, offset, size)
+	}
+
+	switch entry.typ {
+	case objCommit, objTree, objBlob, objTag:
+	case objOfsDelta:
+		// The distance back to the base uses a big-endian varint in which
+		// each continuation adds one
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%w: truncated packfile", ErrProtocol)
+		}
+		distance := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			if c, err = r.ReadByte(); err != nil {
+				return nil, fmt.Errorf("%w: truncated packfile", ErrProtocol)
+			}
+			distance = (distance+1)<<7 | int64(c&0x7f)
+		}
+		if distance <= 0 || distance > offset {
+			return nil, fmt.Errorf("%w: invalid delta base distance %d", ErrProtocol, distance)
+		}
+		entry.baseOfs = offset - distance
+	case objRefDelta:
+		id := make([]byte, sha1.Size)
+		if _, err := io.ReadFull(r, id); err != nil {
+			return nil, fmt.Errorf("%w: truncated packfile", ErrProtocol)
+		}
+		entry.baseID = hex.EncodeToString(id)
+	default:
+		return nil, fmt.Errorf("%w: unknown object type %d at offset %d", ErrProtocol, entry.typ, offset)
+	}
+
+	// bytes.Reader is an io.ByteReader, so zlib stops exactly at the end of
+	// the compressed data and the next entry starts where it leaves off
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: object at offset %d: %v", ErrProtocol, offset, err)
+	}
+	// Grow with the data rather than trusting the size up front. Reading to
+	// the end of the stream consumes its checksum.
+	var data bytes.Buffer
+	data.Grow(int(min(size, maxPrealloc)))
+	if _, err := io.Copy(&data, io.LimitReader(zr, int64(size)+1)); err != nil {
+		return nil, fmt.Errorf("%w: object at offset %d: %v", ErrProtocol, offset, err)
+	}
+	if uint64(data.Len()) != size {
+		return nil, fmt.Errorf("%w: object at offset %d has the wrong size", ErrProtocol, offset)
+	}
+	zr.Close()
+	entry.data = data.Bytes()
+	return entry, nil
+}
+
+// applyDelta rebuilds an object from its base and delta instructions,
+// failing when the result would be larger than limit
+func applyDelta(base, delta []byte, limit uint64) ([]byte, error) {
+	r := bytes.NewReader(delta)
+	baseSize, err := binary.ReadUvarint(r)
+	if err != nil || baseSize != uint64(len(base)) {
+		return nil, fmt.Errorf("%w: delta does not match its base", ErrProtocol)
+	}
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid delta", ErrProtocol)
+	}
+	if size > limit {
+		return nil, fmt.Errorf("%w: delta claims %d bytes", ErrProtocol, size)
+	}
+
+	out := make([]byte, 0, min(size, maxPrealloc))
+	for r.Len() > 0 {
+		if uint64(len(out)) > size {
+			break
+		}
+		op, _ := r.ReadByte()
+		switch {
+		case op&0x80 != 0:
+			// Copy from the base: the low bits say which offset and size
+			// bytes follow
+			var offset, n uint64
+			for i := 0; i < 4; i++ {
+				if op&(1<<i) != 0 {
+					b, err := r.ReadByte()
+					if err != nil {
+						return nil, fmt.Errorf("%w: invalid delta", ErrProtocol)
+					}
+					offset |= uint64(b) << (8 * i)
+				}
+			}
+			for i := 0; i < 3; i++ {
+				if op&(0x10<<i) != 0 {
+					b, err := r.ReadByte()
+					if err != nil {
+						return nil, fmt.Errorf("%w: invalid delta", ErrProtocol)
+					}
+					n |= uint64(b) << (8 * i)
+				}
+			}
+			if n == 0 {
+				n = 0x10000
+			}
+			if offset+n > uint64(len(base)) {
+				return nil, fmt.Errorf("%w: delta copies past the end of its base", ErrProtocol)
+			}
+			out = append(out, base[offset:offset+n]...)
+		case op != 0:
+			// Insert the next op bytes
+			start := len(delta) - r.Len()
+			if int(op) > r.Len() {
+				return nil, fmt.Errorf("%w: invalid delta", ErrProtocol)
+			}
+			out = append(out, delta[start:start+int(op)]...)
+			r.Seek(int64(op), io.SeekCurrent)
+		default:
+			return nil, fmt.Errorf("%w: invalid delta opcode", ErrProtocol)
+		}
+	}
+
+	if uint64(len(out)) != size {
+		return nil, fmt.Errorf("%w: delta produced %d bytes, expected %d", ErrProtocol, len(out), size)
+	}
+	return out, nil
+}
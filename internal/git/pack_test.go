@@ -0,0 +1,120 @@
+package git
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestApplyDelta(t *testing.T) {
+	base := []byte("hello world")
+
+	tests := []struct {
+		name  string
+		delta []byte
+		want  string
+		err   error
+	}{
+		{
+			name:  "Copy and insert",
+			delta: []byte{11, 11, 0x90, 6, 5, 't', 'h', 'e', 'r', 'e'},
+			want:  "hello there",
+		},
+		{
+			name:  "Copy with offset",
+			delta: []byte{11, 5, 0x91, 6, 5},
+			want:  "world",
+		},
+		{
+			name:  "Wrong base size",
+			delta: []byte{10, 5, 0x91, 6, 5},
+			err:   ErrProtocol,
+		},
+		{
+			name:  "Copy past the base",
+			delta: []byte{11, 8, 0x91, 6, 8},
+			err:   ErrProtocol,
+		},
+		{
+			name:  "Wrong result size",
+			delta: []byte{11, 6, 0x90, 5},
+			err:   ErrProtocol,
+		},
+		{
+			name:  "Result over the limit",
+			delta: []byte{11, 0x80, 0x80, 0x80, 0x80, 0x10, 0x90, 5},
+			err:   ErrProtocol,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyDelta(base, tt.delta, 1<<20)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expected error %v, got %v", tt.err, err)
+			}
+			if tt.err == nil && string(got) != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestUnpack_Corrupt(t *testing.T) {
+	pack := append([]byte("PACK\x00\x00\x00\x02\x00\x00\x00\x00"), bytes.Repeat([]byte{0}, 20)...)
+	if err := unpack(pack, map[string]*object{}); !errors.Is(err, ErrProtocol) {
+		t.Errorf("Expected a checksum error, got %v", err)
+	}
+	// A header claiming billions of objects must not be believed
+	huge := append([]byte("PACK\x00\x00\x00\x02\xff\xff\xff\xff"), bytes.Repeat([]byte{0}, 20)...)
+	sum := sha1.Sum(huge[:len(huge)-sha1.Size])
+	copy(huge[len(huge)-sha1.Size:], sum[:])
+	if err := unpack(huge, map[string]*object{}); !errors.Is(err, ErrProtocol) || !strings.Contains(err.Error(), "cannot hold") {
+		t.Errorf("Expected the object count to be refused, got %v", err)
+	}
+	if err := unpack([]byte("not a pack"), map[string]*object{}); !errors.Is(err, ErrProtocol) {
+		t.Errorf("Expected ErrProtocol, got %v", err)
+	}
+}
+
+func TestPktReader(t *testing.T) {
+	pr := &pktReader{r: strings.NewReader("000eversion 2\n00010000000eERR denied")}
+
+	if line, kind, err := pr.line(); err != nil || kind != pktData || line != "version 2" {
+		t.Errorf("Unexpected first packet %q, %v, %v", line, kind, err)
+	}
+	if _, kind, _ := pr.line(); kind != pktDelim {
+		t.Errorf("Expected a delimiter, got %v", kind)
+	}
+	if _, kind, _ := pr.line(); kind != pktFlush {
+		t.Errorf("Expected a flush, got %v", kind)
+	}
+	if _, _, err := pr.line(); !errors.Is(err, ErrProtocol) || !strings.Contains(err.Error(), "denied") {
+		t.Errorf("Expected the server error, got %v", err)
+	}
+	if _, _, err := pr.line(); !errors.Is(err, ErrProtocol) {
+		t.Errorf("Expected an unexpected end, got %v", err)
+	}
+}
+
+func TestParseTree(t *testing.T) {
+	entry := func(mode, name string) []byte {
+		return append([]byte(mode+" "+name+"\x00"), bytes.Repeat([]byte{0xab}, 20)...)
+	}
+
+	entries, err := parseTree(append(entry("100644", "README.md"), entry(modeTree, "src")...))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(entries) != 2 || entries[0].name != "README.md" || entries[1].mode != modeTree || entries[1].id != strings.Repeat("ab", 20) {
+		t.Errorf("Unexpected entries %+v", entries)
+	}
+
+	for _, name := range []string{"", ".", "..", ".git", ".GIT", "../../.bashrc", "a/b"} {
+		if _, err := parseTree(entry("100644", name)); !errors.Is(err, ErrProtocol) {
+			t.Errorf("Expected ErrProtocol for entry name %q, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// maxPktLen is the longest pkt-line allowed, length header included
+const maxPktLen = 65520
+
+var ErrProtocol = errors.New("git protocol error")
+
+// pktKind tells data lines apart from the special packets of protocol v2
+type pktKind int
+
+const (
+	pktData pktKind = iota
+	pktFlush
+	pktDelim
+	pktResponseEnd
+)
+
+// pktWriter builds a request out of pkt-lines
+type pktWriter struct {
+	buf bytes.Buffer
+}
+
+// line writes a data line holding s
+func (w *pktWriter) line(s string) {
+	fmt.Fprintf(&w.buf, "%04x%s", len(s)+4, s)
+}
+
+// linef writes a data line holding the formatted string
+func (w *pktWriter) linef(format string, args ...any) {
+	w.line(fmt.Sprintf(format, args...))
+}
+
+// delim writes a delimiter packet, separating a command from its arguments
+func (w *pktWriter) delim() {
+	w.buf.WriteString("0001")
+}
+
+// flush writes a flush packet, ending the request
+func (w *pktWriter) flush() {
+	w.buf.WriteString("0000")
+}
+
+// pktReader reads the pkt-lines of a response
+type pktReader struct {
+	r   io.Reader
+	buf [maxPktLen]byte
+}
+
+// next reads the next packet. The returned data is only valid until the
+// following call.
+func (r *pktReader) next() (pktKind, []byte, error) {
+	if _, err := io.ReadFull(r.r, r.buf[:4]); err != nil {
+		if err == io.EOF {
+			return 0, nil, fmt.Errorf("%w: unexpected end of response", ErrProtocol)
+		}
+		return 0, nil, err
+	}
+
+	length, err := strconv.ParseUint(string(r.buf[:4]), 16, 16)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: invalid pkt-line length %q", ErrProtocol, r.buf[:4])
+	}
+	switch length {
+	case 0:
+		return pktFlush, nil, nil
+	case 1:
+		return pktDelim, nil, nil
+	case 2:
+		return pktResponseEnd, nil, nil
+	case 3:
+		return 0, nil, fmt.Errorf("%w: invalid pkt-line length 3", ErrProtocol)
+	}
+	if length > maxPktLen {
+		return 0, nil, fmt.Errorf("%w: pkt-line of %d bytes", ErrProtocol, length)
+	}
+
+	data := r.buf[4:length]
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return 0, nil, fmt.Errorf("%w: truncated pkt-line: %v", ErrProtocol, err)
+	}
+	if msg, ok := bytes.CutPrefix(data, []byte("ERR ")); ok {
+		return 0, nil, fmt.Errorf("%w: server error: %s", ErrProtocol, bytes.TrimSpace(msg))
+	}
+	return pktData, data, nil
+}
+
+// line reads the next packet as text without its trailing newline. Special
+// packets come back as an empty line and their kind.
+func (r *pktReader) line() (string, pktKind, error) {
+	kind, data, err := r.next()
+	if err != nil || kind != pktData {
+		return "", kind, err
+	}
+	return string(bytes.TrimSuffix(data, []byte("\n"))), kind, nil
+}
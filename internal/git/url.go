@@ -0,0 +1,85 @@
+// Package git reads repositories from any git server speaking the smart
+// HTTP protocol (version 2), for hosts that offer no archives or API. It
+// makes a shallow fetch of the requested commit, unpacks the packfile in
+// memory and serves the tree through the same interface as the GitHub
+// client, so no git binary is needed. Memory holds one packfile while it is
+// unpacked, the trees, and the blobs fetched but not yet read.
+package git
+
+import (
+	"errors"
+	"strings"
+	"xcp/internal/github"
+)
+
+const (
+	// Scheme names the provider of git remote sources
+	Scheme = "git"
+	// prefix starts every git remote source
+	prefix = "git+https://"
+	// defaultRef is the remote's HEAD, normally its default branch
+	defaultRef = "HEAD"
+)
+
+var ErrInvalidURL = errors.New("invalid git remote URL format")
+
+// NewHost returns the URL of the git server at name
+func NewHost(name string) github.Host {
+	return github.Host{Name: name, Web: "https://" + name}
+}
+
+// IsSource reports whether url is a git remote source
+func IsSource(url string) bool {
+	return strings.HasPrefix(url, prefix)
+}
+
+// ParseGitURL parses a git remote source of the form
+//
+//	git+https://host/path/to/repo.git[@ref][//subdir]
+//
+// The repository path before its last segment becomes the owner. Refs may
+// contain slashes, so a path inside the repository follows "//".
+func ParseGitURL(url string) (*github.ParsedURL, error) {
+	rest, ok := strings.CutPrefix(url, prefix)
+	if !ok {
+		return nil, ErrInvalidURL
+	}
+	// A fragment is never sent to the server; rather than drop it, refuse
+	// it so #asset= is not mistaken for part of the repository path
+	if strings.Contains(rest, "#") {
+		return nil, ErrInvalidURL
+	}
+
+	host, rest, _ := strings.Cut(rest, "/")
+	if host == "" || strings.Contains(host, "@") {
+		return nil, ErrInvalidURL
+	}
+
+	repoPath, path, _ := strings.Cut(rest, "//")
+	repoPath, ref, explicitRef := strings.Cut(repoPath, "@")
+	if explicitRef && ref == "" {
+		return nil, ErrInvalidURL
+	}
+	if !explicitRef {
+		ref = defaultRef
+	}
+
+	repoPath = strings.Trim(repoPath, "/")
+	if repoPath == "" {
+		return nil, ErrInvalidURL
+	}
+	owner, repo := "", repoPath
+	if i := strings.LastIndex(repoPath, "/"); i != -1 {
+		owner, repo = repoPath[:i], repoPath[i+1:]
+	}
+
+	return &github.ParsedURL{
+		Provider:    Scheme,
+		Host:        strings.ToLower(host),
+		Owner:       owner,
+		Repo:        repo,
+		Path:        path,
+		Ref:         ref,
+		ExplicitRef: explicitRef,
+	}, nil
+}
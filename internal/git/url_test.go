@@ -0,0 +1,100 @@
+package git
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseGitURL(t *testing.T) {
+	tests := []struct {
+		name          string
+		url           string
+		expectedHost  string
+		expectedOwner string
+		expectedRepo  string
+		expectedPath  string
+		expectedRef   string
+		explicitRef   bool
+		expectedErr   error
+	}{
+		{
+			name:          "Repository",
+			url:           "git+https://git.example.com/team/tools.git",
+			expectedHost:  "git.example.com",
+			expectedOwner: "team",
+			expectedRepo:  "tools.git",
+			expectedRef:   "HEAD",
+		},
+		{
+			name:          "Ref with slashes and subdir",
+			url:           "git+https://Git.Example.com/a/b/tools.git@release/v2//ci/jobs",
+			expectedHost:  "git.example.com",
+			expectedOwner: "a/b",
+			expectedRepo:  "tools.git",
+			expectedPath:  "ci/jobs",
+			expectedRef:   "release/v2",
+			explicitRef:   true,
+		},
+		{
+			name:         "Repository at the root with a port",
+			url:          "git+https://git.example.com:8443/tools//README.md",
+			expectedHost: "git.example.com:8443",
+			expectedRepo: "tools",
+			expectedPath: "README.md",
+			expectedRef:  "HEAD",
+		},
+		{
+			name:        "Empty ref",
+			url:         "git+https://git.example.com/tools.git@//ci",
+			expectedErr: ErrInvalidURL,
+		},
+		{
+			name:        "Missing repository",
+			url:         "git+https://git.example.com/",
+			expectedErr: ErrInvalidURL,
+		},
+		{
+			name:        "User info",
+			url:         "git+https://user@git.example.com/tools.git",
+			expectedErr: ErrInvalidURL,
+		},
+		{
+			name:        "Fragment",
+			url:         "git+https://git.example.com/tools.git#asset=tools.zip",
+			expectedErr: ErrInvalidURL,
+		},
+		{
+			name:        "Plain HTTPS",
+			url:         "https://git.example.com/tools.git",
+			expectedErr: ErrInvalidURL,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseGitURL(tt.url)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if parsed.Provider != Scheme || parsed.Host != tt.expectedHost {
+				t.Errorf("Expected %s@%s, got %s@%s", Scheme, tt.expectedHost, parsed.Provider, parsed.Host)
+			}
+			if parsed.Owner != tt.expectedOwner || parsed.Repo != tt.expectedRepo {
+				t.Errorf("Expected %s/%s, got %s/%s", tt.expectedOwner, tt.expectedRepo, parsed.Owner, parsed.Repo)
+			}
+			if parsed.Path != tt.expectedPath {
+				t.Errorf("Expected path %q, got %q", tt.expectedPath, parsed.Path)
+			}
+			if parsed.Ref != tt.expectedRef || parsed.ExplicitRef != tt.explicitRef {
+				t.Errorf("Expected ref %s (explicit %v), got %s (%v)", tt.expectedRef, tt.explicitRef, parsed.Ref, parsed.ExplicitRef)
+			}
+		})
+	}
+}
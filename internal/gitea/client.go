@@ -0,0 +1,244 @@
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"xcp/internal/github"
+	"xcp/internal/logger"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+	// pageSize is the number of tree entries requested per page
+	pageSize = 1000
+)
+
+// Client is a Gitea and Forgejo REST API client. It offers the same
+// operations as the GitHub client, reporting results in the same types, so
+// downloaders work with either.
+type Client struct {
+	httpClient *http.Client
+	host       github.Host
+
+	mu       sync.Mutex
+	branches map[string]string // Default branch by owner/repo
+}
+
+// treePage is a page of a recursive git tree listing. Gitea reports more
+// pages as truncation.
+type treePage struct {
+	Sha       string             `json:"sha"`
+	Entries   []github.TreeEntry `json:"tree"`
+	Truncated bool               `json:"truncated"`
+}
+
+// NewClient creates a client for the Gitea or Forgejo instance described by
+// host
+func NewClient(host github.Host) (*Client, error) {
+	httpClient, err := host.HTTPClient(defaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{httpClient: httpClient, host: host, branches: make(map[string]string)}, nil
+}
+
+// SetLogger logs every request made by the client at debug level
+func (c *Client) SetLogger(l *logger.Logger) {
+	logger.WrapClient(c.httpClient, l)
+}
+
+// repoURL returns the API URL of the repository owner/repo
+func (c *Client) repoURL(owner, repo string) string {
+	return fmt.Sprintf("%s/repos/%s/%s", c.host.API, url.PathEscape(owner), url.PathEscape(repo))
+}
+
+// escapePath escapes each segment of a repository path
+func escapePath(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+// withRef appends ref to apiURL as a query parameter unless it is empty
+func withRef(apiURL, ref string) string {
+	if ref == "" || ref == defaultRef {
+		return apiURL
+	}
+	return apiURL + "?ref=" + url.QueryEscape(ref)
+}
+
+// ref returns ref, or the repository's default branch when ref is empty
+func (c *Client) ref(ctx context.Context, owner, repo, ref string) (string, error) {
+	if ref != "" && ref != defaultRef {
+		return ref, nil
+	}
+
+	key := owner + "/" + repo
+	c.mu.Lock()
+	branch, ok := c.branches[key]
+	c.mu.Unlock()
+	if ok {
+		return branch, nil
+	}
+
+	var info struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	if _, err := github.APIGetJSON(ctx, c.httpClient, c.repoURL(owner, repo), github.ErrRepositoryNotFound, &info); err != nil {
+		return "", err
+	}
+	if info.DefaultBranch == "" {
+		return "", fmt.Errorf("%w: %s has no default branch", github.ErrRefNotFound, key)
+	}
+
+	c.mu.Lock()
+	c.branches[key] = info.DefaultBranch
+	c.mu.Unlock()
+	return info.DefaultBranch, nil
+}
+
+// OpenFile opens a streaming reader over the raw content of a file. An
+// empty ref selects the repository's default branch. The caller must close
+// the returned reader.
+func (c *Client) OpenFile(ctx context.Context, owner, repo, ref, path string) (io.ReadCloser, github.FileInfo, error) {
+	apiURL := withRef(c.repoURL(owner, repo)+"/raw/"+escapePath(path), ref)
+	resp, err := github.APIGet(ctx, c.httpClient, apiURL, github.ErrFileNotFound)
+	if err != nil {
+		return nil, github.FileInfo{}, err
+	}
+
+	return resp.Body, github.RawFileInfo(path, resp), nil
+}
+
+// GetDirectoryContents lists a directory through the contents API, which
+// answers like GitHub's. An empty ref selects the repository's default
+// branch.
+func (c *Client) GetDirectoryContents(ctx context.Context, owner, repo, ref, path string) (github.DirectoryContents, error) {
+	apiURL := withRef(c.repoURL(owner, repo)+"/contents/"+escapePath(path), ref)
+	resp, err := github.APIGet(ctx, c.httpClient, apiURL, github.ErrDirectoryNotFound)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	var contents github.DirectoryContents
+	if err := json.Unmarshal(body, &contents); err != nil {
+		var single github.ContentResponse
+		if json.Unmarshal(body, &single) == nil && single.Type == github.FileContent {
+			return nil, fmt.Errorf("expected directory, got file: %s", single.Path)
+		}
+		return nil, fmt.Errorf("failed to parse directory contents: %w", err)
+	}
+	return contents, nil
+}
+
+// GetTree fetches the recursive git tree of ref, following its pagination.
+// An empty ref selects the repository's default branch.
+func (c *Client) GetTree(ctx context.Context, owner, repo, ref string) (*github.Tree, error) {
+	ref, err := c.ref(ctx, owner, repo, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := &github.Tree{}
+	for page := 1; ; page++ {
+		apiURL := fmt.Sprintf("%s/git/trees/%s?recursive=true&per_page=%d&page=%d", c.repoURL(owner, repo), url.PathEscape(ref), pageSize, page)
+		var listing treePage
+		if _, err := github.APIGetJSON(ctx, c.httpClient, apiURL, github.ErrDirectoryNotFound, &listing); err != nil {
+			return nil, err
+		}
+
+		tree.Sha = listing.Sha
+		tree.Entries = append(tree.Entries, listing.Entries...)
+		if !listing.Truncated || len(listing.Entries) == 0 {
+			return tree, nil
+		}
+	}
+}
+
+// RepositoryExists checks if a repository exists and is visible
+func (c *Client) RepositoryExists(ctx context.Context, owner, repo string) (bool, error) {
+	resp, err := github.APIGet(ctx, c.httpClient, c.repoURL(owner, repo), github.ErrRepositoryNotFound)
+	if errors.Is(err, github.ErrRepositoryNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+// ResolveRef finds out whether ref is a branch, tag or commit and which
+// commit it points to. An empty ref resolves the default branch.
+func (c *Client) ResolveRef(ctx context.Context, owner, repo, ref string) (*github.ResolvedRef, error) {
+	lookup, err := c.ref(ctx, owner, repo, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lookup) != 40 || !github.IsCommitSHA(lookup) {
+		var branch struct {
+			Commit struct {
+				ID string `json:"id"`
+			} `json:"commit"`
+		}
+		_, err := github.APIGetJSON(ctx, c.httpClient, c.repoURL(owner, repo)+"/branches/"+url.PathEscape(lookup), github.ErrRefNotFound, &branch)
+		if err == nil {
+			return &github.ResolvedRef{Ref: ref, Kind: github.RefBranch, Commit: branch.Commit.ID}, nil
+		}
+		if !errors.Is(err, github.ErrRefNotFound) {
+			return nil, err
+		}
+
+		var tag struct {
+			Commit struct {
+				Sha string `json:"sha"`
+			} `json:"commit"`
+		}
+		_, err = github.APIGetJSON(ctx, c.httpClient, c.repoURL(owner, repo)+"/tags/"+url.PathEscape(lookup), github.ErrRefNotFound, &tag)
+		if err == nil {
+			return &github.ResolvedRef{Ref: ref, Kind: github.RefTag, Commit: tag.Commit.Sha}, nil
+		}
+		if !errors.Is(err, github.ErrRefNotFound) {
+			return nil, err
+		}
+	}
+
+	var commit struct {
+		Sha string `json:"sha"`
+	}
+	apiURL := c.repoURL(owner, repo) + "/git/commits/" + url.PathEscape(lookup)
+	if _, err := github.APIGetJSON(ctx, c.httpClient, apiURL, fmt.Errorf("%w: %s", github.ErrRefNotFound, lookup), &commit); err != nil {
+		return nil, err
+	}
+	return &github.ResolvedRef{Ref: ref, Kind: github.RefCommit, Commit: commit.Sha}, nil
+}
+
+// ArchiveURL returns the URL of an archive of owner/repo at ref in format
+// ("zip" or "tar.gz"). Gitea always archives the whole repository, so path
+// is not used.
+func (c *Client) ArchiveURL(owner, repo, ref, path, format string) string {
+	return fmt.Sprintf("%s/archive/%s.%s", c.repoURL(owner, repo), url.PathEscape(ref), format)
+}
+
+// ArchivePrefix returns "": Gitea names the top-level directory of an
+// archive after the repository alone, which the downloaders detect
+func (c *Client) ArchivePrefix(repo, ref string) string {
+	return ""
+}
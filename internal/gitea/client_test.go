@@ -0,0 +1,212 @@
+package gitea
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"xcp/internal/downloader"
+	"xcp/internal/github"
+)
+
+const testCommit = "0123456789abcdef0123456789abcdef01234567"
+
+// testArchive builds the zip archive Gitea serves for tools/scripts
+func testArchive(t *testing.T) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	writer := zip.NewWriter(buf)
+	for name, content := range map[string]string{
+		"scripts/README.md":  "# Scripts\n",
+		"scripts/bin/run.sh": "#!/bin/sh\n",
+	} {
+		fw, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(content))
+	}
+	writer.Close()
+	return buf.Bytes()
+}
+
+// newTestServer stands in for a Gitea instance serving the repository
+// tools/scripts
+func newTestServer(t *testing.T) (github.Host, *Client) {
+	t.Helper()
+
+	archive := testArchive(t)
+	const repo = "/api/v1/repos/tools/scripts"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		query := r.URL.Query()
+		switch r.URL.Path {
+		case repo:
+			io.WriteString(w, `{"default_branch":"main"}`)
+		case repo + "/archive/v2.zip":
+			http.ServeContent(w, r, "v2.zip", time.Time{}, bytes.NewReader(archive))
+		case repo + "/raw/bin/run.sh":
+			if query.Get("ref") != "v2" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			io.WriteString(w, "#!/bin/sh\n")
+		case repo + "/contents/bin":
+			io.WriteString(w, `[{"type":"file","name":"run.sh","path":"bin/run.sh","sha":"aaa","size":10}]`)
+		case repo + "/contents/README.md":
+			io.WriteString(w, `{"type":"file","name":"README.md","path":"README.md","sha":"bbb","size":10}`)
+		case repo + "/git/trees/main":
+			if query.Get("page") == "1" {
+				io.WriteString(w, `{"sha":"ccc","tree":[{"path":"bin","mode":"040000","type":"tree","sha":"ddd"}],"truncated":true}`)
+				return
+			}
+			io.WriteString(w, `{"sha":"ccc","tree":[{"path":"bin/run.sh","mode":"100755","type":"blob","sha":"aaa","size":10}],"truncated":false}`)
+		case repo + "/branches/main":
+			io.WriteString(w, `{"commit":{"id":"`+testCommit+`"}}`)
+		case repo + "/tags/v2":
+			io.WriteString(w, `{"commit":{"sha":"`+testCommit+`"}}`)
+		case repo + "/git/commits/0123456":
+			io.WriteString(w, `{"sha":"`+testCommit+`"}`)
+		case "/api/v1/repos/tools/limited":
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	host := github.Host{Name: "gitea.test", API: server.URL + "/api/v1", Web: server.URL, Token: "secret"}
+	client, err := NewClient(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return host, client
+}
+
+func TestClient_OpenFile(t *testing.T) {
+	_, client := newTestServer(t)
+	ctx := context.Background()
+
+	body, info, err := client.OpenFile(ctx, "tools", "scripts", "v2", "bin/run.sh")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer body.Close()
+
+	content, _ := io.ReadAll(body)
+	if string(content) != "#!/bin/sh\n" || info.Name != "run.sh" {
+		t.Errorf("Unexpected file %q (%+v)", content, info)
+	}
+
+	if _, _, err := client.OpenFile(ctx, "tools", "scripts", "v2", "bin"); !errors.Is(err, github.ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound, got %v", err)
+	}
+}
+
+func TestClient_Contents(t *testing.T) {
+	_, client := newTestServer(t)
+	ctx := context.Background()
+
+	contents, err := client.GetDirectoryContents(ctx, "tools", "scripts", "", "bin")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(contents) != 1 || contents[0].Type != github.FileContent || contents[0].Sha != "aaa" {
+		t.Errorf("Unexpected listing %+v", contents)
+	}
+
+	if _, err := client.GetDirectoryContents(ctx, "tools", "scripts", "", "README.md"); err == nil {
+		t.Errorf("Expected an error listing a file")
+	}
+	if _, err := client.GetDirectoryContents(ctx, "tools", "scripts", "", "missing"); !errors.Is(err, github.ErrDirectoryNotFound) {
+		t.Errorf("Expected ErrDirectoryNotFound, got %v", err)
+	}
+
+	tree, err := client.GetTree(ctx, "tools", "scripts", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tree.Entries) != 2 || tree.Entries[1].Mode != github.ExecutableMode || tree.Truncated {
+		t.Errorf("Expected both pages of the tree, got %+v", tree)
+	}
+}
+
+func TestClient_RepositoryExists(t *testing.T) {
+	_, client := newTestServer(t)
+	ctx := context.Background()
+
+	if exists, err := client.RepositoryExists(ctx, "tools", "scripts"); err != nil || !exists {
+		t.Errorf("Expected repository to exist, got %v, %v", exists, err)
+	}
+	if exists, err := client.RepositoryExists(ctx, "tools", "other"); err != nil || exists {
+		t.Errorf("Expected repository not to exist, got %v, %v", exists, err)
+	}
+	if _, err := client.RepositoryExists(ctx, "tools", "limited"); !errors.Is(err, github.ErrRateLimitExceeded) {
+		t.Errorf("Expected ErrRateLimitExceeded, got %v", err)
+	}
+}
+
+func TestClient_ResolveRef(t *testing.T) {
+	_, client := newTestServer(t)
+
+	tests := []struct {
+		ref  string
+		kind github.RefKind
+		err  error
+	}{
+		{ref: "", kind: github.RefBranch},
+		{ref: "main", kind: github.RefBranch},
+		{ref: "v2", kind: github.RefTag},
+		{ref: "0123456", kind: github.RefCommit},
+		{ref: "gone", err: github.ErrRefNotFound},
+	}
+
+	for _, tt := range tests {
+		resolved, err := client.ResolveRef(context.Background(), "tools", "scripts", tt.ref)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%q: expected error %v, got %v", tt.ref, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.ref, err)
+			continue
+		}
+		if resolved.Kind != tt.kind || resolved.Commit != testCommit || resolved.Ref != tt.ref {
+			t.Errorf("%q: unexpected resolution %+v", tt.ref, resolved)
+		}
+	}
+}
+
+func TestClient_Archive(t *testing.T) {
+	host, client := newTestServer(t)
+
+	zd := downloader.NewZipDownloaderWithTempDir(t.TempDir(), new(bytes.Buffer), new(bytes.Buffer))
+	if err := zd.SetHost(host); err != nil {
+		t.Fatal(err)
+	}
+
+	target := filepath.Join(t.TempDir(), "out")
+	req := downloader.DownloadRequest{Owner: "tools", Repo: "scripts", Ref: "v2", Path: "bin", Target: target, Provider: client}
+	if err := zd.Download(context.Background(), req); err != nil {
+		t.Fatalf("Download unexpected error: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(target, "run.sh")); err != nil || string(got) != "#!/bin/sh\n" {
+		t.Errorf("Unexpected extracted content %q (%v)", got, err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "README.md")); !os.IsNotExist(err) {
+		t.Errorf("Expected files outside the path to be filtered out")
+	}
+}
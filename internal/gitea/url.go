@@ -0,0 +1,101 @@
+// Package gitea reads repositories on Gitea and Forgejo instances, which
+// share an API. Sources are parsed into github.ParsedURL with the provider
+// named by their scheme, so they flow through the same downloaders as
+// GitHub sources.
+package gitea
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"xcp/internal/github"
+)
+
+const (
+	// Scheme prefixes Gitea sources and names the provider
+	Scheme = "gitea"
+	// ForgejoScheme prefixes Forgejo sources and names the provider
+	ForgejoScheme = "forgejo"
+	// defaultRef stands for the repository's default branch
+	defaultRef = "HEAD"
+)
+
+var ErrInvalidURL = errors.New("invalid Gitea URL format")
+
+// publicHosts are the instances sources of each scheme name when they give
+// no host
+var publicHosts = map[string]string{
+	Scheme:        "gitea.com",
+	ForgejoScheme: "codeberg.org",
+}
+
+// NewHost returns the URLs of the instance at name, serving its API under
+// /api/v1. An empty name is the scheme's public instance: gitea.com for
+// Gitea and codeberg.org for Forgejo.
+func NewHost(scheme, name string) github.Host {
+	if name == "" {
+		name = publicHosts[scheme]
+	}
+	base := "https://" + name
+	return github.Host{Name: name, API: base + "/api/v1", Web: base}
+}
+
+// IsSource reports whether url is a Gitea or Forgejo source
+func IsSource(url string) bool {
+	for scheme := range publicHosts {
+		if strings.HasPrefix(url, scheme+":") || strings.HasPrefix(url, scheme+"@") {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseGiteaURL parses a Gitea or Forgejo source. Supported formats mirror
+// GitHub's:
+//   - gitea:owner/repo[@ref][/path]
+//   - gitea@host:owner/repo[@ref][/path] for self-hosted instances
+//   - forgejo:owner/repo[@ref][/path] and forgejo@host:...
+func ParseGiteaURL(url string) (*github.ParsedURL, error) {
+	scheme, host, rest, err := splitHost(url)
+	if err != nil {
+		return nil, err
+	}
+
+	// Owners and repositories are single path segments, exactly like on
+	// GitHub, so GitHub's parser applies
+	parsed, err := github.ParseGitHubURLWithRef("github:" + rest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidURL, err)
+	}
+
+	parsed.Provider = scheme
+	parsed.Host = host
+	if !parsed.ExplicitRef {
+		parsed.Ref = defaultRef
+	}
+	return parsed, nil
+}
+
+// splitHost separates the scheme and the host named by a "scheme@host:"
+// prefix from the rest of url. The scheme's public instance is reported as
+// no host.
+func splitHost(url string) (string, string, string, error) {
+	scheme, rest, ok := strings.Cut(url, ":")
+	if !ok {
+		return "", "", "", ErrInvalidURL
+	}
+	scheme, host, _ := strings.Cut(scheme, "@")
+	public, ok := publicHosts[scheme]
+	if !ok {
+		return "", "", "", ErrInvalidURL
+	}
+	if strings.HasPrefix(url, scheme+"@") && (host == "" || strings.Contains(host, "/")) {
+		return "", "", "", ErrInvalidURL
+	}
+
+	host = strings.ToLower(host)
+	if host == public {
+		host = ""
+	}
+	return scheme, host, rest, nil
+}
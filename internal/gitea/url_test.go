@@ -0,0 +1,102 @@
+package gitea
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseGiteaURL(t *testing.T) {
+	tests := []struct {
+		name             string
+		url              string
+		expectedProvider string
+		expectedHost     string
+		expectedOwner    string
+		expectedRepo     string
+		expectedPath     string
+		expectedRef      string
+		explicitRef      bool
+		expectedErr      error
+	}{
+		{
+			name:             "Public Gitea",
+			url:              "gitea:owner/repo",
+			expectedProvider: Scheme,
+			expectedOwner:    "owner",
+			expectedRepo:     "repo",
+			expectedRef:      "HEAD",
+		},
+		{
+			name:             "Self-hosted Forgejo with ref and path",
+			url:              "forgejo@git.corp.example:tools/scripts@v2/bin/run.sh",
+			expectedProvider: ForgejoScheme,
+			expectedHost:     "git.corp.example",
+			expectedOwner:    "tools",
+			expectedRepo:     "scripts",
+			expectedPath:     "bin/run.sh",
+			expectedRef:      "v2",
+			explicitRef:      true,
+		},
+		{
+			name:             "Public Forgejo host named explicitly",
+			url:              "forgejo@Codeberg.org:owner/repo/docs",
+			expectedProvider: ForgejoScheme,
+			expectedOwner:    "owner",
+			expectedRepo:     "repo",
+			expectedPath:     "docs",
+			expectedRef:      "HEAD",
+		},
+		{
+			name:        "Empty host",
+			url:         "gitea@:owner/repo",
+			expectedErr: ErrInvalidURL,
+		},
+		{
+			name:        "Missing repository",
+			url:         "gitea:owner",
+			expectedErr: ErrInvalidURL,
+		},
+		{
+			name:        "Wrong scheme",
+			url:         "github:owner/repo",
+			expectedErr: ErrInvalidURL,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseGiteaURL(tt.url)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if parsed.Provider != tt.expectedProvider || parsed.Host != tt.expectedHost {
+				t.Errorf("Expected %s@%s, got %s@%s", tt.expectedProvider, tt.expectedHost, parsed.Provider, parsed.Host)
+			}
+			if parsed.Owner != tt.expectedOwner || parsed.Repo != tt.expectedRepo {
+				t.Errorf("Expected %s/%s, got %s/%s", tt.expectedOwner, tt.expectedRepo, parsed.Owner, parsed.Repo)
+			}
+			if parsed.Path != tt.expectedPath {
+				t.Errorf("Expected path %q, got %q", tt.expectedPath, parsed.Path)
+			}
+			if parsed.Ref != tt.expectedRef || parsed.ExplicitRef != tt.explicitRef {
+				t.Errorf("Expected ref %s (explicit %v), got %s (%v)", tt.expectedRef, tt.explicitRef, parsed.Ref, parsed.ExplicitRef)
+			}
+		})
+	}
+}
+
+func TestNewHost(t *testing.T) {
+	if host := NewHost(ForgejoScheme, ""); host.API != "https://codeberg.org/api/v1" {
+		t.Errorf("Unexpected public Forgejo host %+v", host)
+	}
+	if host := NewHost(Scheme, "git.corp.example"); host.Name != "git.corp.example" || host.API != "https://git.corp.example/api/v1" {
+		t.Errorf("Unexpected self-hosted host %+v", host)
+	}
+}
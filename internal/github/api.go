@@ -0,0 +1,62 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// APIGet requests apiURL with client and returns the response when it
+// succeeded. A 404 is reported as notFound and a 429 as
+// ErrRateLimitExceeded. It serves the clients of the other services, whose
+// REST APIs signal errors alike.
+func APIGet(ctx context.Context, client *http.Client, apiURL string, notFound error) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNetworkFailure, err)
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, notFound
+	case http.StatusTooManyRequests:
+		return nil, ErrRateLimitExceeded
+	default:
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+}
+
+// APIGetJSON requests apiURL like APIGet and decodes the response into v,
+// returning the response headers
+func APIGetJSON(ctx context.Context, client *http.Client, apiURL string, notFound error, v any) (http.Header, error) {
+	resp, err := APIGet(ctx, client, apiURL, notFound)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return resp.Header, nil
+}
+
+// RawFileInfo describes the file at path whose raw content resp carries
+func RawFileInfo(path string, resp *http.Response) FileInfo {
+	name := path
+	if i := strings.LastIndex(path, "/"); i != -1 {
+		name = path[i+1:]
+	}
+	return FileInfo{Name: name, Path: path, Size: resp.ContentLength}
+}
@@ -0,0 +1,64 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIGetJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			w.Header().Set("X-Next-Page", "2")
+			w.Write([]byte(`{"name":"repo"}`))
+		case "/limited":
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/broken":
+			w.Write([]byte(`{`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		path   string
+		expect error
+	}{
+		{name: "Success", path: "/ok"},
+		{name: "Not found", path: "/missing", expect: ErrRepositoryNotFound},
+		{name: "Rate limited", path: "/limited", expect: ErrRateLimitExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v struct{ Name string }
+			header, err := APIGetJSON(context.Background(), server.Client(), server.URL+tt.path, ErrRepositoryNotFound, &v)
+			if !errors.Is(err, tt.expect) {
+				t.Fatalf("Expected %v, got %v", tt.expect, err)
+			}
+			if tt.expect == nil && (v.Name != "repo" || header.Get("X-Next-Page") != "2") {
+				t.Errorf("Unexpected result %+v, %v", v, header)
+			}
+		})
+	}
+
+	var v struct{}
+	if _, err := APIGetJSON(context.Background(), server.Client(), server.URL+"/broken", ErrRepositoryNotFound, &v); err == nil {
+		t.Error("Expected a parse error")
+	}
+}
+
+func TestRawFileInfo(t *testing.T) {
+	info := RawFileInfo("docs/guide.md", &http.Response{ContentLength: 42})
+	if info.Name != "guide.md" || info.Path != "docs/guide.md" || info.Size != 42 {
+		t.Errorf("Unexpected info %+v", info)
+	}
+	if info := RawFileInfo("README", &http.Response{ContentLength: -1}); info.Name != "README" || info.Size != -1 {
+		t.Errorf("Unexpected info %+v", info)
+	}
+}
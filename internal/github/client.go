@@ -1,6 +1,7 @@
 package github
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -8,33 +9,45 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
+	"xcp/internal/logger"
 )
 
 const (
 	apiBaseURL     = "https://api.github.com"
 	defaultTimeout = 30 * time.Second
+
+	// rawMediaType asks the contents API for the file bytes instead of a JSON envelope
+	rawMediaType = "application/vnd.github.raw"
 )
 
 // URL generators for API endpoints
 var (
 	// getContentsURL generates the URL for fetching repository contents
-	getContentsURL = func(owner, repo, path string) string {
-		return fmt.Sprintf("%s/repos/%s/%s/contents/%s", apiBaseURL, owner, repo, url.PathEscape(path))
+	getContentsURL = func(base, owner, repo, path string) string {
+		return fmt.Sprintf("%s/repos/%s/%s/contents/%s", base, owner, repo, url.PathEscape(path))
 	}
 
 	// getRepoURL generates the URL for checking repository existence
-	getRepoURL = func(owner, repo string) string {
-		return fmt.Sprintf("%s/repos/%s/%s", apiBaseURL, owner, repo)
+	getRepoURL = func(base, owner, repo string) string {
+		return fmt.Sprintf("%s/repos/%s/%s", base, owner, repo)
+	}
+
+	// getTreeURL generates the URL for fetching a recursive git tree
+	getTreeURL = func(base, owner, repo, ref string) string {
+		return fmt.Sprintf("%s/repos/%s/%s/git/trees/%s?recursive=1", base, owner, repo, url.PathEscape(ref))
 	}
 )
 
+// Errors shared by every provider's client, so they are worded without
+// naming GitHub
 var (
 	ErrFileNotFound       = errors.New("file not found in repository")
 	ErrDirectoryNotFound  = errors.New("directory not found in repository")
-	ErrRateLimitExceeded  = errors.New("GitHub API rate limit exceeded")
-	ErrRepositoryNotFound = errors.New("GitHub repository not found")
-	ErrNetworkFailure     = errors.New("network failure when contacting GitHub API")
+	ErrRateLimitExceeded  = errors.New("API rate limit exceeded")
+	ErrRepositoryNotFound = errors.New("repository not found")
+	ErrNetworkFailure     = errors.New("network failure when contacting the server")
 )
 
 // ContentType represents the type of content returned by the GitHub API
@@ -48,7 +61,7 @@ const (
 // Client is a GitHub API client
 type Client struct {
 	httpClient *http.Client
-	token      string // For future authentication support
+	host       Host
 }
 
 // ContentResponse represents the response from the GitHub contents API
@@ -67,20 +80,68 @@ type ContentResponse struct {
 // DirectoryContents represents a list of contents in a directory
 type DirectoryContents []ContentResponse
 
-// NewClient creates a new GitHub API client
+// ExecutableMode is the git tree mode of an executable file
+const ExecutableMode = "100755"
+
+// TreeEntry is a single blob or subtree in a git tree
+type TreeEntry struct {
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+	Type string `json:"type"`
+	Sha  string `json:"sha"`
+	Size int64  `json:"size"` // -1 when the service does not report sizes
+}
+
+// Tree is the recursive listing of a git tree. GitHub truncates very large
+// trees, which is reported by Truncated.
+type Tree struct {
+	Sha       string      `json:"sha"`
+	Entries   []TreeEntry `json:"tree"`
+	Truncated bool        `json:"truncated"`
+}
+
+// FileInfo describes a file opened with OpenFile
+type FileInfo struct {
+	Name string
+	Path string
+	Size int64 // -1 when the server did not report a length
+}
+
+// NewClient creates a new GitHub API client for github.com
 func NewClient() *Client {
 	return &Client{
 		httpClient: &http.Client{
 			Timeout: defaultTimeout,
 		},
+		host: NewHost(PublicHost),
+	}
+}
+
+// NewHostClient creates a GitHub API client for host, authenticating with
+// the host's token and trusting its CA bundle
+func NewHostClient(host Host) (*Client, error) {
+	httpClient, err := host.HTTPClient(defaultTimeout)
+	if err != nil {
+		return nil, err
 	}
+	return &Client{httpClient: httpClient, host: host}, nil
+}
+
+// SetLogger logs every request made by the client at debug level
+func (c *Client) SetLogger(l *logger.Logger) {
+	logger.WrapClient(c.httpClient, l)
 }
 
 // GetFileContent fetches the content of a file from a GitHub repository
-func (c *Client) GetFileContent(owner, repo, path string) ([]byte, error) {
-	apiURL := getContentsURL(owner, repo, path)
+func (c *Client) GetFileContent(ctx context.Context, owner, repo, path string) ([]byte, error) {
+	apiURL := getContentsURL(c.host.API, owner, repo, path)
 
-	resp, err := c.httpClient.Get(apiURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrNetworkFailure, err)
 	}
@@ -124,11 +185,73 @@ func (c *Client) GetFileContent(owner, repo, path string) ([]byte, error) {
 	return []byte(content.Content), nil
 }
 
-// GetDirectoryContents fetches the contents of a directory from a GitHub repository
-func (c *Client) GetDirectoryContents(owner, repo, path string) (DirectoryContents, error) {
-	apiURL := getContentsURL(owner, repo, path)
+// OpenFile opens a streaming reader over the raw content of a file in a GitHub
+// repository. An empty ref selects the repository's default branch. The caller
+// must close the returned reader.
+func (c *Client) OpenFile(ctx context.Context, owner, repo, ref, path string) (io.ReadCloser, FileInfo, error) {
+	apiURL := getContentsURL(c.host.API, owner, repo, path)
+	if ref != "" {
+		apiURL += "?ref=" + url.QueryEscape(ref)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, FileInfo{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", rawMediaType)
 
-	resp, err := c.httpClient.Get(apiURL)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, FileInfo{}, fmt.Errorf("%w: %v", ErrNetworkFailure, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusNotFound:
+			return nil, FileInfo{}, ErrFileNotFound
+		case http.StatusForbidden:
+			return nil, FileInfo{}, ErrRateLimitExceeded
+		default:
+			return nil, FileInfo{}, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		}
+	}
+
+	// Directories ignore the raw media type and come back as a JSON listing
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		resp.Body.Close()
+		return nil, FileInfo{}, ErrFileNotFound
+	}
+
+	name := path
+	if i := strings.LastIndex(path, "/"); i != -1 {
+		name = path[i+1:]
+	}
+
+	info := FileInfo{
+		Name: name,
+		Path: path,
+		Size: resp.ContentLength,
+	}
+
+	return resp.Body, info, nil
+}
+
+// GetDirectoryContents fetches the contents of a directory from a GitHub
+// repository. An empty ref selects the repository's default branch.
+func (c *Client) GetDirectoryContents(ctx context.Context, owner, repo, ref, path string) (DirectoryContents, error) {
+	apiURL := getContentsURL(c.host.API, owner, repo, path)
+	if ref != "" {
+		apiURL += "?ref=" + url.QueryEscape(ref)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrNetworkFailure, err)
 	}
@@ -169,11 +292,52 @@ func (c *Client) GetDirectoryContents(owner, repo, path string) (DirectoryConten
 	return contents, nil
 }
 
+// GetTree fetches the recursive git tree of ref. An empty ref selects the
+// repository's default branch.
+func (c *Client) GetTree(ctx context.Context, owner, repo, ref string) (*Tree, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, getTreeURL(c.host.API, owner, repo, ref), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNetworkFailure, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrDirectoryNotFound
+	case http.StatusForbidden:
+		return nil, ErrRateLimitExceeded
+	default:
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var tree Tree
+	if err := json.NewDecoder(resp.Body).Decode(&tree); err != nil {
+		return nil, fmt.Errorf("failed to parse tree: %w", err)
+	}
+
+	return &tree, nil
+}
+
 // RepositoryExists checks if a repository exists
-func (c *Client) RepositoryExists(owner, repo string) (bool, error) {
-	apiURL := getRepoURL(owner, repo)
+func (c *Client) RepositoryExists(ctx context.Context, owner, repo string) (bool, error) {
+	apiURL := getRepoURL(c.host.API, owner, repo)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
 
-	resp, err := c.httpClient.Get(apiURL)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return false, fmt.Errorf("%w: %v", ErrNetworkFailure, err)
 	}
@@ -1,8 +1,10 @@
 package github
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -67,13 +69,13 @@ func TestGetFileContent(t *testing.T) {
 
 	// Use a custom makeRequest method to point to our test server
 	originalGetFunc := getContentsURL
-	getContentsURL = func(owner, repo, path string) string {
+	getContentsURL = func(base, owner, repo, path string) string {
 		return server.URL + "/repos/" + owner + "/" + repo + "/contents/" + path
 	}
 	defer func() { getContentsURL = originalGetFunc }()
 
 	// Test getting a valid file
-	content, err := client.GetFileContent("owner", "repo", "file.txt")
+	content, err := client.GetFileContent(context.Background(), "owner", "repo", "file.txt")
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
@@ -82,13 +84,86 @@ func TestGetFileContent(t *testing.T) {
 	}
 
 	// Test getting a non-existent file
-	_, err = client.GetFileContent("owner", "repo", "not-found.txt")
+	_, err = client.GetFileContent(context.Background(), "owner", "repo", "not-found.txt")
 	if err != ErrFileNotFound {
 		t.Errorf("Expected ErrFileNotFound, got %v", err)
 	}
 
 	// Test rate limit exceeded
-	_, err = client.GetFileContent("owner", "repo", "rate-limit")
+	_, err = client.GetFileContent(context.Background(), "owner", "repo", "rate-limit")
+	if err != ErrRateLimitExceeded {
+		t.Errorf("Expected ErrRateLimitExceeded, got %v", err)
+	}
+}
+
+func TestOpenFile(t *testing.T) {
+	// Set up a test server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if accept := r.Header.Get("Accept"); accept != rawMediaType {
+			t.Errorf("Expected Accept %q, got %q", rawMediaType, accept)
+		}
+
+		switch r.URL.Path {
+		case "/repos/owner/repo/contents/file.txt":
+			if ref := r.URL.Query().Get("ref"); ref != "v1.0.0" {
+				t.Errorf("Expected ref v1.0.0, got %q", ref)
+			}
+			w.Header().Set("Content-Type", "application/octet-stream")
+			io.WriteString(w, "Hello, World!")
+
+		case "/repos/owner/repo/contents/dir":
+			// Directories are always returned as a JSON listing
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			json.NewEncoder(w).Encode(DirectoryContents{})
+
+		case "/repos/owner/repo/contents/rate-limit":
+			w.WriteHeader(http.StatusForbidden)
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := testClient(server)
+
+	originalGetFunc := getContentsURL
+	getContentsURL = func(base, owner, repo, path string) string {
+		return server.URL + "/repos/" + owner + "/" + repo + "/contents/" + path
+	}
+	defer func() { getContentsURL = originalGetFunc }()
+
+	// Test streaming a valid file
+	body, info, err := client.OpenFile(context.Background(), "owner", "repo", "v1.0.0", "file.txt")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	content, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		t.Fatalf("Failed to read body: %v", err)
+	}
+	if string(content) != "Hello, World!" {
+		t.Errorf("Expected content 'Hello, World!', got '%s'", string(content))
+	}
+	if info.Name != "file.txt" || info.Size != int64(len(content)) {
+		t.Errorf("Unexpected file info: %+v", info)
+	}
+
+	// Test opening a directory
+	_, _, err = client.OpenFile(context.Background(), "owner", "repo", "", "dir")
+	if err != ErrFileNotFound {
+		t.Errorf("Expected ErrFileNotFound for directory, got %v", err)
+	}
+
+	// Test getting a non-existent file
+	_, _, err = client.OpenFile(context.Background(), "owner", "repo", "", "not-found.txt")
+	if err != ErrFileNotFound {
+		t.Errorf("Expected ErrFileNotFound, got %v", err)
+	}
+
+	// Test rate limit exceeded
+	_, _, err = client.OpenFile(context.Background(), "owner", "repo", "", "rate-limit")
 	if err != ErrRateLimitExceeded {
 		t.Errorf("Expected ErrRateLimitExceeded, got %v", err)
 	}
@@ -155,13 +230,13 @@ func TestGetDirectoryContents(t *testing.T) {
 
 	// Use a custom makeRequest method to point to our test server
 	originalGetFunc := getContentsURL
-	getContentsURL = func(owner, repo, path string) string {
+	getContentsURL = func(base, owner, repo, path string) string {
 		return server.URL + "/repos/" + owner + "/" + repo + "/contents/" + path
 	}
 	defer func() { getContentsURL = originalGetFunc }()
 
 	// Test getting a valid directory
-	contents, err := client.GetDirectoryContents("owner", "repo", "dir")
+	contents, err := client.GetDirectoryContents(context.Background(), "owner", "repo", "", "dir")
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
@@ -170,7 +245,7 @@ func TestGetDirectoryContents(t *testing.T) {
 	}
 
 	// Test getting an empty directory
-	contents, err = client.GetDirectoryContents("owner", "repo", "empty-dir")
+	contents, err = client.GetDirectoryContents(context.Background(), "owner", "repo", "", "empty-dir")
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
@@ -179,7 +254,7 @@ func TestGetDirectoryContents(t *testing.T) {
 	}
 
 	// Test getting a non-existent directory
-	_, err = client.GetDirectoryContents("owner", "repo", "not-found-dir")
+	_, err = client.GetDirectoryContents(context.Background(), "owner", "repo", "", "not-found-dir")
 	if err != ErrDirectoryNotFound {
 		t.Errorf("Expected ErrDirectoryNotFound, got %v", err)
 	}
@@ -217,13 +292,13 @@ func TestRepositoryExists(t *testing.T) {
 
 	// Use a custom makeRequest method to point to our test server
 	originalGetFunc := getRepoURL
-	getRepoURL = func(owner, repo string) string {
+	getRepoURL = func(base, owner, repo string) string {
 		return server.URL + "/repos/" + owner + "/" + repo
 	}
 	defer func() { getRepoURL = originalGetFunc }()
 
 	// Test checking an existing repository
-	exists, err := client.RepositoryExists("owner", "existing-repo")
+	exists, err := client.RepositoryExists(context.Background(), "owner", "existing-repo")
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
@@ -232,7 +307,7 @@ func TestRepositoryExists(t *testing.T) {
 	}
 
 	// Test checking a non-existent repository
-	exists, err = client.RepositoryExists("owner", "non-existing-repo")
+	exists, err = client.RepositoryExists(context.Background(), "owner", "non-existing-repo")
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
@@ -241,8 +316,51 @@ func TestRepositoryExists(t *testing.T) {
 	}
 
 	// Test rate limit exceeded
-	_, err = client.RepositoryExists("rate-limited", "repo")
+	_, err = client.RepositoryExists(context.Background(), "rate-limited", "repo")
 	if err != ErrRateLimitExceeded {
 		t.Errorf("Expected ErrRateLimitExceeded, got %v", err)
 	}
 }
+
+func TestGetTree(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/owner/repo/git/trees/v1.0.0":
+			if r.URL.Query().Get("recursive") != "1" {
+				t.Errorf("Expected recursive tree request, got %q", r.URL.RawQuery)
+			}
+			io.WriteString(w, `{"sha":"abc","tree":[{"path":"bin/run.sh","mode":"100755","type":"blob","sha":"def","size":10}],"truncated":false}`)
+
+		case "/repos/owner/repo/git/trees/rate-limit":
+			w.WriteHeader(http.StatusForbidden)
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := testClient(server)
+
+	originalTreeFunc := getTreeURL
+	getTreeURL = func(base, owner, repo, ref string) string {
+		return server.URL + "/repos/" + owner + "/" + repo + "/git/trees/" + ref + "?recursive=1"
+	}
+	defer func() { getTreeURL = originalTreeFunc }()
+
+	tree, err := client.GetTree(context.Background(), "owner", "repo", "v1.0.0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tree.Entries) != 1 || tree.Entries[0].Path != "bin/run.sh" || tree.Entries[0].Mode != ExecutableMode {
+		t.Errorf("Unexpected tree: %+v", tree)
+	}
+
+	if _, err := client.GetTree(context.Background(), "owner", "repo", "missing"); err != ErrDirectoryNotFound {
+		t.Errorf("Expected ErrDirectoryNotFound, got %v", err)
+	}
+
+	if _, err := client.GetTree(context.Background(), "owner", "repo", "rate-limit"); err != ErrRateLimitExceeded {
+		t.Errorf("Expected ErrRateLimitExceeded, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package github
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// PublicHost is the name of github.com, used by sources that name no host
+const PublicHost = "github.com"
+
+var ErrInvalidCABundle = errors.New("invalid CA bundle")
+
+// Host describes a GitHub installation: github.com or a GitHub Enterprise
+// Server instance
+type Host struct {
+	Name   string // Hostname, e.g. github.com
+	API    string // Base URL of the REST API
+	Web    string // Base URL archives are downloaded from
+	Raw    string // Base URL raw file content is served from
+	Token  string // Sent with every request made to the host
+	CAFile string // PEM bundle trusted in addition to the system roots
+}
+
+// NewHost returns the URLs of the installation at name. Any host other than
+// github.com is taken to be GitHub Enterprise Server, which serves its API
+// under /api/v3 and raw files under /raw.
+func NewHost(name string) Host {
+	if name == "" || name == PublicHost {
+		return Host{
+			Name: PublicHost,
+			API:  apiBaseURL,
+			Web:  "https://github.com",
+			Raw:  "https://raw.githubusercontent.com",
+		}
+	}
+
+	base := "https://" + name
+	return Host{
+		Name: name,
+		API:  base + "/api/v3",
+		Web:  base,
+		Raw:  base + "/raw",
+	}
+}
+
+// IsPublic reports whether h is github.com
+func (h Host) IsPublic() bool {
+	return h.Name == PublicHost
+}
+
+// HTTPClient returns a client that trusts the host's CA bundle and
+// authenticates every request sent to the host with its token
+func (h Host) HTTPClient(timeout time.Duration) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if h.CAFile != "" {
+		pem, err := os.ReadFile(h.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCABundle, err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: no certificates found in %s", ErrInvalidCABundle, h.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	client := &http.Client{Timeout: timeout, Transport: transport}
+	if h.Token != "" {
+		client.Transport = &authTransport{base: transport, token: h.Token, hosts: h.authorities()}
+	}
+	return client, nil
+}
+
+// authorities returns the host[:port] of each of the host's base URLs
+func (h Host) authorities() map[string]bool {
+	hosts := make(map[string]bool)
+	for _, base := range []string{h.API, h.Web, h.Raw} {
+		if u, err := url.Parse(base); err == nil && u.Host != "" {
+			hosts[u.Host] = true
+		}
+	}
+	return hosts
+}
+
+// authTransport adds the token to requests for the host it belongs to, and
+// to no others, so redirects to storage servers never see it
+type authTransport struct {
+	base  http.RoundTripper
+	token string
+	hosts map[string]bool
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.hosts[req.URL.Host] || req.Header.Get("Authorization") != "" {
+		return t.base.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,122 @@
+package github
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewHost(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+		want Host
+	}{
+		{
+			name: "Default",
+			host: "",
+			want: Host{Name: "github.com", API: "https://api.github.com", Web: "https://github.com", Raw: "https://raw.githubusercontent.com"},
+		},
+		{
+			name: "Enterprise",
+			host: "git.corp.example",
+			want: Host{Name: "git.corp.example", API: "https://git.corp.example/api/v3", Web: "https://git.corp.example", Raw: "https://git.corp.example/raw"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewHost(tt.host); got != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+// writeCABundle writes the certificate of a TLS test server to a PEM file
+func writeCABundle(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	block := &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestHost_HTTPClient(t *testing.T) {
+	var gotAuth string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.Write([]byte(`{"full_name":"platform/tools"}`))
+	}))
+	defer server.Close()
+
+	host := Host{Name: "ghe", API: server.URL + "/api/v3", Token: "secret"}
+
+	t.Run("Untrusted certificate", func(t *testing.T) {
+		client, err := host.HTTPClient(time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Get(server.URL); err == nil {
+			t.Errorf("Expected the self-signed certificate to be rejected")
+		}
+	})
+
+	host.CAFile = writeCABundle(t, server)
+
+	t.Run("CA bundle and token", func(t *testing.T) {
+		client, err := NewHostClient(host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exists, err := client.RepositoryExists(context.Background(), "platform", "tools")
+		if err != nil || !exists {
+			t.Fatalf("Expected repository to exist, got %v, %v", exists, err)
+		}
+		if gotAuth != "Bearer secret" {
+			t.Errorf("Expected token to be sent, got %q", gotAuth)
+		}
+	})
+
+	t.Run("Token stays with its host", func(t *testing.T) {
+		u, _ := url.Parse(server.URL)
+		other := host
+		other.API = "https://other.example"
+		client, err := other.HTTPClient(time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotAuth = ""
+		if _, err := client.Get("https://" + u.Host); err != nil {
+			t.Fatal(err)
+		}
+		if gotAuth != "" {
+			t.Errorf("Expected no token for another host, got %q", gotAuth)
+		}
+	})
+
+	t.Run("Invalid CA bundle", func(t *testing.T) {
+		bad := host
+		bad.CAFile = filepath.Join(t.TempDir(), "missing.pem")
+		if _, err := bad.HTTPClient(time.Second); !errors.Is(err, ErrInvalidCABundle) {
+			t.Errorf("Expected ErrInvalidCABundle, got %v", err)
+		}
+
+		empty := filepath.Join(t.TempDir(), "empty.pem")
+		os.WriteFile(empty, []byte("not a certificate"), 0644)
+		bad.CAFile = empty
+		if _, err := bad.HTTPClient(time.Second); !errors.Is(err, ErrInvalidCABundle) {
+			t.Errorf("Expected ErrInvalidCABundle, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// LatestRelease names the most recent non-prerelease release in place of a tag
+const LatestRelease = "latest"
+
+const (
+	// assetMediaType asks the release assets API for the asset bytes
+	assetMediaType = "application/octet-stream"
+	// assetTimeout bounds asset transfers, which may be far larger than
+	// API responses
+	assetTimeout = 5 * time.Minute
+)
+
+var (
+	// getReleaseURL generates the URL for looking up a release by tag, or
+	// the latest release
+	getReleaseURL = func(base, owner, repo, tag string) string {
+		if tag == "" || tag == LatestRelease {
+			return fmt.Sprintf("%s/repos/%s/%s/releases/latest", base, owner, repo)
+		}
+		return fmt.Sprintf("%s/repos/%s/%s/releases/tags/%s", base, owner, repo, url.PathEscape(tag))
+	}
+)
+
+var (
+	ErrReleaseNotFound = errors.New("release not found")
+	ErrAssetNotFound   = errors.New("release asset not found")
+)
+
+// ReleaseAsset is a file attached to a release
+type ReleaseAsset struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	// URL is the API location of the asset, which serves its content to
+	// authenticated requests for private repositories too
+	URL string `json:"url"`
+}
+
+// Release is a published release and the assets attached to it
+type Release struct {
+	TagName string         `json:"tag_name"`
+	Name    string         `json:"name"`
+	Assets  []ReleaseAsset `json:"assets"`
+}
+
+// MatchAssets returns the assets whose names match pattern, a name or a
+// glob as understood by path.Match
+func (r *Release) MatchAssets(pattern string) ([]ReleaseAsset, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid asset pattern %q: %w", pattern, err)
+	}
+
+	var matched []ReleaseAsset
+	for _, asset := range r.Assets {
+		if ok, _ := path.Match(pattern, asset.Name); ok {
+			matched = append(matched, asset)
+		}
+	}
+	if len(matched) == 0 {
+		names := make([]string, len(r.Assets))
+		for i, asset := range r.Assets {
+			names[i] = asset.Name
+		}
+		return nil, fmt.Errorf("%w: no asset of %s matches %q (has %s)", ErrAssetNotFound, r.TagName, pattern, strings.Join(names, ", "))
+	}
+	return matched, nil
+}
+
+// GetRelease fetches the release tagged tag. An empty tag or LatestRelease
+// selects the latest release.
+func (c *Client) GetRelease(ctx context.Context, owner, repo, tag string) (*Release, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, getReleaseURL(c.host.API, owner, repo, tag), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNetworkFailure, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		if tag == "" {
+			tag = LatestRelease
+		}
+		return nil, fmt.Errorf("%w: %s/%s@%s", ErrReleaseNotFound, owner, repo, tag)
+	case http.StatusForbidden:
+		return nil, ErrRateLimitExceeded
+	default:
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var release Release
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, fmt.Errorf("failed to parse release: %w", err)
+	}
+	return &release, nil
+}
+
+// OpenAsset opens a streaming reader over the content of a release asset.
+// The caller must close the returned reader.
+func (c *Client) OpenAsset(ctx context.Context, asset ReleaseAsset) (io.ReadCloser, FileInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, asset.URL, nil)
+	if err != nil {
+		return nil, FileInfo{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", assetMediaType)
+
+	// Assets are served from a storage host the API redirects to, which the
+	// client follows without passing on the token
+	client := *c.httpClient
+	client.Timeout = assetTimeout
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, FileInfo{}, fmt.Errorf("%w: %v", ErrNetworkFailure, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusNotFound:
+			return nil, FileInfo{}, fmt.Errorf("%w: %s", ErrAssetNotFound, asset.Name)
+		case http.StatusForbidden:
+			return nil, FileInfo{}, ErrRateLimitExceeded
+		default:
+			return nil, FileInfo{}, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		}
+	}
+
+	size := resp.ContentLength
+	if size < 0 {
+		size = asset.Size
+	}
+	return resp.Body, FileInfo{Name: asset.Name, Path: asset.Name, Size: size}, nil
+}
@@ -0,0 +1,132 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetRelease(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/owner/repo/releases/latest", "/repos/owner/repo/releases/tags/v1.2.3":
+			fmt.Fprintf(w, `{"tag_name": "v1.2.3", "assets": [
+				{"name": "xcp-linux-amd64.tar.gz", "size": 4, "url": "%[1]s/assets/1"},
+				{"name": "xcp-darwin-arm64.tar.gz", "size": 4, "url": "%[1]s/assets/2"},
+				{"name": "checksums.txt", "size": 10, "url": "%[1]s/assets/3"}]}`, server.URL)
+		case "/repos/owner/repo/releases/tags/limited":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := testClient(server)
+	client.host.API = server.URL
+
+	for _, tag := range []string{"", LatestRelease, "v1.2.3"} {
+		release, err := client.GetRelease(context.Background(), "owner", "repo", tag)
+		if err != nil {
+			t.Fatalf("GetRelease(%q) unexpected error: %v", tag, err)
+		}
+		if release.TagName != "v1.2.3" || len(release.Assets) != 3 {
+			t.Errorf("GetRelease(%q) = %+v", tag, release)
+		}
+	}
+
+	if _, err := client.GetRelease(context.Background(), "owner", "repo", "v9"); !errors.Is(err, ErrReleaseNotFound) {
+		t.Errorf("Expected ErrReleaseNotFound, got %v", err)
+	}
+	if _, err := client.GetRelease(context.Background(), "owner", "repo", "limited"); !errors.Is(err, ErrRateLimitExceeded) {
+		t.Errorf("Expected ErrRateLimitExceeded, got %v", err)
+	}
+}
+
+func TestRelease_MatchAssets(t *testing.T) {
+	release := &Release{TagName: "v1", Assets: []ReleaseAsset{
+		{Name: "xcp-linux-amd64.tar.gz"},
+		{Name: "xcp-darwin-arm64.tar.gz"},
+		{Name: "checksums.txt"},
+	}}
+
+	tests := []struct {
+		pattern  string
+		expected []string
+		err      error
+	}{
+		{"checksums.txt", []string{"checksums.txt"}, nil},
+		{"xcp-*.tar.gz", []string{"xcp-linux-amd64.tar.gz", "xcp-darwin-arm64.tar.gz"}, nil},
+		{"xcp-windows-*.zip", nil, ErrAssetNotFound},
+		{"xcp-[", nil, nil},
+	}
+
+	for _, tt := range tests {
+		matched, err := release.MatchAssets(tt.pattern)
+		if tt.expected == nil {
+			if err == nil || (tt.err != nil && !errors.Is(err, tt.err)) {
+				t.Errorf("MatchAssets(%q) expected error %v, got %v", tt.pattern, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("MatchAssets(%q) unexpected error: %v", tt.pattern, err)
+		}
+		var names []string
+		for _, asset := range matched {
+			names = append(names, asset.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("MatchAssets(%q) = %v, expected %v", tt.pattern, names, tt.expected)
+		}
+	}
+}
+
+func TestOpenAsset(t *testing.T) {
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("Expected no token on the storage host")
+		}
+		io.WriteString(w, "binary")
+	}))
+	defer storage.Close()
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != assetMediaType {
+			t.Errorf("Expected Accept %q, got %q", assetMediaType, r.Header.Get("Accept"))
+		}
+		switch r.URL.Path {
+		case "/assets/1":
+			http.Redirect(w, r, storage.URL+"/blob", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer api.Close()
+
+	client, err := NewHostClient(Host{API: api.URL, Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, info, err := client.OpenAsset(context.Background(), ReleaseAsset{Name: "xcp.tar.gz", Size: 6, URL: api.URL + "/assets/1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer body.Close()
+	content, _ := io.ReadAll(body)
+	if string(content) != "binary" || info.Name != "xcp.tar.gz" || info.Size != 6 {
+		t.Errorf("Unexpected asset %q %+v", content, info)
+	}
+
+	_, _, err = client.OpenAsset(context.Background(), ReleaseAsset{Name: "gone.zip", URL: api.URL + "/assets/2"})
+	if !errors.Is(err, ErrAssetNotFound) {
+		t.Errorf("Expected ErrAssetNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,224 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// shaMediaType asks the commits API for the bare commit SHA
+const shaMediaType = "application/vnd.github.sha"
+
+var (
+	// getGitRefURL generates the URL for looking up a single branch or tag
+	getGitRefURL = func(base, owner, repo, ref string) string {
+		return fmt.Sprintf("%s/repos/%s/%s/git/ref/%s", base, owner, repo, ref)
+	}
+
+	// getCommitURL generates the URL for resolving a ref to a commit
+	getCommitURL = func(base, owner, repo, ref string) string {
+		return fmt.Sprintf("%s/repos/%s/%s/commits/%s", base, owner, repo, ref)
+	}
+
+	// getPullURL generates the URL for looking up a pull request
+	getPullURL = func(base, owner, repo string, number int) string {
+		return fmt.Sprintf("%s/repos/%s/%s/pulls/%d", base, owner, repo, number)
+	}
+)
+
+var (
+	ErrRefNotFound   = errors.New("ref not found in repository")
+	ErrNoMergeCommit = errors.New("pull request has no merge commit")
+)
+
+// RefKind tells what a ref names
+type RefKind string
+
+const (
+	RefBranch RefKind = "branch"
+	RefTag    RefKind = "tag"
+	RefCommit RefKind = "commit"
+	// RefPull is a pull request, whose head moves as commits are pushed
+	RefPull RefKind = "pull"
+)
+
+// ResolvedRef is a ref together with the commit it currently points to
+type ResolvedRef struct {
+	Ref    string
+	Kind   RefKind
+	Commit string
+}
+
+// IsCommitSHA reports whether ref looks like an abbreviated or full commit SHA
+func IsCommitSHA(ref string) bool {
+	if len(ref) < 7 || len(ref) > 40 {
+		return false
+	}
+	for _, r := range ref {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// ResolveRef finds out whether ref is a branch, tag or commit and which
+// commit it points to. An empty ref resolves the default branch, and pull
+// request refs resolve to the pull request's head or merge commit.
+func (c *Client) ResolveRef(ctx context.Context, owner, repo, ref string) (*ResolvedRef, error) {
+	if number, merge, ok := ParsePullRef(ref); ok {
+		commit, err := c.pullCommit(ctx, owner, repo, number, merge)
+		if err != nil {
+			return nil, err
+		}
+		return &ResolvedRef{Ref: ref, Kind: RefPull, Commit: commit}, nil
+	}
+
+	kind := RefCommit
+	switch {
+	case ref == "":
+		kind = RefBranch
+	case len(ref) == 40 && IsCommitSHA(ref):
+		// A full SHA can only be a commit
+	default:
+		for _, candidate := range []struct {
+			prefix string
+			kind   RefKind
+		}{{"heads/", RefBranch}, {"tags/", RefTag}} {
+			found, err := c.refExists(ctx, owner, repo, candidate.prefix+ref)
+			if err != nil {
+				return nil, err
+			}
+			if found {
+				kind = candidate.kind
+				break
+			}
+		}
+	}
+
+	lookup := ref
+	if lookup == "" {
+		lookup = "HEAD"
+	}
+	commit, err := c.commitSHA(ctx, owner, repo, lookup)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ResolvedRef{Ref: ref, Kind: kind, Commit: commit}, nil
+}
+
+// pullCommit returns the head commit of pull request number, or its merge
+// commit when merge is set. Heads pushed from forks are reachable in the
+// base repository, so the commit can be fetched from owner/repo either way.
+func (c *Client) pullCommit(ctx context.Context, owner, repo string, number int, merge bool) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, getPullURL(c.host.API, owner, repo, number), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNetworkFailure, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", fmt.Errorf("%w: pull request %d", ErrRefNotFound, number)
+	case http.StatusForbidden:
+		return "", ErrRateLimitExceeded
+	default:
+		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var pull struct {
+		Head struct {
+			SHA string `json:"sha"`
+		} `json:"head"`
+		MergeCommitSHA string `json:"merge_commit_sha"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&pull); err != nil {
+		return "", fmt.Errorf("failed to parse pull request: %w", err)
+	}
+
+	sha := pull.Head.SHA
+	if merge {
+		// GitHub only keeps a merge commit for pull requests that merge cleanly
+		if pull.MergeCommitSHA == "" {
+			return "", fmt.Errorf("%w: pull request %d does not merge cleanly", ErrNoMergeCommit, number)
+		}
+		sha = pull.MergeCommitSHA
+	}
+	if len(sha) != 40 || !IsCommitSHA(sha) {
+		return "", fmt.Errorf("unexpected commit SHA %q for pull request %d", sha, number)
+	}
+	return strings.ToLower(sha), nil
+}
+
+// refExists reports whether the fully qualified ref (e.g. heads/main) exists
+func (c *Client) refExists(ctx context.Context, owner, repo, ref string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, getGitRefURL(c.host.API, owner, repo, ref), nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrNetworkFailure, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	case http.StatusForbidden:
+		return false, ErrRateLimitExceeded
+	default:
+		return false, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+}
+
+// commitSHA returns the full SHA of the commit ref points to, peeling
+// annotated tags
+func (c *Client) commitSHA(ctx context.Context, owner, repo, ref string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, getCommitURL(c.host.API, owner, repo, ref), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", shaMediaType)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNetworkFailure, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusUnprocessableEntity:
+		return "", fmt.Errorf("%w: %s", ErrRefNotFound, ref)
+	case http.StatusForbidden:
+		return "", ErrRateLimitExceeded
+	default:
+		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 128))
+	if err != nil {
+		return "", fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	sha := strings.TrimSpace(string(body))
+	if len(sha) != 40 || !IsCommitSHA(sha) {
+		return "", fmt.Errorf("unexpected commit SHA %q for %s", sha, ref)
+	}
+	return strings.ToLower(sha), nil
+}
@@ -0,0 +1,116 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	mainCommit = "1111111111111111111111111111111111111111"
+	tagCommit  = "2222222222222222222222222222222222222222"
+	fullCommit = "3333333333333333333333333333333333333333"
+)
+
+func TestIsCommitSHA(t *testing.T) {
+	tests := []struct {
+		ref      string
+		expected bool
+	}{
+		{"abc1234", true},
+		{fullCommit, true},
+		{"ABCDEF0", true},
+		{"abc123", false},
+		{"main", false},
+		{"v1.0.0", false},
+		{fullCommit + "3", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsCommitSHA(tt.ref); got != tt.expected {
+			t.Errorf("IsCommitSHA(%q) = %v, expected %v", tt.ref, got, tt.expected)
+		}
+	}
+}
+
+func TestResolveRef(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/owner/repo/git/ref/heads/main", "/repos/owner/repo/git/ref/tags/v1.0.0":
+			io.WriteString(w, `{}`)
+		case "/repos/owner/repo/git/ref/heads/rate-limit":
+			w.WriteHeader(http.StatusForbidden)
+		case "/repos/owner/repo/commits/main", "/repos/owner/repo/commits/HEAD":
+			io.WriteString(w, mainCommit)
+		case "/repos/owner/repo/commits/v1.0.0":
+			io.WriteString(w, tagCommit)
+		case "/repos/owner/repo/commits/333333333", "/repos/owner/repo/commits/" + fullCommit:
+			io.WriteString(w, fullCommit)
+		case "/repos/owner/repo/pulls/7":
+			io.WriteString(w, `{"head":{"sha":"`+tagCommit+`","repo":{"full_name":"fork/repo"}},"merge_commit_sha":"`+fullCommit+`"}`)
+		case "/repos/owner/repo/pulls/8":
+			io.WriteString(w, `{"head":{"sha":"`+tagCommit+`"},"merge_commit_sha":null}`)
+		case "/repos/owner/repo/commits/missing":
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		default:
+			if strings.Contains(r.URL.Path, "/commits/") && r.Header.Get("Accept") != shaMediaType {
+				t.Errorf("Expected Accept %q", shaMediaType)
+			}
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := testClient(server)
+
+	originalRefFunc, originalCommitFunc, originalPullFunc := getGitRefURL, getCommitURL, getPullURL
+	getGitRefURL = func(base, owner, repo, ref string) string {
+		return server.URL + "/repos/" + owner + "/" + repo + "/git/ref/" + ref
+	}
+	getCommitURL = func(base, owner, repo, ref string) string {
+		return server.URL + "/repos/" + owner + "/" + repo + "/commits/" + ref
+	}
+	getPullURL = func(base, owner, repo string, number int) string {
+		return fmt.Sprintf("%s/repos/%s/%s/pulls/%d", server.URL, owner, repo, number)
+	}
+	defer func() { getGitRefURL, getCommitURL, getPullURL = originalRefFunc, originalCommitFunc, originalPullFunc }()
+
+	tests := []struct {
+		ref    string
+		kind   RefKind
+		commit string
+		err    error
+	}{
+		{ref: "", kind: RefBranch, commit: mainCommit},
+		{ref: "main", kind: RefBranch, commit: mainCommit},
+		{ref: "v1.0.0", kind: RefTag, commit: tagCommit},
+		{ref: "333333333", kind: RefCommit, commit: fullCommit},
+		{ref: fullCommit, kind: RefCommit, commit: fullCommit},
+		{ref: "missing", err: ErrRefNotFound},
+		{ref: "pr/7", kind: RefPull, commit: tagCommit},
+		{ref: "pr/7/merge", kind: RefPull, commit: fullCommit},
+		{ref: "pr/8/merge", err: ErrNoMergeCommit},
+		{ref: "pr/9", err: ErrRefNotFound},
+		{ref: "rate-limit", err: ErrRateLimitExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			resolved, err := client.ResolveRef(context.Background(), "owner", "repo", tt.ref)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expected error %v, got %v", tt.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if resolved.Kind != tt.kind || resolved.Commit != tt.commit || resolved.Ref != tt.ref {
+				t.Errorf("Unexpected resolution %+v", resolved)
+			}
+		})
+	}
+}
@@ -3,29 +3,50 @@ package github
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 )
 
 // ParsedURL represents a fully parsed GitHub repository URL with ref support
 type ParsedURL struct {
-	Owner string
-	Repo  string
-	Path  string
-	Ref   string
+	Provider    string // Service the repository lives on; empty for GitHub
+	Host        string // Empty for the provider's public instance
+	Owner       string
+	Repo        string
+	Path        string
+	Ref         string
+	ExplicitRef bool // Ref was given in the URL rather than defaulted to main
+	// Asset names release assets to download, by name or glob, instead of
+	// repository content; Ref is then the release tag, by default the latest
+	Asset string
 }
 
 // GitHubSource represents a parsed GitHub repository source (for backward compatibility)
 type GitHubSource struct {
-	Owner  string
-	Repo   string
-	Path   string
-	IsFile bool
+	Provider string // Empty for GitHub
+	Host     string // Empty for the provider's public instance
+	Owner    string
+	Repo     string
+	Path     string
+	Ref      string // Empty selects the repository's default branch
+	IsFile   bool
+	Asset    string // Release asset pattern; Ref is then the release tag
 }
 
+const (
+	// pullRefPrefix starts refs naming a pull request, which resolve to its
+	// head commit, or with pullMergeSuffix to its test merge commit
+	pullRefPrefix   = "pr/"
+	pullMergeSuffix = "/merge"
+	// rangeSeparator joins the base and head refs of a compare range
+	rangeSeparator = ".."
+)
+
 var (
 	ErrInvalidURL   = errors.New("invalid GitHub URL format")
 	ErrMissingOwner = errors.New("GitHub owner is required")
 	ErrMissingRepo  = errors.New("GitHub repository is required")
+	ErrMissingHost  = errors.New("GitHub host is required")
 )
 
 // ParseGitHubURL parses a GitHub URL in the format "github:owner/repo/path" or "github:owner/repo@ref/path"
@@ -36,12 +57,7 @@ func ParseGitHubURL(url string) (*GitHubSource, error) {
 	}
 
 	// Convert to legacy GitHubSource for backward compatibility
-	return &GitHubSource{
-		Owner:  parsed.Owner,
-		Repo:   parsed.Repo,
-		Path:   parsed.Path,
-		IsFile: parsed.IsFile(),
-	}, nil
+	return parsed.Source(), nil
 }
 
 // ParseGitHubURLWithRef parses a GitHub URL with full ref support
@@ -53,13 +69,22 @@ func ParseGitHubURL(url string) (*GitHubSource, error) {
 //   - github:owner/repo@commit
 //   - github:owner/repo@ref/path/to/file
 //   - github:owner/repo/path@ref
+//   - github@host:owner/repo[@ref][/path] for GitHub Enterprise Server
+//   - github:owner/repo[@tag]#asset=name-or-glob for release assets
+//   - github:owner/repo@pr/123[/merge][/path] for a pull request's head or
+//     merge commit
+//   - github:owner/repo@base..head[/path] for the range xcp diff compares
 func ParseGitHubURLWithRef(url string) (*ParsedURL, error) {
-	if !strings.HasPrefix(url, "github:") {
-		return nil, ErrInvalidURL
+	host, urlPart, err := splitHost(url)
+	if err != nil {
+		return nil, err
 	}
 
-	// Remove prefix
-	urlPart := strings.TrimPrefix(url, "github:")
+	urlPart, fragment, hasFragment := strings.Cut(urlPart, "#")
+	asset, isAsset := strings.CutPrefix(fragment, "asset=")
+	if hasFragment && (!isAsset || asset == "") {
+		return nil, ErrInvalidURL
+	}
 
 	// Split by @ to separate owner/repo/path from ref
 	var ownerRepoPart, refPart string
@@ -74,14 +99,10 @@ func ParseGitHubURLWithRef(url string) (*ParsedURL, error) {
 		refPart = urlPart[atIndex+1:]
 
 		// Handle case where path comes after @ref
-		// e.g., github:owner/repo/path@branch
-		slashInRef := strings.Index(refPart, "/")
-		if slashInRef != -1 {
-			// Path is after the ref, move it to ownerRepoPart
-			pathAfterRef := refPart[slashInRef:]
-			refPart = refPart[:slashInRef]
-			ownerRepoPart = ownerRepoPart + pathAfterRef
-		}
+		// e.g., github:owner/repo@branch/path
+		var pathAfterRef string
+		refPart, pathAfterRef = cutRef(refPart)
+		ownerRepoPart = ownerRepoPart + pathAfterRef
 	}
 
 	// Parse owner/repo/path
@@ -106,18 +127,113 @@ func ParseGitHubURLWithRef(url string) (*ParsedURL, error) {
 		return nil, ErrMissingRepo
 	}
 
+	explicitRef := atIndex != -1 && refPart != ""
 	if refPart == "" {
 		refPart = "main"
 	}
 
+	// Releases hold assets, not paths, and default to the latest one
+	if asset != "" {
+		if path != "" {
+			return nil, fmt.Errorf("%w: release assets take no path", ErrInvalidURL)
+		}
+		if !explicitRef {
+			refPart = LatestRelease
+		}
+	}
+
 	return &ParsedURL{
-		Owner: owner,
-		Repo:  repo,
-		Path:  path,
-		Ref:   refPart,
+		Host:        host,
+		Owner:       owner,
+		Repo:        repo,
+		Path:        path,
+		Ref:         refPart,
+		ExplicitRef: explicitRef,
+		Asset:       asset,
 	}, nil
 }
 
+// cutRef splits the ref at the start of s from the "/path" after it. Pull
+// request refs span slashes, and a compare range joins two refs with "..".
+func cutRef(s string) (string, string) {
+	ref, rest := cutSingleRef(s)
+	if after, ok := strings.CutPrefix(rest, rangeSeparator); ok {
+		head, path := cutSingleRef(after)
+		return ref + rangeSeparator + head, path
+	}
+	return ref, rest
+}
+
+// cutSingleRef splits a single ref at the start of s from whatever follows
+// it: a "/path", a ".." or nothing. Branch names cannot hold "..".
+func cutSingleRef(s string) (string, string) {
+	if ref, rest, ok := cutPullRef(s); ok {
+		return ref, rest
+	}
+	end := len(s)
+	if i := strings.Index(s, "/"); i != -1 {
+		end = i
+	}
+	if i := strings.Index(s, rangeSeparator); i != -1 && i < end {
+		end = i
+	}
+	return s[:end], s[end:]
+}
+
+// cutPullRef splits a pull request ref, pr/N or pr/N/merge, at the start of
+// s from what follows it
+func cutPullRef(s string) (string, string, bool) {
+	digits, ok := strings.CutPrefix(s, pullRefPrefix)
+	if !ok {
+		return "", s, false
+	}
+	n := 0
+	for n < len(digits) && digits[n] >= '0' && digits[n] <= '9' {
+		n++
+	}
+	if n == 0 {
+		return "", s, false
+	}
+
+	ref, rest := s[:len(pullRefPrefix)+n], digits[n:]
+	if after, ok := strings.CutPrefix(rest, pullMergeSuffix); ok && endsRef(after) {
+		ref, rest = ref+pullMergeSuffix, after
+	}
+	if !endsRef(rest) {
+		return "", s, false
+	}
+	return ref, rest, true
+}
+
+// endsRef reports whether rest can follow a complete ref
+func endsRef(rest string) bool {
+	return rest == "" || strings.HasPrefix(rest, "/") || strings.HasPrefix(rest, rangeSeparator)
+}
+
+// splitHost separates the host named by a "github@host:" prefix from the
+// rest of url. github.com is reported as no host.
+func splitHost(url string) (string, string, error) {
+	if rest, ok := strings.CutPrefix(url, "github:"); ok {
+		return "", rest, nil
+	}
+
+	rest, ok := strings.CutPrefix(url, "github@")
+	if !ok {
+		return "", "", ErrInvalidURL
+	}
+	host, rest, ok := strings.Cut(rest, ":")
+	if !ok || strings.Contains(host, "/") {
+		return "", "", ErrInvalidURL
+	}
+	if host == "" {
+		return "", "", ErrMissingHost
+	}
+	if host == PublicHost {
+		host = ""
+	}
+	return strings.ToLower(host), rest, nil
+}
+
 // APIPath returns the GitHub API path for this source
 func (s *GitHubSource) APIPath() string {
 	if s.Path == "" {
@@ -131,9 +247,66 @@ func (s *GitHubSource) FullRepoName() string {
 	return s.Owner + "/" + s.Repo
 }
 
+// Source converts the parsed URL to the GitHubSource the API and raw
+// downloaders take. A ref that was only defaulted is left empty so the
+// repository's default branch is used.
+func (p *ParsedURL) Source() *GitHubSource {
+	source := &GitHubSource{
+		Provider: p.Provider,
+		Host:     p.Host,
+		Owner:    p.Owner,
+		Repo:     p.Repo,
+		Path:     p.Path,
+		IsFile:   p.IsFile(),
+		Asset:    p.Asset,
+	}
+	if p.ExplicitRef {
+		source.Ref = p.Ref
+	}
+	return source
+}
+
+// Pin points the URL at commit, the commit its ref resolved to, so the
+// download cannot change if the ref moves
+func (p *ParsedURL) Pin(commit string) {
+	p.Ref = commit
+	p.ExplicitRef = true
+}
+
+// CompareRefs returns the base and head refs of a compare range ref,
+// base..head, and false for any other ref
+func (p *ParsedURL) CompareRefs() (string, string, bool) {
+	base, head, ok := strings.Cut(p.Ref, rangeSeparator)
+	if !ok || base == "" || head == "" {
+		return "", "", false
+	}
+	return base, head, true
+}
+
+// IsPullRef reports whether ref names a pull request, as pr/N or
+// pr/N/merge
+func IsPullRef(ref string) bool {
+	_, _, ok := ParsePullRef(ref)
+	return ok
+}
+
+// ParsePullRef returns the number of the pull request ref names and whether
+// it asks for the merge commit rather than the head
+func ParsePullRef(ref string) (int, bool, bool) {
+	pull, rest, ok := cutPullRef(ref)
+	if !ok || rest != "" {
+		return 0, false, false
+	}
+	number, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(pull, pullRefPrefix), pullMergeSuffix))
+	if err != nil {
+		return 0, false, false
+	}
+	return number, strings.HasSuffix(pull, pullMergeSuffix), true
+}
+
 // ZipURL returns the GitHub zip download URL for this parsed URL
 func (p *ParsedURL) ZipURL() string {
-	return fmt.Sprintf("https://github.com/%s/%s/archive/%s.zip", p.Owner, p.Repo, p.Ref)
+	return fmt.Sprintf("%s/%s/%s/archive/%s.zip", NewHost(p.Host).Web, p.Owner, p.Repo, p.Ref)
 }
 
 // IsFile returns true if the path appears to be a file (has an extension or doesn't end with /)
@@ -175,13 +348,31 @@ func (p *ParsedURL) APIPath() string {
 
 // String returns a string representation of the parsed URL
 func (p *ParsedURL) String() string {
-	base := fmt.Sprintf("github:%s/%s", p.Owner, p.Repo)
+	scheme := "github"
+	if p.Provider != "" {
+		scheme = p.Provider
+	}
+	if p.Host != "" {
+		scheme += "@" + p.Host
+	}
+	scheme += ":"
+	base := fmt.Sprintf("%s%s/%s", scheme, p.Owner, p.Repo)
+	if p.Owner == "" {
+		// Gists and archives at a server's root have no owner
+		base = scheme + p.Repo
+	}
+
+	if p.Asset != "" {
+		return fmt.Sprintf("%s@%s#asset=%s", base, p.Ref, p.Asset)
+	}
 
-	if p.Path != "" && p.Ref != "main" {
+	// Sources without a ref use their default one
+	defaultRef := p.Ref == "main" || p.Ref == ""
+	if p.Path != "" && !defaultRef {
 		return fmt.Sprintf("%s@%s/%s", base, p.Ref, p.Path)
 	} else if p.Path != "" {
 		return fmt.Sprintf("%s/%s", base, p.Path)
-	} else if p.Ref != "main" {
+	} else if !defaultRef {
 		return fmt.Sprintf("%s@%s", base, p.Ref)
 	}
 
@@ -1,6 +1,7 @@
 package github
 
 import (
+	"errors"
 	"testing"
 )
 
@@ -228,6 +229,85 @@ func TestParseGitHubURLWithRef(t *testing.T) {
 	}
 }
 
+func TestParseGitHubURLWithRef_Host(t *testing.T) {
+	tests := []struct {
+		name          string
+		url           string
+		expectedHost  string
+		expectedOwner string
+		expectedPath  string
+		expectedRef   string
+		expectedErr   error
+	}{
+		{
+			name:          "Enterprise repo",
+			url:           "github@git.corp.example:platform/tools",
+			expectedHost:  "git.corp.example",
+			expectedOwner: "platform",
+			expectedRef:   "main",
+		},
+		{
+			name:          "Enterprise path with ref",
+			url:           "github@GIT.corp.example:platform/tools@v2/bin/run.sh",
+			expectedHost:  "git.corp.example",
+			expectedOwner: "platform",
+			expectedPath:  "bin/run.sh",
+			expectedRef:   "v2",
+		},
+		{
+			name:          "Public host named explicitly",
+			url:           "github@github.com:twilson63/qa",
+			expectedHost:  "",
+			expectedOwner: "twilson63",
+			expectedRef:   "main",
+		},
+		{
+			name:        "Empty host",
+			url:         "github@:platform/tools",
+			expectedErr: ErrMissingHost,
+		},
+		{
+			name:        "No colon after host",
+			url:         "github@git.corp.example/platform/tools",
+			expectedErr: ErrInvalidURL,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseGitHubURLWithRef(tt.url)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if parsed.Host != tt.expectedHost {
+				t.Errorf("Expected host %q, got %q", tt.expectedHost, parsed.Host)
+			}
+			if parsed.Owner != tt.expectedOwner {
+				t.Errorf("Expected owner %s, got %s", tt.expectedOwner, parsed.Owner)
+			}
+			if parsed.Path != tt.expectedPath {
+				t.Errorf("Expected path %s, got %s", tt.expectedPath, parsed.Path)
+			}
+			if parsed.Ref != tt.expectedRef {
+				t.Errorf("Expected ref %s, got %s", tt.expectedRef, parsed.Ref)
+			}
+
+			// The host survives a round trip through String
+			again, err := ParseGitHubURLWithRef(parsed.String())
+			if err != nil || again.Host != parsed.Host {
+				t.Errorf("Expected %s to keep host %q, got %+v (%v)", parsed.String(), parsed.Host, again, err)
+			}
+		})
+	}
+}
+
 func TestParsedURL_ZipURL(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -261,6 +341,16 @@ func TestParsedURL_ZipURL(t *testing.T) {
 			},
 			expectedURL: "https://github.com/twilson63/qa/archive/v1.0.0.zip",
 		},
+		{
+			name: "Enterprise host",
+			parsed: &ParsedURL{
+				Host:  "git.corp.example",
+				Owner: "platform",
+				Repo:  "tools",
+				Ref:   "main",
+			},
+			expectedURL: "https://git.corp.example/platform/tools/archive/main.zip",
+		},
 	}
 
 	for _, tt := range tests {
@@ -378,3 +468,166 @@ func TestParsedURL_IsDirectory(t *testing.T) {
 		})
 	}
 }
+
+func TestParseGitHubURL_Ref(t *testing.T) {
+	tests := []struct {
+		url         string
+		expectedRef string
+	}{
+		{"github:owner/repo", ""},
+		{"github:owner/repo/file.txt", ""},
+		{"github:owner/repo@", ""},
+		{"github:owner/repo@develop", "develop"},
+		{"github:owner/repo@v1.0.0/file.txt", "v1.0.0"},
+	}
+
+	for _, tt := range tests {
+		source, err := ParseGitHubURL(tt.url)
+		if err != nil {
+			t.Errorf("ParseGitHubURL(%q) unexpected error: %v", tt.url, err)
+			continue
+		}
+
+		if source.Ref != tt.expectedRef {
+			t.Errorf("ParseGitHubURL(%q) ref = %q, expected %q", tt.url, source.Ref, tt.expectedRef)
+		}
+	}
+}
+
+func TestParseGitHubURLWithRef_Asset(t *testing.T) {
+	tests := []struct {
+		name          string
+		url           string
+		expectedRef   string
+		expectedAsset string
+		expectedErr   error
+	}{
+		{
+			name:          "Tagged release",
+			url:           "github:owner/repo@v1.2.3#asset=xcp-linux-amd64.tar.gz",
+			expectedRef:   "v1.2.3",
+			expectedAsset: "xcp-linux-amd64.tar.gz",
+		},
+		{
+			name:          "Latest release by default",
+			url:           "github:owner/repo#asset=xcp-*-amd64.tar.gz",
+			expectedRef:   LatestRelease,
+			expectedAsset: "xcp-*-amd64.tar.gz",
+		},
+		{
+			name:          "Latest release named",
+			url:           "github:owner/repo@latest#asset=checksums.txt",
+			expectedRef:   LatestRelease,
+			expectedAsset: "checksums.txt",
+		},
+		{
+			name:        "Empty asset",
+			url:         "github:owner/repo@v1#asset=",
+			expectedErr: ErrInvalidURL,
+		},
+		{
+			name:        "Unknown fragment",
+			url:         "github:owner/repo@v1#file=tools.zip",
+			expectedErr: ErrInvalidURL,
+		},
+		{
+			name:        "Asset with a path",
+			url:         "github:owner/repo@v1/bin#asset=tools.zip",
+			expectedErr: ErrInvalidURL,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseGitHubURLWithRef(tt.url)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if parsed.Ref != tt.expectedRef || parsed.Asset != tt.expectedAsset {
+				t.Errorf("Expected asset %q of %q, got %q of %q", tt.expectedAsset, tt.expectedRef, parsed.Asset, parsed.Ref)
+			}
+			if source := parsed.Source(); source.Asset != tt.expectedAsset || source.IsFile {
+				t.Errorf("Expected source for asset %q, got %+v", tt.expectedAsset, source)
+			}
+
+			again, err := ParseGitHubURLWithRef(parsed.String())
+			if err != nil || again.Asset != parsed.Asset || again.Ref != parsed.Ref {
+				t.Errorf("Expected %s to round trip, got %+v (%v)", parsed.String(), again, err)
+			}
+		})
+	}
+}
+
+func TestParseGitHubURLWithRef_PullAndCompare(t *testing.T) {
+	tests := []struct {
+		url          string
+		expectedRef  string
+		expectedPath string
+		base, head   string
+	}{
+		{url: "github:owner/repo@pr/123", expectedRef: "pr/123"},
+		{url: "github:owner/repo@pr/123/merge", expectedRef: "pr/123/merge"},
+		{url: "github:owner/repo@pr/123/src/main.go", expectedRef: "pr/123", expectedPath: "src/main.go"},
+		{url: "github:owner/repo@pr/123/merge/docs", expectedRef: "pr/123/merge", expectedPath: "docs"},
+		{url: "github:owner/repo@pr/123/merged.txt", expectedRef: "pr/123", expectedPath: "merged.txt"},
+		{url: "github:owner/repo@pr/x/file.txt", expectedRef: "pr", expectedPath: "x/file.txt"},
+		{url: "github:owner/repo@v1.0.0..v1.1.0", expectedRef: "v1.0.0..v1.1.0", base: "v1.0.0", head: "v1.1.0"},
+		{url: "github:owner/repo@main..pr/7/ci", expectedRef: "main..pr/7", expectedPath: "ci", base: "main", head: "pr/7"},
+		{url: "github:owner/repo@pr/7/merge..pr/7/src", expectedRef: "pr/7/merge..pr/7", expectedPath: "src", base: "pr/7/merge", head: "pr/7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			parsed, err := ParseGitHubURLWithRef(tt.url)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if parsed.Ref != tt.expectedRef || parsed.Path != tt.expectedPath {
+				t.Errorf("Expected %q at %q, got %q at %q", tt.expectedPath, tt.expectedRef, parsed.Path, parsed.Ref)
+			}
+
+			base, head, ok := parsed.CompareRefs()
+			if ok != (tt.base != "") || base != tt.base || head != tt.head {
+				t.Errorf("Expected range %q..%q, got %q..%q (%v)", tt.base, tt.head, base, head, ok)
+			}
+
+			again, err := ParseGitHubURLWithRef(parsed.String())
+			if err != nil || again.Ref != parsed.Ref || again.Path != parsed.Path {
+				t.Errorf("Expected %s to round trip, got %+v (%v)", parsed.String(), again, err)
+			}
+		})
+	}
+}
+
+func TestParsePullRef(t *testing.T) {
+	tests := []struct {
+		ref    string
+		number int
+		merge  bool
+		ok     bool
+	}{
+		{"pr/123", 123, false, true},
+		{"pr/9/merge", 9, true, true},
+		{"pr/", 0, false, false},
+		{"pr/12/head", 0, false, false},
+		{"main", 0, false, false},
+		{"pr/1..pr/2", 0, false, false},
+	}
+
+	for _, tt := range tests {
+		number, merge, ok := ParsePullRef(tt.ref)
+		if number != tt.number || merge != tt.merge || ok != tt.ok {
+			t.Errorf("ParsePullRef(%q) = %d, %v, %v; expected %d, %v, %v", tt.ref, number, merge, ok, tt.number, tt.merge, tt.ok)
+		}
+		if IsPullRef(tt.ref) != tt.ok {
+			t.Errorf("IsPullRef(%q) = %v", tt.ref, !tt.ok)
+		}
+	}
+}
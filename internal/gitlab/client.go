@@ -0,0 +1,226 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"xcp/internal/github"
+	"xcp/internal/logger"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+	// pageSize is the largest page the API serves
+	pageSize = 100
+)
+
+// Client is a GitLab REST API client. It offers the same operations as the
+// GitHub client, reporting results in the same types, so downloaders work
+// with either. Owners are full namespace paths, e.g. group/subgroup.
+type Client struct {
+	httpClient *http.Client
+	host       github.Host
+}
+
+// treeEntry is an item of a repository tree listing
+type treeEntry struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+}
+
+// NewClient creates a client for the GitLab instance described by host
+func NewClient(host github.Host) (*Client, error) {
+	httpClient, err := host.HTTPClient(defaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{httpClient: httpClient, host: host}, nil
+}
+
+// SetLogger logs every request made by the client at debug level
+func (c *Client) SetLogger(l *logger.Logger) {
+	logger.WrapClient(c.httpClient, l)
+}
+
+// projectURL returns the API URL of the project owner/repo
+func (c *Client) projectURL(owner, repo string) string {
+	return fmt.Sprintf("%s/projects/%s", c.host.API, url.PathEscape(owner+"/"+repo))
+}
+
+// OpenFile opens a streaming reader over the raw content of a file through
+// the repository files API. An empty ref selects the default branch. The
+// caller must close the returned reader.
+func (c *Client) OpenFile(ctx context.Context, owner, repo, ref, path string) (io.ReadCloser, github.FileInfo, error) {
+	apiURL := fmt.Sprintf("%s/repository/files/%s/raw", c.projectURL(owner, repo), url.PathEscape(path))
+	if ref != "" {
+		apiURL += "?ref=" + url.QueryEscape(ref)
+	}
+
+	resp, err := github.APIGet(ctx, c.httpClient, apiURL, github.ErrFileNotFound)
+	if err != nil {
+		return nil, github.FileInfo{}, err
+	}
+
+	return resp.Body, github.RawFileInfo(path, resp), nil
+}
+
+// listTree returns every entry of the repository tree under path, following
+// the API's pagination
+func (c *Client) listTree(ctx context.Context, owner, repo, ref, path string, recursive bool) ([]treeEntry, error) {
+	query := url.Values{"per_page": {fmt.Sprint(pageSize)}}
+	if ref != "" {
+		query.Set("ref", ref)
+	}
+	if path != "" {
+		query.Set("path", strings.TrimSuffix(path, "/"))
+	}
+	if recursive {
+		query.Set("recursive", "true")
+	}
+
+	var entries []treeEntry
+	for page := "1"; page != ""; {
+		query.Set("page", page)
+		apiURL := c.projectURL(owner, repo) + "/repository/tree?" + query.Encode()
+
+		var batch []treeEntry
+		header, err := github.APIGetJSON(ctx, c.httpClient, apiURL, github.ErrDirectoryNotFound, &batch)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, batch...)
+		page = header.Get("X-Next-Page")
+	}
+	return entries, nil
+}
+
+// GetDirectoryContents lists a directory of the repository. An empty ref
+// selects the default branch. GitLab does not report sizes in listings.
+func (c *Client) GetDirectoryContents(ctx context.Context, owner, repo, ref, path string) (github.DirectoryContents, error) {
+	entries, err := c.listTree(ctx, owner, repo, ref, path, false)
+	if err != nil {
+		return nil, err
+	}
+
+	contents := make(github.DirectoryContents, 0, len(entries))
+	for _, entry := range entries {
+		item := github.ContentResponse{Name: entry.Name, Path: entry.Path, Sha: entry.ID, Size: -1}
+		switch entry.Type {
+		case "blob":
+			item.Type = github.FileContent
+		case "tree":
+			item.Type = github.DirectoryContent
+		default:
+			// Submodules are listed as commits
+			item.Type = github.ContentType(entry.Type)
+		}
+		contents = append(contents, item)
+	}
+	return contents, nil
+}
+
+// GetTree returns the recursive tree of the repository at ref. GitLab does
+// not report blob sizes, so every entry's Size is -1.
+func (c *Client) GetTree(ctx context.Context, owner, repo, ref string) (*github.Tree, error) {
+	entries, err := c.listTree(ctx, owner, repo, ref, "", true)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := &github.Tree{Entries: make([]github.TreeEntry, 0, len(entries))}
+	for _, entry := range entries {
+		tree.Entries = append(tree.Entries, github.TreeEntry{
+			Path: entry.Path,
+			Mode: entry.Mode,
+			Type: entry.Type,
+			Sha:  entry.ID,
+			Size: -1,
+		})
+	}
+	return tree, nil
+}
+
+// RepositoryExists checks if a project exists and is visible
+func (c *Client) RepositoryExists(ctx context.Context, owner, repo string) (bool, error) {
+	resp, err := github.APIGet(ctx, c.httpClient, c.projectURL(owner, repo), github.ErrRepositoryNotFound)
+	if errors.Is(err, github.ErrRepositoryNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+// ResolveRef finds out whether ref is a branch, tag or commit and which
+// commit it points to. An empty ref resolves the default branch.
+func (c *Client) ResolveRef(ctx context.Context, owner, repo, ref string) (*github.ResolvedRef, error) {
+	project := c.projectURL(owner, repo)
+
+	lookup := ref
+	if lookup == "" || lookup == defaultRef {
+		var info struct {
+			DefaultBranch string `json:"default_branch"`
+		}
+		if _, err := github.APIGetJSON(ctx, c.httpClient, project, github.ErrRepositoryNotFound, &info); err != nil {
+			return nil, err
+		}
+		lookup = info.DefaultBranch
+	}
+
+	if len(lookup) != 40 || !github.IsCommitSHA(lookup) {
+		for _, candidate := range []struct {
+			path string
+			kind github.RefKind
+		}{{"branches", github.RefBranch}, {"tags", github.RefTag}} {
+			var named struct {
+				Commit struct {
+					ID string `json:"id"`
+				} `json:"commit"`
+			}
+			apiURL := fmt.Sprintf("%s/repository/%s/%s", project, candidate.path, url.PathEscape(lookup))
+			_, err := github.APIGetJSON(ctx, c.httpClient, apiURL, github.ErrRefNotFound, &named)
+			if errors.Is(err, github.ErrRefNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			return &github.ResolvedRef{Ref: ref, Kind: candidate.kind, Commit: named.Commit.ID}, nil
+		}
+	}
+
+	var commit struct {
+		ID string `json:"id"`
+	}
+	apiURL := fmt.Sprintf("%s/repository/commits/%s", project, url.PathEscape(lookup))
+	if _, err := github.APIGetJSON(ctx, c.httpClient, apiURL, fmt.Errorf("%w: %s", github.ErrRefNotFound, lookup), &commit); err != nil {
+		return nil, err
+	}
+	return &github.ResolvedRef{Ref: ref, Kind: github.RefCommit, Commit: commit.ID}, nil
+}
+
+// ArchiveURL returns the URL of an archive of owner/repo at ref in format
+// ("zip" or "tar.gz"), restricted to path when one is given
+func (c *Client) ArchiveURL(owner, repo, ref, path, format string) string {
+	query := url.Values{"sha": {ref}}
+	if path != "" {
+		query.Set("path", strings.TrimSuffix(path, "/"))
+	}
+	return fmt.Sprintf("%s/repository/archive.%s?%s", c.projectURL(owner, repo), format, query.Encode())
+}
+
+// ArchivePrefix returns "": GitLab names the top-level directory of an
+// archive after the commit and path as well as the ref
+func (c *Client) ArchivePrefix(repo, ref string) string {
+	return ""
+}
@@ -0,0 +1,185 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"xcp/internal/github"
+)
+
+const testCommit = "0123456789abcdef0123456789abcdef01234567"
+
+// newTestServer serves the GitLab API endpoints of the project
+// group/sub/project
+func newTestServer(t *testing.T) (*httptest.Server, *Client) {
+	t.Helper()
+
+	const project = "/api/v4/projects/group%2Fsub%2Fproject"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		query := r.URL.Query()
+		switch path := r.URL.EscapedPath(); path {
+		case project:
+			io.WriteString(w, `{"default_branch":"main"}`)
+		case project + "/repository/files/ci%2Fbuild.yml/raw":
+			if query.Get("ref") != "v1" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			io.WriteString(w, "stages: [build]\n")
+		case project + "/repository/tree":
+			if query.Get("path") == "missing" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if query.Get("page") == "1" {
+				w.Header().Set("X-Next-Page", "2")
+				io.WriteString(w, `[{"id":"aaa","name":"ci","type":"tree","path":"ci","mode":"040000"}]`)
+				return
+			}
+			io.WriteString(w, `[{"id":"bbb","name":"run.sh","type":"blob","path":"ci/run.sh","mode":"100755"}]`)
+		case project + "/repository/branches/main":
+			io.WriteString(w, `{"commit":{"id":"`+testCommit+`"}}`)
+		case project + "/repository/tags/v1":
+			io.WriteString(w, `{"commit":{"id":"`+testCommit+`"}}`)
+		case project + "/repository/commits/0123456":
+			io.WriteString(w, `{"id":"`+testCommit+`"}`)
+		case "/api/v4/projects/group%2Fsub%2Flimited":
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(github.Host{Name: "gitlab.test", API: server.URL + "/api/v4", Web: server.URL, Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, client
+}
+
+func TestClient_OpenFile(t *testing.T) {
+	_, client := newTestServer(t)
+	ctx := context.Background()
+
+	body, info, err := client.OpenFile(ctx, "group/sub", "project", "v1", "ci/build.yml")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer body.Close()
+
+	content, _ := io.ReadAll(body)
+	if string(content) != "stages: [build]\n" || info.Name != "build.yml" {
+		t.Errorf("Unexpected file %q (%+v)", content, info)
+	}
+
+	if _, _, err := client.OpenFile(ctx, "group/sub", "project", "v1", "ci"); !errors.Is(err, github.ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound, got %v", err)
+	}
+}
+
+func TestClient_Tree(t *testing.T) {
+	_, client := newTestServer(t)
+	ctx := context.Background()
+
+	contents, err := client.GetDirectoryContents(ctx, "group/sub", "project", "main", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(contents) != 2 || contents[0].Type != github.DirectoryContent || contents[1].Type != github.FileContent {
+		t.Errorf("Expected both pages of the listing, got %+v", contents)
+	}
+	if contents[1].Sha != "bbb" || contents[1].Size != -1 {
+		t.Errorf("Expected blob SHA and unknown size, got %+v", contents[1])
+	}
+
+	if _, err := client.GetDirectoryContents(ctx, "group/sub", "project", "main", "missing"); !errors.Is(err, github.ErrDirectoryNotFound) {
+		t.Errorf("Expected ErrDirectoryNotFound, got %v", err)
+	}
+
+	tree, err := client.GetTree(ctx, "group/sub", "project", "main")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tree.Entries) != 2 || tree.Entries[1].Mode != github.ExecutableMode {
+		t.Errorf("Unexpected tree %+v", tree)
+	}
+}
+
+func TestClient_RepositoryExists(t *testing.T) {
+	_, client := newTestServer(t)
+	ctx := context.Background()
+
+	if exists, err := client.RepositoryExists(ctx, "group/sub", "project"); err != nil || !exists {
+		t.Errorf("Expected project to exist, got %v, %v", exists, err)
+	}
+	if exists, err := client.RepositoryExists(ctx, "group/sub", "other"); err != nil || exists {
+		t.Errorf("Expected project not to exist, got %v, %v", exists, err)
+	}
+	if _, err := client.RepositoryExists(ctx, "group/sub", "limited"); !errors.Is(err, github.ErrRateLimitExceeded) {
+		t.Errorf("Expected ErrRateLimitExceeded, got %v", err)
+	}
+}
+
+func TestClient_ResolveRef(t *testing.T) {
+	_, client := newTestServer(t)
+
+	tests := []struct {
+		ref  string
+		kind github.RefKind
+		err  error
+	}{
+		{ref: "", kind: github.RefBranch},
+		{ref: "main", kind: github.RefBranch},
+		{ref: "v1", kind: github.RefTag},
+		{ref: "0123456", kind: github.RefCommit},
+		{ref: "gone", err: github.ErrRefNotFound},
+	}
+
+	for _, tt := range tests {
+		resolved, err := client.ResolveRef(context.Background(), "group/sub", "project", tt.ref)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%q: expected error %v, got %v", tt.ref, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.ref, err)
+			continue
+		}
+		if resolved.Kind != tt.kind || resolved.Commit != testCommit || resolved.Ref != tt.ref {
+			t.Errorf("%q: unexpected resolution %+v", tt.ref, resolved)
+		}
+	}
+}
+
+func TestClient_ArchiveURL(t *testing.T) {
+	client, err := NewClient(NewHost("gitlab.corp.example"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := url.Parse(client.ArchiveURL("group/sub", "project", "v1", "ci/", "zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.EscapedPath() != "/api/v4/projects/group%2Fsub%2Fproject/repository/archive.zip" {
+		t.Errorf("Unexpected archive path %s", got.EscapedPath())
+	}
+	if got.Query().Get("sha") != "v1" || got.Query().Get("path") != "ci" {
+		t.Errorf("Unexpected archive query %s", got.RawQuery)
+	}
+	if client.ArchivePrefix("project", "v1") != "" {
+		t.Errorf("Expected the archive prefix to be detected")
+	}
+}
@@ -0,0 +1,118 @@
+// Package gitlab reads repositories on gitlab.com and self-managed GitLab
+// instances. Sources are parsed into github.ParsedURL with the GitLab
+// provider, so they flow through the same downloaders as GitHub sources.
+package gitlab
+
+import (
+	"errors"
+	"strings"
+	"xcp/internal/github"
+)
+
+const (
+	// Scheme prefixes GitLab sources and names the provider
+	Scheme = "gitlab"
+	// PublicHost is the name of gitlab.com, used by sources that name no host
+	PublicHost = "gitlab.com"
+	// defaultRef lets GitLab pick the project's default branch
+	defaultRef = "HEAD"
+)
+
+var (
+	ErrInvalidURL     = errors.New("invalid GitLab URL format")
+	ErrMissingProject = errors.New("GitLab project must be given as namespace/project")
+)
+
+// NewHost returns the URLs of the GitLab instance at name, serving its API
+// under /api/v4
+func NewHost(name string) github.Host {
+	if name == "" {
+		name = PublicHost
+	}
+	base := "https://" + name
+	return github.Host{Name: name, API: base + "/api/v4", Web: base}
+}
+
+// IsSource reports whether url is a GitLab source
+func IsSource(url string) bool {
+	return strings.HasPrefix(url, Scheme+":") || strings.HasPrefix(url, Scheme+"@")
+}
+
+// ParseGitLabURL parses a GitLab source. Supported formats:
+//   - gitlab:group/project
+//   - gitlab:group/subgroup/project@ref
+//   - gitlab:group/subgroup/project@ref/path/to/file
+//   - gitlab:group/subgroup/project/-/path/to/file
+//   - gitlab@host:group/project[@ref][/path] for self-managed instances
+//
+// Fragments such as GitHub's #asset= are rejected.
+//
+// Projects nest in any number of subgroups, so a path inside the project
+// must follow a ref or GitLab's "/-/" separator.
+func ParseGitLabURL(url string) (*github.ParsedURL, error) {
+	host, rest, err := splitHost(url)
+	if err != nil {
+		return nil, err
+	}
+	// Project paths cannot hold "#", and GitLab has no release assets to
+	// name with a fragment
+	if strings.Contains(rest, "#") {
+		return nil, ErrInvalidURL
+	}
+
+	project, ref, path := rest, "", ""
+	explicitRef := false
+	if at := strings.Index(rest, "@"); at != -1 {
+		project = rest[:at]
+		ref, path, _ = strings.Cut(rest[at+1:], "/")
+		explicitRef = ref != ""
+	} else if before, after, ok := strings.Cut(rest, "/-/"); ok {
+		project, path = before, after
+	}
+	if ref == "" {
+		ref = defaultRef
+	}
+
+	parts := strings.Split(strings.TrimSuffix(project, "/"), "/")
+	if len(parts) < 2 {
+		return nil, ErrMissingProject
+	}
+	for _, part := range parts {
+		if part == "" {
+			return nil, ErrInvalidURL
+		}
+	}
+
+	return &github.ParsedURL{
+		Provider:    Scheme,
+		Host:        host,
+		Owner:       strings.Join(parts[:len(parts)-1], "/"),
+		Repo:        parts[len(parts)-1],
+		Path:        path,
+		Ref:         ref,
+		ExplicitRef: explicitRef,
+	}, nil
+}
+
+// splitHost separates the host named by a "gitlab@host:" prefix from the
+// rest of url. gitlab.com is reported as no host.
+func splitHost(url string) (string, string, error) {
+	if rest, ok := strings.CutPrefix(url, Scheme+":"); ok {
+		return "", rest, nil
+	}
+
+	rest, ok := strings.CutPrefix(url, Scheme+"@")
+	if !ok {
+		return "", "", ErrInvalidURL
+	}
+	host, rest, ok := strings.Cut(rest, ":")
+	if !ok || host == "" || strings.Contains(host, "/") {
+		return "", "", ErrInvalidURL
+	}
+
+	host = strings.ToLower(host)
+	if host == PublicHost {
+		host = ""
+	}
+	return host, rest, nil
+}
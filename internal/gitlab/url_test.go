@@ -0,0 +1,120 @@
+package gitlab
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseGitLabURL(t *testing.T) {
+	tests := []struct {
+		name          string
+		url           string
+		expectedHost  string
+		expectedOwner string
+		expectedRepo  string
+		expectedPath  string
+		expectedRef   string
+		explicitRef   bool
+		expectedErr   error
+	}{
+		{
+			name:          "Project",
+			url:           "gitlab:group/project",
+			expectedOwner: "group",
+			expectedRepo:  "project",
+			expectedRef:   "HEAD",
+		},
+		{
+			name:          "Nested subgroups with ref",
+			url:           "gitlab:group/sub/team/templates@v1.2",
+			expectedOwner: "group/sub/team",
+			expectedRepo:  "templates",
+			expectedRef:   "v1.2",
+			explicitRef:   true,
+		},
+		{
+			name:          "Path after ref",
+			url:           "gitlab:group/sub/templates@main/ci/build.yml",
+			expectedOwner: "group/sub",
+			expectedRepo:  "templates",
+			expectedPath:  "ci/build.yml",
+			expectedRef:   "main",
+			explicitRef:   true,
+		},
+		{
+			name:          "Path after separator",
+			url:           "gitlab:group/sub/templates/-/ci/",
+			expectedOwner: "group/sub",
+			expectedRepo:  "templates",
+			expectedPath:  "ci/",
+			expectedRef:   "HEAD",
+		},
+		{
+			name:          "Self-managed host",
+			url:           "gitlab@gitlab.corp.example:platform/ci@main",
+			expectedHost:  "gitlab.corp.example",
+			expectedOwner: "platform",
+			expectedRepo:  "ci",
+			expectedRef:   "main",
+			explicitRef:   true,
+		},
+		{
+			name:          "Public host named explicitly",
+			url:           "gitlab@gitlab.com:group/project",
+			expectedOwner: "group",
+			expectedRepo:  "project",
+			expectedRef:   "HEAD",
+		},
+		{
+			name:        "Missing namespace",
+			url:         "gitlab:project",
+			expectedErr: ErrMissingProject,
+		},
+		{
+			name:        "Empty path segment",
+			url:         "gitlab:group//project",
+			expectedErr: ErrInvalidURL,
+		},
+		{
+			name:        "Fragment",
+			url:         "gitlab:group/project#asset=tools.zip",
+			expectedErr: ErrInvalidURL,
+		},
+		{
+			name:        "Wrong scheme",
+			url:         "github:owner/repo",
+			expectedErr: ErrInvalidURL,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseGitLabURL(tt.url)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if parsed.Provider != Scheme {
+				t.Errorf("Expected provider %s, got %s", Scheme, parsed.Provider)
+			}
+			if parsed.Host != tt.expectedHost {
+				t.Errorf("Expected host %q, got %q", tt.expectedHost, parsed.Host)
+			}
+			if parsed.Owner != tt.expectedOwner || parsed.Repo != tt.expectedRepo {
+				t.Errorf("Expected %s/%s, got %s/%s", tt.expectedOwner, tt.expectedRepo, parsed.Owner, parsed.Repo)
+			}
+			if parsed.Path != tt.expectedPath {
+				t.Errorf("Expected path %q, got %q", tt.expectedPath, parsed.Path)
+			}
+			if parsed.Ref != tt.expectedRef || parsed.ExplicitRef != tt.explicitRef {
+				t.Errorf("Expected ref %s (explicit %v), got %s (%v)", tt.expectedRef, tt.explicitRef, parsed.Ref, parsed.ExplicitRef)
+			}
+		})
+	}
+}
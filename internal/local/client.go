@@ -0,0 +1,188 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"xcp/internal/github"
+	"xcp/internal/logger"
+)
+
+// gitDir is left out of listings; it holds the checkout's history, not its
+// content
+const gitDir = ".git"
+
+// Client reads a directory on the local filesystem. It offers the same
+// operations as the GitHub client, reporting results in the same types, so
+// downloaders work with either. Owners are the parent of the directory and
+// refs are ignored.
+type Client struct{}
+
+// NewClient creates a client for local directories
+func NewClient() *Client {
+	return &Client{}
+}
+
+// SetLogger does nothing; the client makes no requests
+func (c *Client) SetLogger(*logger.Logger) {}
+
+// resolve returns the filesystem path of path inside the directory
+// owner/repo, refusing paths that lead out of it
+func resolve(owner, repo, path string) (string, error) {
+	root := filepath.Join(owner, repo)
+	full := filepath.Join(root, filepath.FromSlash(path))
+	if rel, err := filepath.Rel(root, full); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s leads out of %s", ErrInvalidPath, path, root)
+	}
+	return full, nil
+}
+
+// isGitDir reports whether rel, relative to the directory's root, is inside
+// its .git directory
+func isGitDir(rel string) bool {
+	top, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+	return top == gitDir
+}
+
+// OpenFile opens a regular file of the directory. Symlinks are not followed
+// and report github.ErrFileNotFound, as directories do. The caller must
+// close the returned reader.
+func (c *Client) OpenFile(ctx context.Context, owner, repo, ref, path string) (io.ReadCloser, github.FileInfo, error) {
+	full, err := resolve(owner, repo, path)
+	if err != nil {
+		return nil, github.FileInfo{}, err
+	}
+	if isGitDir(path) {
+		return nil, github.FileInfo{}, github.ErrFileNotFound
+	}
+
+	info, err := os.Lstat(full)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && !info.Mode().IsRegular()) {
+		return nil, github.FileInfo{}, github.ErrFileNotFound
+	}
+	if err != nil {
+		return nil, github.FileInfo{}, err
+	}
+
+	f, err := os.Open(full)
+	if err != nil {
+		return nil, github.FileInfo{}, err
+	}
+	return f, github.FileInfo{Name: info.Name(), Path: path, Size: info.Size()}, nil
+}
+
+// GetDirectoryContents lists a directory, leaving out .git
+func (c *Client) GetDirectoryContents(ctx context.Context, owner, repo, ref, path string) (github.DirectoryContents, error) {
+	full, err := resolve(owner, repo, path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(full)
+	if errors.Is(err, fs.ErrNotExist) || isGitDir(path) {
+		return nil, github.ErrDirectoryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var contents github.DirectoryContents
+	for _, entry := range entries {
+		itemPath := entry.Name()
+		if path != "" {
+			itemPath = strings.TrimSuffix(filepath.ToSlash(path), "/") + "/" + entry.Name()
+		}
+		if isGitDir(itemPath) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		item := github.ContentResponse{Name: entry.Name(), Path: itemPath, Size: int(info.Size())}
+		switch {
+		case entry.IsDir():
+			item.Type = github.DirectoryContent
+		case info.Mode()&fs.ModeSymlink != 0:
+			item.Type = "symlink"
+		case info.Mode().IsRegular():
+			item.Type = github.FileContent
+		default:
+			item.Type = "special"
+		}
+		contents = append(contents, item)
+	}
+	return contents, nil
+}
+
+// GetTree walks the directory, reporting the mode of every file from its
+// permissions. Files carry no blob SHAs; the bytes read are the source.
+func (c *Client) GetTree(ctx context.Context, owner, repo, ref string) (*github.Tree, error) {
+	root := filepath.Join(owner, repo)
+	tree := &github.Tree{}
+	err := filepath.WalkDir(root, func(full string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if full == root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, full)
+		if err != nil {
+			return err
+		}
+		if isGitDir(rel) {
+			return filepath.SkipDir
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		item := github.TreeEntry{Path: filepath.ToSlash(rel), Type: "blob", Mode: "100644", Size: info.Size()}
+		switch {
+		case entry.IsDir():
+			item.Type, item.Mode, item.Size = "tree", "040000", -1
+		case info.Mode()&fs.ModeSymlink != 0:
+			item.Mode = "120000"
+		case info.Mode()&0111 != 0:
+			item.Mode = github.ExecutableMode
+		}
+		tree.Entries = append(tree.Entries, item)
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, github.ErrDirectoryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// RepositoryExists checks that the directory exists
+func (c *Client) RepositoryExists(ctx context.Context, owner, repo string) (bool, error) {
+	info, err := os.Stat(filepath.Join(owner, repo))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return info.IsDir(), nil
+}
+
+// ResolveRef fails: a directory has no refs to pin
+func (c *Client) ResolveRef(ctx context.Context, owner, repo, ref string) (*github.ResolvedRef, error) {
+	return nil, fmt.Errorf("%w: local sources have no refs", github.ErrRefNotFound)
+}
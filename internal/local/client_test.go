@@ -0,0 +1,115 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"xcp/internal/github"
+)
+
+// newTestDir lays out a checkout named repo and returns its parent
+func newTestDir(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	files := map[string]os.FileMode{
+		"repo/README.md":  0644,
+		"repo/bin/run.sh": 0755,
+		"repo/.git/HEAD":  0644,
+	}
+	for name, mode := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("run.sh", filepath.Join(dir, "repo", "bin", "run")); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestClient_OpenFile(t *testing.T) {
+	dir := newTestDir(t)
+	client := NewClient()
+	ctx := context.Background()
+
+	body, info, err := client.OpenFile(ctx, dir, "repo", "", "bin/run.sh")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	content, _ := io.ReadAll(body)
+	body.Close()
+	if string(content) != "repo/bin/run.sh" || info.Name != "run.sh" || info.Size != int64(len(content)) {
+		t.Errorf("Unexpected file %q (%+v)", content, info)
+	}
+
+	for _, path := range []string{"bin", "bin/run", "missing", ".git/HEAD"} {
+		if _, _, err := client.OpenFile(ctx, dir, "repo", "", path); !errors.Is(err, github.ErrFileNotFound) {
+			t.Errorf("%s: expected ErrFileNotFound, got %v", path, err)
+		}
+	}
+	if _, _, err := client.OpenFile(ctx, dir, "repo", "", "../outside"); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("Expected ErrInvalidPath, got %v", err)
+	}
+}
+
+func TestClient_Tree(t *testing.T) {
+	dir := newTestDir(t)
+	client := NewClient()
+	ctx := context.Background()
+
+	contents, err := client.GetDirectoryContents(ctx, dir, "repo", "", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(contents) != 2 || contents[0].Name != "README.md" || contents[1].Type != github.DirectoryContent {
+		t.Errorf("Expected .git to be left out, got %+v", contents)
+	}
+
+	contents, err = client.GetDirectoryContents(ctx, dir, "repo", "", "bin")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(contents) != 2 || contents[0].Type != "symlink" || contents[1].Path != "bin/run.sh" {
+		t.Errorf("Unexpected listing %+v", contents)
+	}
+
+	if _, err := client.GetDirectoryContents(ctx, dir, "repo", "", "missing"); !errors.Is(err, github.ErrDirectoryNotFound) {
+		t.Errorf("Expected ErrDirectoryNotFound, got %v", err)
+	}
+
+	tree, err := client.GetTree(ctx, dir, "repo", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	modes := make(map[string]string)
+	for _, entry := range tree.Entries {
+		modes[entry.Path] = entry.Mode
+	}
+	if len(modes) != 4 || modes["bin/run.sh"] != github.ExecutableMode || modes["README.md"] != "100644" || modes["bin/run"] != "120000" {
+		t.Errorf("Unexpected tree %+v", tree.Entries)
+	}
+}
+
+func TestClient_RepositoryExists(t *testing.T) {
+	dir := newTestDir(t)
+	client := NewClient()
+	ctx := context.Background()
+
+	if exists, err := client.RepositoryExists(ctx, dir, "repo"); err != nil || !exists {
+		t.Errorf("Expected directory to exist, got %v, %v", exists, err)
+	}
+	if exists, err := client.RepositoryExists(ctx, dir, "other"); err != nil || exists {
+		t.Errorf("Expected directory not to exist, got %v, %v", exists, err)
+	}
+	if _, err := client.ResolveRef(ctx, dir, "repo", "main"); !errors.Is(err, github.ErrRefNotFound) {
+		t.Errorf("Expected ErrRefNotFound, got %v", err)
+	}
+}
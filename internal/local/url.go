@@ -0,0 +1,68 @@
+// Package local reads sources from the local filesystem: a checkout or
+// unpacked mirror of a repository, or an archive of one. Directories are
+// served through the same interface as the GitHub client, so downloads from
+// them share the conflict handling and reporting of remote sources.
+package local
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"xcp/internal/github"
+)
+
+const (
+	// Scheme names the provider of local sources
+	Scheme = "file"
+	// prefix starts a local source given as a URL
+	prefix = "file://"
+)
+
+var ErrInvalidPath = errors.New("invalid local source")
+
+// IsSource reports whether url is a local source: a file:// URL or a path
+// starting with "/", "./" or "../"
+func IsSource(url string) bool {
+	for _, p := range []string{prefix, "/", "./", "../"} {
+		if strings.HasPrefix(url, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseLocalPath parses a local source of the form
+//
+//	file:///path/to/repo[//subdir]
+//	./path/to/repo.zip[//subdir]
+//
+// The directory or archive becomes the owner (its parent) and repo (its
+// name); a path inside it follows "//". Local sources have no refs.
+func ParseLocalPath(url string) (*github.ParsedURL, error) {
+	if !IsSource(url) {
+		return nil, ErrInvalidPath
+	}
+
+	root := url
+	if rest, ok := strings.CutPrefix(url, prefix); ok {
+		// file://host/path is not supported; the path must be absolute
+		if !strings.HasPrefix(rest, "/") {
+			return nil, ErrInvalidPath
+		}
+		root = rest
+	}
+
+	// The leading slash of an absolute path is not a separator
+	root, path, _ := strings.Cut(root, "//")
+	if root == "" {
+		return nil, ErrInvalidPath
+	}
+	root = filepath.Clean(filepath.FromSlash(root))
+
+	return &github.ParsedURL{
+		Provider: Scheme,
+		Owner:    filepath.Dir(root),
+		Repo:     filepath.Base(root),
+		Path:     path,
+	}, nil
+}
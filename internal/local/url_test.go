@@ -0,0 +1,76 @@
+package local
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseLocalPath(t *testing.T) {
+	tests := []struct {
+		name          string
+		url           string
+		expectedOwner string
+		expectedRepo  string
+		expectedPath  string
+		expectedErr   error
+	}{
+		{
+			name:          "File URL",
+			url:           "file:///srv/mirror/repo",
+			expectedOwner: "/srv/mirror",
+			expectedRepo:  "repo",
+		},
+		{
+			name:          "File URL with subdir",
+			url:           "file:///srv/mirror/repo//ci/jobs",
+			expectedOwner: "/srv/mirror",
+			expectedRepo:  "repo",
+			expectedPath:  "ci/jobs",
+		},
+		{
+			name:          "Relative archive",
+			url:           "./dist/repo.tar.gz//README.md",
+			expectedOwner: "dist",
+			expectedRepo:  "repo.tar.gz",
+			expectedPath:  "README.md",
+		},
+		{
+			name:          "Parent directory",
+			url:           "../repo.zip",
+			expectedOwner: "..",
+			expectedRepo:  "repo.zip",
+		},
+		{
+			name:        "File URL with a host",
+			url:         "file://server/repo",
+			expectedErr: ErrInvalidPath,
+		},
+		{
+			name:        "Not a local source",
+			url:         "github:owner/repo",
+			expectedErr: ErrInvalidPath,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseLocalPath(tt.url)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if parsed.Provider != Scheme || parsed.Owner != tt.expectedOwner || parsed.Repo != tt.expectedRepo || parsed.Path != tt.expectedPath {
+				t.Errorf("Unexpected result %+v", parsed)
+			}
+			if parsed.ExplicitRef || parsed.Ref != "" {
+				t.Errorf("Expected no ref, got %q", parsed.Ref)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+// Package logger provides leveled diagnostic output for xcp
+package logger
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Level controls how much output a Logger produces
+type Level int
+
+const (
+	// Quiet suppresses everything except errors returned to the caller
+	Quiet Level = iota
+	// Normal prints summaries and warnings
+	Normal
+	// Verbose adds details about what xcp is doing
+	Verbose
+	// Debug adds HTTP requests, status codes and timing
+	Debug
+)
+
+// Logger writes messages at or below its configured level
+type Logger struct {
+	w     io.Writer
+	level Level
+}
+
+// New creates a Logger writing to w
+func New(w io.Writer, level Level) *Logger {
+	return &Logger{w: w, level: level}
+}
+
+// Level returns the configured level
+func (l *Logger) Level() Level {
+	return l.level
+}
+
+// Enabled reports whether messages at level would be written
+func (l *Logger) Enabled(level Level) bool {
+	return l.level >= level
+}
+
+func (l *Logger) logf(level Level, prefix, format string, args ...any) {
+	if !l.Enabled(level) {
+		return
+	}
+	fmt.Fprintf(l.w, prefix+format+"\n", args...)
+}
+
+// Infof writes a message at Normal level
+func (l *Logger) Infof(format string, args ...any) {
+	l.logf(Normal, "", format, args...)
+}
+
+// Warnf writes a warning at Normal level
+func (l *Logger) Warnf(format string, args ...any) {
+	l.logf(Normal, "Warning: ", format, args...)
+}
+
+// Verbosef writes a message at Verbose level
+func (l *Logger) Verbosef(format string, args ...any) {
+	l.logf(Verbose, "", format, args...)
+}
+
+// Debugf writes a message at Debug level
+func (l *Logger) Debugf(format string, args ...any) {
+	l.logf(Debug, "debug: ", format, args...)
+}
+
+// Transport is an http.RoundTripper that logs each request, its status code
+// and how long it took at Debug level
+type Transport struct {
+	Base   http.RoundTripper
+	Logger *Logger
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	start := time.Now()
+	t.Logger.Debugf("%s %s", req.Method, req.URL)
+
+	resp, err := base.RoundTrip(req)
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		t.Logger.Debugf("%s %s failed after %s: %v", req.Method, req.URL, elapsed, err)
+		return nil, err
+	}
+
+	t.Logger.Debugf("%s %s -> %d (%s)", req.Method, req.URL, resp.StatusCode, elapsed)
+	return resp, nil
+}
+
+// WrapClient installs a logging Transport on client. A client wrapped
+// already has its Transport's Logger replaced, so each request is still
+// logged once.
+func WrapClient(client *http.Client, l *Logger) {
+	if t, ok := client.Transport.(*Transport); ok {
+		t.Logger = l
+		return
+	}
+	client.Transport = &Transport{Base: client.Transport, Logger: l}
+}
@@ -0,0 +1,89 @@
+package logger
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLogger_levels(t *testing.T) {
+	tests := []struct {
+		level Level
+		want  []string
+		skip  []string
+	}{
+		{Quiet, nil, []string{"info", "warn", "verbose", "debug"}},
+		{Normal, []string{"info", "Warning: warn"}, []string{"verbose", "debug"}},
+		{Verbose, []string{"info", "Warning: warn", "verbose"}, []string{"debug"}},
+		{Debug, []string{"info", "Warning: warn", "verbose", "debug: debug"}, nil},
+	}
+
+	for _, tt := range tests {
+		buf := new(bytes.Buffer)
+		l := New(buf, tt.level)
+
+		l.Infof("info")
+		l.Warnf("warn")
+		l.Verbosef("verbose")
+		l.Debugf("debug")
+
+		out := buf.String()
+		for _, w := range tt.want {
+			if !strings.Contains(out, w) {
+				t.Errorf("level %d: expected %q in output %q", tt.level, w, out)
+			}
+		}
+		for _, s := range tt.skip {
+			if strings.Contains(out, s) {
+				t.Errorf("level %d: did not expect %q in output %q", tt.level, s, out)
+			}
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer server.Close()
+
+	buf := new(bytes.Buffer)
+	client := server.Client()
+	WrapClient(client, New(buf, Debug))
+
+	resp, err := client.Get(server.URL + "/path")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	out := buf.String()
+	if !strings.Contains(out, "GET "+server.URL+"/path -> 418") {
+		t.Errorf("Expected request and status in debug output, got %q", out)
+	}
+}
+
+func TestWrapClient_twice(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	first, second := new(bytes.Buffer), new(bytes.Buffer)
+	client := server.Client()
+	WrapClient(client, New(first, Debug))
+	WrapClient(client, New(second, Debug))
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if first.Len() != 0 {
+		t.Errorf("Expected the replaced logger to stay silent, got %q", first.String())
+	}
+	if n := strings.Count(second.String(), "GET "); n != 2 {
+		t.Errorf("Expected the request and its status logged once each, got %q", second.String())
+	}
+}
@@ -0,0 +1,126 @@
+// Package manifest records the files a download wrote so that the target
+// can be checked against them later
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"xcp/internal/report"
+)
+
+// Name is the file a manifest is stored in, at the root of the target
+const Name = ".xcp-manifest.json"
+
+var (
+	ErrNoManifest = errors.New("no manifest found")
+	ErrMismatch   = errors.New("files do not match the manifest")
+)
+
+// File is a file recorded in a manifest, relative to the target
+type File struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest describes what a download wrote into a target directory
+type Manifest struct {
+	Source string `json:"source"`
+	Ref    string `json:"ref,omitempty"`
+	Commit string `json:"commit,omitempty"`
+	Files  []File `json:"files"`
+}
+
+// Problem describes a recorded file that no longer matches
+type Problem struct {
+	Path   string
+	Reason string // "missing" or "modified"
+}
+
+// FromResult builds the manifest of the files result reports written under
+// dir. Skipped files are left out.
+func FromResult(dir string, result report.Result) (*Manifest, error) {
+	m := &Manifest{Source: result.Source, Ref: result.Ref, Commit: result.Commit, Files: []File{}}
+
+	for _, f := range result.Files {
+		if f.Action == report.Skipped {
+			continue
+		}
+
+		rel, err := filepath.Rel(dir, f.Path)
+		if err != nil {
+			return nil, err
+		}
+		m.Files = append(m.Files, File{Path: filepath.ToSlash(rel), Size: f.Size, SHA256: f.SHA256})
+	}
+
+	return m, nil
+}
+
+// Write stores m in dir
+func Write(dir string, m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, Name), append(data, '\n'), 0644)
+}
+
+// Read loads the manifest stored in dir
+func Read(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, Name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w in %s", ErrNoManifest, dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", filepath.Join(dir, Name), err)
+	}
+	return &m, nil
+}
+
+// Verify rehashes every file recorded in m under dir and returns those that
+// are missing or differ
+func Verify(dir string, m *Manifest) ([]Problem, error) {
+	var problems []Problem
+
+	for _, f := range m.Files {
+		size, sum, err := hashFile(filepath.Join(dir, filepath.FromSlash(f.Path)))
+		switch {
+		case os.IsNotExist(err):
+			problems = append(problems, Problem{Path: f.Path, Reason: "missing"})
+		case err != nil:
+			return nil, err
+		case size != f.Size || sum != f.SHA256:
+			problems = append(problems, Problem{Path: f.Path, Reason: "modified"})
+		}
+	}
+
+	return problems, nil
+}
+
+// hashFile returns the size and SHA-256 digest of the file at path
+func hashFile(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(hash, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(hash.Sum(nil)), nil
+}
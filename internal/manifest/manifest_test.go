@@ -0,0 +1,85 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"xcp/internal/report"
+)
+
+func TestWriteReadVerify(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"README.md":   "# Test\n",
+		"src/main.go": "package main\n",
+		"docs/old.md": "old\n",
+	}
+
+	result := report.Result{Source: "github:owner/repo", Ref: "main", Commit: "abc123"}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		sum := sha256.Sum256([]byte(content))
+		result.Files = append(result.Files, report.File{
+			Path: path, Action: report.Written, Size: int64(len(content)), SHA256: hex.EncodeToString(sum[:]),
+		})
+	}
+	result.Files = append(result.Files, report.File{Path: filepath.Join(dir, "skipped"), Action: report.Skipped})
+
+	m, err := FromResult(dir, result)
+	if err != nil {
+		t.Fatalf("FromResult unexpected error: %v", err)
+	}
+	if len(m.Files) != len(files) {
+		t.Fatalf("Expected %d files in manifest, got %+v", len(files), m.Files)
+	}
+	if err := Write(dir, m); err != nil {
+		t.Fatalf("Write unexpected error: %v", err)
+	}
+
+	read, err := Read(dir)
+	if err != nil {
+		t.Fatalf("Read unexpected error: %v", err)
+	}
+	if read.Commit != "abc123" || len(read.Files) != len(files) {
+		t.Errorf("Unexpected manifest read back: %+v", read)
+	}
+
+	problems, err := Verify(dir, read)
+	if err != nil || len(problems) != 0 {
+		t.Fatalf("Expected clean verification, got %+v (%v)", problems, err)
+	}
+
+	// Change one file and remove another
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("# Changed\n"), 0644)
+	os.Remove(filepath.Join(dir, "docs", "old.md"))
+
+	problems, err = Verify(dir, read)
+	if err != nil {
+		t.Fatalf("Verify unexpected error: %v", err)
+	}
+	want := map[string]string{"README.md": "modified", "docs/old.md": "missing"}
+	if len(problems) != len(want) {
+		t.Fatalf("Expected %d problems, got %+v", len(want), problems)
+	}
+	for _, p := range problems {
+		if want[p.Path] != p.Reason {
+			t.Errorf("Unexpected problem %+v", p)
+		}
+	}
+}
+
+func TestRead_Missing(t *testing.T) {
+	if _, err := Read(t.TempDir()); !errors.Is(err, ErrNoManifest) {
+		t.Errorf("Expected ErrNoManifest, got %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+// Package progress renders progress for long-running downloads and extractions
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Unit describes what a reporter is counting
+type Unit int
+
+const (
+	Bytes Unit = iota
+	Items
+)
+
+const (
+	barWidth       = 30
+	renderInterval = 100 * time.Millisecond
+	lineStep       = 10 // percent between lines in line mode
+)
+
+// Reporter receives progress updates for a single task at a time
+type Reporter interface {
+	// Start begins a new task. A total of -1 means the size is unknown.
+	Start(task string, total int64, unit Unit)
+	// Add records n more units of completed work
+	Add(n int64)
+	// Finish marks the current task as complete
+	Finish()
+	// Stop ends the current task where it stands, for work that failed
+	Stop()
+}
+
+// New returns the reporter appropriate for w: nothing when quiet, a redrawing
+// bar when w is a terminal and one line per step otherwise
+func New(w io.Writer, quiet bool) Reporter {
+	if quiet {
+		return Nop{}
+	}
+	if isTerminal(w) {
+		return NewBar(w)
+	}
+	return NewLines(w)
+}
+
+// isTerminal reports whether w is a character device such as a TTY
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+// Nop is a Reporter that discards all updates
+type Nop struct{}
+
+func (Nop) Start(string, int64, Unit) {}
+func (Nop) Add(int64)                 {}
+func (Nop) Finish()                   {}
+func (Nop) Stop()                     {}
+
+// Task is a task started on a Reporter that ends exactly once, so a deferred
+// Stop covers early returns without undoing a Finish. A nil Task does
+// nothing, for tasks that were never started.
+type Task struct {
+	r    Reporter
+	once sync.Once
+}
+
+// Begin starts a task on r
+func Begin(r Reporter, task string, total int64, unit Unit) *Task {
+	r.Start(task, total, unit)
+	return &Task{r: r}
+}
+
+// Finish marks the task complete unless it has ended already
+func (t *Task) Finish() {
+	if t != nil {
+		t.once.Do(t.r.Finish)
+	}
+}
+
+// Stop ends the task where it stands unless it has ended already
+func (t *Task) Stop() {
+	if t != nil {
+		t.once.Do(t.r.Stop)
+	}
+}
+
+// state holds the counters shared by the reporters
+type state struct {
+	mu      sync.Mutex
+	w       io.Writer
+	task    string
+	total   int64
+	current int64
+	unit    Unit
+}
+
+func (s *state) start(task string, total int64, unit Unit) {
+	s.task = task
+	s.total = total
+	s.current = 0
+	s.unit = unit
+}
+
+// percent returns the completed percentage, or -1 when the total is unknown
+func (s *state) percent() int {
+	if s.total <= 0 {
+		return -1
+	}
+	p := int(s.current * 100 / s.total)
+	if p > 100 {
+		p = 100
+	}
+	return p
+}
+
+// amount formats the counters for display
+func (s *state) amount() string {
+	if s.total > 0 {
+		return fmt.Sprintf("%s/%s", format(s.current, s.unit), format(s.total, s.unit))
+	}
+	return format(s.current, s.unit)
+}
+
+// Bar redraws a single progress bar line in place
+type Bar struct {
+	state
+	lastRender time.Time
+}
+
+// NewBar creates a Bar writing to w
+func NewBar(w io.Writer) *Bar {
+	return &Bar{state: state{w: w}}
+}
+
+// Start implements Reporter
+func (b *Bar) Start(task string, total int64, unit Unit) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.start(task, total, unit)
+	b.lastRender = time.Time{}
+	b.render()
+}
+
+// Add implements Reporter
+func (b *Bar) Add(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.current += n
+	if time.Since(b.lastRender) >= renderInterval {
+		b.render()
+	}
+}
+
+// Finish implements Reporter
+func (b *Bar) Finish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.total > 0 {
+		b.current = b.total
+	}
+	b.render()
+	fmt.Fprintln(b.w)
+}
+
+// Stop implements Reporter, leaving the bar at the progress made
+func (b *Bar) Stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.render()
+	fmt.Fprintln(b.w)
+}
+
+func (b *Bar) render() {
+	b.lastRender = time.Now()
+
+	p := b.percent()
+	if p < 0 {
+		fmt.Fprintf(b.w, "\r%s %s\033[K", b.task, b.amount())
+		return
+	}
+
+	filled := barWidth * p / 100
+	bar := strings.Repeat("=", filled)
+	if filled < barWidth {
+		bar += ">" + strings.Repeat(" ", barWidth-filled-1)
+	}
+	fmt.Fprintf(b.w, "\r%s [%s] %3d%% %s\033[K", b.task, bar, p, b.amount())
+}
+
+// Lines writes a new line every time another step of progress is made, for
+// output that is not a terminal
+type Lines struct {
+	state
+	lastStep int
+}
+
+// NewLines creates a Lines reporter writing to w
+func NewLines(w io.Writer) *Lines {
+	return &Lines{state: state{w: w}}
+}
+
+// Start implements Reporter
+func (l *Lines) Start(task string, total int64, unit Unit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.start(task, total, unit)
+	l.lastStep = 0
+}
+
+// Add implements Reporter
+func (l *Lines) Add(n int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.current += n
+
+	p := l.percent()
+	if p < 0 || p == 100 {
+		return
+	}
+	if step := p / lineStep * lineStep; step > l.lastStep {
+		l.lastStep = step
+		fmt.Fprintf(l.w, "%s: %d%% (%s)\n", l.task, step, l.amount())
+	}
+}
+
+// Finish implements Reporter
+func (l *Lines) Finish() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.total > 0 {
+		l.current = l.total
+	}
+	fmt.Fprintf(l.w, "%s: done (%s)\n", l.task, l.amount())
+}
+
+// Stop implements Reporter
+func (l *Lines) Stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.w, "%s: stopped (%s)\n", l.task, l.amount())
+}
+
+// format renders n in the given unit
+func format(n int64, unit Unit) string {
+	if unit == Items {
+		return fmt.Sprintf("%d", n)
+	}
+
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+// Reader wraps an io.Reader and reports every read to a Reporter
+type Reader struct {
+	R        io.Reader
+	Reporter Reporter
+}
+
+// Read implements io.Reader
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.R.Read(p)
+	if n > 0 {
+		r.Reporter.Add(int64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,125 @@
+package progress
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	if _, ok := New(buf, true).(Nop); !ok {
+		t.Errorf("Expected Nop reporter in quiet mode")
+	}
+
+	// A buffer is not a terminal, so the line reporter is used
+	if _, ok := New(buf, false).(*Lines); !ok {
+		t.Errorf("Expected Lines reporter for non-terminal output")
+	}
+}
+
+func TestLines(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := NewLines(buf)
+
+	l.Start("Extracting", 4, Items)
+	for i := 0; i < 4; i++ {
+		l.Add(1)
+	}
+	l.Finish()
+
+	want := "Extracting: 20% (1/4)\n" +
+		"Extracting: 50% (2/4)\n" +
+		"Extracting: 70% (3/4)\n" +
+		"Extracting: done (4/4)\n"
+	if buf.String() != want {
+		t.Errorf("Unexpected output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestLines_unknownTotal(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := NewLines(buf)
+
+	l.Start("Downloading", -1, Bytes)
+	l.Add(2048)
+	l.Finish()
+
+	if got := buf.String(); got != "Downloading: done (2.0 KB)\n" {
+		t.Errorf("Unexpected output: %q", got)
+	}
+}
+
+func TestBar(t *testing.T) {
+	buf := new(bytes.Buffer)
+	b := NewBar(buf)
+
+	b.Start("Downloading", 1<<20, Bytes)
+	b.Add(1 << 19)
+	b.Finish()
+
+	out := buf.String()
+	if !strings.HasPrefix(out, "\rDownloading [>") {
+		t.Errorf("Expected bar to start empty, got %q", out)
+	}
+	if !strings.Contains(out, "100% 1.0 MB/1.0 MB") {
+		t.Errorf("Expected completed bar, got %q", out)
+	}
+	if !strings.HasSuffix(out, "\n") {
+		t.Errorf("Expected bar to end with a newline, got %q", out)
+	}
+}
+
+func TestReader(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := NewLines(buf)
+	l.Start("Downloading", 10, Bytes)
+
+	r := &Reader{R: strings.NewReader("0123456789"), Reporter: l}
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if l.current != 10 {
+		t.Errorf("Expected 10 bytes reported, got %d", l.current)
+	}
+}
+
+func TestTask(t *testing.T) {
+	buf := new(bytes.Buffer)
+	b := NewBar(buf)
+
+	task := Begin(b, "Extracting", 4, Items)
+	b.Add(1)
+	task.Stop()
+	task.Finish()
+
+	out := buf.String()
+	if strings.Contains(out, "100%") || !strings.Contains(out, "25% 1/4") {
+		t.Errorf("Expected the bar stopped at 25%%, got %q", out)
+	}
+	if strings.Count(out, "\n") != 1 {
+		t.Errorf("Expected the task to end once, got %q", out)
+	}
+
+	// Tasks never started end without output
+	var none *Task
+	none.Finish()
+	none.Stop()
+}
+
+func TestLines_stop(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := NewLines(buf)
+
+	task := Begin(l, "Downloading", 10, Bytes)
+	l.Add(3)
+	task.Stop()
+	task.Finish()
+
+	if got := buf.String(); got != "Downloading: 30% (3 B/10 B)\nDownloading: stopped (3 B/10 B)\n" {
+		t.Errorf("Unexpected output: %q", got)
+	}
+}
@@ -0,0 +1,184 @@
+// Package report builds machine-readable descriptions of what a download did
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Format selects how results are written
+type Format string
+
+const (
+	Text   Format = "text"
+	JSON   Format = "json"
+	NDJSON Format = "ndjson"
+)
+
+// ParseFormat validates an --output value
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case Text, JSON, NDJSON:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown output format %q (want text, json or ndjson)", s)
+	}
+}
+
+// Action describes what happened to a file
+type Action string
+
+const (
+	Written     Action = "written"
+	Overwritten Action = "overwritten"
+	Skipped     Action = "skipped"
+)
+
+// File describes a single file handled by a download
+type File struct {
+	Path   string `json:"path"`
+	Action Action `json:"action"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// Error describes why a download failed. Code is stable across releases.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Result is the complete description of a download
+type Result struct {
+	Source     string `json:"source"`
+	Ref        string `json:"ref,omitempty"`
+	Commit     string `json:"commit,omitempty"`
+	Method     string `json:"method"`
+	Target     string `json:"target,omitempty"`
+	Files      []File `json:"files"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      *Error `json:"error,omitempty"`
+}
+
+// Recorder receives facts about a download as they become known
+type Recorder interface {
+	// Resolved records the ref that was downloaded and, when known, its commit SHA
+	Resolved(ref, commit string)
+	// File records a file that was written or skipped
+	File(f File)
+}
+
+// Nop is a Recorder that discards everything
+type Nop struct{}
+
+func (Nop) Resolved(string, string) {}
+func (Nop) File(File)               {}
+
+// Collector is a Recorder that assembles a Result and writes it to w. In
+// NDJSON mode each fact is also emitted as its own event line.
+type Collector struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format Format
+	start  time.Time
+	result Result
+}
+
+// NDJSON event lines, each tagged with its kind
+type (
+	resolvedEvent struct {
+		Event  string `json:"event"`
+		Ref    string `json:"ref,omitempty"`
+		Commit string `json:"commit,omitempty"`
+	}
+	fileEvent struct {
+		Event string `json:"event"`
+		File
+	}
+	resultEvent struct {
+		Event string `json:"event"`
+		Result
+	}
+)
+
+// NewCollector creates a Collector writing in the given format
+func NewCollector(w io.Writer, format Format) *Collector {
+	return &Collector{
+		w:      w,
+		format: format,
+		start:  time.Now(),
+		result: Result{Files: []File{}},
+	}
+}
+
+// Begin records the request being served
+func (c *Collector) Begin(source, ref, method, target string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.result.Source = source
+	c.result.Ref = ref
+	c.result.Method = method
+	c.result.Target = target
+}
+
+// SetMethod records the download method actually used
+func (c *Collector) SetMethod(method string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.result.Method = method
+}
+
+// Resolved implements Recorder
+func (c *Collector) Resolved(ref, commit string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ref != "" {
+		c.result.Ref = ref
+	}
+	c.result.Commit = commit
+	c.emit(resolvedEvent{Event: "resolved", Ref: ref, Commit: commit})
+}
+
+// File implements Recorder
+func (c *Collector) File(f File) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.result.Files = append(c.result.Files, f)
+	c.emit(fileEvent{Event: "file", File: f})
+}
+
+// Finish completes the result with err (which may be nil) and writes it
+func (c *Collector) Finish(err error, code string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.result.DurationMS = time.Since(c.start).Milliseconds()
+	if err != nil {
+		c.result.Error = &Error{Code: code, Message: err.Error()}
+	}
+
+	if c.format == NDJSON {
+		return c.emit(resultEvent{Event: "result", Result: c.result})
+	}
+	return json.NewEncoder(c.w).Encode(c.result)
+}
+
+// Result returns a copy of the result collected so far
+func (c *Collector) Result() Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r := c.result
+	r.Files = append([]File(nil), c.result.Files...)
+	return r
+}
+
+// emit writes an NDJSON event; it does nothing in other formats
+func (c *Collector) emit(e any) error {
+	if c.format != NDJSON {
+		return nil
+	}
+	return json.NewEncoder(c.w).Encode(e)
+}
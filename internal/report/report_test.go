@@ -0,0 +1,88 @@
+package report
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseFormat(t *testing.T) {
+	for _, s := range []string{"text", "json", "ndjson"} {
+		if _, err := ParseFormat(s); err != nil {
+			t.Errorf("ParseFormat(%q) unexpected error: %v", s, err)
+		}
+	}
+
+	if _, err := ParseFormat("yaml"); err == nil {
+		t.Errorf("ParseFormat(yaml) expected error")
+	}
+}
+
+func TestCollector_JSON(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewCollector(buf, JSON)
+
+	c.Begin("github:owner/repo", "main", "zip", "out")
+	c.Resolved("main", "0123456789abcdef0123456789abcdef01234567")
+	c.File(File{Path: "out/a.txt", Action: Written, Size: 3, SHA256: "abc"})
+
+	if err := c.Finish(errors.New("boom"), "unknown"); err != nil {
+		t.Fatalf("Finish unexpected error: %v", err)
+	}
+
+	var result Result
+	if err := json.Unmarshal(buf.Bytes(), &result); err != nil {
+		t.Fatalf("Output is not a single JSON document: %v\n%s", err, buf.String())
+	}
+
+	if result.Source != "github:owner/repo" || result.Method != "zip" || result.Ref != "main" {
+		t.Errorf("Unexpected request fields: %+v", result)
+	}
+	if result.Commit != "0123456789abcdef0123456789abcdef01234567" {
+		t.Errorf("Unexpected commit: %q", result.Commit)
+	}
+	if len(result.Files) != 1 || result.Files[0].Action != Written {
+		t.Errorf("Unexpected files: %+v", result.Files)
+	}
+	if result.Error == nil || result.Error.Code != "unknown" || result.Error.Message != "boom" {
+		t.Errorf("Unexpected error: %+v", result.Error)
+	}
+}
+
+func TestCollector_NDJSON(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := NewCollector(buf, NDJSON)
+
+	c.Begin("github:owner/repo", "main", "api", "out")
+	c.File(File{Path: "out/a.txt", Action: Written, Size: 3})
+	c.File(File{Path: "out/b.txt", Action: Skipped})
+	if err := c.Finish(nil, ""); err != nil {
+		t.Fatalf("Finish unexpected error: %v", err)
+	}
+
+	var events []map[string]any
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var e map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("Invalid NDJSON line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, e)
+	}
+
+	want := []string{"file", "file", "result"}
+	if len(events) != len(want) {
+		t.Fatalf("Expected %d events, got %d", len(want), len(events))
+	}
+	for i, e := range events {
+		if e["event"] != want[i] {
+			t.Errorf("Event %d: expected %q, got %v", i, want[i], e["event"])
+		}
+	}
+
+	if events[2]["source"] != "github:owner/repo" || events[2]["error"] != nil {
+		t.Errorf("Unexpected result event: %v", events[2])
+	}
+}
@@ -2,7 +2,11 @@
 package testing
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"io"
+	"path"
 	"xcp/internal/github"
 )
 
@@ -11,9 +15,13 @@ type MockGitHubClient struct {
 	FileContents       map[string][]byte
 	DirectoryContents  map[string]github.DirectoryContents
 	ExistingRepos      map[string]bool
+	Trees              map[string]*github.Tree
 	FailGetFileContent bool
 	FailGetDirContent  bool
 	FailRepoExists     bool
+
+	// TreeRequests counts the calls to GetTree
+	TreeRequests int
 }
 
 // NewMockGitHubClient creates a new mock GitHub client
@@ -22,11 +30,16 @@ func NewMockGitHubClient() *MockGitHubClient {
 		FileContents:      make(map[string][]byte),
 		DirectoryContents: make(map[string]github.DirectoryContents),
 		ExistingRepos:     make(map[string]bool),
+		Trees:             make(map[string]*github.Tree),
 	}
 }
 
 // GetFileContent mocks fetching a file's content
-func (m *MockGitHubClient) GetFileContent(owner, repo, path string) ([]byte, error) {
+func (m *MockGitHubClient) GetFileContent(ctx context.Context, owner, repo, path string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	if m.FailGetFileContent {
 		return nil, errors.New("mock file content failure")
 	}
@@ -40,8 +53,28 @@ func (m *MockGitHubClient) GetFileContent(owner, repo, path string) ([]byte, err
 	return content, nil
 }
 
+// OpenFile mocks opening a streaming reader over a file's content
+func (m *MockGitHubClient) OpenFile(ctx context.Context, owner, repo, ref, filePath string) (io.ReadCloser, github.FileInfo, error) {
+	content, err := m.GetFileContent(ctx, owner, repo, filePath)
+	if err != nil {
+		return nil, github.FileInfo{}, err
+	}
+
+	info := github.FileInfo{
+		Name: path.Base(filePath),
+		Path: filePath,
+		Size: int64(len(content)),
+	}
+
+	return io.NopCloser(bytes.NewReader(content)), info, nil
+}
+
 // GetDirectoryContents mocks fetching directory contents
-func (m *MockGitHubClient) GetDirectoryContents(owner, repo, path string) (github.DirectoryContents, error) {
+func (m *MockGitHubClient) GetDirectoryContents(ctx context.Context, owner, repo, ref, path string) (github.DirectoryContents, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	if m.FailGetDirContent {
 		return nil, errors.New("mock directory content failure")
 	}
@@ -55,8 +88,27 @@ func (m *MockGitHubClient) GetDirectoryContents(owner, repo, path string) (githu
 	return content, nil
 }
 
+// GetTree mocks fetching a recursive git tree
+func (m *MockGitHubClient) GetTree(ctx context.Context, owner, repo, ref string) (*github.Tree, error) {
+	m.TreeRequests++
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	tree, exists := m.Trees[owner+"/"+repo]
+	if !exists {
+		return nil, github.ErrDirectoryNotFound
+	}
+
+	return tree, nil
+}
+
 // RepositoryExists mocks checking if a repository exists
-func (m *MockGitHubClient) RepositoryExists(owner, repo string) (bool, error) {
+func (m *MockGitHubClient) RepositoryExists(ctx context.Context, owner, repo string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
 	if m.FailRepoExists {
 		return false, errors.New("mock repository exists failure")
 	}
@@ -87,3 +139,9 @@ func (m *MockGitHubClient) AddRepository(owner, repo string, exists bool) {
 	key := owner + "/" + repo
 	m.ExistingRepos[key] = exists
 }
+
+// AddTree adds a mock git tree, served for any ref
+func (m *MockGitHubClient) AddTree(owner, repo string, tree *github.Tree) {
+	key := owner + "/" + repo
+	m.Trees[key] = tree
+}
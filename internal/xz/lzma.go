@@ -0,0 +1,399 @@
+package xz
+
+import (
+	"fmt"
+)
+
+// LZMA model sizes, see the LZMA specification
+const (
+	numStates          = 12
+	numPosBitsMax      = 4
+	numLenToPosStates  = 4
+	numAlignBits       = 4
+	startPosModelIndex = 4
+	endPosModelIndex   = 14
+	numFullDistances   = 1 << (endPosModelIndex >> 1)
+	matchMinLen        = 2
+
+	probBits  = 11
+	probInit  = 1 << (probBits - 1)
+	moveBits  = 5
+	topValue  = 1 << 24
+	endMarker = 0xFFFFFFFF
+)
+
+// prob is an adaptive bit probability
+type prob uint16
+
+// initProbs resets every probability in ps
+func initProbs(ps []prob) {
+	for i := range ps {
+		ps[i] = probInit
+	}
+}
+
+// rangeDecoder decodes bits from the compressed bytes of one LZMA chunk
+type rangeDecoder struct {
+	in    []byte
+	rng   uint32
+	code  uint32
+	fault bool // Read past the chunk or saw an invalid code
+}
+
+// init starts decoding in, which must open with a zero byte
+func (rc *rangeDecoder) init(in []byte) error {
+	if len(in) < 5 || in[0] != 0 {
+		return fmt.Errorf("%w: bad range coder start", ErrFormat)
+	}
+	rc.in = in[5:]
+	rc.rng = 0xFFFFFFFF
+	rc.code = uint32(in[1])<<24 | uint32(in[2])<<16 | uint32(in[3])<<8 | uint32(in[4])
+	rc.fault = rc.code == rc.rng
+	return nil
+}
+
+func (rc *rangeDecoder) normalize() {
+	if rc.rng >= topValue {
+		return
+	}
+	if len(rc.in) == 0 {
+		rc.fault = true
+		return
+	}
+	rc.rng <<= 8
+	rc.code = rc.code<<8 | uint32(rc.in[0])
+	rc.in = rc.in[1:]
+}
+
+// finished reports whether the chunk was consumed exactly
+func (rc *rangeDecoder) finished() bool {
+	return !rc.fault && len(rc.in) == 0 && rc.code == 0
+}
+
+// bit decodes a bit with probability p
+func (rc *rangeDecoder) bit(p *prob) uint32 {
+	bound := (rc.rng >> probBits) * uint32(*p)
+	var b uint32
+	if rc.code < bound {
+		*p += (1<<probBits - *p) >> moveBits
+		rc.rng = bound
+	} else {
+		*p -= *p >> moveBits
+		rc.code -= bound
+		rc.rng -= bound
+		b = 1
+	}
+	rc.normalize()
+	return b
+}
+
+// direct decodes n bits of equal probability
+func (rc *rangeDecoder) direct(n int) uint32 {
+	var res uint32
+	for ; n > 0; n-- {
+		rc.rng >>= 1
+		rc.code -= rc.rng
+		t := 0 - (rc.code >> 31)
+		rc.code += rc.rng & t
+		if rc.code == rc.rng {
+			rc.fault = true
+		}
+		rc.normalize()
+		res = res<<1 + t + 1
+	}
+	return res
+}
+
+// tree decodes an n-bit symbol, most significant bit first
+func (rc *rangeDecoder) tree(ps []prob, n int) uint32 {
+	m := uint32(1)
+	for i := 0; i < n; i++ {
+		m = m<<1 | rc.bit(&ps[m])
+	}
+	return m - 1<<n
+}
+
+// reverseTree decodes an n-bit symbol, least significant bit first
+func (rc *rangeDecoder) reverseTree(ps []prob, n int) uint32 {
+	m := uint32(1)
+	var sym uint32
+	for i := 0; i < n; i++ {
+		b := rc.bit(&ps[m])
+		m = m<<1 | b
+		sym |= b << i
+	}
+	return sym
+}
+
+// lenDecoder decodes match lengths
+type lenDecoder struct {
+	choice  prob
+	choice2 prob
+	low     [1 << numPosBitsMax][1 << 3]prob
+	mid     [1 << numPosBitsMax][1 << 3]prob
+	high    [1 << 8]prob
+}
+
+func (ld *lenDecoder) init() {
+	ld.choice, ld.choice2 = probInit, probInit
+	for i := range ld.low {
+		initProbs(ld.low[i][:])
+		initProbs(ld.mid[i][:])
+	}
+	initProbs(ld.high[:])
+}
+
+// decode returns the length less matchMinLen
+func (ld *lenDecoder) decode(rc *rangeDecoder, posState uint32) uint32 {
+	if rc.bit(&ld.choice) == 0 {
+		return rc.tree(ld.low[posState][:], 3)
+	}
+	if rc.bit(&ld.choice2) == 0 {
+		return 8 + rc.tree(ld.mid[posState][:], 3)
+	}
+	return 16 + rc.tree(ld.high[:], 8)
+}
+
+// window is the LZMA dictionary: the most recent output, which matches copy
+// from. Everything put into it is also collected in out.
+type window struct {
+	buf  []byte
+	pos  int
+	full int // Bytes of buf holding output
+	out  []byte
+}
+
+// reset empties the dictionary
+func (w *window) reset() {
+	w.pos, w.full = 0, 0
+}
+
+func (w *window) put(b byte) {
+	w.buf[w.pos] = b
+	w.pos++
+	if w.pos == len(w.buf) {
+		w.pos = 0
+	}
+	if w.full < len(w.buf) {
+		w.full++
+	}
+	w.out = append(w.out, b)
+}
+
+// get returns the byte dist+1 positions back
+func (w *window) get(dist uint32) byte {
+	i := w.pos - int(dist) - 1
+	if i < 0 {
+		i += len(w.buf)
+	}
+	return w.buf[i]
+}
+
+// repeat copies n bytes starting dist+1 positions back
+func (w *window) repeat(dist uint32, n int) error {
+	if int64(dist) >= int64(w.full) {
+		return fmt.Errorf("%w: match distance beyond dictionary", ErrFormat)
+	}
+	for ; n > 0; n-- {
+		w.put(w.get(dist))
+	}
+	return nil
+}
+
+// lzmaDecoder holds the state LZMA2 carries between chunks
+type lzmaDecoder struct {
+	lc, lp, pb uint32
+	state      uint32
+	reps       [4]uint32
+	total      uint64 // Bytes output since the dictionary was reset
+
+	literal    []prob
+	isMatch    [numStates << numPosBitsMax]prob
+	isRep      [numStates]prob
+	isRepG0    [numStates]prob
+	isRepG1    [numStates]prob
+	isRepG2    [numStates]prob
+	isRep0Long [numStates << numPosBitsMax]prob
+	posSlot    [numLenToPosStates][1 << 6]prob
+	posSpecial [1 + numFullDistances - endPosModelIndex]prob
+	align      [1 << numAlignBits]prob
+	lenDec     lenDecoder
+	repLenDec  lenDecoder
+}
+
+// setProps applies an LZMA properties byte
+func (d *lzmaDecoder) setProps(b byte) error {
+	if b >= 9*5*5 {
+		return fmt.Errorf("%w: bad LZMA properties", ErrFormat)
+	}
+	props := uint32(b)
+	d.lc, props = props%9, props/9
+	d.lp, d.pb = props%5, props/5
+	if d.lc+d.lp > 4 {
+		return fmt.Errorf("%w: bad LZMA2 properties", ErrFormat)
+	}
+	if n := 0x300 << (d.lc + d.lp); len(d.literal) != n {
+		d.literal = make([]prob, n)
+	}
+	return nil
+}
+
+// resetState resets the probabilities and match state
+func (d *lzmaDecoder) resetState() {
+	d.state = 0
+	d.reps = [4]uint32{}
+	initProbs(d.literal)
+	initProbs(d.isMatch[:])
+	initProbs(d.isRep[:])
+	initProbs(d.isRepG0[:])
+	initProbs(d.isRepG1[:])
+	initProbs(d.isRepG2[:])
+	initProbs(d.isRep0Long[:])
+	for i := range d.posSlot {
+		initProbs(d.posSlot[i][:])
+	}
+	initProbs(d.posSpecial[:])
+	initProbs(d.align[:])
+	d.lenDec.init()
+	d.repLenDec.init()
+}
+
+// nextState returns the state after a match: afterLiteral when the previous
+// symbol was a literal, afterMatch otherwise
+func nextState(state, afterLiteral, afterMatch uint32) uint32 {
+	if state < 7 {
+		return afterLiteral
+	}
+	return afterMatch
+}
+
+// decodeLiteral decodes one byte into w
+func (d *lzmaDecoder) decodeLiteral(rc *rangeDecoder, w *window) {
+	var prev uint32
+	if w.full > 0 {
+		prev = uint32(w.get(0))
+	}
+	litState := (uint32(d.total)&(1<<d.lp-1))<<d.lc + prev>>(8-d.lc)
+	ps := d.literal[0x300*litState:]
+
+	sym := uint32(1)
+	if d.state >= 7 {
+		match := uint32(w.get(d.reps[0]))
+		for sym < 0x100 {
+			matchBit := (match >> 7) & 1
+			match <<= 1
+			b := rc.bit(&ps[(1+matchBit)<<8+sym])
+			sym = sym<<1 | b
+			if matchBit != b {
+				break
+			}
+		}
+	}
+	for sym < 0x100 {
+		sym = sym<<1 | rc.bit(&ps[sym])
+	}
+	w.put(byte(sym))
+	d.total++
+}
+
+// decodeDistance decodes the distance of a match of length l, less
+// matchMinLen
+func (d *lzmaDecoder) decodeDistance(rc *rangeDecoder, l uint32) uint32 {
+	lenState := min(l, numLenToPosStates-1)
+	slot := rc.tree(d.posSlot[lenState][:], 6)
+	if slot < startPosModelIndex {
+		return slot
+	}
+
+	direct := int(slot>>1) - 1
+	dist := (2 | slot&1) << direct
+	if slot < endPosModelIndex {
+		return dist + rc.reverseTree(d.posSpecial[dist-slot:], direct)
+	}
+	dist += rc.direct(direct-numAlignBits) << numAlignBits
+	return dist + rc.reverseTree(d.align[:], numAlignBits)
+}
+
+// decode decodes a chunk of size bytes of output from in into w
+func (d *lzmaDecoder) decode(in []byte, size int, w *window) error {
+	var rc rangeDecoder
+	if err := rc.init(in); err != nil {
+		return err
+	}
+
+	end := len(w.out) + size
+	for len(w.out) < end {
+		if rc.fault {
+			return fmt.Errorf("%w: truncated LZMA chunk", ErrFormat)
+		}
+
+		posState := uint32(d.total) & (1<<d.pb - 1)
+		if rc.bit(&d.isMatch[d.state<<numPosBitsMax+posState]) == 0 {
+			d.decodeLiteral(&rc, w)
+			switch {
+			case d.state < 4:
+				d.state = 0
+			case d.state < 10:
+				d.state -= 3
+			default:
+				d.state -= 6
+			}
+			continue
+		}
+
+		var l uint32
+		if rc.bit(&d.isRep[d.state]) == 0 {
+			l = d.lenDec.decode(&rc, posState)
+			d.state = nextState(d.state, 7, 10)
+			dist := d.decodeDistance(&rc, l)
+			if dist == endMarker {
+				return fmt.Errorf("%w: end marker in LZMA2 chunk", ErrFormat)
+			}
+			d.reps = [4]uint32{dist, d.reps[0], d.reps[1], d.reps[2]}
+		} else {
+			if w.full == 0 {
+				return fmt.Errorf("%w: repeated match in empty dictionary", ErrFormat)
+			}
+			if rc.bit(&d.isRepG0[d.state]) == 0 {
+				if rc.bit(&d.isRep0Long[d.state<<numPosBitsMax+posState]) == 0 {
+					// A single byte from the last distance
+					d.state = nextState(d.state, 9, 11)
+					w.put(w.get(d.reps[0]))
+					d.total++
+					continue
+				}
+			} else {
+				var dist uint32
+				if rc.bit(&d.isRepG1[d.state]) == 0 {
+					dist = d.reps[1]
+				} else {
+					if rc.bit(&d.isRepG2[d.state]) == 0 {
+						dist = d.reps[2]
+					} else {
+						dist = d.reps[3]
+						d.reps[3] = d.reps[2]
+					}
+					d.reps[2] = d.reps[1]
+				}
+				d.reps[1] = d.reps[0]
+				d.reps[0] = dist
+			}
+			l = d.repLenDec.decode(&rc, posState)
+			d.state = nextState(d.state, 8, 11)
+		}
+
+		n := int(l) + matchMinLen
+		if n > end-len(w.out) {
+			return fmt.Errorf("%w: match crosses LZMA2 chunk", ErrFormat)
+		}
+		if err := w.repeat(d.reps[0], n); err != nil {
+			return err
+		}
+		d.total += uint64(n)
+	}
+
+	if !rc.finished() {
+		return fmt.Errorf("%w: LZMA chunk does not end cleanly", ErrFormat)
+	}
+	return nil
+}
@@ -0,0 +1,527 @@
+// Package xz decompresses the xz format with the LZMA2 filter, which is what
+// xz produces by default and what .tar.xz release archives use. Branch
+// converter and delta filters are not supported.
+package xz
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+)
+
+var (
+	ErrFormat      = errors.New("xz: invalid data")
+	ErrUnsupported = errors.New("xz: unsupported stream")
+	ErrChecksum    = errors.New("xz: checksum error")
+)
+
+const (
+	headerMagic = "\xfd7zXZ\x00"
+	footerMagic = "YZ"
+	// lzma2Filter is the ID of the LZMA2 filter
+	lzma2Filter = 0x21
+	// maxDictSize bounds the dictionary a stream may ask for, which is
+	// allocated up front: 64 MiB is what xz -9 uses, and nothing real needs more
+	maxDictSize = 64 << 20
+)
+
+// Integrity checks a stream may carry
+const (
+	checkNone   = 0x00
+	checkCRC32  = 0x01
+	checkCRC64  = 0x04
+	checkSHA256 = 0x0A
+)
+
+// errEnd ends the input after a complete stream
+var errEnd = errors.New("end of xz input")
+
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+// record is what the index says about a block
+type record struct {
+	unpadded     uint64
+	uncompressed uint64
+}
+
+// Reader decompresses an xz stream. Concatenated streams are read one after
+// the other.
+type Reader struct {
+	r     *countingReader
+	flags [2]byte
+	check byte
+
+	lzma      lzmaDecoder
+	win       window
+	blocks    []record
+	indexSize int64
+	pending   []byte
+	err       error
+
+	// State of the block being read
+	inBlock      bool
+	hash         hash.Hash
+	blockStart   int64
+	headerSize   uint64
+	compressed   int64 // -1 when the header gives none
+	uncompressed int64 // -1 when the header gives none
+	produced     uint64
+	needDict     bool
+	needProps    bool
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+func (cr *countingReader) ReadByte() (byte, error) {
+	b, err := cr.r.ReadByte()
+	if err == nil {
+		cr.n++
+	}
+	return b, err
+}
+
+// NewReader reads the header of the xz stream from r and returns a Reader
+// decompressing it
+func NewReader(r io.Reader) (*Reader, error) {
+	z := &Reader{r: &countingReader{r: bufio.NewReader(r)}}
+	if err := z.readStreamHeader(); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return z, nil
+}
+
+// Read implements io.Reader. Corrupt data is reported as ErrFormat and a
+// failed integrity check as ErrChecksum.
+func (z *Reader) Read(p []byte) (int, error) {
+	for len(z.pending) == 0 {
+		if z.err != nil {
+			return 0, z.err
+		}
+		z.err = z.advance()
+		switch {
+		case z.err == errEnd:
+			z.err = io.EOF
+		case errors.Is(z.err, io.EOF), errors.Is(z.err, io.ErrUnexpectedEOF):
+			// The input ended inside a stream
+			z.err = fmt.Errorf("%w: %w", ErrFormat, io.ErrUnexpectedEOF)
+		}
+	}
+	n := copy(p, z.pending)
+	z.pending = z.pending[n:]
+	return n, nil
+}
+
+// advance decodes the next LZMA2 chunk, or moves on to the next block or
+// stream, leaving any output in pending
+func (z *Reader) advance() error {
+	if z.inBlock {
+		return z.readChunk()
+	}
+
+	size, err := z.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if size == 0 {
+		if err := z.readIndex(); err != nil {
+			return err
+		}
+		if err := z.readFooter(); err != nil {
+			return err
+		}
+		return z.nextStream()
+	}
+	return z.readBlockHeader(size)
+}
+
+// readStreamHeader reads the magic bytes and flags opening a stream
+func (z *Reader) readStreamHeader() error {
+	var hdr [12]byte
+	if _, err := io.ReadFull(z.r, hdr[:]); err != nil {
+		return err
+	}
+	if string(hdr[:6]) != headerMagic {
+		return fmt.Errorf("%w: not an xz stream", ErrFormat)
+	}
+	if crc32.ChecksumIEEE(hdr[6:8]) != binary.LittleEndian.Uint32(hdr[8:]) {
+		return fmt.Errorf("%w: stream header", ErrChecksum)
+	}
+	if hdr[6] != 0 || hdr[7] > 0x0F {
+		return fmt.Errorf("%w: stream flags %x", ErrUnsupported, hdr[6:8])
+	}
+
+	z.flags = [2]byte{hdr[6], hdr[7]}
+	z.check = hdr[7]
+	z.blocks = nil
+	return nil
+}
+
+// nextStream skips stream padding and reads the header of a concatenated
+// stream, returning errEnd at the end of the input
+func (z *Reader) nextStream() error {
+	padding := 0
+	for {
+		b, err := z.r.r.Peek(1)
+		if err == io.EOF {
+			if padding%4 != 0 {
+				return fmt.Errorf("%w: bad stream padding", ErrFormat)
+			}
+			return errEnd
+		}
+		if err != nil {
+			return err
+		}
+		if b[0] != 0 {
+			break
+		}
+		z.r.ReadByte()
+		padding++
+	}
+	if padding%4 != 0 {
+		return fmt.Errorf("%w: bad stream padding", ErrFormat)
+	}
+	return z.readStreamHeader()
+}
+
+// readVLI reads a variable-length integer
+func readVLI(r io.ByteReader) (uint64, error) {
+	var v uint64
+	for i := 0; i < 9; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		v |= uint64(b&0x7F) << (7 * i)
+		if b&0x80 == 0 {
+			if i > 0 && b == 0 {
+				return 0, fmt.Errorf("%w: non-minimal integer", ErrFormat)
+			}
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: integer too large", ErrFormat)
+}
+
+// readBlockHeader reads the header of a block whose first byte is size and
+// prepares to decode its data
+func (z *Reader) readBlockHeader(size byte) error {
+	z.blockStart = z.r.n - 1
+	z.headerSize = (uint64(size) + 1) * 4
+	hdr := make([]byte, z.headerSize)
+	hdr[0] = size
+	if _, err := io.ReadFull(z.r, hdr[1:]); err != nil {
+		return err
+	}
+	body := hdr[:len(hdr)-4]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(hdr[len(hdr)-4:]) {
+		return fmt.Errorf("%w: block header", ErrChecksum)
+	}
+
+	r := bytes.NewReader(body[2:])
+	flags := body[1]
+	if flags&0x3C != 0 {
+		return fmt.Errorf("%w: block flags %x", ErrUnsupported, flags)
+	}
+	z.compressed, z.uncompressed = -1, -1
+	if flags&0x40 != 0 {
+		v, err := readVLI(r)
+		if err != nil || v == 0 {
+			return fmt.Errorf("%w: bad compressed size", ErrFormat)
+		}
+		z.compressed = int64(v)
+	}
+	if flags&0x80 != 0 {
+		v, err := readVLI(r)
+		if err != nil {
+			return fmt.Errorf("%w: bad uncompressed size", ErrFormat)
+		}
+		z.uncompressed = int64(v)
+	}
+
+	// LZMA2 must be the only filter; it cannot follow the others
+	if flags&0x03 != 0 {
+		return fmt.Errorf("%w: filter chains are not supported", ErrUnsupported)
+	}
+	id, err := readVLI(r)
+	if err != nil {
+		return fmt.Errorf("%w: bad filter flags", ErrFormat)
+	}
+	if id != lzma2Filter {
+		return fmt.Errorf("%w: filter %#x", ErrUnsupported, id)
+	}
+	propsSize, err := readVLI(r)
+	if err != nil || propsSize != 1 {
+		return fmt.Errorf("%w: bad LZMA2 properties", ErrFormat)
+	}
+	dictBits, _ := r.ReadByte()
+	if dictBits > 40 {
+		return fmt.Errorf("%w: bad dictionary size", ErrFormat)
+	}
+	for r.Len() > 0 {
+		if b, _ := r.ReadByte(); b != 0 {
+			return fmt.Errorf("%w: block header padding", ErrFormat)
+		}
+	}
+
+	dictSize := uint64(2|dictBits&1) << (dictBits/2 + 11)
+	if dictSize > maxDictSize {
+		return fmt.Errorf("%w: %d byte dictionary", ErrUnsupported, dictSize)
+	}
+	if uint64(cap(z.win.buf)) >= dictSize {
+		z.win.buf = z.win.buf[:dictSize]
+	} else {
+		z.win.buf = make([]byte, dictSize)
+	}
+	z.win.reset()
+
+	switch z.check {
+	case checkCRC32:
+		z.hash = crc32.NewIEEE()
+	case checkCRC64:
+		z.hash = crc64.New(crc64Table)
+	case checkSHA256:
+		z.hash = sha256.New()
+	default:
+		z.hash = nil
+	}
+	z.produced = 0
+	z.needDict, z.needProps = true, true
+	z.inBlock = true
+	return nil
+}
+
+// readChunk decodes the next LZMA2 chunk of the current block
+func (z *Reader) readChunk() error {
+	control, err := z.r.ReadByte()
+	if err != nil {
+		return err
+	}
+
+	z.win.out = z.win.out[:0]
+	switch {
+	case control == 0x00:
+		return z.endBlock()
+
+	case control == 0x01 || control == 0x02:
+		if control == 0x01 {
+			z.win.reset()
+			z.lzma.total = 0
+			z.needDict = false
+		} else if z.needDict {
+			return fmt.Errorf("%w: missing dictionary reset", ErrFormat)
+		}
+		var size [2]byte
+		if _, err := io.ReadFull(z.r, size[:]); err != nil {
+			return err
+		}
+		data := make([]byte, int(binary.BigEndian.Uint16(size[:]))+1)
+		if _, err := io.ReadFull(z.r, data); err != nil {
+			return err
+		}
+		for _, b := range data {
+			z.win.put(b)
+		}
+		z.lzma.total += uint64(len(data))
+
+	case control >= 0x80:
+		var hdr [4]byte
+		if _, err := io.ReadFull(z.r, hdr[:]); err != nil {
+			return err
+		}
+		size := int(control&0x1F)<<16 + int(binary.BigEndian.Uint16(hdr[:2])) + 1
+		packed := int(binary.BigEndian.Uint16(hdr[2:])) + 1
+
+		reset := control >> 5 & 0x03
+		if reset == 3 {
+			z.win.reset()
+			z.lzma.total = 0
+			z.needDict = false
+		} else if z.needDict {
+			return fmt.Errorf("%w: missing dictionary reset", ErrFormat)
+		}
+		if reset >= 2 {
+			props, err := z.r.ReadByte()
+			if err != nil {
+				return err
+			}
+			if err := z.lzma.setProps(props); err != nil {
+				return err
+			}
+			z.needProps = false
+		} else if z.needProps {
+			return fmt.Errorf("%w: missing LZMA properties", ErrFormat)
+		}
+		if reset >= 1 {
+			z.lzma.resetState()
+		}
+
+		in := make([]byte, packed)
+		if _, err := io.ReadFull(z.r, in); err != nil {
+			return err
+		}
+		if err := z.lzma.decode(in, size, &z.win); err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("%w: bad LZMA2 control byte %#x", ErrFormat, control)
+	}
+
+	z.produced += uint64(len(z.win.out))
+	if z.uncompressed >= 0 && z.produced > uint64(z.uncompressed) {
+		return fmt.Errorf("%w: block larger than its header says", ErrFormat)
+	}
+	if z.hash != nil {
+		z.hash.Write(z.win.out)
+	}
+	z.pending = z.win.out
+	return nil
+}
+
+// checkSize returns the size of the integrity check of a block
+func checkSize(check byte) int {
+	if check == 0 {
+		return 0
+	}
+	return 4 << ((check - 1) / 3)
+}
+
+// endBlock reads the padding and check ending the current block
+func (z *Reader) endBlock() error {
+	z.inBlock = false
+	compressed := z.r.n - z.blockStart - int64(z.headerSize)
+	if z.compressed >= 0 && compressed != z.compressed {
+		return fmt.Errorf("%w: compressed size does not match block header", ErrFormat)
+	}
+	if z.uncompressed >= 0 && z.produced != uint64(z.uncompressed) {
+		return fmt.Errorf("%w: uncompressed size does not match block header", ErrFormat)
+	}
+
+	for n := compressed; n%4 != 0; n++ {
+		if b, err := z.r.ReadByte(); err != nil || b != 0 {
+			return fmt.Errorf("%w: block padding", ErrFormat)
+		}
+	}
+
+	sum := make([]byte, checkSize(z.check))
+	if _, err := io.ReadFull(z.r, sum); err != nil {
+		return err
+	}
+	if z.hash != nil {
+		want := z.hash.Sum(nil)
+		if z.check != checkSHA256 {
+			// CRCs are stored little-endian
+			for i, j := 0, len(want)-1; i < j; i, j = i+1, j-1 {
+				want[i], want[j] = want[j], want[i]
+			}
+		}
+		if !bytes.Equal(sum, want) {
+			return ErrChecksum
+		}
+	}
+
+	z.blocks = append(z.blocks, record{
+		unpadded:     uint64(z.headerSize) + uint64(compressed) + uint64(len(sum)),
+		uncompressed: z.produced,
+	})
+	return nil
+}
+
+// readIndex reads the index after the blocks, whose indicator byte has been
+// read, and checks it against the blocks decoded
+func (z *Reader) readIndex() error {
+	start := z.r.n - 1
+	crc := crc32.NewIEEE()
+	crc.Write([]byte{0})
+	r := &teeByteReader{r: z.r, w: crc}
+
+	count, err := readVLI(r)
+	if err != nil {
+		return err
+	}
+	if count != uint64(len(z.blocks)) {
+		return fmt.Errorf("%w: index lists %d blocks, stream has %d", ErrFormat, count, len(z.blocks))
+	}
+	for _, block := range z.blocks {
+		unpadded, err := readVLI(r)
+		if err != nil {
+			return err
+		}
+		uncompressed, err := readVLI(r)
+		if err != nil {
+			return err
+		}
+		if unpadded != block.unpadded || uncompressed != block.uncompressed {
+			return fmt.Errorf("%w: index does not match blocks", ErrFormat)
+		}
+	}
+	for (z.r.n-start)%4 != 0 {
+		if b, err := r.ReadByte(); err != nil || b != 0 {
+			return fmt.Errorf("%w: index padding", ErrFormat)
+		}
+	}
+
+	var sum [4]byte
+	if _, err := io.ReadFull(z.r, sum[:]); err != nil {
+		return err
+	}
+	if crc.Sum32() != binary.LittleEndian.Uint32(sum[:]) {
+		return fmt.Errorf("%w: index", ErrChecksum)
+	}
+	z.indexSize = z.r.n - start
+	return nil
+}
+
+// readFooter reads the footer ending a stream and checks it against the
+// header and index
+func (z *Reader) readFooter() error {
+	var ftr [12]byte
+	if _, err := io.ReadFull(z.r, ftr[:]); err != nil {
+		return err
+	}
+	if string(ftr[10:]) != footerMagic {
+		return fmt.Errorf("%w: bad stream footer", ErrFormat)
+	}
+	if crc32.ChecksumIEEE(ftr[4:10]) != binary.LittleEndian.Uint32(ftr[:4]) {
+		return fmt.Errorf("%w: stream footer", ErrChecksum)
+	}
+	backward := (int64(binary.LittleEndian.Uint32(ftr[4:8])) + 1) * 4
+	if backward != z.indexSize || ftr[8] != z.flags[0] || ftr[9] != z.flags[1] {
+		return fmt.Errorf("%w: stream footer does not match", ErrFormat)
+	}
+	return nil
+}
+
+// teeByteReader writes every byte read from r to w
+type teeByteReader struct {
+	r io.ByteReader
+	w io.Writer
+}
+
+func (t *teeByteReader) ReadByte() (byte, error) {
+	b, err := t.r.ReadByte()
+	if err == nil {
+		t.w.Write([]byte{b})
+	}
+	return b, err
+}
@@ -0,0 +1,211 @@
+package xz
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// Fixtures made with xz 5.6 from fixtureText
+const (
+	fixtureCRC64  = "/Td6WFoAAATm1rRGBMBcoBAhARYAAAAAAAAAAGhVDtngCB8AVF0ANhpKHwigJlZODWy4pe1jnI582072nkt4GFZc9ybr1KNuHEYQDFhq50GSHX9YS8V/X2r+G/OnxLosr/PslfCab/MKEdwc2CJ47ftC27t9qkzU9UAAAEAnVi+EUZleAAF4oBAAAAB4kxoEscRn+wIAAAAABFla"
+	fixtureSHA256 = "/Td6WFoAAArh+wyhBMBcoBAhARYAAAAAAAAAAGhVDtngCB8AVF0ANhpKHwigJlZODWy4pe1jnI582072nkt4GFZc9ybr1KNuHEYQDFhq50GSHX9YS8V/X2r+G/OnxLosr/PslfCab/MKEdwc2CJ47ftC27t9qkzU9UAAAHcZc2yrurKk8ysHh/jn7I1oZcMRBnodRvoVezW//hXPAAGQAaAQAABbUR6ytunfHAIAAAAAClla"
+	fixtureEmpty  = "/Td6WFoAAATm1rRGAAAAABzfRCEftvN9AQAAAAAEWVo="
+	fixtureX86    = "/Td6WFoAAATm1rRGBMFcoBAEACEBFgAAAAAAAFrCCPrgCB8AVF0ANhpKHwigJlZODWy4pe1jnI582072nkt4GFZc9ybr1KNuHEYQDFhq50GSHX9YS8V/X2r+G/OnxLosr/PslfCab/MKEdwc2CJ47ftC27t9qkzU9UAAAEAnVi+EUZleAAF4oBAAAAB4kxoEscRn+wIAAAAABFla"
+)
+
+func fixtureText() string {
+	var sb strings.Builder
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&sb, "line %d: the quick brown fox jumps over the lazy dog\n", i%7)
+	}
+	return sb.String()
+}
+
+func fixture(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatalf("Failed to decode fixture: %v", err)
+	}
+	return data
+}
+
+func decompress(data []byte) ([]byte, error) {
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestReader(t *testing.T) {
+	text := fixtureText()
+	crc := fixture(t, fixtureCRC64)
+	sha := fixture(t, fixtureSHA256)
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"CRC64 check", crc, text},
+		{"SHA-256 check", sha, text},
+		{"Empty", fixture(t, fixtureEmpty), ""},
+		{"Concatenated streams", append(append(append([]byte{}, crc...), 0, 0, 0, 0), sha...), text + text},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decompress(tt.data)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Got %d bytes, want %d", len(got), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestReader_Invalid(t *testing.T) {
+	sha := fixture(t, fixtureSHA256)
+	corrupt := func(i int) []byte {
+		data := append([]byte{}, sha...)
+		data[i] ^= 0x40
+		return data
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{"Not xz", []byte("PK\x03\x04 not an xz stream"), ErrFormat},
+		{"Truncated", sha[:len(sha)-40], ErrFormat},
+		{"Corrupt data", corrupt(40), ErrFormat},
+		{"Corrupt check", corrupt(130), ErrChecksum},
+		{"Bad stream padding", append(append([]byte{}, sha...), 0, 0), ErrFormat},
+		{"Filter chain", fixture(t, fixtureX86), ErrUnsupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decompress(tt.data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// withDictBits returns the single-block fixture data with the dictionary
+// size byte of its block header set to bits and the header CRC fixed up
+func withDictBits(data []byte, bits byte) []byte {
+	data = append([]byte{}, data...)
+	// The block header follows the 12-byte stream header; the dictionary
+	// byte comes after the flags, both sizes, the filter ID and props size
+	const start, dictOffset = 12, 12 + 7
+	size := (int(data[start]) + 1) * 4
+	data[dictOffset] = bits
+	binary.LittleEndian.PutUint32(data[start+size-4:], crc32.ChecksumIEEE(data[start:start+size-4]))
+	return data
+}
+
+func TestReader_DictionarySize(t *testing.T) {
+	crc := fixture(t, fixtureCRC64)
+
+	tests := []struct {
+		name    string
+		bits    byte
+		wantErr error
+	}{
+		{"Fixture size", crc[12+7], nil},
+		{"Largest allowed", 28, nil},         // 64 MiB
+		{"Over the cap", 29, ErrUnsupported}, // 96 MiB
+		{"1 GiB", 36, ErrUnsupported},
+		{"Largest encodable", 40, ErrUnsupported},
+		{"Out of range", 41, ErrFormat},
+		{"Garbage", 0xff, ErrFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decompress(withDictBits(crc, tt.bits))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && string(got) != fixtureText() {
+				t.Errorf("Got %d bytes, want %d", len(got), len(fixtureText()))
+			}
+		})
+	}
+}
+
+func FuzzReader(f *testing.F) {
+	for _, s := range []string{fixtureCRC64, fixtureSHA256, fixtureEmpty, fixtureX86} {
+		data, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	crc, _ := base64.StdEncoding.DecodeString(fixtureCRC64)
+	for _, bits := range []byte{29, 40, 41} {
+		f.Add(withDictBits(crc, bits))
+	}
+
+	// Anything may be rejected, but nothing may panic or loop
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r, err := NewReader(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		io.Copy(io.Discard, io.LimitReader(r, 1<<20))
+	})
+}
+
+func TestReader_XZTool(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping xz tool comparison in short mode")
+	}
+	if _, err := exec.LookPath("xz"); err != nil {
+		t.Skip("xz not installed")
+	}
+
+	// Text compresses with long matches, the pseudo-random tail with literals
+	text := []byte(strings.Repeat(fixtureText(), 200))
+	seed := uint32(1)
+	for i := 0; i < 300000; i++ {
+		seed = seed*1664525 + 1013904223
+		text = append(text, byte(seed>>24))
+	}
+
+	for _, args := range [][]string{{"-0"}, {"-6", "--check=crc32"}, {"-9e", "--check=none"}, {"--block-size=100000", "-T2"}} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			cmd := exec.Command("xz", append(args, "-c")...)
+			cmd.Stdin = bytes.NewReader(text)
+			cmd.Stderr = os.Stderr
+			data, err := cmd.Output()
+			if err != nil {
+				t.Fatalf("xz failed: %v", err)
+			}
+
+			got, err := decompress(data)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !bytes.Equal(got, text) {
+				t.Errorf("Decompressed output differs from the input")
+			}
+		})
+	}
+}